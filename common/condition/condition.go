@@ -0,0 +1,419 @@
+// Parses the composite condition of strategy(model.Strategy.Condition), e.g.
+//
+//	and load.1min:avg(#3) > cpu.core:max(#1) * 2
+//	or mem.memfree.percent:all(#3) < 5 and swap.free.percent:max(#1) < 10
+//
+// The leading "and"(default) or "or" is how the condition is combined with the one of strategy itself,
+// the rest is an expression:
+//
+//  1. "metric:func" references another series of the same endpoint, "metric/k1=v1,k2=v2:func" for the series with tags;
+//     "func" alone references the series of strategy itself
+//  2. "func > number" uses the judgement of function itself(e.g. "all(#3) < 5" means all of 3 points are less than 5),
+//     otherwise the left value of function is used in the arithmetic
+//  3. Supports + - * /, comparisons(== != < <= > >=), and(&&), or(||) and parentheses
+//
+// The syntax tree is evaluated by judge, this package is shared by APIs to validate the condition as well.
+package condition
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fwtpe/owl-backend/common/utils"
+)
+
+const (
+	OpAnd = "and"
+	OpOr  = "or"
+)
+
+type Condition struct {
+	// How the condition is combined with the one of strategy: "and" or "or"
+	Combiner string
+	Root     BoolNode
+	// The referenced series in order of appearance
+	Refs []*SeriesRef
+}
+
+// The referenced series, the empty metric is the series of strategy itself
+type SeriesRef struct {
+	Metric string
+	Tags   map[string]string
+}
+
+// Node of arithmetic
+type NumNode interface {
+	numNode()
+}
+
+// Node of judgement
+type BoolNode interface {
+	boolNode()
+}
+
+type Number float64
+
+// The left value of function on a series
+type Series struct {
+	Ref  *SeriesRef
+	Func string
+}
+
+type Binary struct {
+	Op          string
+	Left, Right NumNode
+}
+
+type Negative struct {
+	Node NumNode
+}
+
+type Compare struct {
+	Op          string
+	Left, Right NumNode
+}
+
+// "func > number", which uses the judgement of function itself
+type SeriesTest struct {
+	Ref        *SeriesRef
+	Func       string
+	Operator   string
+	RightValue float64
+}
+
+type Logic struct {
+	Op          string
+	Left, Right BoolNode
+}
+
+func (Number) numNode()    {}
+func (*Series) numNode()   {}
+func (*Binary) numNode()   {}
+func (*Negative) numNode() {}
+
+func (*Compare) boolNode()    {}
+func (*SeriesTest) boolNode() {}
+func (*Logic) boolNode()      {}
+
+// Only the form of function is checked here, e.g. "avg(#3)" or "lookup(#5,3)", the arguments are checked by judge
+var funcPattern = regexp.MustCompile(`^[a-z]+\(#\d+(\s*,\s*-?[0-9.]+)*\s*\)$`)
+
+func Parse(str string) (*Condition, error) {
+	tokens, err := tokenize(str)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, cond: &Condition{Combiner: OpAnd}}
+	if tok := p.peek(); tok.kind == tokenAnd || tok.kind == tokenOr {
+		p.cond.Combiner = tok.text
+		p.pos++
+	}
+
+	if p.cond.Root, err = p.parseOr(); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %q in condition", tok.text)
+	}
+
+	return p.cond, nil
+}
+
+const (
+	tokenEnd = iota
+	tokenNumber
+	tokenSeries
+	tokenOperator
+	tokenCompare
+	tokenLeftParen
+	tokenRightParen
+	tokenAnd
+	tokenOr
+)
+
+type token struct {
+	kind int
+	text string
+
+	number float64
+	// tokenSeries
+	ref     *SeriesRef
+	funcStr string
+}
+
+func tokenize(str string) ([]*token, error) {
+	tokens := []*token{}
+
+	for i := 0; i < len(str); {
+		c := str[i]
+		rest := str[i:]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, &token{kind: tokenLeftParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, &token{kind: tokenRightParen, text: ")"})
+			i++
+		case strings.HasPrefix(rest, "&&"):
+			tokens = append(tokens, &token{kind: tokenAnd, text: OpAnd})
+			i += 2
+		case strings.HasPrefix(rest, "||"):
+			tokens = append(tokens, &token{kind: tokenOr, text: OpOr})
+			i += 2
+		case strings.IndexByte("<>!=", c) >= 0:
+			op := rest[:1]
+			if len(rest) > 1 && rest[1] == '=' {
+				op = rest[:2]
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected \"!\" in condition")
+			}
+			tokens = append(tokens, &token{kind: tokenCompare, text: op})
+			i += len(op)
+		case strings.IndexByte("+-*/", c) >= 0:
+			tokens = append(tokens, &token{kind: tokenOperator, text: rest[:1]})
+			i++
+		case (c >= '0' && c <= '9') || c == '.':
+			j := i
+			for j < len(str) && ((str[j] >= '0' && str[j] <= '9') || str[j] == '.') {
+				j++
+			}
+			number, err := strconv.ParseFloat(str[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q in condition", str[i:j])
+			}
+			tokens = append(tokens, &token{kind: tokenNumber, text: str[i:j], number: number})
+			i = j
+		default:
+			tok, size, err := scanSeries(rest)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i += size
+		}
+	}
+
+	return append(tokens, &token{kind: tokenEnd, text: "<end>"}), nil
+}
+
+// Scans "and", "or", "func(...)" or "metric/tags:func(...)"
+func scanSeries(str string) (*token, int, error) {
+	end := strings.IndexAny(str, " \t\r\n()<>!&|+*:")
+	if end < 0 {
+		end = len(str)
+	}
+
+	word := str[:end]
+	switch strings.ToLower(word) {
+	case OpAnd:
+		return &token{kind: tokenAnd, text: OpAnd}, end, nil
+	case OpOr:
+		return &token{kind: tokenOr, text: OpOr}, end, nil
+	}
+
+	ref := &SeriesRef{}
+	funcStart := 0
+	if end < len(str) && str[end] == ':' {
+		if word == "" {
+			return nil, 0, fmt.Errorf("metric is empty in condition: %q", str)
+		}
+
+		metricAndTags := strings.SplitN(word, "/", 2)
+		ref.Metric = metricAndTags[0]
+		if len(metricAndTags) == 2 {
+			ref.Tags = utils.DictedTagstring(metricAndTags[1])
+		}
+		funcStart = end + 1
+	}
+
+	funcEnd := strings.IndexByte(str[funcStart:], ')')
+	if funcEnd < 0 {
+		return nil, 0, fmt.Errorf("invalid function in condition: %q", str)
+	}
+	funcEnd += funcStart + 1
+
+	funcStr := str[funcStart:funcEnd]
+	if !funcPattern.MatchString(funcStr) {
+		return nil, 0, fmt.Errorf("invalid function in condition: %q", funcStr)
+	}
+
+	return &token{kind: tokenSeries, text: str[:funcEnd], ref: ref, funcStr: funcStr}, funcEnd, nil
+}
+
+type parser struct {
+	tokens []*token
+	pos    int
+	cond   *Condition
+}
+
+func (p *parser) peek() *token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() *token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEnd {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (BoolNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logic{Op: OpOr, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (BoolNode, error) {
+	left, err := p.parseBoolPrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseBoolPrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logic{Op: OpAnd, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// The parenthesis could be arithmetic or logical, tries the comparison first
+func (p *parser) parseBoolPrimary() (BoolNode, error) {
+	start := p.pos
+	refs := len(p.cond.Refs)
+	node, err := p.parseCompare()
+	if err == nil || p.tokens[start].kind != tokenLeftParen {
+		return node, err
+	}
+
+	p.pos = start + 1
+	p.cond.Refs = p.cond.Refs[:refs]
+	node, err = p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok.kind != tokenRightParen {
+		return nil, fmt.Errorf("expected \")\" in condition. got: %q", tok.text)
+	}
+	return node, nil
+}
+
+func (p *parser) parseCompare() (BoolNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+	if op.kind != tokenCompare {
+		return nil, fmt.Errorf("expected comparison in condition. got: %q", op.text)
+	}
+
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	series, isSeries := left.(*Series)
+	rightValue, isNumber := right.(Number)
+	if isSeries && isNumber {
+		return &SeriesTest{Ref: series.Ref, Func: series.Func, Operator: op.text, RightValue: float64(rightValue)}, nil
+	}
+
+	return &Compare{Op: op.text, Left: left, Right: right}, nil
+}
+
+func (p *parser) parseSum() (NumNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for tok := p.peek(); tok.kind == tokenOperator && (tok.text == "+" || tok.text == "-"); tok = p.peek() {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: tok.text, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (NumNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for tok := p.peek(); tok.kind == tokenOperator && (tok.text == "*" || tok.text == "/"); tok = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: tok.text, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (NumNode, error) {
+	if tok := p.peek(); tok.kind == tokenOperator && tok.text == "-" {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := node.(Number); ok {
+			return -value, nil
+		}
+		return &Negative{Node: node}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (NumNode, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenNumber:
+		return Number(tok.number), nil
+	case tokenSeries:
+		p.cond.Refs = append(p.cond.Refs, tok.ref)
+		return &Series{Ref: tok.ref, Func: tok.funcStr}, nil
+	case tokenLeftParen:
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokenRightParen {
+			return nil, fmt.Errorf("expected \")\" in condition. got: %q", tok.text)
+		}
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q in condition", tok.text)
+}
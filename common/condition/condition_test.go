@@ -0,0 +1,58 @@
+package condition
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	DescribeTable("Valid conditions",
+		func(str string, expectedCombiner string, expectedMetrics []string) {
+			cond, err := Parse(str)
+			Expect(err).To(Succeed())
+			Expect(cond.Combiner).To(Equal(expectedCombiner))
+
+			metrics := []string{}
+			for _, ref := range cond.Refs {
+				metrics = append(metrics, ref.Metric)
+			}
+			Expect(metrics).To(Equal(expectedMetrics))
+		},
+		Entry("Series of strategy", "avg(#3) > 5", OpAnd, []string{""}),
+		Entry("Arithmetic", "or load.1min:avg(#3) > cpu.core:max(#1) * 2", OpOr, []string{"load.1min", "cpu.core"}),
+		Entry("Logical parentheses", "AND (mem.free/host=a,b=c:all(#3) < 5 || swap.free:max(#1) <= -10) && load.1min:avg(#3) != 0",
+			OpAnd, []string{"mem.free", "swap.free", "load.1min"}),
+		Entry("Arithmetic parentheses", "(net.in:lookup(#5, 3) + net.out:max(#1)) / 2 >= 100 and net.in:max(#1) > 1",
+			OpAnd, []string{"net.in", "net.out", "net.in"}),
+	)
+
+	It("Judgement of function itself", func() {
+		cond, err := Parse("or mem.free/mount=/:all(#3) < -5")
+		Expect(err).To(Succeed())
+		Expect(cond.Root).To(Equal(&SeriesTest{
+			Ref:  &SeriesRef{Metric: "mem.free", Tags: map[string]string{"mount": "/"}},
+			Func: "all(#3)", Operator: "<", RightValue: -5,
+		}))
+	})
+
+	DescribeTable("Invalid conditions",
+		func(str string) {
+			_, err := Parse(str)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("Empty", ""),
+		Entry("Combiner only", "and"),
+		Entry("No comparison", "avg(#3)"),
+		Entry("No right side", "avg(#3) >"),
+		Entry("Dangling and", "avg(#3) > 5 and"),
+		Entry("Unclosed parenthesis", "(avg(#3) > 5"),
+		Entry("Extra parenthesis", "avg(#3) > 5)"),
+		Entry("Bare word", "cores > 5"),
+		Entry("Empty metric", ":avg(#3) > 5"),
+		Entry("Invalid operator", "avg(#3) ! 5"),
+		Entry("Invalid number", "avg(#3) > 1.2.3"),
+		Entry("No number of points", "load.1min:avg(3) > 5"),
+		Entry("Invalid argument", "load.1min:lookup(#5,x) > 5"),
+	)
+})
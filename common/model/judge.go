@@ -38,3 +38,24 @@ type HistoryData struct {
 	Timestamp int64   `json:"timestamp"`
 	Value     float64 `json:"value"`
 }
+
+// The counts of current alerts(PROBLEM events) of judge, the keys are id of template and priority
+type AlertCounts struct {
+	Total      int            `json:"total"`
+	ByTemplate map[string]int `json:"byTemplate"`
+	ByPriority map[string]int `json:"byPriority"`
+}
+
+func NewAlertCounts() *AlertCounts {
+	return &AlertCounts{ByTemplate: make(map[string]int), ByPriority: make(map[string]int)}
+}
+
+func (this *AlertCounts) Merge(other *AlertCounts) {
+	this.Total += other.Total
+	for k, v := range other.ByTemplate {
+		this.ByTemplate[k] += v
+	}
+	for k, v := range other.ByPriority {
+		this.ByPriority[k] += v
+	}
+}
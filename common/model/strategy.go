@@ -14,6 +14,7 @@ type Strategy struct {
 	Func       string            `json:"func"`       // e.g. max(#3) all(#3)
 	Operator   string            `json:"operator"`   // e.g. < !=
 	RightValue float64           `json:"rightValue"` // critical value
+	Condition  string            `json:"condition"`  // e.g. and load.1min:avg(#3) > 8
 	MaxStep    int               `json:"maxStep"`
 	Priority   int               `json:"priority"`
 	Note       string            `json:"note"`
@@ -61,6 +62,7 @@ type NewStrategy struct {
 	Func       string       `json:"func"`               // e.g. max(#3) all(#3)
 	Operator   string       `json:"operator"`           // e.g. < !=
 	RightValue float64      `json:"right_value,string"` // critical value
+	Condition  string       `json:"condition"`
 	MaxStep    int          `json:"max_step"`
 	Priority   int          `json:"priority"`
 	Note       string       `json:"note"`
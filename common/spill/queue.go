@@ -0,0 +1,431 @@
+// Provides on-disk FIFO queue, which is used to keep the batches of data
+// while the backend(e.g. graph or judge of transfer, or transfer of agent) is unreachable.
+//
+// The data is kept in segment files("<seq>.spill") under a directory, each record is:
+//
+//	<4 bytes: length of payload><4 bytes: CRC32 of payload><payload>
+//
+// The position of the oldest record is persisted in file "head", so the queue survives restarting.
+package spill
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	recordHeaderSize = 8
+	segmentSuffix    = ".spill"
+	headFileName     = "head"
+)
+
+// Returned by "Push()" if the size of queue would exceed the limit
+var ErrFull = errors.New("spill queue is full")
+
+type Queue struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	lock *sync.Mutex
+
+	// Sequence numbers of segments, sorted ascending
+	segments []int64
+	// Read offset in the first segment
+	headOffset int64
+
+	// Number of pending records
+	count int64
+	// Bytes of pending records(including headers)
+	size int64
+
+	writer     *os.File
+	writerSize int64
+}
+
+// Opens(or creates) the queue under the directory.
+//
+// The "maxBytes" is the limit on size of pending records, the "segmentBytes" is
+// the size for rolling segment file.
+func Open(dir string, maxBytes int64, segmentBytes int64) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: segmentBytes,
+		lock:         &sync.Mutex{},
+		segments:     make([]int64, 0),
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Appends a record to the tail of queue
+func (q *Queue) Push(data []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	recordSize := int64(recordHeaderSize + len(data))
+	if q.maxBytes > 0 && q.size+recordSize > q.maxBytes {
+		return ErrFull
+	}
+
+	if q.writer == nil || q.writerSize >= q.segmentBytes {
+		if err := q.rollSegment(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[recordHeaderSize:], data)
+
+	if _, err := q.writer.Write(record); err != nil {
+		return err
+	}
+
+	q.writerSize += recordSize
+	q.size += recordSize
+	q.count++
+
+	return nil
+}
+
+// Reads the oldest record without removing it.
+//
+// Returns nil(without error) if the queue is empty.
+func (q *Queue) Peek() ([]byte, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.count == 0 {
+		return nil, nil
+	}
+
+	data, _, err := q.readHead()
+	return data, err
+}
+
+// Removes the oldest record
+func (q *Queue) Pop() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.count == 0 {
+		return nil
+	}
+
+	_, recordSize, err := q.readHead()
+	if err != nil && recordSize == 0 {
+		return err
+	}
+
+	q.headOffset += recordSize
+	q.size -= recordSize
+	q.count--
+
+	/**
+	 * Removes all of the files if the queue is empty,
+	 * so the disk space is released as soon as possible
+	 */
+	if q.count == 0 {
+		return q.reset()
+	}
+	// :~)
+
+	return q.saveHead()
+}
+
+// The number of pending records
+func (q *Queue) Len() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.count
+}
+
+// The bytes of pending records
+func (q *Queue) Size() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.size
+}
+
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.writer != nil {
+		err := q.writer.Close()
+		q.writer = nil
+		return err
+	}
+
+	return nil
+}
+
+// Reads the record at head, moves to next segment if current one is consumed.
+//
+// The size of record is returned even if the payload is corrupted,
+// so the caller could skip it.
+func (q *Queue) readHead() ([]byte, int64, error) {
+	for {
+		headSegment := q.segments[0]
+		fileInfo, err := os.Stat(q.segmentPath(headSegment))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if q.headOffset < fileInfo.Size() || len(q.segments) == 1 {
+			break
+		}
+
+		// The head segment has been consumed
+		os.Remove(q.segmentPath(headSegment))
+		q.segments = q.segments[1:]
+		q.headOffset = 0
+	}
+
+	file, err := os.Open(q.segmentPath(q.segments[0]))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	return readRecord(file, q.headOffset)
+}
+
+func (q *Queue) rollSegment() error {
+	if q.writer != nil {
+		q.writer.Sync()
+		q.writer.Close()
+		q.writer = nil
+	}
+
+	seq := int64(1)
+	if len(q.segments) > 0 {
+		seq = q.segments[len(q.segments)-1] + 1
+	}
+
+	file, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	q.segments = append(q.segments, seq)
+	q.writer = file
+	q.writerSize = 0
+
+	if len(q.segments) == 1 {
+		q.headOffset = 0
+		return q.saveHead()
+	}
+
+	return nil
+}
+
+func (q *Queue) reset() error {
+	if q.writer != nil {
+		q.writer.Close()
+		q.writer = nil
+	}
+
+	for _, seq := range q.segments {
+		os.Remove(q.segmentPath(seq))
+	}
+
+	q.segments = make([]int64, 0)
+	q.headOffset = 0
+	q.size = 0
+	q.count = 0
+
+	return q.saveHead()
+}
+
+// Loads segments and the position of head, then counts the pending records.
+//
+// Incomplete record at the end of last segment(e.g. crash while writing) is truncated.
+func (q *Queue) load() error {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fileInfo := range files {
+		name := fileInfo.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, seq)
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	headSeq, headOffset := q.loadHead()
+	for len(q.segments) > 0 && q.segments[0] < headSeq {
+		os.Remove(q.segmentPath(q.segments[0]))
+		q.segments = q.segments[1:]
+	}
+	if len(q.segments) > 0 && q.segments[0] == headSeq {
+		q.headOffset = headOffset
+	}
+
+	for i, seq := range q.segments {
+		offset := int64(0)
+		if i == 0 {
+			offset = q.headOffset
+		}
+
+		validEnd, err := q.countRecords(seq, offset)
+		if err != nil {
+			return err
+		}
+
+		/**
+		 * The bytes after last complete record are dropped, which are
+		 * the incomplete record of last segment or the corrupted data of any segment
+		 */
+		if err = os.Truncate(q.segmentPath(seq), validEnd); err != nil {
+			return err
+		}
+		// :~)
+	}
+
+	if q.count == 0 {
+		return q.reset()
+	}
+
+	/**
+	 * Continues writing on the last segment
+	 */
+	lastPath := q.segmentPath(q.segments[len(q.segments)-1])
+	q.writer, err = os.OpenFile(lastPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := q.writer.Stat()
+	if err != nil {
+		return err
+	}
+	q.writerSize = fileInfo.Size()
+	// :~)
+
+	return nil
+}
+
+// Counts records of the segment from offset, returns the end of last complete record
+func (q *Queue) countRecords(seq int64, offset int64) (int64, error) {
+	file, err := os.Open(q.segmentPath(seq))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	for {
+		_, recordSize, err := readRecord(file, offset)
+		if recordSize == 0 {
+			if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			return offset, err
+		}
+
+		offset += recordSize
+		q.size += recordSize
+		q.count++
+	}
+}
+
+func (q *Queue) loadHead() (int64, int64) {
+	content, err := ioutil.ReadFile(filepath.Join(q.dir, headFileName))
+	if err != nil {
+		return 0, 0
+	}
+
+	var seq, offset int64
+	if _, err := fmt.Sscanf(string(content), "%d %d", &seq, &offset); err != nil {
+		return 0, 0
+	}
+
+	return seq, offset
+}
+
+func (q *Queue) saveHead() error {
+	seq := int64(0)
+	if len(q.segments) > 0 {
+		seq = q.segments[0]
+	}
+
+	headPath := filepath.Join(q.dir, headFileName)
+	tmpPath := headPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, []byte(fmt.Sprintf("%d %d\n", seq, q.headOffset)), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, headPath)
+}
+
+func (q *Queue) segmentPath(seq int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+// Reads the record at offset, returns the payload and the size of whole record.
+//
+// If the record is incomplete(including the length exceeding the file), the size is 0.
+// If the checksum is mismatched, the size of record is returned with error.
+func readRecord(file *os.File, offset int64) ([]byte, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return nil, 0, err
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	checksum := binary.BigEndian.Uint32(header[4:8])
+
+	/**
+	 * The length from corrupted header could be huge,
+	 * it is checked before allocating the buffer of payload
+	 */
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset+recordHeaderSize+length > fileInfo.Size() {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	// :~)
+
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, offset+recordHeaderSize); err != nil {
+		return nil, 0, err
+	}
+
+	recordSize := recordHeaderSize + length
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, recordSize, fmt.Errorf("checksum mismatched at offset %d of %s", offset, file.Name())
+	}
+
+	return data, recordSize, nil
+}
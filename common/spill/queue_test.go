@@ -0,0 +1,144 @@
+package spill
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Queue", func() {
+	var (
+		testedDir   string
+		testedQueue *Queue
+	)
+
+	openQueue := func(maxBytes int64, segmentBytes int64) {
+		var err error
+		testedQueue, err = Open(testedDir, maxBytes, segmentBytes)
+		Expect(err).To(Succeed())
+	}
+	pushAll := func(values ...string) {
+		for _, value := range values {
+			Expect(testedQueue.Push([]byte(value))).To(Succeed())
+		}
+	}
+	popAll := func() []string {
+		values := make([]string, 0)
+		for {
+			data, err := testedQueue.Peek()
+			Expect(err).To(Succeed())
+			if data == nil {
+				return values
+			}
+
+			values = append(values, string(data))
+			Expect(testedQueue.Pop()).To(Succeed())
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		testedDir, err = ioutil.TempDir("", "spill-queue")
+		Expect(err).To(Succeed())
+	})
+	AfterEach(func() {
+		if testedQueue != nil {
+			testedQueue.Close()
+			testedQueue = nil
+		}
+		os.RemoveAll(testedDir)
+	})
+
+	Context("Push and pop across segments", func() {
+		It("Records should be popped by order", func() {
+			openQueue(0, 32)
+
+			for i := 0; i < 10; i++ {
+				pushAll(fmt.Sprintf("record-%02d", i))
+			}
+			Expect(testedQueue.Len()).To(BeEquivalentTo(10))
+			Expect(testedQueue.Size()).To(BeEquivalentTo(10 * (recordHeaderSize + 9)))
+
+			values := popAll()
+			Expect(values).To(HaveLen(10))
+			Expect(values[0]).To(Equal("record-00"))
+			Expect(values[9]).To(Equal("record-09"))
+
+			Expect(testedQueue.Len()).To(BeEquivalentTo(0))
+			Expect(testedQueue.Size()).To(BeEquivalentTo(0))
+
+			segments, _ := filepath.Glob(filepath.Join(testedDir, "*"+segmentSuffix))
+			Expect(segments).To(BeEmpty())
+		})
+	})
+
+	Context("Limit of size", func() {
+		It("Pushing should be rejected if the queue is full", func() {
+			openQueue(3*(recordHeaderSize+4), 1024)
+
+			pushAll("aaaa", "bbbb", "cccc")
+			Expect(testedQueue.Push([]byte("dddd"))).To(Equal(ErrFull))
+
+			Expect(testedQueue.Pop()).To(Succeed())
+			Expect(testedQueue.Push([]byte("dddd"))).To(Succeed())
+		})
+	})
+
+	Context("Reopen the queue", func() {
+		It("Pending records should survive", func() {
+			openQueue(0, 32)
+			pushAll("r1-aaaaaaaaaa", "r2-bbbbbbbbbb", "r3-cccccccccc", "r4-dddddddddd")
+
+			Expect(testedQueue.Pop()).To(Succeed())
+			testedQueue.Close()
+
+			openQueue(0, 32)
+			Expect(testedQueue.Len()).To(BeEquivalentTo(3))
+
+			pushAll("r5-eeeeeeeeee")
+			Expect(popAll()).To(Equal([]string{"r2-bbbbbbbbbb", "r3-cccccccccc", "r4-dddddddddd", "r5-eeeeeeeeee"}))
+		})
+
+		It("Incomplete record at the tail should be truncated", func() {
+			openQueue(0, 1024)
+			pushAll("r1", "r2")
+			testedQueue.Close()
+
+			segments, _ := filepath.Glob(filepath.Join(testedDir, "*"+segmentSuffix))
+			Expect(segments).To(HaveLen(1))
+
+			file, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+			Expect(err).To(Succeed())
+			file.Write([]byte{0, 0, 0, 9, 1, 2})
+			file.Close()
+
+			openQueue(0, 1024)
+			Expect(testedQueue.Len()).To(BeEquivalentTo(2))
+
+			pushAll("r3")
+			Expect(popAll()).To(Equal([]string{"r1", "r2", "r3"}))
+		})
+
+		It("Corrupted length in a middle segment should be dropped without allocating it", func() {
+			openQueue(0, 32)
+			pushAll("r1-aaaaaaaaaa", "r2-bbbbbbbbbb", "r3-cccccccccc", "r4-dddddddddd")
+			testedQueue.Close()
+
+			segments, _ := filepath.Glob(filepath.Join(testedDir, "*"+segmentSuffix))
+			Expect(segments).To(HaveLen(2))
+
+			file, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+			Expect(err).To(Succeed())
+			file.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4, 5, 6})
+			file.Close()
+
+			openQueue(0, 32)
+			Expect(testedQueue.Len()).To(BeEquivalentTo(4))
+			Expect(popAll()).To(Equal([]string{"r1-aaaaaaaaaa", "r2-bbbbbbbbbb", "r3-cccccccccc", "r4-dddddddddd"}))
+		})
+	})
+})
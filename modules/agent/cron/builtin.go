@@ -30,6 +30,7 @@ func syncBuiltinMetrics() {
 		var paths = []string{}
 		var procs = make(map[string]map[int]string)
 		var urls = make(map[string]string)
+		var logPatterns = []*g.LogPattern{}
 
 		hostname, err := g.Hostname()
 		if err != nil {
@@ -81,6 +82,16 @@ func syncBuiltinMetrics() {
 				}
 			}
 
+			if metric.Metric == g.LOG_MATCH {
+				if pattern, err := g.ParseLogPatternOfTags(metric.Tags); err == nil {
+					logPatterns = append(logPatterns, pattern)
+				} else {
+					log.Errorln("log.match with wrong tags:", err)
+				}
+
+				continue
+			}
+
 			if metric.Metric == g.NET_PORT_LISTEN {
 				arr := strings.Split(metric.Tags, "=")
 				if len(arr) != 2 {
@@ -132,6 +143,7 @@ func syncBuiltinMetrics() {
 		}
 
 		g.SetReportUrls(urls)
+		g.SetReportLogPatterns(logPatterns)
 		g.SetReportPorts(ports)
 		g.SetReportProcs(procs)
 		g.SetDuPaths(paths)
@@ -2,10 +2,21 @@ package funcs
 
 import (
 	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/agent/g"
 )
 
 func AgentMetrics() []*model.MetricValue {
-	return []*model.MetricValue{GaugeValue("agent.alive", 1)}
+	metrics := []*model.MetricValue{GaugeValue("agent.alive", 1)}
+
+	if status := g.GetTransferBufferStatus(); status.Enabled {
+		metrics = append(metrics,
+			GaugeValue("agent.transfer.buffer.batches", status.Batches),
+			GaugeValue("agent.transfer.buffer.bytes", status.Bytes),
+			CounterValue("agent.transfer.buffer.dropped", status.Dropped),
+		)
+	}
+
+	return metrics
 }
 
 func AgentMetricsThirty() []*model.MetricValue {
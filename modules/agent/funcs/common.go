@@ -2,9 +2,12 @@ package funcs
 
 import (
 	"github.com/fwtpe/owl-backend/common/model"
+	"sort"
 	"strings"
 )
 
+var tagCharReplacer = strings.NewReplacer(",", "_", "=", "_", " ", "_")
+
 func NewMetricValue(metric string, val interface{}, dataType string, tags ...string) *model.MetricValue {
 	mv := model.MetricValue{
 		Metric: metric,
@@ -28,3 +31,17 @@ func GaugeValue(metric string, val interface{}, tags ...string) *model.MetricVal
 func CounterValue(metric string, val interface{}, tags ...string) *model.MetricValue {
 	return NewMetricValue(metric, val, "COUNTER", tags...)
 }
+
+// Builds the tag string("k1=v1,k2=v2") sorted by key, the characters of "," and "=" are replaced by "_"
+func buildTagString(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for name, value := range tags {
+		if name == "" || value == "" {
+			continue
+		}
+		pairs = append(pairs, tagCharReplacer.Replace(name)+"="+tagCharReplacer.Replace(value))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
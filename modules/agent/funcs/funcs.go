@@ -66,5 +66,13 @@ func BuildMappers() {
 			},
 			Interval: interval,
 		},
+		{
+			Fs: []func() []*model.MetricValue{
+				LogMetrics,
+			},
+			Interval: interval,
+		},
 	}
+
+	Mappers = append(Mappers, PrometheusMappers(interval)...)
 }
@@ -0,0 +1,345 @@
+package funcs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/agent/g"
+)
+
+const (
+	logAggregateCount = "count"
+	logAggregateSum   = "sum"
+	logAggregateMax   = "max"
+
+	// Only the beginning of too long line is matched
+	maxLogLineBytes = 64 * 1024
+)
+
+// The followers of log patterns, the key is built by "logFollowerKey()"
+var (
+	logFollowers     = make(map[string]*logFollower)
+	logFollowersLock = new(sync.Mutex)
+)
+
+// Reads the new lines of log files since last collecting, the matched lines are
+// aggregated as "log.match" per pattern.
+//
+// The patterns are from local configuration and heartbeat(builtin metric of "log.match").
+func LogMetrics() (L []*model.MetricValue) {
+	patterns := append([]*g.LogPattern{}, g.ReportLogPatterns()...)
+	if logConfig := g.Config().LogCollector; logConfig != nil && logConfig.Enabled {
+		patterns = append(patterns, logConfig.Patterns...)
+	}
+
+	logFollowersLock.Lock()
+	defer logFollowersLock.Unlock()
+
+	syncLogFollowers(patterns)
+
+	keys := make([]string, 0, len(logFollowers))
+	for key := range logFollowers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if metric := logFollowers[key].collect(); metric != nil {
+			L = append(L, metric)
+		}
+	}
+	return
+}
+
+// Builds followers for new patterns and closes the followers of removed patterns
+func syncLogFollowers(patterns []*g.LogPattern) {
+	activeKeys := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		key := logFollowerKey(pattern)
+		activeKeys[key] = true
+
+		if _, ok := logFollowers[key]; ok {
+			continue
+		}
+
+		follower, err := newLogFollower(pattern)
+		if err != nil {
+			log.Errorf("invalid pattern of log [%v]: %v", pattern.Name, err)
+			continue
+		}
+		logFollowers[key] = follower
+	}
+
+	for key, follower := range logFollowers {
+		if !activeKeys[key] {
+			follower.close()
+			delete(logFollowers, key)
+		}
+	}
+}
+
+func logFollowerKey(pattern *g.LogPattern) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%s", logMetricTags(pattern), pattern.File, pattern.Regex, pattern.Group, pattern.Aggregate)
+}
+
+// The tags of metric are the tags of pattern with "name"
+func logMetricTags(pattern *g.LogPattern) string {
+	tags := make(map[string]string, len(pattern.Tags)+1)
+	for name, value := range pattern.Tags {
+		tags[name] = value
+	}
+	if _, ok := tags["name"]; !ok {
+		tags["name"] = pattern.Name
+	}
+
+	return buildTagString(tags)
+}
+
+// Follows the files matched by glob of a pattern
+type logFollower struct {
+	pattern   *g.LogPattern
+	regex     *regexp.Regexp
+	aggregate string
+	tags      string
+
+	// The key is path of file
+	files map[string]*followedFile
+	// The existing files are read from the end on first collecting,
+	// the files created afterward(e.g. rotated) are read from the beginning.
+	collected bool
+}
+
+type followedFile struct {
+	file   *os.File
+	offset int64
+}
+
+func newLogFollower(pattern *g.LogPattern) (*logFollower, error) {
+	if pattern.File == "" {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if _, err := filepath.Match(pattern.File, ""); err != nil {
+		return nil, err
+	}
+
+	regex, err := regexp.Compile(pattern.Regex)
+	if err != nil {
+		return nil, err
+	}
+	if pattern.Group < 0 || pattern.Group > regex.NumSubexp() {
+		return nil, fmt.Errorf("group %d is not in the regex", pattern.Group)
+	}
+
+	aggregate := pattern.Aggregate
+	switch aggregate {
+	case "":
+		aggregate = logAggregateCount
+	case logAggregateCount, logAggregateSum, logAggregateMax:
+	default:
+		return nil, fmt.Errorf("unknown aggregate: %q", aggregate)
+	}
+
+	return &logFollower{
+		pattern:   pattern,
+		regex:     regex,
+		aggregate: aggregate,
+		tags:      logMetricTags(pattern),
+		files:     make(map[string]*followedFile),
+	}, nil
+}
+
+// Reads the new lines of files and aggregates the matched ones.
+//
+// The metric of "max" is nil if nothing is matched.
+func (f *logFollower) collect() *model.MetricValue {
+	paths, _ := filepath.Glob(f.pattern.File)
+	pathInfos := make(map[string]os.FileInfo, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			pathInfos[path] = info
+		}
+	}
+
+	aggregator := &logAggregator{aggregate: f.aggregate}
+
+	/**
+	 * Tracks the followed files by identity(device and inode), so the rotated file
+	 * (renamed to another path matched by glob) is still read from the followed offset.
+	 *
+	 * The file renamed out of glob or removed is read to the end, then is closed.
+	 */
+	files := make(map[string]*followedFile, len(pathInfos))
+	for path, followed := range f.files {
+		if newPath, ok := findFollowedPath(path, followed, pathInfos); ok {
+			files[newPath] = followed
+			continue
+		}
+
+		f.readLines(followed, aggregator)
+		followed.file.Close()
+	}
+	// :~)
+
+	for _, path := range paths {
+		info, ok := pathInfos[path]
+		if !ok {
+			continue
+		}
+
+		followed, ok := files[path]
+		if !ok {
+			var err error
+			if followed, err = openFollowedFile(path, !f.collected); err != nil {
+				log.Errorf("open log file [%v] failed: %v", path, err)
+				continue
+			}
+			files[path] = followed
+		}
+
+		// The file is truncated(e.g. "copytruncate" of logrotate)
+		if info.Size() < followed.offset {
+			followed.offset = 0
+		}
+
+		f.readLines(followed, aggregator)
+	}
+
+	f.files = files
+	f.collected = true
+
+	value, ok := aggregator.result()
+	if !ok {
+		return nil
+	}
+	return GaugeValue(g.LOG_MATCH, value, f.tags)
+}
+
+// Finds the current path of followed file, the original path is preferred
+func findFollowedPath(path string, followed *followedFile, pathInfos map[string]os.FileInfo) (string, bool) {
+	fileInfo, err := followed.file.Stat()
+	if err != nil {
+		return "", false
+	}
+
+	if info, ok := pathInfos[path]; ok && os.SameFile(info, fileInfo) {
+		return path, true
+	}
+	for newPath, info := range pathInfos {
+		if os.SameFile(info, fileInfo) {
+			return newPath, true
+		}
+	}
+
+	return "", false
+}
+
+// Reads the complete lines from the offset, the incomplete line at the end is left for next reading
+func (f *logFollower) readLines(followed *followedFile, aggregator *logAggregator) {
+	if _, err := followed.file.Seek(followed.offset, io.SeekStart); err != nil {
+		log.Errorf("seek log file [%v] failed: %v", followed.file.Name(), err)
+		return
+	}
+
+	reader := bufio.NewReader(followed.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err != io.EOF {
+				log.Errorf("read log file [%v] failed: %v", followed.file.Name(), err)
+			}
+			return
+		}
+		followed.offset += int64(len(line))
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > maxLogLineBytes {
+			line = line[:maxLogLineBytes]
+		}
+		f.match(line, aggregator)
+	}
+}
+
+func (f *logFollower) match(line []byte, aggregator *logAggregator) {
+	if f.pattern.Group == 0 {
+		if f.regex.Match(line) {
+			aggregator.add(1)
+		}
+		return
+	}
+
+	submatches := f.regex.FindSubmatch(line)
+	if submatches == nil {
+		return
+	}
+
+	value, err := strconv.ParseFloat(string(submatches[f.pattern.Group]), 64)
+	if err != nil {
+		return
+	}
+	aggregator.add(value)
+}
+
+func (f *logFollower) close() {
+	for _, followed := range f.files {
+		followed.file.Close()
+	}
+	f.files = make(map[string]*followedFile)
+}
+
+// Opens the file, the offset is set to the end of file if "fromEnd" is true
+func openFollowedFile(path string, fromEnd bool) (*followedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	followed := &followedFile{file: file}
+	if fromEnd {
+		if followed.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return followed, nil
+}
+
+type logAggregator struct {
+	aggregate string
+	value     float64
+	hasValue  bool
+}
+
+func (a *logAggregator) add(value float64) {
+	switch a.aggregate {
+	case logAggregateCount:
+		a.value++
+	case logAggregateSum:
+		a.value += value
+	case logAggregateMax:
+		if !a.hasValue || value > a.value {
+			a.value = value
+		}
+	}
+	a.hasValue = true
+}
+
+// The count and sum are 0 if nothing is matched, the max has no result if nothing is matched
+func (a *logAggregator) result() (float64, bool) {
+	if a.aggregate == logAggregateMax && !a.hasValue {
+		return 0, false
+	}
+	return a.value, true
+}
@@ -0,0 +1,137 @@
+package funcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/modules/agent/g"
+)
+
+func TestLogFollower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "app.log")
+	appendLog(t, logFile, "ERROR existing line\n")
+
+	countFollower := mustNewLogFollower(t, &g.LogPattern{
+		Name: "error", File: filepath.Join(dir, "app.log*"), Regex: "ERROR",
+	})
+	maxFollower := mustNewLogFollower(t, &g.LogPattern{
+		Name: "latency", File: filepath.Join(dir, "app.log*"), Regex: `cost=(\d+)ms$`, Group: 1, Aggregate: "max",
+		Tags: map[string]string{"service": "api"},
+	})
+	defer countFollower.close()
+	defer maxFollower.close()
+
+	testCases := []*struct {
+		// Modifies the log files before collecting
+		action        func()
+		expectedCount float64
+		// nil if no value is expected
+		expectedMax interface{}
+	}{
+		// The existing lines are skipped on first collecting
+		{func() {}, 0, nil},
+		{
+			func() {
+				appendLog(t, logFile, "ERROR first\nINFO cost=12ms\nERROR cost=30ms\nINFO cost=7ms\nERROR incomplete")
+			},
+			2, float64(30),
+		},
+		// Rotated: the rest of renamed file is read, then the new file is read from the beginning
+		{
+			func() {
+				appendLog(t, logFile, " line\n")
+				if err := os.Rename(logFile, logFile+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendLog(t, logFile, "ERROR after rotation cost=5ms\n")
+			},
+			2, float64(5),
+		},
+		// Truncated
+		{
+			func() {
+				if err := ioutil.WriteFile(logFile, []byte("ERROR truncated\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			1, nil,
+		},
+		// Renamed file out of glob
+		{
+			func() {
+				appendLog(t, logFile+".1", "ERROR cost=3ms\n")
+				if err := os.Rename(logFile+".1", filepath.Join(dir, "old.log")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			1, float64(3),
+		},
+		{func() {}, 0, nil},
+	}
+
+	for i, testCase := range testCases {
+		testCase.action()
+
+		countMetric := countFollower.collect()
+		if countMetric == nil || countMetric.Value != testCase.expectedCount {
+			t.Errorf("[%d] Expected count: %v. Got: %v", i, testCase.expectedCount, countMetric)
+		}
+		if countMetric != nil && countMetric.Tags != "name=error" {
+			t.Errorf("[%d] Unexpected tags: %s", i, countMetric.Tags)
+		}
+
+		maxMetric := maxFollower.collect()
+		switch {
+		case testCase.expectedMax == nil && maxMetric != nil:
+			t.Errorf("[%d] Expected no max. Got: %v", i, maxMetric)
+		case testCase.expectedMax != nil && (maxMetric == nil || maxMetric.Value != testCase.expectedMax):
+			t.Errorf("[%d] Expected max: %v. Got: %v", i, testCase.expectedMax, maxMetric)
+		case maxMetric != nil && maxMetric.Tags != "name=latency,service=api":
+			t.Errorf("[%d] Unexpected tags: %s", i, maxMetric.Tags)
+		}
+	}
+}
+
+func TestNewLogFollowerWithInvalidPattern(t *testing.T) {
+	invalidPatterns := []*g.LogPattern{
+		{Name: "a", File: "", Regex: "ERROR"},
+		{Name: "a", File: "/var/log/[.log", Regex: "ERROR"},
+		{Name: "a", File: "/var/log/*.log", Regex: "(ERROR"},
+		{Name: "a", File: "/var/log/*.log", Regex: "ERROR", Group: 1},
+		{Name: "a", File: "/var/log/*.log", Regex: "ERROR", Aggregate: "avg"},
+	}
+
+	for i, pattern := range invalidPatterns {
+		if _, err := newLogFollower(pattern); err == nil {
+			t.Errorf("[%d] Expected error for pattern: %#v", i, pattern)
+		}
+	}
+}
+
+func mustNewLogFollower(t *testing.T, pattern *g.LogPattern) *logFollower {
+	follower, err := newLogFollower(pattern)
+	if err != nil {
+		t.Fatalf("newLogFollower() has error: %v", err)
+	}
+	return follower
+}
+
+func appendLog(t *testing.T, path string, content string) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,217 @@
+package funcs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/agent/g"
+)
+
+const (
+	defaultPromScrapeTimeout = 3000
+	// Protects from reading huge response of scraping
+	maxPromScrapeBytes = 16 * 1024 * 1024
+
+	promAcceptHeader = "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+)
+
+// Scrapes metrics of a target, the metrics are converted by the configuration of target
+type promScraper struct {
+	target *g.PrometheusTarget
+	client *http.Client
+	// Empty if all of metrics are collected
+	metricFilters []*regexp.Regexp
+}
+
+// Builds the mappers of scraping Prometheus targets, the targets of the same interval share a mapper.
+//
+// Invalid configuration of target leads to fatal error.
+func PrometheusMappers(defaultInterval int) []FuncsAndInterval {
+	promConfig := g.Config().Prometheus
+	if promConfig == nil || !promConfig.Enabled {
+		return nil
+	}
+
+	fsOfInterval := make(map[int][]func() []*model.MetricValue)
+	for _, target := range promConfig.Targets {
+		scraper, err := newPromScraper(target)
+		if err != nil {
+			log.Fatalln("invalid target of prometheus:", target.Url, "error:", err)
+		}
+
+		interval := target.Interval
+		if interval <= 0 {
+			interval = defaultInterval
+		}
+		fsOfInterval[interval] = append(fsOfInterval[interval], scraper.Metrics)
+	}
+
+	intervals := make([]int, 0, len(fsOfInterval))
+	for interval := range fsOfInterval {
+		intervals = append(intervals, interval)
+	}
+	sort.Ints(intervals)
+
+	mappers := make([]FuncsAndInterval, 0, len(intervals))
+	for _, interval := range intervals {
+		mappers = append(mappers, FuncsAndInterval{Fs: fsOfInterval[interval], Interval: interval})
+	}
+
+	return mappers
+}
+
+func newPromScraper(target *g.PrometheusTarget) (*promScraper, error) {
+	if target.Url == "" {
+		return nil, fmt.Errorf("url is empty")
+	}
+
+	for promType, falconType := range target.Types {
+		if falconType != "COUNTER" && falconType != "GAUGE" {
+			return nil, fmt.Errorf("type of %q must be \"COUNTER\" or \"GAUGE\". Got: %q", promType, falconType)
+		}
+	}
+
+	metricFilters := make([]*regexp.Regexp, 0, len(target.Metrics))
+	for _, pattern := range target.Metrics {
+		filter, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		metricFilters = append(metricFilters, filter)
+	}
+
+	timeout := target.Timeout
+	if timeout <= 0 {
+		timeout = defaultPromScrapeTimeout
+	}
+
+	return &promScraper{
+		target:        target,
+		client:        &http.Client{Timeout: time.Duration(timeout) * time.Millisecond},
+		metricFilters: metricFilters,
+	}, nil
+}
+
+// Scrapes the target, the result of scraping is reported by "prometheus.scrape.up"(1 or 0)
+func (s *promScraper) Metrics() []*model.MetricValue {
+	upTags := "url=" + tagCharReplacer.Replace(s.target.Url)
+
+	samples, err := s.scrape()
+	if err != nil {
+		log.Printf("scrape prometheus target [%v] failed. the err is: [%v]", s.target.Url, err)
+		return []*model.MetricValue{GaugeValue(g.PROMETHEUS_SCRAPE_UP, 0, upTags)}
+	}
+
+	metrics := s.convert(samples)
+	return append(metrics, GaugeValue(g.PROMETHEUS_SCRAPE_UP, 1, upTags))
+}
+
+func (s *promScraper) scrape() ([]*promTextSample, error) {
+	req, err := http.NewRequest("GET", s.target.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", promAcceptHeader)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code is %d", resp.StatusCode)
+	}
+
+	return parsePromText(io.LimitReader(resp.Body, maxPromScrapeBytes))
+}
+
+// Converts the samples to metrics, the endpoint, step and timestamp are filled by the collector
+func (s *promScraper) convert(samples []*promTextSample) []*model.MetricValue {
+	metrics := make([]*model.MetricValue, 0, len(samples))
+
+	for _, sample := range samples {
+		// The creation time of counter(OpenMetrics) is not a metric to be monitored
+		if sample.suffix == "_created" {
+			continue
+		}
+		if !s.accepts(sample.name) {
+			continue
+		}
+
+		metrics = append(metrics, &model.MetricValue{
+			Metric: sample.name,
+			Value:  sample.value,
+			Type:   s.falconType(sample),
+			Tags:   s.buildTags(sample.labels),
+		})
+	}
+
+	return metrics
+}
+
+func (s *promScraper) accepts(name string) bool {
+	if len(s.metricFilters) == 0 {
+		return true
+	}
+
+	for _, filter := range s.metricFilters {
+		if filter.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Counters and the cumulative samples("_count", "_sum", "_bucket") of histogram/summary are "COUNTER",
+// others are "GAUGE". The mapping could be overridden by "types" of target.
+func (s *promScraper) falconType(sample *promTextSample) string {
+	if falconType, ok := s.target.Types[sample.familyType]; ok {
+		return falconType
+	}
+
+	switch sample.familyType {
+	case promTypeCounter:
+		return "COUNTER"
+	case promTypeHistogram, promTypeSummary:
+		switch sample.suffix {
+		case "_count", "_sum", "_bucket":
+			return "COUNTER"
+		}
+	}
+
+	return "GAUGE"
+}
+
+// Builds tags("k1=v1,k2=v2", sorted by key) from labels and extra tags of target
+func (s *promScraper) buildTags(labels []promLabel) string {
+	tags := make(map[string]string, len(labels)+len(s.target.Tags))
+
+	for _, label := range labels {
+		tagName := label.name
+		if len(s.target.Labels) > 0 {
+			mappedName, ok := s.target.Labels[label.name]
+			if !ok {
+				continue
+			}
+			if mappedName != "" {
+				tagName = mappedName
+			}
+		}
+
+		tags[tagName] = label.value
+	}
+	for name, value := range s.target.Tags {
+		tags[name] = value
+	}
+
+	return buildTagString(tags)
+}
@@ -0,0 +1,154 @@
+package funcs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/modules/agent/g"
+)
+
+const promTextOfTest = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# TYPE queue_size gauge
+queue_size{name="a,b=c"} 12.5
+queue_size{name="with \"quote\""} NaN
+
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.05
+rpc_duration_seconds_sum 1.7560473e+07
+rpc_duration_seconds_count 2693
+
+# TYPE jobs counter
+jobs_total{type="batch"} 5 # {trace_id="abc"} 1.0
+jobs_created{type="batch"} 1.6e+09
+no_type_metric 7
+# EOF
+ignored_after_eof 1
+`
+
+func TestParsePromText(t *testing.T) {
+	samples, err := parsePromText(strings.NewReader(promTextOfTest))
+	if err != nil {
+		t.Fatalf("parsePromText() has error: %v", err)
+	}
+
+	type expectedSample struct {
+		name       string
+		labels     []promLabel
+		value      float64
+		familyType string
+		suffix     string
+	}
+	expected := []expectedSample{
+		{"http_requests_total", []promLabel{{"method", "post"}, {"code", "200"}}, 1027, "counter", ""},
+		{"http_requests_total", []promLabel{{"method", "post"}, {"code", "400"}}, 3, "counter", ""},
+		{"queue_size", []promLabel{{"name", "a,b=c"}}, 12.5, "gauge", ""},
+		{"rpc_duration_seconds", []promLabel{{"quantile", "0.5"}}, 0.05, "summary", ""},
+		{"rpc_duration_seconds_sum", []promLabel{}, 1.7560473e+07, "summary", "_sum"},
+		{"rpc_duration_seconds_count", []promLabel{}, 2693, "summary", "_count"},
+		{"jobs_total", []promLabel{{"type", "batch"}}, 5, "counter", "_total"},
+		{"jobs_created", []promLabel{{"type", "batch"}}, 1.6e+09, "counter", "_created"},
+		{"no_type_metric", nil, 7, "untyped", ""},
+	}
+
+	if len(samples) != len(expected) {
+		t.Fatalf("Expected %d samples. Got: %d", len(expected), len(samples))
+	}
+	for i, sample := range samples {
+		testCase := expected[i]
+		if sample.name != testCase.name || sample.value != testCase.value ||
+			sample.familyType != testCase.familyType || sample.suffix != testCase.suffix ||
+			len(sample.labels) != len(testCase.labels) ||
+			(len(sample.labels) > 0 && !reflect.DeepEqual(sample.labels, testCase.labels)) {
+			t.Errorf("[%d] Expected: %v. Got: %#v", i, testCase, sample)
+		}
+	}
+}
+
+func TestParsePromTextWithInvalidContent(t *testing.T) {
+	invalidContents := []string{
+		`metric{name="a"`,
+		`metric{name=a} 1`,
+		`metric{name="a} 1`,
+		`metric`,
+		`metric abc`,
+	}
+
+	for _, content := range invalidContents {
+		if _, err := parsePromText(strings.NewReader(content)); err == nil {
+			t.Errorf("Expected error for content: %s", content)
+		}
+	}
+}
+
+func TestPromScraperMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(promTextOfTest))
+	}))
+	defer server.Close()
+
+	scraper, err := newPromScraper(&g.PrometheusTarget{
+		Url:     server.URL,
+		Metrics: []string{"http_requests_.*", "queue_size", "rpc_duration_seconds.*", "jobs.*"},
+		Labels:  map[string]string{"code": "status", "name": "", "quantile": "", "type": ""},
+		Tags:    map[string]string{"service": "api"},
+		Types:   map[string]string{"summary": "GAUGE"},
+	})
+	if err != nil {
+		t.Fatalf("newPromScraper() has error: %v", err)
+	}
+
+	expected := []string{
+		"http_requests_total/COUNTER/service=api,status=200/1027",
+		"http_requests_total/COUNTER/service=api,status=400/3",
+		"queue_size/GAUGE/name=a_b_c,service=api/12.5",
+		"rpc_duration_seconds/GAUGE/quantile=0.5,service=api/0.05",
+		"rpc_duration_seconds_sum/GAUGE/service=api/1.7560473e+07",
+		"rpc_duration_seconds_count/GAUGE/service=api/2693",
+		"jobs_total/COUNTER/service=api,type=batch/5",
+		"prometheus.scrape.up/GAUGE/url=" + server.URL + "/1",
+	}
+
+	metrics := scraper.Metrics()
+	if len(metrics) != len(expected) {
+		t.Fatalf("Expected %d metrics. Got: %v", len(expected), metrics)
+	}
+	for i, metric := range metrics {
+		if got := strings.Join([]string{metric.Metric, metric.Type, metric.Tags, fmt.Sprint(metric.Value)}, "/"); got != expected[i] {
+			t.Errorf("[%d] Expected: %s. Got: %s", i, expected[i], got)
+		}
+	}
+}
+
+func TestPromScraperOfUnreachableTarget(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	scraper, _ := newPromScraper(&g.PrometheusTarget{Url: server.URL})
+
+	metrics := scraper.Metrics()
+	if len(metrics) != 1 || metrics[0].Metric != g.PROMETHEUS_SCRAPE_UP || metrics[0].Value != 0 {
+		t.Errorf("Expected only \"prometheus.scrape.up\" of 0. Got: %v", metrics)
+	}
+}
+
+func TestNewPromScraperWithInvalidTarget(t *testing.T) {
+	invalidTargets := []*g.PrometheusTarget{
+		{Url: ""},
+		{Url: "http://127.0.0.1:9090/metrics", Metrics: []string{"(abc"}},
+		{Url: "http://127.0.0.1:9090/metrics", Types: map[string]string{"counter": "DERIVE"}},
+	}
+
+	for _, target := range invalidTargets {
+		if _, err := newPromScraper(target); err == nil {
+			t.Errorf("Expected error for target: %#v", target)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package funcs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	promTypeCounter        = "counter"
+	promTypeGauge          = "gauge"
+	promTypeHistogram      = "histogram"
+	promTypeGaugeHistogram = "gaugehistogram"
+	promTypeSummary        = "summary"
+	promTypeUntyped        = "untyped"
+)
+
+// The suffixes of samples which belong to a family(e.g. "http_requests_total" of counter "http_requests")
+var promSampleSuffixes = []string{"_total", "_count", "_sum", "_bucket", "_created", "_gcount", "_gsum", "_info"}
+
+type promLabel struct {
+	name  string
+	value string
+}
+
+type promTextSample struct {
+	name   string
+	labels []promLabel
+	value  float64
+	// Type of the family, "untyped" if the family has no "# TYPE" line
+	familyType string
+	// Suffix of name(e.g. "_total", "_bucket"), empty if the name is the same as the family
+	suffix string
+}
+
+// Parses the text format of Prometheus(0.0.4) or OpenMetrics(1.0.0).
+//
+// Timestamps and exemplars are ignored, the samples of NaN or Inf are skipped.
+func parsePromText(reader io.Reader) ([]*promTextSample, error) {
+	familyTypes := make(map[string]string)
+	samples := make([]*promTextSample, 0)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if line[0] == '#' {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[1] == "EOF" {
+				break
+			}
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				familyTypes[fields[2]] = strings.ToLower(fields[3])
+			}
+			continue
+		}
+
+		sample, err := parsePromSampleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			continue
+		}
+
+		sample.familyType, sample.suffix = promFamilyType(sample.name, familyTypes)
+		samples = append(samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Parses line of sample: <name>[{<label>="<value>",...}] <value> [<timestamp>]
+func parsePromSampleLine(line string) (*promTextSample, error) {
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return nil, fmt.Errorf("invalid sample: %q", line)
+	}
+
+	sample := &promTextSample{name: line[:nameEnd]}
+	rest := line[nameEnd:]
+
+	if rest[0] == '{' {
+		labels, remained, err := parsePromLabels(rest[1:])
+		if err != nil {
+			return nil, err
+		}
+		sample.labels = labels
+		rest = remained
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("sample has no value: %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of sample: %q", line)
+	}
+	sample.value = value
+
+	return sample, nil
+}
+
+// Parses labels until "}", returns the remained content after "}"
+func parsePromLabels(content string) ([]promLabel, string, error) {
+	labels := make([]promLabel, 0)
+
+	for {
+		content = strings.TrimLeft(content, " \t,")
+		if content == "" {
+			return nil, "", fmt.Errorf("labels are not closed")
+		}
+		if content[0] == '}' {
+			return labels, content[1:], nil
+		}
+
+		eq := strings.IndexByte(content, '=')
+		if eq <= 0 {
+			return nil, "", fmt.Errorf("invalid label: %q", content)
+		}
+		name := strings.TrimSpace(content[:eq])
+
+		content = strings.TrimLeft(content[eq+1:], " \t")
+		if content == "" || content[0] != '"' {
+			return nil, "", fmt.Errorf("value of label %q is not quoted", name)
+		}
+
+		value, end, err := unquotePromLabelValue(content)
+		if err != nil {
+			return nil, "", err
+		}
+
+		labels = append(labels, promLabel{name: name, value: value})
+		content = content[end:]
+	}
+}
+
+// Unquotes the value(started with '"'), returns the value and the position after closing quote.
+//
+// The escapes of "\\", "\"" and "\n" are supported.
+func unquotePromLabelValue(content string) (string, int, error) {
+	value := make([]byte, 0, 32)
+
+	for i := 1; i < len(content); i++ {
+		switch c := content[i]; c {
+		case '"':
+			return string(value), i + 1, nil
+		case '\\':
+			i++
+			if i >= len(content) {
+				break
+			}
+			switch content[i] {
+			case 'n':
+				value = append(value, '\n')
+			default:
+				value = append(value, content[i])
+			}
+		default:
+			value = append(value, c)
+		}
+	}
+
+	return "", 0, fmt.Errorf("value of label is not closed: %q", content)
+}
+
+// Finds type of the family which the sample belongs to
+func promFamilyType(name string, familyTypes map[string]string) (string, string) {
+	if familyType, ok := familyTypes[name]; ok {
+		return familyType, ""
+	}
+
+	for _, suffix := range promSampleSuffixes {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		if familyType, ok := familyTypes[strings.TrimSuffix(name, suffix)]; ok {
+			return familyType, suffix
+		}
+	}
+
+	return promTypeUntyped, ""
+}
@@ -1,54 +1,296 @@
 package funcs
 
 import (
-	"bufio"
-	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
 	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 
 	"github.com/fwtpe/owl-backend/common/model"
 	"github.com/fwtpe/owl-backend/modules/agent/g"
-	"github.com/toolkits/file"
-	"github.com/toolkits/sys"
 )
 
+const (
+	urlCheckStatus         = "url.check.status"
+	urlCheckBodyMatch      = "url.check.body.match"
+	urlCheckTimeDns        = "url.check.time.dns"
+	urlCheckTimeConnect    = "url.check.time.connect"
+	urlCheckTimeTls        = "url.check.time.tls"
+	urlCheckTimeFirstByte  = "url.check.time.firstbyte"
+	urlCheckTimeTotal      = "url.check.time.total"
+	urlCheckCertExpiryDays = "url.check.cert.expiry.days"
+
+	defaultUrlProbeTimeout = 5
+	// Only the beginning of body is read(the same as "--max-filesize" of curl used formerly)
+	maxUrlProbeBodyBytes = 102400
+)
+
+// The certificate is verified after the response is received,
+// so the days to expiry could be reported even if the certificate is invalid.
+var urlProbeTransport = &http.Transport{
+	Proxy:             http.ProxyFromEnvironment,
+	DisableKeepAlives: true,
+	TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+}
+
 func UrlMetrics() (L []*model.MetricValue) {
-	reportUrls := g.ReportUrls()
-	sz := len(reportUrls)
-	if sz == 0 {
+	targets := urlProbeTargets()
+	if len(targets) == 0 {
 		return
 	}
+
 	hostname, err := g.Hostname()
 	if err != nil {
 		hostname = "None"
 	}
+	for _, target := range targets {
+		tags := fmt.Sprintf("url=%v,timeout=%v,src=%v", target.Url, target.tagTimeout, hostname)
+		L = append(L, probeUrl(target.UrlProbeTarget).metrics(tags)...)
+	}
+	return
+}
+
+type urlProbeTarget struct {
+	*g.UrlProbeTarget
+	// The "timeout" tag of metrics, which is the timeout assigned by heartbeat if there is one,
+	// so the series matched by strategies of "url.check.health" are kept even if the timeout is overridden locally.
+	tagTimeout string
+}
+
+func urlProbeTargets() []*urlProbeTarget {
+	var localTargets []*g.UrlProbeTarget
+	if probeConfig := g.Config().UrlProbe; probeConfig != nil {
+		localTargets = probeConfig.Urls
+	}
+	return mergeUrlProbeTargets(g.ReportUrls(), localTargets)
+}
+
+// Merges the urls assigned by heartbeat with the ones of local configuration(which has precedence)
+func mergeUrlProbeTargets(reportUrls map[string]string, localTargets []*g.UrlProbeTarget) []*urlProbeTarget {
+	localByUrl := make(map[string]*g.UrlProbeTarget)
+	for _, target := range localTargets {
+		localByUrl[target.Url] = target
+	}
+
+	targets := make([]*urlProbeTarget, 0, len(reportUrls)+len(localByUrl))
 	for furl, timeout := range reportUrls {
-		tags := fmt.Sprintf("url=%v,timeout=%v,src=%v", furl, timeout, hostname)
-		if ok, _ := probeUrl(furl, timeout); !ok {
-			L = append(L, GaugeValue(g.URL_CHECK_HEALTH, 0, tags))
+		if target, ok := localByUrl[furl]; ok {
+			targets = append(targets, &urlProbeTarget{target, timeout})
+			delete(localByUrl, furl)
 			continue
 		}
-		L = append(L, GaugeValue(g.URL_CHECK_HEALTH, 1, tags))
+
+		timeoutSeconds, _ := strconv.Atoi(timeout)
+		targets = append(targets, &urlProbeTarget{&g.UrlProbeTarget{Url: furl, Timeout: timeoutSeconds}, timeout})
 	}
-	return
+	for _, target := range localByUrl {
+		targets = append(targets, &urlProbeTarget{target, strconv.Itoa(target.Timeout)})
+	}
+
+	return targets
+}
+
+type urlProbeResult struct {
+	healthy bool
+	// 0 if there is no response
+	statusCode int
+	// nil if "bodyRegex" is not set
+	bodyMatched *bool
+
+	dns       time.Duration
+	connect   time.Duration
+	tls       time.Duration
+	firstByte time.Duration
+	total     time.Duration
+
+	// nil if it is not https
+	certExpiry *time.Time
 }
 
-func probeUrl(furl string, timeout string) (bool, error) {
-	bs, err := sys.CmdOutBytes("curl", "--max-filesize", "102400", "-I", "-m", timeout, "-o", "/dev/null", "-s", "-w", "%{http_code}", furl)
+func (r *urlProbeResult) metrics(tags string) []*model.MetricValue {
+	healthy := 0
+	if r.healthy {
+		healthy = 1
+	}
+
+	metrics := []*model.MetricValue{
+		GaugeValue(g.URL_CHECK_HEALTH, healthy, tags),
+		GaugeValue(urlCheckStatus, r.statusCode, tags),
+	}
+	if r.statusCode == 0 {
+		return metrics
+	}
+
+	if r.bodyMatched != nil {
+		matched := 0
+		if *r.bodyMatched {
+			matched = 1
+		}
+		metrics = append(metrics, GaugeValue(urlCheckBodyMatch, matched, tags))
+	}
+
+	metrics = append(metrics,
+		GaugeValue(urlCheckTimeDns, toMilliseconds(r.dns), tags),
+		GaugeValue(urlCheckTimeConnect, toMilliseconds(r.connect), tags),
+		GaugeValue(urlCheckTimeTls, toMilliseconds(r.tls), tags),
+		GaugeValue(urlCheckTimeFirstByte, toMilliseconds(r.firstByte), tags),
+		GaugeValue(urlCheckTimeTotal, toMilliseconds(r.total), tags),
+	)
+
+	if r.certExpiry != nil {
+		days := math.Floor(r.certExpiry.Sub(time.Now()).Hours()/24*100) / 100
+		metrics = append(metrics, GaugeValue(urlCheckCertExpiryDays, days, tags))
+	}
+
+	return metrics
+}
+
+func probeUrl(target *g.UrlProbeTarget) *urlProbeResult {
+	result := &urlProbeResult{}
+
+	// HEAD is the default(the same as "curl -I" used formerly), the body is needed by "bodyRegex"
+	method := target.Method
+	if method == "" {
+		method = "HEAD"
+		if target.BodyRegex != "" {
+			method = "GET"
+		}
+	}
+	timeout := target.Timeout
+	if timeout <= 0 {
+		timeout = defaultUrlProbeTimeout
+	}
+
+	req, err := http.NewRequest(method, target.Url, nil)
+	if err != nil {
+		log.Printf("probe url [%v] failed.the err is: [%v]\n", target.Url, err)
+		return result
+	}
+
+	/**
+	 * Traces the timings of phases
+	 */
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			if !dnsStart.IsZero() {
+				result.dns = time.Since(dnsStart)
+			}
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil && !connectStart.IsZero() {
+				result.connect = time.Since(connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			if !tlsStart.IsZero() {
+				result.tls = time.Since(tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() { result.firstByte = time.Since(start) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	// :~)
+
+	client := &http.Client{
+		Transport: urlProbeTransport,
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("probe url [%v] failed.the err is: [%v]\n", furl, err)
-		return false, err
+		log.Printf("probe url [%v] failed.the err is: [%v]\n", target.Url, err)
+		return result
 	}
-	reader := bufio.NewReader(bytes.NewBuffer(bs))
-	retcode, err := file.ReadLine(reader)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxUrlProbeBodyBytes))
+	result.total = time.Since(start)
+	result.statusCode = resp.StatusCode
 	if err != nil {
-		log.Println("read retcode failed.err is:", err)
-		return false, err
+		log.Printf("read body of url [%v] failed.the err is: [%v]\n", target.Url, err)
+		return result
+	}
+
+	result.healthy = matchStatus(resp.StatusCode, target.ExpectedStatus)
+	if !result.healthy {
+		log.Printf("return code [%v] is not expected.query url is [%v]", resp.StatusCode, target.Url)
 	}
-	if strings.TrimSpace(string(retcode)) != "200" {
-		log.Printf("return code [%v] is not 200.query url is [%v]", string(retcode), furl)
-		return false, err
+
+	if bodyRegexp := target.BodyRegexp(); bodyRegexp != nil {
+		matched := bodyRegexp.Match(body)
+		result.bodyMatched = &matched
+		result.healthy = result.healthy && matched
+	}
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.certExpiry = &resp.TLS.PeerCertificates[0].NotAfter
+
+		if !target.InsecureSkipVerify {
+			if err := verifyCertificates(req.URL.Host, resp.TLS.PeerCertificates); err != nil {
+				log.Printf("certificate of url [%v] is invalid: %v", target.Url, err)
+				result.healthy = false
+			}
+		}
 	}
-	return true, err
+
+	return result
+}
+
+// Checks the code matches any of the expected ones("200" or "2xx"), the default one is "200"
+func matchStatus(code int, expectedStatus []string) bool {
+	if len(expectedStatus) == 0 {
+		return code == http.StatusOK
+	}
+
+	codeText := strconv.Itoa(code)
+	for _, expected := range expectedStatus {
+		expected = strings.ToLower(strings.TrimSpace(expected))
+		if len(expected) == 3 && strings.HasSuffix(expected, "xx") {
+			if codeText[0] == expected[0] {
+				return true
+			}
+			continue
+		}
+
+		if expected == codeText {
+			return true
+		}
+	}
+
+	return false
+}
+
+func verifyCertificates(host string, certs []*x509.Certificate) error {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
@@ -0,0 +1,165 @@
+package funcs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/modules/agent/g"
+)
+
+func TestProbeUrl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"UP"}`))
+	}))
+	defer server.Close()
+
+	testCases := []*struct {
+		target             *g.UrlProbeTarget
+		expectedHealthy    bool
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{&g.UrlProbeTarget{Url: server.URL}, true, 200, ""},
+		{&g.UrlProbeTarget{Url: server.URL, BodyRegex: `"status":"UP"`}, true, 200, "1"},
+		{&g.UrlProbeTarget{Url: server.URL, BodyRegex: `"status":"DOWN"`}, false, 200, "0"},
+		{&g.UrlProbeTarget{Url: server.URL + "/missing"}, false, 404, ""},
+		{&g.UrlProbeTarget{Url: server.URL + "/missing", ExpectedStatus: []string{"2xx", "404"}}, true, 404, ""},
+		{&g.UrlProbeTarget{Url: server.URL, Method: "HEAD", ExpectedStatus: []string{"3XX"}}, false, 200, ""},
+		{&g.UrlProbeTarget{Url: "http://127.0.0.1:1/", Timeout: 1}, false, 0, ""},
+	}
+
+	for i, testCase := range testCases {
+		if err := testCase.target.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		result := probeUrl(testCase.target)
+
+		if result.healthy != testCase.expectedHealthy || result.statusCode != testCase.expectedStatusCode {
+			t.Errorf("[%d] Expected healthy: %v, status code: %d. Got: %#v", i, testCase.expectedHealthy, testCase.expectedStatusCode, result)
+		}
+
+		metrics := make(map[string]interface{})
+		for _, metric := range result.metrics("url=" + testCase.target.Url) {
+			metrics[metric.Metric] = metric.Value
+		}
+		if _, ok := metrics[urlCheckBodyMatch]; ok != (testCase.expectedBody != "") {
+			t.Errorf("[%d] Unexpected metric of body matching: %v", i, metrics)
+		}
+		if _, ok := metrics[urlCheckTimeTotal]; ok != (testCase.expectedStatusCode != 0) {
+			t.Errorf("[%d] Unexpected metric of timing: %v", i, metrics)
+		}
+		if _, ok := metrics[urlCheckCertExpiryDays]; ok {
+			t.Errorf("[%d] Metric of certificate should be absent for http: %v", i, metrics)
+		}
+	}
+}
+
+func TestProbeUrlOfTls(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	testCases := []*struct {
+		insecureSkipVerify bool
+		expectedHealthy    bool
+	}{
+		// The certificate of test server is not signed by trusted CA
+		{false, false},
+		{true, true},
+	}
+
+	for i, testCase := range testCases {
+		result := probeUrl(&g.UrlProbeTarget{Url: server.URL, InsecureSkipVerify: testCase.insecureSkipVerify})
+
+		if result.healthy != testCase.expectedHealthy {
+			t.Errorf("[%d] Expected healthy: %v. Got: %#v", i, testCase.expectedHealthy, result)
+		}
+		if result.certExpiry == nil {
+			t.Errorf("[%d] Expiry of certificate should be reported", i)
+		}
+		if result.tls <= 0 {
+			t.Errorf("[%d] Time of TLS handshake should be traced", i)
+		}
+	}
+}
+
+func TestMatchStatus(t *testing.T) {
+	testCases := []*struct {
+		code     int
+		expected []string
+		matched  bool
+	}{
+		{200, nil, true},
+		{204, nil, false},
+		{204, []string{"2xx"}, true},
+		{302, []string{"200", "301"}, false},
+		{302, []string{"200", "3xx"}, true},
+		{503, []string{" 503 "}, true},
+	}
+
+	for i, testCase := range testCases {
+		if matched := matchStatus(testCase.code, testCase.expected); matched != testCase.matched {
+			t.Errorf("[%d] Expected: %v. Got: %v", i, testCase.matched, matched)
+		}
+	}
+}
+
+func TestMergeUrlProbeTargets(t *testing.T) {
+	reportUrls := map[string]string{"http://a/": "10", "http://b/": "3"}
+	localTargets := []*g.UrlProbeTarget{
+		{Url: "http://b/", Timeout: 20, Method: "GET"},
+		{Url: "http://c/", Timeout: 7},
+	}
+
+	testCases := map[string]*struct {
+		timeout    int
+		tagTimeout string
+		method     string
+	}{
+		"http://a/": {10, "10", ""},
+		// The timeout assigned by heartbeat is kept in tags
+		"http://b/": {20, "3", "GET"},
+		"http://c/": {7, "7", ""},
+	}
+
+	targets := mergeUrlProbeTargets(reportUrls, localTargets)
+	if len(targets) != len(testCases) {
+		t.Fatalf("Expected %d targets. Got: %d", len(testCases), len(targets))
+	}
+	for _, target := range targets {
+		testCase, ok := testCases[target.Url]
+		if !ok {
+			t.Errorf("Unexpected target: %v", target.Url)
+			continue
+		}
+		if target.Timeout != testCase.timeout || target.tagTimeout != testCase.tagTimeout || target.Method != testCase.method {
+			t.Errorf("[%s] Expected timeout: %d, tag timeout: %s, method: %q. Got: %d, %s, %q",
+				target.Url, testCase.timeout, testCase.tagTimeout, testCase.method, target.Timeout, target.tagTimeout, target.Method)
+		}
+	}
+}
+
+func TestProbeUrlDefaultMethod(t *testing.T) {
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+	defer server.Close()
+
+	probeUrl(&g.UrlProbeTarget{Url: server.URL})
+	if method != "HEAD" {
+		t.Errorf("Expected HEAD by default. Got: %s", method)
+	}
+	target := &g.UrlProbeTarget{Url: server.URL, BodyRegex: "ok"}
+	target.Compile()
+	probeUrl(target)
+	if method != "GET" {
+		t.Errorf("Expected GET for bodyRegex. Got: %s", method)
+	}
+}
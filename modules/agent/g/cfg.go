@@ -3,6 +3,7 @@ package g
 import (
 	"encoding/json"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
 
@@ -28,10 +29,24 @@ type HeartbeatConfig struct {
 }
 
 type TransferConfig struct {
-	Enabled  bool     `json:"enabled"`
-	Addrs    []string `json:"addrs"`
-	Interval int      `json:"interval"`
-	Timeout  int      `json:"timeout"`
+	Enabled  bool                  `json:"enabled"`
+	Addrs    []string              `json:"addrs"`
+	Interval int                   `json:"interval"`
+	Timeout  int                   `json:"timeout"`
+	Buffer   *TransferBufferConfig `json:"buffer"`
+}
+
+type TransferBufferConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`
+	// The limit(MB) of buffered data, the new data would be dropped if exceeded
+	MaxSizeMB int64 `json:"maxSizeMB"`
+	// The size(MB) of a segment file
+	SegmentSizeMB int64 `json:"segmentSizeMB"`
+	// The interval(ms) between replaying of two batches, which limits the rate of replaying
+	ReplayInterval int `json:"replayInterval"`
+	// The interval(ms) to retry replaying if all of the transfers are still unreachable
+	RetryInterval int `json:"retryInterval"`
 }
 
 type HttpConfig struct {
@@ -45,16 +60,97 @@ type CollectorConfig struct {
 	EthAll      []string `json:"eth_all"`
 }
 
+type PrometheusConfig struct {
+	Enabled bool                `json:"enabled"`
+	Targets []*PrometheusTarget `json:"targets"`
+}
+
+type PrometheusTarget struct {
+	// URL of "/metrics" endpoint, which exports metrics in Prometheus(or OpenMetrics) text format
+	Url string `json:"url"`
+	// Interval(seconds) of scraping, default is the interval of transfer
+	Interval int `json:"interval"`
+	// Timeout(ms) of scraping
+	Timeout int `json:"timeout"`
+	// Regular expressions(matching whole name) of metrics to be collected, all of metrics are collected if empty
+	Metrics []string `json:"metrics"`
+	// Mapping from label to tag, only the labels in the mapping are kept.
+	// All of labels are kept(by same name) if empty
+	Labels map[string]string `json:"labels"`
+	// Extra tags on every metric of the target
+	Tags map[string]string `json:"tags"`
+	// Mapping from type of Prometheus("counter", "gauge", "histogram", "summary", "untyped") to "COUNTER" or "GAUGE"
+	Types map[string]string `json:"types"`
+}
+
+type UrlProbeConfig struct {
+	// The urls to be probed besides the ones assigned by heartbeat,
+	// the settings are applied to the url assigned by heartbeat as well if the url is the same.
+	Urls []*UrlProbeTarget `json:"urls"`
+}
+
+type UrlProbeTarget struct {
+	Url string `json:"url"`
+	// Timeout(seconds) of probing
+	Timeout int `json:"timeout"`
+	// "HEAD" or "GET", the default is "HEAD"("GET" if "bodyRegex" is set)
+	Method string `json:"method"`
+	// The expected status codes, could be exact code("200") or class of codes("2xx"). Default is "200"
+	ExpectedStatus []string `json:"expectedStatus"`
+	// Regular expression which must be matched by the body(first 100KB) of response
+	BodyRegex string `json:"bodyRegex"`
+	// Skips verification of certificate(the days to expiry are still reported)
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+
+	bodyRegexp *regexp.Regexp
+}
+
+// Compiles "bodyRegex", which is called when the configuration is parsed
+func (this *UrlProbeTarget) Compile() (err error) {
+	if this.BodyRegex == "" {
+		this.bodyRegexp = nil
+		return nil
+	}
+	this.bodyRegexp, err = regexp.Compile(this.BodyRegex)
+	return
+}
+
+// nil if "bodyRegex" is not set
+func (this *UrlProbeTarget) BodyRegexp() *regexp.Regexp {
+	return this.bodyRegexp
+}
+
+type LogCollectorConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Patterns []*LogPattern `json:"patterns"`
+}
+
+type LogPattern struct {
+	Name string `json:"name"`
+	// Glob of files to be followed, e.g. "/var/log/app/*.log"
+	File  string `json:"file"`
+	Regex string `json:"regex"`
+	// Index of capture group whose numeric value is aggregated, 0 means the matched lines are counted
+	Group int `json:"group"`
+	// "count"(default), "sum" or "max" on the matched lines(or the values of capture group) per step
+	Aggregate string `json:"aggregate"`
+	// Extra tags of metric
+	Tags map[string]string `json:"tags"`
+}
+
 type GlobalConfig struct {
-	Debug         bool             `json:"debug"`
-	Hostname      string           `json:"hostname"`
-	IP            string           `json:"ip"`
-	Plugin        *PluginConfig    `json:"plugin"`
-	Heartbeat     *HeartbeatConfig `json:"heartbeat"`
-	Transfer      *TransferConfig  `json:"transfer"`
-	Http          *HttpConfig      `json:"http"`
-	Collector     *CollectorConfig `json:"collector"`
-	IgnoreMetrics map[string]bool  `json:"ignore"`
+	Debug         bool                `json:"debug"`
+	Hostname      string              `json:"hostname"`
+	IP            string              `json:"ip"`
+	Plugin        *PluginConfig       `json:"plugin"`
+	Heartbeat     *HeartbeatConfig    `json:"heartbeat"`
+	Transfer      *TransferConfig     `json:"transfer"`
+	Http          *HttpConfig         `json:"http"`
+	Collector     *CollectorConfig    `json:"collector"`
+	Prometheus    *PrometheusConfig   `json:"prometheus"`
+	UrlProbe      *UrlProbeConfig     `json:"urlProbe"`
+	LogCollector  *LogCollectorConfig `json:"logCollector"`
+	IgnoreMetrics map[string]bool     `json:"ignore"`
 }
 
 var (
@@ -122,6 +218,14 @@ func ParseConfig(cfg string) {
 		log.Fatalln("parse config file:", cfg, "fail:", err)
 	}
 
+	if c.UrlProbe != nil {
+		for _, target := range c.UrlProbe.Urls {
+			if err := target.Compile(); err != nil {
+				log.Fatalln("parse config file:", cfg, "fail: bodyRegex of url", target.Url, "is invalid:", err)
+			}
+		}
+	}
+
 	lock.Lock()
 	defer lock.Unlock()
 
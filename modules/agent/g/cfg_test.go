@@ -0,0 +1,19 @@
+package g
+
+import (
+	"testing"
+)
+
+func TestCompileUrlProbeTarget(t *testing.T) {
+	target := &UrlProbeTarget{Url: "http://a/", BodyRegex: `"status":\s*"UP"`}
+	if err := target.Compile(); err != nil || !target.BodyRegexp().MatchString(`{"status": "UP"}`) {
+		t.Errorf("Unexpected compiled bodyRegex: %v, %v", target.BodyRegexp(), err)
+	}
+
+	if err := (&UrlProbeTarget{Url: "http://a/", BodyRegex: `"status":("UP"`}).Compile(); err == nil {
+		t.Errorf("Expected error of invalid bodyRegex")
+	}
+	if target := (&UrlProbeTarget{Url: "http://a/"}); target.Compile() != nil || target.BodyRegexp() != nil {
+		t.Errorf("Expected no bodyRegex")
+	}
+}
@@ -20,11 +20,18 @@ import (
 // 5.2.0: Fix agent orphan processes problem and add /v1/tail API
 // 6.0.0: Use new plugin/git repo updating mechanism.
 // 6.1.0: Add timeout mechanism on 'git fetch', 'git clone', 'git ls-remote' command
+// 6.2.0: Buffer metrics on disk while all of the transfers are unreachable
+// 6.3.0: Scrape metrics from endpoints of Prometheus
+// 6.4.0: Probe url natively(instead of curl) with timings, status code and expiry of certificate
+// 6.5.0: Collect matched lines of log files
 const (
-	VERSION          = "6.1.0"
+	VERSION          = "6.5.0"
 	COLLECT_INTERVAL = time.Second
 	URL_CHECK_HEALTH = "url.check.health"
 	NET_PORT_LISTEN  = "net.port.listen"
 	DU_BS            = "du.bs"
 	PROC_NUM         = "proc.num"
+	LOG_MATCH        = "log.match"
+
+	PROMETHEUS_SCRAPE_UP = "prometheus.scrape.up"
 )
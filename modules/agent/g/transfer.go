@@ -14,7 +14,22 @@ var (
 	TransferClients map[string]*SingleConnRpcClient = map[string]*SingleConnRpcClient{}
 )
 
+// Sends the metrics to any of transfers, the metrics are buffered(if enabled) if all of the transfers fail.
+//
+// While there are buffered metrics, the new metrics are appended to the buffer as well,
+// so the metrics are received by transfer in order of time.
 func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) {
+	if hasBufferedMetrics() {
+		bufferMetrics(metrics)
+		return
+	}
+
+	if !sendMetricsToAnyTransfer(metrics, resp) {
+		bufferMetrics(metrics)
+	}
+}
+
+func sendMetricsToAnyTransfer(metrics []*model.MetricValue, resp *model.TransferResponse) bool {
 	rand.Seed(time.Now().UnixNano())
 	for _, i := range rand.Perm(len(Config().Transfer.Addrs)) {
 		addr := Config().Transfer.Addrs[i]
@@ -22,9 +37,11 @@ func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) {
 			initTransferClient(addr)
 		}
 		if updateMetrics(addr, metrics, resp) {
-			break
+			return true
 		}
 	}
+
+	return false
 }
 
 func initTransferClient(addr string) {
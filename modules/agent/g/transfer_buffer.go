@@ -0,0 +1,161 @@
+package g
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/spill"
+)
+
+const (
+	defaultBufferDir            = "./data/buffer"
+	defaultBufferMaxSizeMB      = 512
+	defaultBufferSegmentSizeMB  = 16
+	defaultBufferReplayInterval = 200
+	defaultBufferRetryInterval  = 5000
+)
+
+// Keeps the batches of metrics on disk while all of the transfers are unreachable.
+//
+// The buffer is nil if it is not enabled.
+var transferBuffer *spill.Queue
+
+// Number of metrics dropped since the buffer is full(or cannot be written)
+var transferBufferDropped int64
+
+type TransferBufferStatus struct {
+	Enabled bool  `json:"enabled"`
+	Batches int64 `json:"batches"`
+	Bytes   int64 `json:"bytes"`
+	Dropped int64 `json:"dropped"`
+}
+
+// Opens the buffer and starts replaying of buffered metrics, does nothing if the buffer is not enabled
+func InitTransferBuffer() {
+	bufferConfig := Config().Transfer.Buffer
+	if bufferConfig == nil || !bufferConfig.Enabled {
+		return
+	}
+
+	dir := bufferConfig.Dir
+	if dir == "" {
+		dir = defaultBufferDir
+	}
+	maxSizeMB := bufferConfig.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultBufferMaxSizeMB
+	}
+	segmentSizeMB := bufferConfig.SegmentSizeMB
+	if segmentSizeMB <= 0 {
+		segmentSizeMB = defaultBufferSegmentSizeMB
+	}
+
+	queue, err := spill.Open(dir, maxSizeMB<<20, segmentSizeMB<<20)
+	if err != nil {
+		log.Fatalln("open buffer of transfer:", dir, "fail:", err)
+	}
+	if queue.Len() > 0 {
+		log.Warnf("Buffer of transfer[%s] has %d batch(es) to be replayed", dir, queue.Len())
+	}
+
+	transferBuffer = queue
+
+	go replayTransferBuffer(
+		durationOfMs(bufferConfig.ReplayInterval, defaultBufferReplayInterval),
+		durationOfMs(bufferConfig.RetryInterval, defaultBufferRetryInterval),
+	)
+}
+
+func GetTransferBufferStatus() *TransferBufferStatus {
+	status := &TransferBufferStatus{
+		Enabled: transferBuffer != nil,
+		Dropped: atomic.LoadInt64(&transferBufferDropped),
+	}
+	if transferBuffer != nil {
+		status.Batches = transferBuffer.Len()
+		status.Bytes = transferBuffer.Size()
+	}
+
+	return status
+}
+
+// Whether or not there are buffered metrics waiting for replaying
+func hasBufferedMetrics() bool {
+	return transferBuffer != nil && transferBuffer.Len() > 0
+}
+
+// Appends the metrics to the buffer(if enabled), the metrics are dropped if the buffer is full
+func bufferMetrics(metrics []*model.MetricValue) {
+	if transferBuffer == nil {
+		return
+	}
+
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		dropMetrics(len(metrics), err.Error())
+		return
+	}
+
+	if err := transferBuffer.Push(data); err != nil {
+		dropMetrics(len(metrics), err.Error())
+	}
+}
+
+func dropMetrics(count int, reason string) {
+	atomic.AddInt64(&transferBufferDropped, int64(count))
+	log.Warnf("Drop %d metric(s) since all of the transfers are unreachable: %s", count, reason)
+}
+
+// Replays the buffered metrics by order(oldest first), one batch per "replayInterval".
+//
+// If all of the transfers are still unreachable, waits for "retryInterval".
+func replayTransferBuffer(replayInterval time.Duration, retryInterval time.Duration) {
+	for {
+		data, err := transferBuffer.Peek()
+		if err != nil {
+			log.Errorf("Read buffer of transfer has error: %v. Skip the batch", err)
+			if err := transferBuffer.Pop(); err != nil {
+				log.Errorf("Skip batch of buffer has error: %v", err)
+				time.Sleep(retryInterval)
+			}
+			continue
+		}
+		if data == nil {
+			time.Sleep(replayInterval)
+			continue
+		}
+
+		metrics := make([]*model.MetricValue, 0)
+		if err := json.Unmarshal(data, &metrics); err != nil {
+			log.Errorf("Decode batch of buffer has error: %v. Skip the batch", err)
+			transferBuffer.Pop()
+			continue
+		}
+
+		var resp model.TransferResponse
+		if !sendMetricsToAnyTransfer(metrics, &resp) {
+			time.Sleep(retryInterval)
+			continue
+		}
+
+		if err := transferBuffer.Pop(); err != nil {
+			log.Errorf("Remove replayed batch from buffer has error: %v", err)
+		}
+		if Config().Debug {
+			log.Printf("Replayed %d buffered metric(s). Remaining batches: %d", len(metrics), transferBuffer.Len())
+		}
+
+		time.Sleep(replayInterval)
+	}
+}
+
+func durationOfMs(ms int, defaultMs int) time.Duration {
+	if ms <= 0 {
+		ms = defaultMs
+	}
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,71 @@
+package g
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/spill"
+)
+
+func TestBufferMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	transferBuffer, err = spill.Open(dir, 512, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		transferBuffer.Close()
+		transferBuffer = nil
+		transferBufferDropped = 0
+	}()
+
+	newMetrics := func(value int) []*model.MetricValue {
+		return []*model.MetricValue{
+			{Endpoint: "host-1", Metric: "cpu.idle", Value: value, Step: 60, Type: "GAUGE", Timestamp: 1500000000},
+		}
+	}
+
+	bufferMetrics(newMetrics(1))
+	if !hasBufferedMetrics() {
+		t.Fatalf("Metrics should be buffered")
+	}
+
+	/**
+	 * New metrics are appended to the buffer while there are buffered metrics(without sending)
+	 */
+	var resp model.TransferResponse
+	SendMetrics(newMetrics(2), &resp)
+
+	status := GetTransferBufferStatus()
+	if !status.Enabled || status.Batches != 2 || status.Dropped != 0 {
+		t.Fatalf("Unexpected status of buffer: %#v", status)
+	}
+	// :~)
+
+	/**
+	 * The metrics are dropped if the buffer is full
+	 */
+	for i := 0; i < 10; i++ {
+		bufferMetrics(newMetrics(i))
+	}
+	if status := GetTransferBufferStatus(); status.Dropped == 0 || status.Bytes > 512 {
+		t.Fatalf("Metrics should be dropped if the buffer is full: %#v", status)
+	}
+	// :~)
+
+	/**
+	 * The oldest batch is read first
+	 */
+	data, _ := transferBuffer.Peek()
+	if expected := `[{"endpoint":"host-1","metric":"cpu.idle","value":1,"step":60,"counterType":"GAUGE","tags":"","timestamp":1500000000}]`; string(data) != expected {
+		t.Errorf("Unexpected oldest batch: %s", data)
+	}
+	// :~)
+}
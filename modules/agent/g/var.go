@@ -1,12 +1,15 @@
 package g
 
 import (
+	"fmt"
 	"github.com/fwtpe/owl-backend/common/model"
 	n "github.com/fwtpe/owl-backend/common/net"
 	log "github.com/sirupsen/logrus"
 	"github.com/toolkits/net"
 	"github.com/toolkits/slice"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -145,6 +148,68 @@ func SetReportProcs(procs map[string]map[int]string) {
 	reportProcs = procs
 }
 
+var (
+	reportLogPatterns     []*LogPattern
+	reportLogPatternsLock = new(sync.RWMutex)
+)
+
+func ReportLogPatterns() []*LogPattern {
+	reportLogPatternsLock.RLock()
+	defer reportLogPatternsLock.RUnlock()
+	return reportLogPatterns
+}
+
+func SetReportLogPatterns(patterns []*LogPattern) {
+	reportLogPatternsLock.Lock()
+	defer reportLogPatternsLock.Unlock()
+	reportLogPatterns = patterns
+}
+
+// Parses the tags of builtin metric "log.match" assigned by heartbeat,
+// e.g. "name=oom,file=/var/log/app/*.log,regex=OutOfMemory".
+//
+// The values are unescaped by URL encoding, so the "," and "=" could be written as "%2C" and "%3D".
+// All of the tags(in original form) are kept as tags of the metric, so the strategy matches the metric.
+func ParseLogPatternOfTags(tags string) (*LogPattern, error) {
+	pattern := &LogPattern{Tags: make(map[string]string)}
+
+	for _, pair := range strings.Split(tags, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid tag: %q", pair)
+		}
+
+		key, rawValue := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		pattern.Tags[key] = rawValue
+
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unescape value of tag %q: %v", key, err)
+		}
+
+		switch key {
+		case "name":
+			pattern.Name = value
+		case "file":
+			pattern.File = value
+		case "regex":
+			pattern.Regex = value
+		case "group":
+			if pattern.Group, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid group: %q", value)
+			}
+		case "aggregate":
+			pattern.Aggregate = value
+		}
+	}
+
+	if pattern.Name == "" || pattern.File == "" || pattern.Regex == "" {
+		return nil, fmt.Errorf("\"name\", \"file\" and \"regex\" are required. Tags: %q", tags)
+	}
+
+	return pattern, nil
+}
+
 var (
 	ips     []string
 	ipsLock = new(sync.Mutex)
@@ -0,0 +1,35 @@
+package g
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLogPatternOfTags(t *testing.T) {
+	pattern, err := ParseLogPatternOfTags("name=slow,file=/var/log/app/*.log,regex=cost%3D(%5Cd%2B)ms,group=1,aggregate=max")
+	if err != nil {
+		t.Fatalf("ParseLogPatternOfTags() has error: %v", err)
+	}
+
+	expected := &LogPattern{
+		Name: "slow", File: "/var/log/app/*.log", Regex: `cost=(\d+)ms`, Group: 1, Aggregate: "max",
+		Tags: map[string]string{
+			"name": "slow", "file": "/var/log/app/*.log", "regex": "cost%3D(%5Cd%2B)ms", "group": "1", "aggregate": "max",
+		},
+	}
+	if !reflect.DeepEqual(pattern, expected) {
+		t.Errorf("Expected: %#v. Got: %#v", expected, pattern)
+	}
+
+	invalidTags := []string{
+		"name=oom,file=/var/log/app.log",
+		"name=oom,file=/var/log/app.log,regex=OOM,group=a",
+		"name=oom,file=/var/log/app.log,regex=%ZZ",
+		"name=oom,file",
+	}
+	for _, tags := range invalidTags {
+		if _, err := ParseLogPatternOfTags(tags); err == nil {
+			t.Errorf("Expected error for tags: %s", tags)
+		}
+	}
+}
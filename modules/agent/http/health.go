@@ -7,6 +7,12 @@ import (
 
 func configHealthRoutes() {
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		// Renders status of transfer buffer only if it is enabled, for compatibility of health checking
+		if status := g.GetTransferBufferStatus(); status.Enabled {
+			RenderJson(w, Dto{Msg: "ok", Data: map[string]interface{}{"transferBuffer": status}})
+			return
+		}
+
 		w.Write([]byte("ok"))
 	})
 
@@ -32,6 +32,7 @@ func main() {
 	g.InitRootDir()
 	g.InitPublicIps()
 	g.InitRpcClients()
+	g.InitTransferBuffer()
 
 	funcs.BuildMappers()
 
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/fwtpe/owl-backend/common/model"
 	"github.com/fwtpe/owl-backend/common/utils"
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
 	"github.com/fwtpe/owl-backend/modules/alarm/g"
+	"strings"
 )
 
 func BuildCommonSMSContent(event *model.Event) string {
@@ -110,18 +112,27 @@ func BuildCommonQQContent(event *model.Event) string {
 	)
 }
 
-func GenerateSmsContent(event *model.Event) string {
-	return BuildCommonSMSContent(event)
+// 聊天工具使用\n换行
+func BuildCommonChatContent(event *model.Event) string {
+	return strings.Replace(BuildCommonQQContent(event), "\r\n", "\n", -1)
 }
 
-func GenerateMailContent(event *model.Event) string {
-	return BuildCommonMailContent(event)
+func GenerateSmsContent(event *model.Event, action *api.Action) string {
+	return renderContent(TemplateSms, event, action, BuildCommonSMSContent)
 }
 
-func GenerateQQContent(event *model.Event) string {
-	return BuildCommonQQContent(event)
+func GenerateMailContent(event *model.Event, action *api.Action) string {
+	return renderContent(TemplateMail, event, action, BuildCommonMailContent)
 }
 
-func GenerateServerchanContent(event *model.Event) string {
-	return BuildCommonQQContent(event)
+func GenerateQQContent(event *model.Event, action *api.Action) string {
+	return renderContent(TemplateQQ, event, action, BuildCommonQQContent)
+}
+
+func GenerateServerchanContent(event *model.Event, action *api.Action) string {
+	return renderContent(TemplateServerchan, event, action, BuildCommonQQContent)
+}
+
+func GenerateChatContent(event *model.Event, action *api.Action) string {
+	return renderContent(TemplateChat, event, action, BuildCommonChatContent)
 }
@@ -14,13 +14,11 @@ func HandleCallback(event *model.Event, action *api.Action) {
 
 	// falcon,dinp
 	teams := action.Uic
-	phones := []string{}
-	mails := []string{}
 
 	if teams != "" {
-		phones, mails = api.ParseTeams(teams)
-		smsContent := GenerateSmsContent(event)
-		mailContent := GenerateMailContent(event)
+		phones, mails := api.ParseTeams(teams)
+		smsContent := GenerateSmsContent(event, action)
+		mailContent := GenerateMailContent(event, action)
 		if action.BeforeCallbackSms == 1 {
 			redis.WriteSms(phones, smsContent)
 		}
@@ -30,18 +28,32 @@ func HandleCallback(event *model.Event, action *api.Action) {
 		}
 	}
 
+	// webhook在送出(或放弃重试)之后才通知结果
+	if webhookEnabled() {
+		if err := enqueueWebhook(event, action); err != nil {
+			log.Errorf("enqueue webhook of event %s fail: %v", event.Id, err)
+			afterCallback(action, fmt.Sprintf("enqueue webhook %s fail:%s", action.Url, err.Error()))
+		}
+		return
+	}
+
 	message := Callback(event, action)
+	afterCallback(action, message)
+}
 
-	if teams != "" {
-		if action.AfterCallbackSms == 1 {
-			redis.WriteSms(phones, message)
-		}
+func afterCallback(action *api.Action, message string) {
+	if action.Uic == "" || (action.AfterCallbackSms != 1 && action.AfterCallbackMail != 1) {
+		return
+	}
 
-		if action.AfterCallbackMail == 1 {
-			redis.WriteMail(mails, message, message)
-		}
+	phones, mails := api.ParseTeams(action.Uic)
+	if action.AfterCallbackSms == 1 {
+		redis.WriteSms(phones, message)
 	}
 
+	if action.AfterCallbackMail == 1 {
+		redis.WriteMail(mails, message, message)
+	}
 }
 
 func Callback(event *model.Event, action *api.Action) string {
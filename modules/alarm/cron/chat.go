@@ -0,0 +1,59 @@
+package cron
+
+import (
+	"strings"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/g"
+	"github.com/fwtpe/owl-backend/modules/alarm/redis"
+	smodel "github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+// 依照action的团队发送到聊天工具，由sender中同名的chat渠道送出。
+// 聊天室是团队共用的，不做报警合并；多个团队使用同一个聊天室时只发送一次
+func ParseTeamChats(event *model.Event, action *api.Action) {
+	for queue, chats := range BuildTeamChats(event, action) {
+		for _, chat := range chats {
+			redis.WriteChatModel(queue, chat)
+		}
+	}
+}
+
+// 按照队列分组的消息
+func BuildTeamChats(event *model.Event, action *api.Action) map[string][]*smodel.Chat {
+	result := map[string][]*smodel.Chat{}
+
+	config := g.Config().Chat
+	if config == nil || len(config.Routes) == 0 {
+		return result
+	}
+
+	subject := GenerateSmsContent(event, action)
+	content := GenerateChatContent(event, action)
+
+	sent := map[string]bool{}
+	for _, team := range strings.Split(action.Uic, ",") {
+		for _, route := range config.Routes[team] {
+			queue := config.Queues[route.Channel]
+			if queue == "" {
+				log.Errorf("queue of chat channel %q is not configured. team: %s", route.Channel, team)
+				continue
+			}
+			key := route.Channel + "/" + route.Route
+			if sent[key] {
+				continue
+			}
+			sent[key] = true
+
+			result[queue] = append(result[queue], &smodel.Chat{
+				Target:  team,
+				Route:   route.Route,
+				Status:  event.Status,
+				Subject: subject,
+				Content: content,
+			})
+		}
+	}
+	return result
+}
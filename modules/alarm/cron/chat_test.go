@@ -0,0 +1,48 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/g"
+)
+
+func TestBuildTeamChats(t *testing.T) {
+	g.ParseConfig("../test_cfg.json")
+	g.Config().Chat = &g.ChatConfig{
+		Queues: map[string]string{"dingtalk": "/chat/dingtalk", "slack": "/chat/slack"},
+		Routes: map[string][]*g.ChatRoute{
+			"ops": {
+				{Channel: "dingtalk", Route: "ops"},
+				{Channel: "slack", Route: "ops"},
+			},
+			// 与ops共用聊天室
+			"dba":   {{Channel: "slack", Route: "ops"}},
+			"other": {{Channel: "unknown", Route: "other"}},
+		},
+	}
+	defer func() {
+		g.Config().Chat = nil
+	}()
+
+	event := SampleEvent()
+	chats := BuildTeamChats(event, &api.Action{Id: 1, Uic: "dba,ops,other,nobody"})
+
+	if len(chats) != 2 || len(chats["/chat/dingtalk"]) != 1 || len(chats["/chat/slack"]) != 1 {
+		t.Fatalf("Unexpected chats: %v", chats)
+	}
+	if chat := chats["/chat/slack"][0]; chat.Target != "dba" {
+		t.Errorf("Expected the first team sharing the room. Got: %s", chat.Target)
+	}
+
+	chat := chats["/chat/dingtalk"][0]
+	if chat.Target != "ops" || chat.Route != "ops" || chat.Status != event.Status ||
+		!strings.HasPrefix(chat.Subject, "[P") || strings.Contains(chat.Content, "\r\n") {
+		t.Errorf("Unexpected chat: %#v", chat)
+	}
+
+	if chats := BuildTeamChats(event, &api.Action{Id: 1, Uic: "nobody"}); len(chats) != 0 {
+		t.Errorf("Expected no chats. Got: %v", chats)
+	}
+}
@@ -9,6 +9,14 @@ import (
 )
 
 func consume(event *model.Event, isHigh bool) {
+	// 被静默的event恢复时也要停止升级
+	if event.Status == "OK" {
+		StopEscalation(event.Id)
+	}
+	if isSilenced(event) {
+		return
+	}
+
 	actionId := event.ActionId()
 	if actionId <= 0 {
 		return
@@ -18,6 +26,7 @@ func consume(event *model.Event, isHigh bool) {
 	if action == nil {
 		return
 	}
+	trackEscalation(event, action)
 
 	if action.Callback == 1 {
 		HandleCallback(event, action)
@@ -39,9 +48,9 @@ func consumeHighEvents(event *model.Event, action *api.Action) {
 
 	phones, mails := api.ParseTeams(action.Uic)
 
-	smsContent := GenerateSmsContent(event)
-	mailContent := GenerateMailContent(event)
-	QQContent := GenerateQQContent(event)
+	smsContent := GenerateSmsContent(event, action)
+	mailContent := GenerateMailContent(event, action)
+	QQContent := GenerateQQContent(event, action)
 
 	if event.Priority() < 3 {
 		redis.WriteSms(phones, smsContent)
@@ -50,6 +59,7 @@ func consumeHighEvents(event *model.Event, action *api.Action) {
 	redis.WriteMail(mails, smsContent, mailContent)
 	redis.WriteQQ(mails, smsContent, QQContent)
 	ParseUserServerchan(event, action)
+	ParseTeamChats(event, action)
 }
 
 // 低优先级的做报警合并
@@ -65,12 +75,13 @@ func consumeLowEvents(event *model.Event, action *api.Action) {
 	ParseUserMail(event, action)
 	ParseUserQQ(event, action)
 	ParseUserServerchan(event, action)
+	ParseTeamChats(event, action)
 }
 
 func ParseUserSms(event *model.Event, action *api.Action) {
 	userMap := api.GetUsers(action.Uic)
 
-	content := GenerateSmsContent(event)
+	content := GenerateSmsContent(event, action)
 	metric := event.Metric()
 	status := event.Status
 	priority := event.Priority()
@@ -110,8 +121,8 @@ func ParseUserMail(event *model.Event, action *api.Action) {
 	userMap := api.GetUsers(action.Uic)
 
 	metric := event.Metric()
-	subject := GenerateSmsContent(event)
-	content := GenerateMailContent(event)
+	subject := GenerateSmsContent(event, action)
+	content := GenerateMailContent(event, action)
 	status := event.Status
 	priority := event.Priority()
 
@@ -146,8 +157,8 @@ func ParseUserQQ(event *model.Event, action *api.Action) {
 	userMap := api.GetUsers(action.Uic)
 
 	metric := event.Metric()
-	subject := GenerateSmsContent(event)
-	content := GenerateQQContent(event)
+	subject := GenerateSmsContent(event, action)
+	content := GenerateQQContent(event, action)
 	status := event.Status
 	priority := event.Priority()
 
@@ -181,8 +192,8 @@ func ParseUserQQ(event *model.Event, action *api.Action) {
 func ParseUserServerchan(event *model.Event, action *api.Action) {
 	userMap := api.GetUsers(action.Uic)
 	metric := event.Metric()
-	subject := GenerateSmsContent(event)
-	content := GenerateServerchanContent(event)
+	subject := GenerateSmsContent(event, action)
+	content := GenerateServerchanContent(event, action)
 	status := event.Status
 	priority := event.Priority()
 
@@ -0,0 +1,179 @@
+package cron
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/model/escalation"
+	eventmodel "github.com/fwtpe/owl-backend/modules/alarm/model/event"
+	"github.com/fwtpe/owl-backend/modules/alarm/model/silence"
+	"github.com/fwtpe/owl-backend/modules/alarm/redis"
+)
+
+// 尚未被确认的event，按照报警接收组(action)的升级策略逐级通知
+type pendingEscalation struct {
+	event *model.Event
+	steps []*escalation.Step
+	start time.Time
+	// 最后一次收到这个event的时间
+	updated time.Time
+	// 下一个要执行的step
+	next int
+}
+
+// 所有step都执行过的event会继续保留（重复的PROBLEM不会重新升级），直到恢复、被确认，
+// 或者这么久没有再收到这个event
+const completedEscalationTTL = 24 * time.Hour
+
+type dueStep struct {
+	event *model.Event
+	step  *escalation.Step
+}
+
+type escalationList struct {
+	sync.Mutex
+	m map[string]*pendingEscalation
+}
+
+var escalations = &escalationList{m: make(map[string]*pendingEscalation)}
+
+// 同一个event重复报警时，只更新event的内容，不重新计时
+func (this *escalationList) start(event *model.Event, steps []*escalation.Step, now time.Time) {
+	this.Lock()
+	defer this.Unlock()
+
+	if pending, ok := this.m[event.Id]; ok {
+		pending.event, pending.updated = event, now
+		return
+	}
+	this.m[event.Id] = &pendingEscalation{event: event, steps: steps, start: now, updated: now}
+}
+
+func (this *escalationList) stop(eventId string) bool {
+	this.Lock()
+	defer this.Unlock()
+
+	_, ok := this.m[eventId]
+	delete(this.m, eventId)
+	return ok
+}
+
+// 取出到期的step
+func (this *escalationList) popDue(now time.Time) []*dueStep {
+	this.Lock()
+	defer this.Unlock()
+
+	due := []*dueStep{}
+	for id, pending := range this.m {
+		for ; pending.next < len(pending.steps); pending.next++ {
+			step := pending.steps[pending.next]
+			if now.Before(pending.start.Add(time.Duration(step.Delay) * time.Minute)) {
+				break
+			}
+			due = append(due, &dueStep{pending.event, step})
+		}
+		if pending.next >= len(pending.steps) && now.Sub(pending.updated) > completedEscalationTTL {
+			delete(this.m, id)
+		}
+	}
+	return due
+}
+
+func (this *escalationList) size() int {
+	this.Lock()
+	defer this.Unlock()
+	return len(this.m)
+}
+
+var (
+	isEventAcked     = eventmodel.IsAcked
+	notifyEscalation = notifyEscalationStep
+)
+
+func SyncEscalationPolicies() {
+	for {
+		// 每分钟重新加载一次，API修改升级策略之后会立即重新加载
+		if err := escalation.Policies.Reload(); err != nil {
+			log.Errorf("reload escalation policies fail: %v", err)
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+func Escalate() {
+	for {
+		time.Sleep(10 * time.Second)
+		escalate(time.Now())
+	}
+}
+
+// 只有PROBLEM的event需要升级，恢复(OK)之后停止
+func trackEscalation(event *model.Event, action *api.Action) {
+	if event.Status == "OK" {
+		escalations.stop(event.Id)
+		return
+	}
+
+	steps := escalation.Policies.Get(action.Id)
+	if len(steps) == 0 {
+		return
+	}
+	escalations.start(event, steps, time.Now())
+}
+
+// 被确认的event停止升级
+func StopEscalation(eventId string) bool {
+	return escalations.stop(eventId)
+}
+
+// 被静默的event跳过到期的step
+func escalate(now time.Time) {
+	for _, due := range escalations.popDue(now) {
+		if matched := silence.Silences.Match(due.event, now); matched != nil {
+			log.Debugf("event %s is silenced by silence %d, skip level %d of escalation", due.event.Id, matched.Id, due.step.Level)
+			continue
+		}
+
+		acked, err := isEventAcked(due.event.Id)
+		if err != nil {
+			log.Errorf("check acknowledgement of event %s fail: %v", due.event.Id, err)
+		}
+		if acked {
+			log.Debugf("event %s is acknowledged, stop escalation", due.event.Id)
+			escalations.stop(due.event.Id)
+			continue
+		}
+
+		log.Infof("escalate event %s to level %d of action %d", due.event.Id, due.step.Level, due.step.ActionId)
+		notifyEscalation(due.event, due.step)
+	}
+}
+
+func notifyEscalationStep(event *model.Event, step *escalation.Step) {
+	if step.Uic != "" {
+		action := &api.Action{Id: step.ActionId, Uic: step.Uic}
+		prefix := fmt.Sprintf("[Escalation L%d]", step.Level)
+		phones, mails := api.ParseTeams(step.Uic)
+		smsContent := prefix + GenerateSmsContent(event, action)
+
+		for _, channel := range step.ChannelList() {
+			switch channel {
+			case escalation.ChannelSms:
+				redis.WriteSms(phones, smsContent)
+			case escalation.ChannelMail:
+				redis.WriteMail(mails, smsContent, GenerateMailContent(event, action))
+			case escalation.ChannelQQ:
+				redis.WriteQQ(mails, smsContent, GenerateQQContent(event, action))
+			case escalation.ChannelServerchan:
+				ParseUserServerchan(event, action)
+			}
+		}
+	}
+
+	if step.Url != "" {
+		log.Info(Callback(event, &api.Action{Url: step.Url}))
+	}
+}
@@ -0,0 +1,182 @@
+package cron
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/model/escalation"
+	"github.com/fwtpe/owl-backend/modules/alarm/model/silence"
+)
+
+func TestEscalate(t *testing.T) {
+	acked := map[string]bool{}
+	notified := []string{}
+
+	defer func(oldAcked func(string) (bool, error), oldNotify func(*model.Event, *escalation.Step)) {
+		isEventAcked, notifyEscalation = oldAcked, oldNotify
+		escalations = &escalationList{m: make(map[string]*pendingEscalation)}
+		escalation.Policies.Set(map[int][]*escalation.Step{})
+	}(isEventAcked, notifyEscalation)
+
+	isEventAcked = func(eventId string) (bool, error) {
+		return acked[eventId], nil
+	}
+	notifyEscalation = func(event *model.Event, step *escalation.Step) {
+		notified = append(notified, fmt.Sprintf("%s:L%d", event.Id, step.Level))
+	}
+	escalation.Policies.Set(map[int][]*escalation.Step{
+		1: {
+			{ActionId: 1, Level: 1, Delay: 5, Uic: "team-a"},
+			{ActionId: 1, Level: 2, Delay: 15, Uic: "team-b", Channels: "sms"},
+		},
+	})
+
+	action := &api.Action{Id: 1}
+	trackEscalation(&model.Event{Id: "s_1_a", Status: "PROBLEM"}, action)
+	trackEscalation(&model.Event{Id: "s_1_b", Status: "PROBLEM"}, action)
+	trackEscalation(&model.Event{Id: "s_1_c", Status: "PROBLEM"}, action)
+	// No policy
+	trackEscalation(&model.Event{Id: "s_2_a", Status: "PROBLEM"}, &api.Action{Id: 2})
+	start := time.Now()
+
+	testCases := []*struct {
+		after    time.Duration
+		setup    func()
+		expected []string
+	}{
+		{time.Minute, nil, []string{}},
+		{5 * time.Minute, nil, []string{"s_1_a:L1", "s_1_b:L1", "s_1_c:L1"}},
+		// Acknowledged and recovered
+		{15 * time.Minute, func() {
+			acked["s_1_b"] = true
+			trackEscalation(&model.Event{Id: "s_1_c", Status: "OK"}, action)
+		}, []string{"s_1_a:L2"}},
+		{30 * time.Minute, nil, []string{}},
+		// The completed escalation is not restarted by the repeated event
+		{45 * time.Minute, func() {
+			trackEscalation(&model.Event{Id: "s_1_a", Status: "PROBLEM"}, action)
+		}, []string{}},
+	}
+	for i, testCase := range testCases {
+		notified = []string{}
+		if testCase.setup != nil {
+			testCase.setup()
+		}
+
+		escalate(start.Add(testCase.after))
+		if !equalSet(notified, testCase.expected) {
+			t.Errorf("[%d] Expected: %v. Got: %v", i, testCase.expected, notified)
+		}
+	}
+
+	if size := escalations.size(); size != 1 {
+		t.Errorf("Expected only the completed escalation. Got: %d", size)
+	}
+	escalate(start.Add(completedEscalationTTL + time.Hour))
+	if size := escalations.size(); size != 0 {
+		t.Errorf("Expected no pending escalation. Got: %d", size)
+	}
+}
+
+func TestEscalationOfSilencedEvent(t *testing.T) {
+	notified := []string{}
+
+	defer func(oldAcked func(string) (bool, error), oldNotify func(*model.Event, *escalation.Step), oldRecord func(string, int64) error) {
+		isEventAcked, notifyEscalation, recordSuppressed = oldAcked, oldNotify, oldRecord
+		escalations = &escalationList{m: make(map[string]*pendingEscalation)}
+		escalation.Policies.Set(map[int][]*escalation.Step{})
+		silence.Silences.Set(nil)
+	}(isEventAcked, notifyEscalation, recordSuppressed)
+
+	isEventAcked = func(eventId string) (bool, error) { return false, nil }
+	notifyEscalation = func(event *model.Event, step *escalation.Step) {
+		notified = append(notified, fmt.Sprintf("%s:L%d", event.Id, step.Level))
+	}
+	recordSuppressed = func(eventCaseId string, silenceId int64) error { return nil }
+	escalation.Policies.Set(map[int][]*escalation.Step{
+		1: {
+			{ActionId: 1, Level: 1, Delay: 5, Uic: "team-a"},
+			{ActionId: 1, Level: 2, Delay: 15, Uic: "team-b"},
+		},
+	})
+
+	newEvent := func(id string, endpoint string, status string) *model.Event {
+		return &model.Event{
+			Id: id, Endpoint: endpoint, Status: status,
+			Expression: &model.Expression{Id: 5, Metric: "disk.io.util", ActionId: 1, Priority: 2},
+		}
+	}
+
+	action := &api.Action{Id: 1}
+	trackEscalation(newEvent("e_5_a", "host-1", "PROBLEM"), action)
+	trackEscalation(newEvent("e_5_b", "host-2", "PROBLEM"), action)
+	start := time.Now()
+
+	// The silence is created after the escalation has started
+	silence.Silences.Set([]*silence.Silence{
+		{Id: 1, Endpoint: "host-1", Priority: -1, StartTime: start.Add(-time.Hour), EndTime: start.Add(time.Hour)},
+	})
+	escalate(start.Add(5 * time.Minute))
+	if expected := []string{"e_5_b:L1"}; !equalSet(notified, expected) {
+		t.Errorf("Expected: %v. Got: %v", expected, notified)
+	}
+
+	// The silenced OK event still stops the escalation
+	consume(newEvent("e_5_a", "host-1", "OK"), true)
+	if _, ok := escalations.m["e_5_a"]; ok {
+		t.Errorf("Expected the escalation of recovered event to be stopped")
+	}
+}
+
+func TestRepeatedEventKeepsEscalationTime(t *testing.T) {
+	list := &escalationList{m: make(map[string]*pendingEscalation)}
+	steps := []*escalation.Step{{Level: 1, Delay: 10}}
+	start := time.Now()
+
+	list.start(&model.Event{Id: "s_1_a", CurrentStep: 1}, steps, start)
+	list.start(&model.Event{Id: "s_1_a", CurrentStep: 2}, steps, start.Add(5*time.Minute))
+
+	due := list.popDue(start.Add(10 * time.Minute))
+	if len(due) != 1 || due[0].event.CurrentStep != 2 {
+		t.Errorf("Expected the latest event to be escalated at 10 minutes. Got: %v", due)
+	}
+}
+
+func TestStepFormat(t *testing.T) {
+	testCases := []*struct {
+		step     *escalation.Step
+		expected bool
+	}{
+		{&escalation.Step{Delay: 5, Uic: "team-a"}, true},
+		{&escalation.Step{Delay: 5, Url: "http://127.0.0.1/hook"}, true},
+		{&escalation.Step{Delay: 5, Uic: "team-a", Channels: "sms, serverchan"}, true},
+		{&escalation.Step{Delay: 0, Uic: "team-a"}, false},
+		{&escalation.Step{Delay: 5}, false},
+		{&escalation.Step{Delay: 5, Uic: "team-a", Channels: "sms,fax"}, false},
+	}
+	for i, testCase := range testCases {
+		if err := testCase.step.CheckFormat(); (err == nil) != testCase.expected {
+			t.Errorf("[%d] Expected valid: %v. Got error: %v", i, testCase.expected, err)
+		}
+	}
+}
+
+func equalSet(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	m := make(map[string]bool)
+	for _, v := range a {
+		m[v] = true
+	}
+	for _, v := range b {
+		if !m[v] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/alarm/model/silence"
+)
+
+func SyncSilences() {
+	for {
+		// 每分钟重新加载一次，API修改静默规则之后会立即重新加载
+		if err := silence.Silences.Reload(); err != nil {
+			log.Errorf("reload silences fail: %v", err)
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// 可以在测试中替换
+var recordSuppressed = silence.RecordSuppressed
+
+// 匹配静默规则的event不发送任何通知，只在event记录中标记
+func isSilenced(event *model.Event) bool {
+	matched := silence.Silences.Match(event, time.Now())
+	if matched == nil {
+		return false
+	}
+
+	log.Debugf("event %s is silenced by silence %d", event.Id, matched.Id)
+	if err := recordSuppressed(event.Id, matched.Id); err != nil {
+		log.Error(err.Error())
+	}
+	return true
+}
@@ -0,0 +1,260 @@
+package cron
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/utils"
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/g"
+)
+
+// 通知的渠道，也是模板的文件名(<channel>.tmpl)
+const (
+	TemplateSms        = "sms"
+	TemplateMail       = "mail"
+	TemplateQQ         = "qq"
+	TemplateServerchan = "serverchan"
+	TemplateChat       = "chat"
+)
+
+const (
+	templateExt  = ".tmpl"
+	defaultScope = "default"
+	actionPrefix = "action-"
+	teamPrefix   = "team-"
+)
+
+// 模板可以使用event的所有字段和方法(如 .Endpoint, .Metric, .Priority)，以及下面的字段
+type TemplateData struct {
+	*model.Event
+	Action     *api.Action
+	Link       string
+	Tags       map[string]string
+	SortedTags string
+}
+
+func NewTemplateData(event *model.Event, action *api.Action) *TemplateData {
+	tags := event.PushedTags
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	if action == nil {
+		action = &api.Action{}
+	}
+
+	return &TemplateData{
+		Event:      event,
+		Action:     action,
+		Link:       g.Link(event),
+		Tags:       tags,
+		SortedTags: utils.SortedTags(event.PushedTags),
+	}
+}
+
+var templateFuncs = map[string]interface{}{
+	"readable":   utils.ReadableFloat,
+	"sortedTags": utils.SortedTags,
+	"formatTime": func(ts int64, layout string) string {
+		return time.Unix(ts, 0).Format(layout)
+	},
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"join":      strings.Join,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"default": func(defaultValue string, value string) string {
+		if value == "" {
+			return defaultValue
+		}
+		return value
+	},
+}
+
+// *text/template.Template or *html/template.Template
+type ContentTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// 模板按照"<scope>/<channel>"索引，scope为"default", "action-<id>"或"team-<name>"
+type TemplateCache struct {
+	sync.RWMutex
+	templates map[string]ContentTemplate
+}
+
+var Templates = &TemplateCache{templates: make(map[string]ContentTemplate)}
+
+func (this *TemplateCache) get(scope string, channel string) ContentTemplate {
+	this.RLock()
+	defer this.RUnlock()
+	return this.templates[scope+"/"+channel]
+}
+
+func (this *TemplateCache) set(templates map[string]ContentTemplate) {
+	this.Lock()
+	defer this.Unlock()
+	this.templates = templates
+}
+
+func (this *TemplateCache) Names() []string {
+	this.RLock()
+	defer this.RUnlock()
+
+	names := make([]string, 0, len(this.templates))
+	for name := range this.templates {
+		names = append(names, name)
+	}
+	return names
+}
+
+// 从目录中载入所有的模板，有错误的模板不会被载入
+func (this *TemplateCache) Load(dir string) error {
+	templates := make(map[string]ContentTemplate)
+	if dir == "" {
+		this.set(templates)
+		return nil
+	}
+
+	scopes, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if !scope.IsDir() {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(dir, scope.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != templateExt {
+				continue
+			}
+
+			channel := strings.TrimSuffix(file.Name(), templateExt)
+			name := scope.Name() + "/" + channel
+			tpl, err := readTemplate(filepath.Join(dir, name+templateExt), channel)
+			if err != nil {
+				log.Errorf("load template %s fail: %v", name, err)
+				continue
+			}
+			templates[name] = tpl
+		}
+	}
+
+	this.set(templates)
+	return nil
+}
+
+// 文件最后的换行会被忽略
+func readTemplate(path string, channel string) (ContentTemplate, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTemplate(channel, strings.TrimSuffix(string(text), "\n"))
+}
+
+// 邮件使用html/template，其他的渠道使用text/template
+func ParseTemplate(channel string, text string) (ContentTemplate, error) {
+	if channel == TemplateMail {
+		return htmltemplate.New(channel).Funcs(templateFuncs).Parse(text)
+	}
+	return template.New(channel).Funcs(templateFuncs).Parse(text)
+}
+
+// 按照 action-<id>, team-<name>(action中的组依序), default 的顺序寻找模板
+func (this *TemplateCache) Lookup(channel string, action *api.Action) ContentTemplate {
+	if action != nil {
+		if tpl := this.get(fmt.Sprintf("%s%d", actionPrefix, action.Id), channel); tpl != nil {
+			return tpl
+		}
+		for _, team := range strings.Split(action.Uic, ",") {
+			if team = strings.TrimSpace(team); team == "" {
+				continue
+			}
+			if tpl := this.get(teamPrefix+team, channel); tpl != nil {
+				return tpl
+			}
+		}
+	}
+	return this.get(defaultScope, channel)
+}
+
+func SyncTemplates() {
+	for {
+		// 每分钟重新加载一次，修改模板文件不需要重启
+		time.Sleep(time.Minute)
+		LoadTemplates()
+	}
+}
+
+func LoadTemplates() {
+	dir := ""
+	if g.Config().Template != nil {
+		dir = g.Config().Template.Dir
+	}
+	if err := Templates.Load(dir); err != nil {
+		log.Errorf("load templates in %s fail: %v", dir, err)
+	}
+}
+
+// 没有模板或者模板执行失败时，使用内建的格式(Build*Content)
+func renderContent(channel string, event *model.Event, action *api.Action, builtin func(*model.Event) string) string {
+	tpl := Templates.Lookup(channel, action)
+	if tpl == nil {
+		return builtin(event)
+	}
+
+	content, err := RenderTemplate(tpl, event, action)
+	if err != nil {
+		log.Errorf("render %s template of event %s fail: %v", channel, event.Id, err)
+		return builtin(event)
+	}
+	return content
+}
+
+func RenderTemplate(tpl ContentTemplate, event *model.Event, action *api.Action) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, NewTemplateData(event, action)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// 用于预览模板的event
+func SampleEvent() *model.Event {
+	return &model.Event{
+		Id: "s_1_0123456789abcdef0123456789abcdef",
+		Strategy: &model.Strategy{
+			Id:         1,
+			Metric:     "cpu.idle",
+			Tags:       map[string]string{},
+			Func:       "all(#3)",
+			Operator:   "<",
+			RightValue: 10,
+			MaxStep:    3,
+			Priority:   0,
+			Note:       "CPU is busy",
+			Tpl:        &model.Template{Id: 1, Name: "sample", ActionId: 1, Creator: "root"},
+		},
+		Status:      "PROBLEM",
+		Endpoint:    "host-01",
+		LeftValue:   3.5,
+		CurrentStep: 1,
+		PushedTags:  map[string]string{"cpu": "0"},
+		EventTime:   time.Now().Unix(),
+	}
+}
@@ -0,0 +1,82 @@
+package cron
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/g"
+)
+
+func TestDefaultTemplatesAsBuiltin(t *testing.T) {
+	g.ParseConfig("../test_cfg.json")
+	defer Templates.Load("")
+
+	if err := Templates.Load("../templates"); err != nil {
+		t.Fatalf("Load() has error: %v", err)
+	}
+
+	event := SampleEvent()
+	action := &api.Action{Id: 1}
+	if content, builtin := GenerateSmsContent(event, action), BuildCommonSMSContent(event); content != builtin {
+		t.Errorf("Expected: %s. Got: %s", builtin, content)
+	}
+
+	event.PushedTags["cpu"] = "<b>"
+	mail := GenerateMailContent(event, action)
+	if !strings.Contains(mail, "cpu=&lt;b&gt;") || !strings.Contains(mail, g.Link(event)) {
+		t.Errorf("Unexpected mail content: %s", mail)
+	}
+}
+
+func TestLookupTemplate(t *testing.T) {
+	g.ParseConfig("../test_cfg.json")
+	defer Templates.Load("")
+
+	dir, err := ioutil.TempDir("", "alarm-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, text := range map[string]string{
+		"default/sms.tmpl":  "default {{.Endpoint}}\n",
+		"action-3/sms.tmpl": "action {{.Action.Id}} {{upper .Status}}",
+		"team-ops/sms.tmpl": `team {{index .Tags "cpu"}}`,
+		"team-dev/sms.tmpl": "broken {{.Endpoint",
+		"team-dev/qq.tmpl":  "{{.NoSuchField}}",
+	} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Templates.Load(dir); err != nil {
+		t.Fatalf("Load() has error: %v", err)
+	}
+
+	event := SampleEvent()
+	testCases := []*struct {
+		action   *api.Action
+		expected string
+	}{
+		{&api.Action{Id: 3, Uic: "ops"}, "action 3 PROBLEM"},
+		{&api.Action{Id: 4, Uic: "dev, ops"}, "team 0"},
+		{&api.Action{Id: 4, Uic: "dev"}, "default host-01"},
+		{nil, "default host-01"},
+	}
+	for i, testCase := range testCases {
+		if content := GenerateSmsContent(event, testCase.action); content != testCase.expected {
+			t.Errorf("[%d] Expected: %q. Got: %q", i, testCase.expected, content)
+		}
+	}
+
+	// Falls back to built-in content if the template fails
+	if content := GenerateQQContent(event, &api.Action{Uic: "dev"}); content != BuildCommonQQContent(event) {
+		t.Errorf("Expected built-in content. Got: %q", content)
+	}
+}
@@ -0,0 +1,344 @@
+package cron
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/g"
+	"github.com/fwtpe/owl-backend/modules/alarm/model/webhook"
+	"github.com/garyburd/redigo/redis"
+)
+
+// payload的格式有不相容的修改时增加
+const WebhookVersion = 1
+
+const (
+	HeaderWebhookDelivery  = "X-Owl-Delivery"
+	HeaderWebhookEvent     = "X-Owl-Event"
+	HeaderWebhookAttempt   = "X-Owl-Attempt"
+	HeaderWebhookSignature = "X-Owl-Signature"
+)
+
+// 读取的response长度上限
+const maxWebhookResponse = 4096
+
+type WebhookEvent struct {
+	Id            string            `json:"id"`
+	Status        string            `json:"status"`
+	Endpoint      string            `json:"endpoint"`
+	Metric        string            `json:"metric"`
+	Tags          map[string]string `json:"tags"`
+	Func          string            `json:"func"`
+	LeftValue     float64           `json:"leftValue"`
+	Operator      string            `json:"operator"`
+	RightValue    float64           `json:"rightValue"`
+	Note          string            `json:"note"`
+	Priority      int               `json:"priority"`
+	CurrentStep   int               `json:"currentStep"`
+	MaxStep       int               `json:"maxStep"`
+	EventTime     int64             `json:"eventTime"`
+	FormattedTime string            `json:"formattedTime"`
+	StrategyId    int               `json:"strategyId"`
+	ExpressionId  int               `json:"expressionId"`
+	Strategy      *model.Strategy   `json:"strategy,omitempty"`
+	Expression    *model.Expression `json:"expression,omitempty"`
+	Template      *model.Template   `json:"template,omitempty"`
+	// "portal": 模板或表达式的链接, "alarm": alarm的页面
+	Links map[string]string `json:"links"`
+}
+
+type WebhookPayload struct {
+	Version  int           `json:"version"`
+	Delivery string        `json:"delivery"`
+	Time     int64         `json:"time"`
+	ActionId int           `json:"actionId"`
+	Event    *WebhookEvent `json:"event"`
+}
+
+func NewWebhookPayload(event *model.Event, action *api.Action, deliveryId string, now time.Time) *WebhookPayload {
+	tags := event.PushedTags
+	if tags == nil {
+		tags = map[string]string{}
+	}
+
+	links := map[string]string{}
+	if link := g.Link(event); link != "" {
+		links["portal"] = link
+	}
+	if shortcut := g.Config().Shortcut; shortcut != nil && shortcut.FalconAlarm != "" {
+		links["alarm"] = shortcut.FalconAlarm
+	}
+
+	return &WebhookPayload{
+		Version:  WebhookVersion,
+		Delivery: deliveryId,
+		Time:     now.Unix(),
+		ActionId: action.Id,
+		Event: &WebhookEvent{
+			Id:            event.Id,
+			Status:        event.Status,
+			Endpoint:      event.Endpoint,
+			Metric:        event.Metric(),
+			Tags:          tags,
+			Func:          event.Func(),
+			LeftValue:     event.LeftValue,
+			Operator:      event.Operator(),
+			RightValue:    event.RightValue(),
+			Note:          event.Note(),
+			Priority:      event.Priority(),
+			CurrentStep:   event.CurrentStep,
+			MaxStep:       event.MaxStep(),
+			EventTime:     event.EventTime,
+			FormattedTime: event.FormattedTime(),
+			StrategyId:    event.StrategyId(),
+			ExpressionId:  event.ExpressionId(),
+			Strategy:      event.Strategy,
+			Expression:    event.Expression,
+			Template:      event.Tpl(),
+			Links:         links,
+		},
+	}
+}
+
+// 保存在redis的待送出的webhook
+type webhookTask struct {
+	Id       string `json:"id"`
+	EventId  string `json:"eventId"`
+	ActionId int    `json:"actionId"`
+	Url      string `json:"url"`
+	Body     string `json:"body"`
+	Attempts int    `json:"attempts"`
+}
+
+type webhookResult struct {
+	code      int
+	response  string
+	retryable bool
+	err       error
+}
+
+func (this *webhookResult) success() bool {
+	return this.err == nil && this.code >= 200 && this.code < 300
+}
+
+func (this *webhookResult) String() string {
+	if this.err != nil {
+		return fmt.Sprintf("fail:%s", this.err.Error())
+	}
+	return fmt.Sprintf("status:%d resp:%s", this.code, this.response)
+}
+
+func webhookEnabled() bool {
+	return g.Config().Webhook != nil && g.Config().Webhook.Enabled
+}
+
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDeliveryId() string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(bs)
+}
+
+func enqueueWebhook(event *model.Event, action *api.Action) error {
+	id := newDeliveryId()
+	body, err := json.Marshal(NewWebhookPayload(event, action, id, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	task := &webhookTask{Id: id, EventId: event.Id, ActionId: action.Id, Url: action.Url, Body: string(body)}
+	if err := webhook.CreateDelivery(&webhook.Delivery{
+		Id: id, EventCaseId: event.Id, ActionId: action.Id, Url: action.Url, Status: webhook.StatusPending,
+	}); err != nil {
+		log.Error(err.Error())
+	}
+	return pushWebhookTask(task)
+}
+
+func pushWebhookTask(task *webhookTask) error {
+	bs, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+	_, err = rc.Do("LPUSH", g.Config().Webhook.Queue, string(bs))
+	return err
+}
+
+func ConsumeWebhooks() {
+	config := g.Config().Webhook
+	client := &http.Client{Timeout: time.Duration(config.Timeout) * time.Millisecond}
+
+	for i := 0; i < config.Workers; i++ {
+		go func() {
+			for {
+				task, err := popWebhookTask(config.Queue)
+				if err != nil {
+					time.Sleep(time.Second)
+					continue
+				}
+				processWebhook(client, task, time.Now())
+			}
+		}()
+	}
+
+	for {
+		// 每秒把到期的重试放回队列
+		time.Sleep(time.Second)
+		requeueDueWebhooks(time.Now())
+	}
+}
+
+func popWebhookTask(queue string) (*webhookTask, error) {
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+
+	reply, err := redis.Strings(rc.Do("BRPOP", queue, 0))
+	if err != nil {
+		log.Errorf("[REDIS BRPOP] %s has error: %v", queue, err)
+		return nil, err
+	}
+
+	task := &webhookTask{}
+	if err := json.Unmarshal([]byte(reply[1]), task); err != nil {
+		log.Errorf("Unmarshal JSON of webhook has error: %v", err)
+		return nil, err
+	}
+	return task, nil
+}
+
+// 5xx, 429或者连线错误(包含timeout)会重试，重试的间隔每次加倍
+func processWebhook(client *http.Client, task *webhookTask, now time.Time) {
+	config := g.Config().Webhook
+
+	task.Attempts++
+	result := postWebhook(client, task, config.Secret)
+
+	status := webhook.StatusFailed
+	switch {
+	case result.success():
+		status = webhook.StatusSuccess
+	case result.retryable && task.Attempts < config.MaxAttempts:
+		status = webhook.StatusRetrying
+	}
+
+	response := result.response
+	if result.err != nil {
+		response = result.err.Error()
+	}
+	if err := webhook.UpdateDelivery(task.Id, status, task.Attempts, result.code, response); err != nil {
+		log.Error(err.Error())
+	}
+
+	if status == webhook.StatusRetrying {
+		if err := scheduleWebhookRetry(task, now.Add(webhookBackoff(config, task.Attempts))); err != nil {
+			log.Errorf("schedule retry of webhook %s fail: %v", task.Id, err)
+		}
+		return
+	}
+
+	if status == webhook.StatusFailed {
+		log.Warnf("webhook %s of event %s fail after %d attempts: %s", task.Id, task.EventId, task.Attempts, result)
+	}
+	if action := api.GetAction(task.ActionId); action != nil {
+		afterCallback(action, fmt.Sprintf("webhook %s %s after %d attempts. %s", task.Url, status, task.Attempts, result))
+	}
+}
+
+func webhookBackoff(config *g.WebhookConfig, attempts int) time.Duration {
+	backoff := config.Backoff
+	for i := 1; i < attempts && backoff < config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > config.MaxBackoff {
+		backoff = config.MaxBackoff
+	}
+	return time.Duration(backoff) * time.Second
+}
+
+func postWebhook(client *http.Client, task *webhookTask, secret string) *webhookResult {
+	body := []byte(task.Body)
+	req, err := http.NewRequest("POST", task.Url, bytes.NewReader(body))
+	if err != nil {
+		return &webhookResult{err: err}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "owl-alarm/"+g.VERSION)
+	req.Header.Set(HeaderWebhookDelivery, task.Id)
+	req.Header.Set(HeaderWebhookEvent, task.EventId)
+	req.Header.Set(HeaderWebhookAttempt, strconv.Itoa(task.Attempts))
+	if secret != "" {
+		req.Header.Set(HeaderWebhookSignature, SignWebhook(secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &webhookResult{retryable: true, err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	return &webhookResult{
+		code:      resp.StatusCode,
+		response:  string(respBody),
+		retryable: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+	}
+}
+
+func scheduleWebhookRetry(task *webhookTask, next time.Time) error {
+	bs, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+	_, err = rc.Do("ZADD", g.Config().Webhook.RetryQueue, next.Unix(), string(bs))
+	return err
+}
+
+// 多个alarm共用队列时，只有ZREM成功的会放回队列
+func requeueDueWebhooks(now time.Time) {
+	config := g.Config().Webhook
+
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+
+	members, err := redis.Strings(rc.Do("ZRANGEBYSCORE", config.RetryQueue, "-inf", now.Unix(), "LIMIT", 0, 100))
+	if err != nil {
+		log.Errorf("[REDIS ZRANGEBYSCORE] %s has error: %v", config.RetryQueue, err)
+		return
+	}
+
+	for _, member := range members {
+		removed, err := redis.Int(rc.Do("ZREM", config.RetryQueue, member))
+		if err != nil || removed == 0 {
+			continue
+		}
+		if _, err := rc.Do("LPUSH", config.Queue, member); err != nil {
+			log.Errorf("LPUSH redis %s fail: %v. webhook: %s", config.Queue, err, member)
+		}
+	}
+}
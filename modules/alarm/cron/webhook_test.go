@@ -0,0 +1,104 @@
+package cron
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/g"
+)
+
+func TestPostWebhook(t *testing.T) {
+	g.ParseConfig("../test_cfg.json")
+
+	codes := []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusBadRequest, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(HeaderWebhookSignature) != SignWebhook("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(HeaderWebhookDelivery) != "d1" || r.Header.Get(HeaderWebhookEvent) != "s_1_a" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		code := codes[0]
+		codes = codes[1:]
+		w.WriteHeader(code)
+		w.Write([]byte("handled"))
+	}))
+
+	client := &http.Client{Timeout: time.Second}
+	task := &webhookTask{Id: "d1", EventId: "s_1_a", Url: server.URL, Body: `{"version": 1}`}
+
+	testCases := []*struct {
+		secret    string
+		code      int
+		retryable bool
+		success   bool
+	}{
+		{"other", http.StatusUnauthorized, false, false},
+		{"secret", http.StatusInternalServerError, true, false},
+		{"secret", http.StatusTooManyRequests, true, false},
+		{"secret", http.StatusBadRequest, false, false},
+		{"secret", http.StatusOK, false, true},
+	}
+	for i, testCase := range testCases {
+		result := postWebhook(client, task, testCase.secret)
+		if result.code != testCase.code || result.retryable != testCase.retryable || result.success() != testCase.success {
+			t.Errorf("[%d] Unexpected result: %#v", i, result)
+		}
+	}
+
+	server.Close()
+	if result := postWebhook(client, task, "secret"); result.err == nil || !result.retryable {
+		t.Errorf("Expected retryable error. Got: %#v", result)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	config := &g.WebhookConfig{Backoff: 10, MaxBackoff: 60}
+	for i, expected := range []int{10, 20, 40, 60, 60} {
+		attempts := i + 1
+		if backoff := webhookBackoff(config, attempts); backoff != time.Duration(expected)*time.Second {
+			t.Errorf("[%d] Expected: %ds. Got: %v", attempts, expected, backoff)
+		}
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	g.ParseConfig("../test_cfg.json")
+
+	body, err := json.Marshal(NewWebhookPayload(SampleEvent(), &api.Action{Id: 3}, "d1", time.Unix(100, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := &struct {
+		Version  int    `json:"version"`
+		Delivery string `json:"delivery"`
+		ActionId int    `json:"actionId"`
+		Event    struct {
+			Metric   string            `json:"metric"`
+			Tags     map[string]string `json:"tags"`
+			Template struct {
+				Id int `json:"id"`
+			} `json:"template"`
+			Links map[string]string `json:"links"`
+		} `json:"event"`
+	}{}
+	if err := json.Unmarshal(body, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Version != WebhookVersion || payload.Delivery != "d1" || payload.ActionId != 3 ||
+		payload.Event.Metric != "cpu.idle" || payload.Event.Tags["cpu"] != "0" || payload.Event.Template.Id != 1 ||
+		payload.Event.Links["portal"] == "" {
+		t.Errorf("Unexpected payload: %s", body)
+	}
+}
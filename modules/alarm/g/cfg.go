@@ -78,6 +78,83 @@ type ShortcutConfig struct {
 	FalconAlarm      string `json:"falconAlarm"`
 	FalconUIC        string `json:"falconUIC"`
 }
+
+// If enabled, the callbacks of actions are POSTed as signed JSON and retried on failures.
+//
+// The deliveries are queued in redis: @Queue(list) and @RetryQueue(sorted set by the time of next attempt).
+type WebhookConfig struct {
+	Enabled bool   `json:"enabled"`
+	Secret  string `json:"secret"`
+	Queue   string `json:"queue"`
+	// sorted set
+	RetryQueue  string `json:"retryQueue"`
+	Workers     int    `json:"workers"`
+	MaxAttempts int    `json:"maxAttempts"`
+	// Seconds, doubled after every failure up to @MaxBackoff
+	Backoff    int `json:"backoff"`
+	MaxBackoff int `json:"maxBackoff"`
+	// Milliseconds
+	Timeout int `json:"timeout"`
+}
+
+const (
+	defaultWebhookQueue       = "/queue/webhook"
+	defaultWebhookRetryQueue  = "/queue/webhook/retry"
+	defaultWebhookWorkers     = 4
+	defaultWebhookMaxAttempts = 5
+	defaultWebhookBackoff     = 10
+	defaultWebhookMaxBackoff  = 600
+	defaultWebhookTimeout     = 5000
+)
+
+func (this *WebhookConfig) fillDefaults() {
+	if this.Queue == "" {
+		this.Queue = defaultWebhookQueue
+	}
+	if this.RetryQueue == "" {
+		this.RetryQueue = defaultWebhookRetryQueue
+	}
+	if this.Workers <= 0 {
+		this.Workers = defaultWebhookWorkers
+	}
+	if this.MaxAttempts <= 0 {
+		this.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if this.Backoff <= 0 {
+		this.Backoff = defaultWebhookBackoff
+	}
+	if this.MaxBackoff <= 0 {
+		this.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	if this.MaxBackoff < this.Backoff {
+		this.MaxBackoff = this.Backoff
+	}
+	if this.Timeout <= 0 {
+		this.Timeout = defaultWebhookTimeout
+	}
+}
+
+// A chat room of a team, e.g. a robot of DingTalk
+type ChatRoute struct {
+	// The name of chat channel in sender, which has a queue in @ChatConfig.Queues
+	Channel string `json:"channel"`
+	// The name of route in the chat channel of sender, which has the webhook and secret
+	Route string `json:"route"`
+}
+
+// The notifications to chat tools(sent by sender), routed by the teams of actions
+type ChatConfig struct {
+	// By channel, the same as the queues of "chat" in the config of sender
+	Queues map[string]string `json:"queues"`
+	// By name of team
+	Routes map[string][]*ChatRoute `json:"routes"`
+}
+
+// The templates of notifications are loaded from <dir>/<scope>/<channel>.tmpl
+type TemplateConfig struct {
+	Dir string `json:"dir"`
+}
+
 type GlobalConfig struct {
 	Debug        bool                `json:"debug"`
 	UicToken     string              `json:"uicToken"`
@@ -90,6 +167,9 @@ type GlobalConfig struct {
 	Shortcut     *ShortcutConfig     `json:"shortcut"`
 	Uic          *UicConfig          `json:"uic"`
 	RedirectUrl  string              `json:"redirectUrl"`
+	Template     *TemplateConfig     `json:"template"`
+	Webhook      *WebhookConfig      `json:"webhook"`
+	Chat         *ChatConfig         `json:"chat"`
 }
 
 var (
@@ -126,6 +206,10 @@ func ParseConfig(cfg string) {
 		log.Fatalln("parse config file:", cfg, "fail:", err)
 	}
 
+	if c.Webhook != nil {
+		c.Webhook.fillDefaults()
+	}
+
 	configLock.Lock()
 	defer configLock.Unlock()
 	config = &c
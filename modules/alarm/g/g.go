@@ -5,7 +5,7 @@ import (
 )
 
 const (
-	VERSION = "2.0.2"
+	VERSION = "2.5.0"
 )
 
 func init() {
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/fwtpe/owl-backend/modules/alarm/cron"
+	"github.com/fwtpe/owl-backend/modules/alarm/g"
+	eventmodel "github.com/fwtpe/owl-backend/modules/alarm/model/event"
+	. "github.com/fwtpe/owl-backend/modules/alarm/model/uic"
+	log "github.com/sirupsen/logrus"
+)
+
+type AckController struct {
+	MainController
+}
+
+type ackInput struct {
+	// Only used in debug mode, otherwise the logged-in user is used
+	User string `json:"user"`
+	Note string `json:"note"`
+}
+
+// POST /api/events/:id/ack, the escalation of event is stopped
+func (this *AckController) Ack() {
+	this.addNote(eventmodel.AckEvent)
+}
+
+// POST /api/events/:id/unack
+func (this *AckController) Unack() {
+	this.addNote(eventmodel.UnackEvent)
+}
+
+func (this *AckController) addNote(add func(eventCaseId string, userId int64, note string) error) {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	input := &ackInput{}
+	if err := json.NewDecoder(this.Ctx.Request.Body).Decode(input); err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+
+	user := this.currentUser(input.User)
+	if user == nil {
+		this.serveError(http.StatusBadRequest, fmt.Errorf("user is not found"))
+		return
+	}
+
+	eventId := this.GetString(":id")
+	switch err := add(eventId, user.Id, input.Note); err {
+	case nil:
+	case eventmodel.ErrEventCaseNotFound:
+		this.serveError(http.StatusNotFound, err)
+		return
+	default:
+		this.serveError(http.StatusInternalServerError, err)
+		return
+	}
+
+	stopped := false
+	if acked, err := eventmodel.IsAcked(eventId); err == nil && acked {
+		stopped = cron.StopEscalation(eventId)
+	}
+	this.serveData(map[string]interface{}{
+		"id":                 eventId,
+		"user":               user.Name,
+		"escalation_stopped": stopped,
+	}, nil)
+}
+
+// The logged-in user, or the user named @name in debug mode(the login check is skipped)
+func (this *MainController) currentUser(name string) *User {
+	if session := SelectSessionBySig(this.Ctx.GetCookie("sig")); session != nil {
+		return SelectUserById(session.Uid)
+	}
+	if g.Config().Debug {
+		return SelectUserByName(name)
+	}
+	return nil
+}
+
+func SelectUserByName(name string) *User {
+	if name == "" {
+		return nil
+	}
+
+	obj := User{Name: name}
+	err := orm.NewOrm().Read(&obj, "Name")
+	if err != nil {
+		if err != orm.ErrNoRows {
+			log.Println(err.Error())
+		}
+		return nil
+	}
+	return &obj
+}
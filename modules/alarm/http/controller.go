@@ -8,6 +8,7 @@ import (
 	. "github.com/fwtpe/owl-backend/modules/alarm/model/uic"
 	log "github.com/sirupsen/logrus"
 	"github.com/toolkits/file"
+	"net/http"
 	"strings"
 	"time"
 )
@@ -176,3 +177,20 @@ func checkLogin(m *MainController) bool {
 	}
 	return true
 }
+
+// Serves the data as JSON, or {"error": "..."} with status 500 if @err is not nil
+func (this *MainController) serveData(data interface{}, err error) {
+	if err != nil {
+		this.serveError(http.StatusInternalServerError, err)
+		return
+	}
+
+	this.Data["json"] = data
+	this.ServeJSON()
+}
+
+func (this *MainController) serveError(status int, err error) {
+	this.Ctx.Output.SetStatus(status)
+	this.Data["json"] = map[string]string{"error": err.Error()}
+	this.ServeJSON()
+}
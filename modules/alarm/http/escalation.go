@@ -0,0 +1,78 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fwtpe/owl-backend/modules/alarm/model/escalation"
+)
+
+type EscalationController struct {
+	MainController
+}
+
+type policyInput struct {
+	Creator string             `json:"creator"`
+	Steps   []*escalation.Step `json:"steps"`
+}
+
+// GET /api/escalations, the policies keyed by the id of action
+func (this *EscalationController) List() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	policies, err := escalation.ListPolicies()
+	this.serveData(policies, err)
+}
+
+func (this *EscalationController) Get() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	steps, err := escalation.GetPolicy(this.actionId())
+	this.serveData(steps, err)
+}
+
+// PUT /api/escalations/:action_id, replaces all of the steps of action
+func (this *EscalationController) Set() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	input := &policyInput{}
+	if err := json.NewDecoder(this.Ctx.Request.Body).Decode(input); err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+	if len(input.Steps) == 0 {
+		this.serveError(http.StatusBadRequest, fmt.Errorf("steps are empty"))
+		return
+	}
+
+	if err := escalation.SetPolicy(this.actionId(), input.Steps, input.Creator); err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+	this.serveData(input.Steps, nil)
+}
+
+func (this *EscalationController) Delete() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	deleted, err := escalation.DeletePolicy(this.actionId())
+	if err == nil && !deleted {
+		this.serveError(http.StatusNotFound, fmt.Errorf("escalation policy is not found"))
+		return
+	}
+	this.serveData(map[string]bool{"deleted": deleted}, err)
+}
+
+func (this *EscalationController) actionId() int {
+	id, _ := this.GetInt(":action_id")
+	return id
+}
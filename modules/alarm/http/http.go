@@ -20,6 +20,15 @@ func configRoutes() {
 	beego.Router("/config/reload", &MainController{}, "get:ConfigReload")
 	beego.Router("/event", &MainController{}, "get:Event")
 	beego.Router("/event/solve", &MainController{}, "post:Solve")
+	beego.Router("/api/silences", &SilenceController{}, "get:List;post:Create")
+	beego.Router("/api/silences/:id:int", &SilenceController{}, "get:Get;put:Update;delete:Delete")
+	beego.Router("/api/events/:id/ack", &AckController{}, "post:Ack")
+	beego.Router("/api/events/:id/unack", &AckController{}, "post:Unack")
+	beego.Router("/api/events/:id/webhooks", &WebhookController{}, "get:List")
+	beego.Router("/api/escalations", &EscalationController{}, "get:List")
+	beego.Router("/api/escalations/:action_id:int", &EscalationController{}, "get:Get;put:Set;delete:Delete")
+	beego.Router("/api/templates", &TemplateController{}, "get:List")
+	beego.Router("/api/templates/preview", &TemplateController{}, "post:Preview")
 }
 
 func Duration(now, before int64) string {
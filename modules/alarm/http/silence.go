@@ -0,0 +1,145 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/alarm/model/silence"
+)
+
+type SilenceController struct {
+	MainController
+}
+
+// The times are unix timestamps, start_time is now and priority is -1(any) by default
+type silenceInput struct {
+	Endpoint   string `json:"endpoint"`
+	Metric     string `json:"metric"`
+	Tags       string `json:"tags"`
+	StrategyId int    `json:"strategy_id"`
+	TemplateId int    `json:"template_id"`
+	Priority   *int   `json:"priority"`
+	StartTime  int64  `json:"start_time"`
+	EndTime    int64  `json:"end_time"`
+	Creator    string `json:"creator"`
+	Comment    string `json:"comment"`
+}
+
+func (this *silenceInput) toSilence() *silence.Silence {
+	s := &silence.Silence{
+		Endpoint:   this.Endpoint,
+		Metric:     this.Metric,
+		Tags:       this.Tags,
+		StrategyId: this.StrategyId,
+		TemplateId: this.TemplateId,
+		Priority:   -1,
+		StartTime:  time.Now(),
+		EndTime:    time.Unix(this.EndTime, 0),
+		Creator:    this.Creator,
+		Comment:    this.Comment,
+	}
+	if this.Priority != nil {
+		s.Priority = *this.Priority
+	}
+	if this.StartTime > 0 {
+		s.StartTime = time.Unix(this.StartTime, 0)
+	}
+	return s
+}
+
+// GET /api/silences?all=true, the expired silences are listed only if "all" is true
+func (this *SilenceController) List() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	all, _ := this.GetBool("all", false)
+	silences, err := silence.ListSilences(all)
+	this.serveData(silences, err)
+}
+
+func (this *SilenceController) Get() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	s, err := silence.GetSilence(this.silenceId())
+	if err == nil && s == nil {
+		this.serveError(http.StatusNotFound, fmt.Errorf("silence is not found"))
+		return
+	}
+	this.serveData(s, err)
+}
+
+func (this *SilenceController) Create() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	input, err := this.parseInput()
+	if err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+
+	s := input.toSilence()
+	if err := silence.CreateSilence(s); err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+	this.serveData(s, nil)
+}
+
+func (this *SilenceController) Update() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	input, err := this.parseInput()
+	if err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+
+	old, err := silence.GetSilence(this.silenceId())
+	if err != nil || old == nil {
+		this.serveError(http.StatusNotFound, fmt.Errorf("silence is not found"))
+		return
+	}
+
+	s := input.toSilence()
+	s.Id, s.Creator, s.Created = old.Id, old.Creator, old.Created
+	if _, err := silence.UpdateSilence(s); err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+	this.serveData(s, nil)
+}
+
+func (this *SilenceController) Delete() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	deleted, err := silence.DeleteSilence(this.silenceId())
+	if err == nil && !deleted {
+		this.serveError(http.StatusNotFound, fmt.Errorf("silence is not found"))
+		return
+	}
+	this.serveData(map[string]bool{"deleted": deleted}, err)
+}
+
+func (this *SilenceController) silenceId() int64 {
+	id, _ := this.GetInt64(":id")
+	return id
+}
+
+func (this *SilenceController) parseInput() (*silenceInput, error) {
+	input := &silenceInput{}
+	if err := json.NewDecoder(this.Ctx.Request.Body).Decode(input); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
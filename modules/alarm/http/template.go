@@ -0,0 +1,87 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/alarm/api"
+	"github.com/fwtpe/owl-backend/modules/alarm/cron"
+)
+
+type TemplateController struct {
+	MainController
+}
+
+// If @Template is empty, the loaded template(by @ActionId and @Uic) is rendered.
+// If @Event is nil, a sample event is rendered.
+type previewInput struct {
+	Channel  string       `json:"channel"`
+	ActionId int          `json:"action_id"`
+	Uic      string       `json:"uic"`
+	Template string       `json:"template"`
+	Event    *model.Event `json:"event"`
+}
+
+// GET /api/templates, the names("<scope>/<channel>") of loaded templates
+func (this *TemplateController) List() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	names := cron.Templates.Names()
+	sort.Strings(names)
+	this.serveData(names, nil)
+}
+
+// POST /api/templates/preview
+func (this *TemplateController) Preview() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	input := &previewInput{}
+	if err := json.NewDecoder(this.Ctx.Request.Body).Decode(input); err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+
+	switch input.Channel {
+	case cron.TemplateSms, cron.TemplateMail, cron.TemplateQQ, cron.TemplateServerchan, cron.TemplateChat:
+	default:
+		this.serveError(http.StatusBadRequest, fmt.Errorf("channel is not supported: %s", input.Channel))
+		return
+	}
+
+	action := &api.Action{Id: input.ActionId, Uic: input.Uic}
+	if input.ActionId > 0 && input.Uic == "" {
+		if loaded := api.GetAction(input.ActionId); loaded != nil {
+			action = loaded
+		}
+	}
+	event := input.Event
+	if event == nil {
+		event = cron.SampleEvent()
+	}
+
+	var tpl cron.ContentTemplate
+	if input.Template != "" {
+		var err error
+		if tpl, err = cron.ParseTemplate(input.Channel, input.Template); err != nil {
+			this.serveError(http.StatusBadRequest, err)
+			return
+		}
+	} else if tpl = cron.Templates.Lookup(input.Channel, action); tpl == nil {
+		this.serveError(http.StatusNotFound, fmt.Errorf("no template of %s, the built-in content is used", input.Channel))
+		return
+	}
+
+	content, err := cron.RenderTemplate(tpl, event, action)
+	if err != nil {
+		this.serveError(http.StatusBadRequest, err)
+		return
+	}
+	this.serveData(map[string]string{"content": content}, nil)
+}
@@ -0,0 +1,19 @@
+package http
+
+import (
+	"github.com/fwtpe/owl-backend/modules/alarm/model/webhook"
+)
+
+type WebhookController struct {
+	MainController
+}
+
+// GET /api/events/:id/webhooks, the delivery status of webhooks of the event
+func (this *WebhookController) List() {
+	if checkLogin(&this.MainController) == false {
+		return
+	}
+
+	deliveries, err := webhook.ListDeliveries(this.GetString(":id"))
+	this.serveData(deliveries, err)
+}
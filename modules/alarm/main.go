@@ -34,6 +34,8 @@ func main() {
 	g.InitRedisConnPool()
 	model.InitDatabase()
 
+	cron.LoadTemplates()
+
 	go http.Start()
 	go cron.ReadHighEvent()
 	go cron.ReadLowEvent()
@@ -41,6 +43,13 @@ func main() {
 	go cron.CombineMail()
 	go cron.CombineQQ()
 	go cron.CombineServerchan()
+	go cron.SyncSilences()
+	go cron.SyncEscalationPolicies()
+	go cron.Escalate()
+	go cron.SyncTemplates()
+	if g.Config().Webhook != nil && g.Config().Webhook.Enabled {
+		go cron.ConsumeWebhooks()
+	}
 	// read external alarms
 	if g.Config().Redis.ExternalQueues.Enable {
 		go cron.ReadExternalEvent()
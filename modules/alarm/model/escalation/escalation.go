@@ -0,0 +1,196 @@
+package escalation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ChannelSms        = "sms"
+	ChannelMail       = "mail"
+	ChannelQQ         = "qq"
+	ChannelServerchan = "serverchan"
+)
+
+// Used if the channels of step are empty
+var defaultChannels = []string{ChannelSms, ChannelMail}
+
+// A step of the escalation policy of an action.
+//
+// If the event is still not acknowledged after @Delay minutes since the first notification,
+// the users of @Uic(teams) are notified through @Channels and the @Url(webhook) is called.
+type Step struct {
+	Id       int64  `json:"id"`
+	ActionId int    `json:"action_id"`
+	Level    int    `json:"level"`
+	Delay    int    `json:"delay"`
+	Uic      string `json:"uic"`
+	// e.g. "sms,mail", see Channel* constants
+	Channels string    `json:"channels"`
+	Url      string    `json:"url"`
+	Creator  string    `json:"creator"`
+	Created  time.Time `json:"created"`
+}
+
+func (this *Step) ChannelList() []string {
+	if strings.TrimSpace(this.Channels) == "" {
+		return defaultChannels
+	}
+
+	channels := []string{}
+	for _, channel := range strings.Split(this.Channels, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+func (this *Step) CheckFormat() error {
+	switch {
+	case this.Delay <= 0:
+		return errors.New("delay must be greater than 0")
+	case this.Uic == "" && this.Url == "":
+		return errors.New("uic or url is needed")
+	}
+
+	for _, channel := range this.ChannelList() {
+		switch channel {
+		case ChannelSms, ChannelMail, ChannelQQ, ChannelServerchan:
+		default:
+			return fmt.Errorf("channel is not supported: %s", channel)
+		}
+	}
+	return nil
+}
+
+// The escalation policies(steps ordered by level) keyed by the id of action
+type PolicyCache struct {
+	sync.RWMutex
+	policies map[int][]*Step
+}
+
+var Policies = &PolicyCache{policies: make(map[int][]*Step)}
+
+func (this *PolicyCache) Get(actionId int) []*Step {
+	this.RLock()
+	defer this.RUnlock()
+	return this.policies[actionId]
+}
+
+func (this *PolicyCache) Set(policies map[int][]*Step) {
+	this.Lock()
+	defer this.Unlock()
+	this.policies = policies
+}
+
+func (this *PolicyCache) Reload() error {
+	policies, err := ListPolicies()
+	if err != nil {
+		return err
+	}
+
+	this.Set(policies)
+	return nil
+}
+
+const selectStep = `SELECT id, action_id, level, delay, uic, channels, url, creator, created
+	FROM alarm_escalation`
+
+func ListPolicies() (map[int][]*Step, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var steps []*Step
+	if _, err := q.Raw(selectStep + " ORDER BY action_id, level").QueryRows(&steps); err != nil {
+		return nil, fmt.Errorf("[ListPolicies] %v", err)
+	}
+
+	policies := make(map[int][]*Step)
+	for _, step := range steps {
+		policies[step.ActionId] = append(policies[step.ActionId], step)
+	}
+	return policies, nil
+}
+
+func GetPolicy(actionId int) ([]*Step, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	steps := []*Step{}
+	if _, err := q.Raw(selectStep+" WHERE action_id = ? ORDER BY level", actionId).QueryRows(&steps); err != nil {
+		return nil, fmt.Errorf("[GetPolicy] %v", err)
+	}
+	return steps, nil
+}
+
+// Replaces the policy of action, the steps are sorted by delay and the levels are assigned from 1
+func SetPolicy(actionId int, steps []*Step, creator string) error {
+	if creator == "" {
+		return errors.New("creator is empty")
+	}
+	for _, step := range steps {
+		if err := step.CheckFormat(); err != nil {
+			return err
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Delay < steps[j].Delay
+	})
+
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	if err := q.Begin(); err != nil {
+		return fmt.Errorf("[SetPolicy] %v", err)
+	}
+	if _, err := q.Raw("DELETE FROM alarm_escalation WHERE action_id = ?", actionId).Exec(); err != nil {
+		q.Rollback()
+		return fmt.Errorf("[SetPolicy] %v", err)
+	}
+	for i, step := range steps {
+		step.ActionId, step.Level, step.Creator = actionId, i+1, creator
+		_, err := q.Raw(
+			`INSERT INTO alarm_escalation(action_id, level, delay, uic, channels, url, creator)
+			VALUES(?,?,?,?,?,?,?)`,
+			step.ActionId, step.Level, step.Delay, step.Uic, step.Channels, step.Url, step.Creator,
+		).Exec()
+		if err != nil {
+			q.Rollback()
+			return fmt.Errorf("[SetPolicy] %v", err)
+		}
+	}
+	if err := q.Commit(); err != nil {
+		return fmt.Errorf("[SetPolicy] %v", err)
+	}
+
+	logReloadError(Policies.Reload())
+	return nil
+}
+
+func DeletePolicy(actionId int) (bool, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	res, err := q.Raw("DELETE FROM alarm_escalation WHERE action_id = ?", actionId).Exec()
+	if err != nil {
+		return false, fmt.Errorf("[DeletePolicy] %v", err)
+	}
+
+	logReloadError(Policies.Reload())
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+func logReloadError(err error) {
+	if err != nil {
+		log.Errorf("reload escalation policies fail: %v", err)
+	}
+}
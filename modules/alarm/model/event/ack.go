@@ -0,0 +1,86 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// The statuses of event_note(and process_status of event_cases) set by ack/unack
+const (
+	ProcessStatusAcked   = "acknowledged"
+	ProcessStatusUnacked = "unacknowledged"
+)
+
+// The process statuses which mean that somebody is handling the event,
+// "in progress", "resolved" and "ignored" are set by the notes of f2e-api.
+var ackedStatuses = map[string]bool{
+	ProcessStatusAcked: true,
+	"in progress":      true,
+	"resolved":         true,
+	"ignored":          true,
+}
+
+var ErrEventCaseNotFound = errors.New("event case is not found")
+
+// Acknowledges the event case with a note of user, which is stored as the notes added by f2e-api
+func AckEvent(eventCaseId string, userId int64, note string) error {
+	return addProcessNote(eventCaseId, userId, note, ProcessStatusAcked)
+}
+
+func UnackEvent(eventCaseId string, userId int64, note string) error {
+	return addProcessNote(eventCaseId, userId, note, ProcessStatusUnacked)
+}
+
+func IsAcked(eventCaseId string) (bool, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var statuses []string
+	if _, err := q.Raw("SELECT process_status FROM event_cases WHERE id = ?", eventCaseId).QueryRows(&statuses); err != nil {
+		return false, fmt.Errorf("[IsAcked] %v", err)
+	}
+	if len(statuses) == 0 {
+		return false, ErrEventCaseNotFound
+	}
+	return ackedStatuses[statuses[0]], nil
+}
+
+func addProcessNote(eventCaseId string, userId int64, note string, status string) error {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var ids []string
+	if _, err := q.Raw("SELECT id FROM event_cases WHERE id = ?", eventCaseId).QueryRows(&ids); err != nil {
+		return fmt.Errorf("[addProcessNote] %v", err)
+	}
+	if len(ids) == 0 {
+		return ErrEventCaseNotFound
+	}
+
+	if err := q.Begin(); err != nil {
+		return fmt.Errorf("[addProcessNote] %v", err)
+	}
+
+	res, err := q.Raw(
+		"INSERT INTO event_note(event_caseId, note, case_id, status, timestamp, user_id) VALUES(?,?,?,?,?,?)",
+		eventCaseId, note, "", status, time.Now().Format(timeLayout), userId,
+	).Exec()
+	if err != nil {
+		q.Rollback()
+		return fmt.Errorf("[addProcessNote] %v", err)
+	}
+	noteId, _ := res.LastInsertId()
+
+	if _, err := q.Raw("UPDATE event_cases SET process_note = ?, process_status = ? WHERE id = ?", noteId, status, eventCaseId).Exec(); err != nil {
+		q.Rollback()
+		return fmt.Errorf("[addProcessNote] %v", err)
+	}
+
+	if err := q.Commit(); err != nil {
+		return fmt.Errorf("[addProcessNote] %v", err)
+	}
+	return nil
+}
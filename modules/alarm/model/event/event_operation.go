@@ -147,6 +147,10 @@ func InsertEvent(eve *coommonModel.Event, alarmType string) error {
 		if event[0].ProcessStatus == "resolved" || event[0].ProcessStatus == "ignored" {
 			sqltemplete = fmt.Sprintf("%v ,process_status = '%s', process_note = %d", sqltemplete, "unresolved", 0)
 		}
+		//the acknowledgement is for the last problem only
+		if event[0].ProcessStatus == ProcessStatusAcked && event[0].Status == "OK" && eve.Status != "OK" {
+			sqltemplete = fmt.Sprintf("%v ,process_status = '%s', process_note = %d", sqltemplete, ProcessStatusUnacked, 0)
+		}
 
 		tpl_creator := ""
 		if eve.Tpl() != nil {
@@ -353,6 +357,10 @@ func InsertExternalEvent(exevent ExternalEvent) error {
 		if event[0].ProcessStatus == "resolved" || event[0].ProcessStatus == "ignored" {
 			sqltemplete = fmt.Sprintf("%v ,process_status = '%s', process_note = %d", sqltemplete, "unresolved", 0)
 		}
+		//the acknowledgement is for the last problem only
+		if event[0].ProcessStatus == ProcessStatusAcked && event[0].Status == "OK" && exevent.StatusStr() != "OK" {
+			sqltemplete = fmt.Sprintf("%v ,process_status = '%s', process_note = %d", sqltemplete, ProcessStatusUnacked, 0)
+		}
 
 		tpl_creator := ""
 		if exevent.CurrentStep == 1 {
@@ -0,0 +1,235 @@
+package silence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	coommonModel "github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// The notifications of events matching all of the non-empty matchers are suppressed during [start_time, end_time)
+type Silence struct {
+	Id       int64  `json:"id"`
+	Endpoint string `json:"endpoint"`
+	Metric   string `json:"metric"`
+	// e.g. "device=sda,mount=/", all of them must be in the pushed tags of event
+	Tags       string `json:"tags"`
+	StrategyId int    `json:"strategy_id"`
+	TemplateId int    `json:"template_id"`
+	// -1 for any priority
+	Priority  int       `json:"priority"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Creator   string    `json:"creator"`
+	Comment   string    `json:"comment"`
+	Created   time.Time `json:"created"`
+}
+
+func (this *Silence) CheckFormat() error {
+	switch {
+	case this.Endpoint == "" && this.Metric == "" && this.Tags == "" && this.StrategyId == 0 && this.TemplateId == 0 && this.Priority < 0:
+		return errors.New("at least one matcher is needed")
+	case this.Priority < -1 || this.Priority > 6:
+		return errors.New("priority is not vaild")
+	case !this.EndTime.After(this.StartTime):
+		return errors.New("end_time must be after start_time")
+	case this.Creator == "":
+		return errors.New("creator is empty")
+	}
+	return nil
+}
+
+func (this *Silence) IsActive(now time.Time) bool {
+	return !now.Before(this.StartTime) && now.Before(this.EndTime)
+}
+
+func (this *Silence) Match(event *coommonModel.Event, now time.Time) bool {
+	if !this.IsActive(now) {
+		return false
+	}
+
+	switch {
+	case this.Endpoint != "" && this.Endpoint != event.Endpoint:
+		return false
+	case this.Metric != "" && this.Metric != event.Metric():
+		return false
+	case this.StrategyId != 0 && this.StrategyId != event.StrategyId():
+		return false
+	case this.TemplateId != 0 && (event.Tpl() == nil || this.TemplateId != event.Tpl().Id):
+		return false
+	case this.Priority >= 0 && this.Priority != event.Priority():
+		return false
+	}
+
+	for k, v := range utils.DictedTagstring(this.Tags) {
+		if pushed, ok := event.PushedTags[k]; !ok || pushed != v {
+			return false
+		}
+	}
+	return true
+}
+
+// The silences which are not expired, refreshed by cron and after any change from API
+type SilenceCache struct {
+	sync.RWMutex
+	silences []*Silence
+}
+
+var Silences = &SilenceCache{}
+
+func (this *SilenceCache) Set(silences []*Silence) {
+	this.Lock()
+	defer this.Unlock()
+	this.silences = silences
+}
+
+// Returns the first silence matching the event, nil if there is none
+func (this *SilenceCache) Match(event *coommonModel.Event, now time.Time) *Silence {
+	this.RLock()
+	defer this.RUnlock()
+
+	for _, silence := range this.silences {
+		if silence.Match(event, now) {
+			return silence
+		}
+	}
+	return nil
+}
+
+func (this *SilenceCache) Reload() error {
+	silences, err := ListSilences(false)
+	if err != nil {
+		return err
+	}
+
+	this.Set(silences)
+	return nil
+}
+
+const selectSilence = `SELECT id, endpoint, metric, tags, strategy_id, template_id, priority,
+		start_time, end_time, creator, comment, created
+	FROM alarm_silence`
+
+// Lists the silences ordered by start time(latest first), including the expired ones if @all is true
+func ListSilences(all bool) ([]*Silence, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var silences []*Silence
+	var err error
+	if all {
+		_, err = q.Raw(selectSilence + " ORDER BY start_time DESC, id DESC").QueryRows(&silences)
+	} else {
+		_, err = q.Raw(selectSilence+" WHERE end_time > ? ORDER BY start_time DESC, id DESC", time.Now().Format(timeLayout)).QueryRows(&silences)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[ListSilences] %v", err)
+	}
+	return silences, nil
+}
+
+func GetSilence(id int64) (*Silence, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var silences []*Silence
+	if _, err := q.Raw(selectSilence+" WHERE id = ?", id).QueryRows(&silences); err != nil {
+		return nil, fmt.Errorf("[GetSilence] %v", err)
+	}
+	if len(silences) == 0 {
+		return nil, nil
+	}
+	return silences[0], nil
+}
+
+func CreateSilence(silence *Silence) error {
+	if err := silence.CheckFormat(); err != nil {
+		return err
+	}
+
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	res, err := q.Raw(
+		`INSERT INTO alarm_silence(endpoint, metric, tags, strategy_id, template_id, priority, start_time, end_time, creator, comment)
+		VALUES(?,?,?,?,?,?,?,?,?,?)`,
+		silence.Endpoint, silence.Metric, silence.Tags, silence.StrategyId, silence.TemplateId, silence.Priority,
+		silence.StartTime.Format(timeLayout), silence.EndTime.Format(timeLayout), silence.Creator, silence.Comment,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("[CreateSilence] %v", err)
+	}
+
+	silence.Id, _ = res.LastInsertId()
+	logReloadError(Silences.Reload())
+	return nil
+}
+
+// The creator is kept
+func UpdateSilence(silence *Silence) (bool, error) {
+	if err := silence.CheckFormat(); err != nil {
+		return false, err
+	}
+
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	res, err := q.Raw(
+		`UPDATE alarm_silence SET endpoint = ?, metric = ?, tags = ?, strategy_id = ?, template_id = ?, priority = ?,
+		start_time = ?, end_time = ?, comment = ? WHERE id = ?`,
+		silence.Endpoint, silence.Metric, silence.Tags, silence.StrategyId, silence.TemplateId, silence.Priority,
+		silence.StartTime.Format(timeLayout), silence.EndTime.Format(timeLayout), silence.Comment, silence.Id,
+	).Exec()
+	if err != nil {
+		return false, fmt.Errorf("[UpdateSilence] %v", err)
+	}
+
+	logReloadError(Silences.Reload())
+	return rowsAffected(res), nil
+}
+
+func DeleteSilence(id int64) (bool, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	res, err := q.Raw("DELETE FROM alarm_silence WHERE id = ?", id).Exec()
+	if err != nil {
+		return false, fmt.Errorf("[DeleteSilence] %v", err)
+	}
+
+	logReloadError(Silences.Reload())
+	return rowsAffected(res), nil
+}
+
+// Records that the notifications of the latest record of event are suppressed by the silence
+func RecordSuppressed(eventCaseId string, silenceId int64) error {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	if _, err := q.Raw("UPDATE event_cases SET suppressed_count = suppressed_count + 1 WHERE id = ?", eventCaseId).Exec(); err != nil {
+		return fmt.Errorf("[RecordSuppressed] %v", err)
+	}
+	if _, err := q.Raw("UPDATE events SET silence_id = ? WHERE event_caseId = ? ORDER BY id DESC LIMIT 1", silenceId, eventCaseId).Exec(); err != nil {
+		return fmt.Errorf("[RecordSuppressed] %v", err)
+	}
+	return nil
+}
+
+func rowsAffected(res sql.Result) bool {
+	affected, _ := res.RowsAffected()
+	return affected > 0
+}
+
+func logReloadError(err error) {
+	if err != nil {
+		log.Errorf("reload silences fail: %v", err)
+	}
+}
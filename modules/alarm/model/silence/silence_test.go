@@ -0,0 +1,94 @@
+package silence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+)
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+
+	strategyEvent := &model.Event{
+		Endpoint: "host-1",
+		Strategy: &model.Strategy{
+			Id: 7, Metric: "disk.io.util", Priority: 2, Tpl: &model.Template{Id: 3},
+		},
+		PushedTags: map[string]string{"device": "sda", "mount": "/"},
+	}
+	expressionEvent := &model.Event{
+		Endpoint:   "host-1",
+		Expression: &model.Expression{Id: 5, Metric: "disk.io.util", Priority: 2},
+		PushedTags: map[string]string{"device": "sda"},
+	}
+
+	testCases := []*struct {
+		silence  *Silence
+		event    *model.Event
+		now      time.Time
+		expected bool
+	}{
+		{&Silence{Endpoint: "host-1", Priority: -1}, strategyEvent, now, true},
+		{&Silence{Endpoint: "host-2", Priority: -1}, strategyEvent, now, false},
+		{&Silence{Metric: "disk.io.util", Priority: -1}, strategyEvent, now, true},
+		{&Silence{Metric: "cpu.idle", Priority: -1}, strategyEvent, now, false},
+		{&Silence{Metric: "disk.io.util", Priority: -1}, expressionEvent, now, true},
+		// All of the tags must be pushed
+		{&Silence{Tags: "device=sda", Priority: -1}, strategyEvent, now, true},
+		{&Silence{Tags: "device=sda,mount=/", Priority: -1}, strategyEvent, now, true},
+		{&Silence{Tags: "device=sdb", Priority: -1}, strategyEvent, now, false},
+		{&Silence{Tags: "device=sda,mount=/", Priority: -1}, expressionEvent, now, false},
+		{&Silence{StrategyId: 7, Priority: -1}, strategyEvent, now, true},
+		{&Silence{StrategyId: 8, Priority: -1}, strategyEvent, now, false},
+		{&Silence{StrategyId: 7, Priority: -1}, expressionEvent, now, false},
+		{&Silence{TemplateId: 3, Priority: -1}, strategyEvent, now, true},
+		{&Silence{TemplateId: 4, Priority: -1}, strategyEvent, now, false},
+		// There is no template of expression
+		{&Silence{TemplateId: 3, Priority: -1}, expressionEvent, now, false},
+		{&Silence{Priority: 2}, strategyEvent, now, true},
+		{&Silence{Priority: 0}, strategyEvent, now, false},
+		{&Silence{Priority: 2}, expressionEvent, now, true},
+		{&Silence{Endpoint: "host-1", Metric: "disk.io.util", Tags: "device=sda", StrategyId: 7, TemplateId: 3, Priority: 2}, strategyEvent, now, true},
+		{&Silence{Endpoint: "host-1", Metric: "disk.io.util", Tags: "device=sda", StrategyId: 7, TemplateId: 3, Priority: 1}, strategyEvent, now, false},
+		// [start_time, end_time)
+		{&Silence{Endpoint: "host-1", Priority: -1}, strategyEvent, start, true},
+		{&Silence{Endpoint: "host-1", Priority: -1}, strategyEvent, start.Add(-time.Second), false},
+		{&Silence{Endpoint: "host-1", Priority: -1}, strategyEvent, end.Add(-time.Second), true},
+		{&Silence{Endpoint: "host-1", Priority: -1}, strategyEvent, end, false},
+	}
+
+	for i, testCase := range testCases {
+		testCase.silence.StartTime, testCase.silence.EndTime = start, end
+		if matched := testCase.silence.Match(testCase.event, testCase.now); matched != testCase.expected {
+			t.Errorf("[%d] Expected matched: %v. Got: %v", i, testCase.expected, matched)
+		}
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	now := time.Now()
+
+	testCases := []*struct {
+		silence *Silence
+		valid   bool
+	}{
+		{&Silence{Endpoint: "host-1", Priority: -1, StartTime: now, EndTime: now.Add(time.Hour), Creator: "root"}, true},
+		{&Silence{Priority: 0, StartTime: now, EndTime: now.Add(time.Hour), Creator: "root"}, true},
+		{&Silence{TemplateId: 3, Priority: -1, StartTime: now, EndTime: now.Add(time.Hour), Creator: "root"}, true},
+		// No matcher
+		{&Silence{Priority: -1, StartTime: now, EndTime: now.Add(time.Hour), Creator: "root"}, false},
+		{&Silence{Endpoint: "host-1", Priority: -2, StartTime: now, EndTime: now.Add(time.Hour), Creator: "root"}, false},
+		{&Silence{Endpoint: "host-1", Priority: 7, StartTime: now, EndTime: now.Add(time.Hour), Creator: "root"}, false},
+		{&Silence{Endpoint: "host-1", Priority: -1, StartTime: now, EndTime: now, Creator: "root"}, false},
+		{&Silence{Endpoint: "host-1", Priority: -1, StartTime: now, EndTime: now.Add(-time.Hour), Creator: "root"}, false},
+		{&Silence{Endpoint: "host-1", Priority: -1, StartTime: now, EndTime: now.Add(time.Hour)}, false},
+	}
+
+	for i, testCase := range testCases {
+		if err := testCase.silence.CheckFormat(); (err == nil) != testCase.valid {
+			t.Errorf("[%d] Expected valid: %v. Got: %v", i, testCase.valid, err)
+		}
+	}
+}
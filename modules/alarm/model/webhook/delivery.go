@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/astaxie/beego/orm"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+const (
+	StatusPending  = "pending"
+	StatusRetrying = "retrying"
+	StatusSuccess  = "success"
+	StatusFailed   = "failed"
+)
+
+// The response is truncated(as valid UTF-8) to the size of column
+const maxResponseLen = 1024
+
+// The status of the webhook delivery of an event
+type Delivery struct {
+	Id           string    `json:"id"`
+	EventCaseId  string    `json:"event_caseId" orm:"column(event_caseId)"`
+	ActionId     int       `json:"action_id"`
+	Url          string    `json:"url"`
+	Status       string    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	ResponseCode int       `json:"response_code"`
+	Response     string    `json:"response"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+}
+
+func CreateDelivery(delivery *Delivery) error {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	_, err := q.Raw(
+		"INSERT INTO alarm_webhook_delivery(id, event_caseId, action_id, url, status) VALUES(?,?,?,?,?)",
+		delivery.Id, delivery.EventCaseId, delivery.ActionId, delivery.Url, delivery.Status,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("[CreateDelivery] %v", err)
+	}
+	return nil
+}
+
+// Updates the result of the latest attempt
+func UpdateDelivery(id string, status string, attempts int, responseCode int, response string) error {
+	if len(response) > maxResponseLen {
+		response = response[:maxResponseLen]
+	}
+	for !utf8.ValidString(response) {
+		response = response[:len(response)-1]
+	}
+
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	_, err := q.Raw(
+		"UPDATE alarm_webhook_delivery SET status = ?, attempts = ?, response_code = ?, response = ?, updated = ? WHERE id = ?",
+		status, attempts, responseCode, response, time.Now().Format(timeLayout), id,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("[UpdateDelivery] %v", err)
+	}
+	return nil
+}
+
+// Lists the deliveries of event case, latest first
+func ListDeliveries(eventCaseId string) ([]*Delivery, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	deliveries := []*Delivery{}
+	_, err := q.Raw(
+		`SELECT id, event_caseId, action_id, url, status, attempts, response_code, response, created, updated
+		FROM alarm_webhook_delivery WHERE event_caseId = ? ORDER BY created DESC`,
+		eventCaseId,
+	).QueryRows(&deliveries)
+	if err != nil {
+		return nil, fmt.Errorf("[ListDeliveries] %v", err)
+	}
+	return deliveries, nil
+}
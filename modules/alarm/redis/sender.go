@@ -73,6 +73,20 @@ func WriteServerchanModel(serverchan *model.Serverchan) {
 	LPUSH(g.Config().Queue.Serverchan, string(bs))
 }
 
+func WriteChatModel(queue string, chat *model.Chat) {
+	if chat == nil {
+		return
+	}
+
+	bs, err := json.Marshal(chat)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	LPUSH(queue, string(bs))
+}
+
 func WriteSms(tos []string, content string) {
 	if len(tos) == 0 {
 		return
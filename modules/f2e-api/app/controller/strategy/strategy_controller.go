@@ -9,6 +9,7 @@ import (
 
 	"io/ioutil"
 
+	"github.com/fwtpe/owl-backend/common/condition"
 	h "github.com/fwtpe/owl-backend/modules/f2e-api/app/helper"
 	f "github.com/fwtpe/owl-backend/modules/f2e-api/app/model/falcon_portal"
 	"github.com/gin-gonic/gin"
@@ -16,6 +17,20 @@ import (
 	"path/filepath"
 )
 
+// The composite condition of strategy, which is evaluated by judge
+const maxCondLength = 1024
+
+// Checks the syntax of composite condition, the empty one is valid
+func checkCond(cond string) error {
+	if strings.TrimSpace(cond) == "" {
+		return nil
+	}
+	if _, err := condition.Parse(cond); err != nil {
+		return fmt.Errorf("cond's formating is not vaild: %v", err)
+	}
+	return nil
+}
+
 type APIGetStrategysInput struct {
 	Tip int `json:"tid" form:"tid" binding:"required"`
 }
@@ -44,6 +59,7 @@ type APICreateStrategyInput struct {
 	Func       string `json:"func" binding:"required"`
 	Op         string `json:"op" binding:"required"`
 	RightValue string `json:"right_value" binding:"required"`
+	Cond       string `json:"cond"`
 	Note       string `json:"note"`
 	RunBegin   string `json:"run_begin"`
 	RunEnd     string `json:"run_end"`
@@ -59,10 +75,14 @@ func (this APICreateStrategyInput) CheckFormat() (err error) {
 		err = errors.New("op's formating is not vaild")
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
+	case len(this.Cond) > maxCondLength:
+		err = fmt.Errorf("cond is longer than %d", maxCondLength)
 	case !validTime.MatchString(this.RunBegin) && this.RunBegin != "":
 		err = errors.New("run_begin's formating is not vaild, please refer ex. 00:00")
 	case !validTime.MatchString(this.RunEnd) && this.RunEnd != "":
 		err = errors.New("run_end's formating is not vaild, please refer ex. 24:00")
+	default:
+		err = checkCond(this.Cond)
 	}
 	return
 }
@@ -85,6 +105,7 @@ func CreateStrategy(c *gin.Context) {
 		Func:       inputs.Func,
 		Op:         inputs.Op,
 		RightValue: inputs.RightValue,
+		Cond:       inputs.Cond,
 		Note:       inputs.Note,
 		RunBegin:   inputs.RunBegin,
 		RunEnd:     inputs.RunEnd,
@@ -131,6 +152,7 @@ type APIUpdateStrategyInput struct {
 	Func       string `json:"func" binding:"required"`
 	Op         string `json:"op" binding:"required"`
 	RightValue string `json:"right_value" binding:"required"`
+	Cond       string `json:"cond"`
 	Note       string `json:"note"`
 	RunBegin   string `json:"run_begin"`
 	RunEnd     string `json:"run_end"`
@@ -145,10 +167,14 @@ func (this APIUpdateStrategyInput) CheckFormat() (err error) {
 		err = errors.New("op's formating is not vaild")
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
+	case len(this.Cond) > maxCondLength:
+		err = fmt.Errorf("cond is longer than %d", maxCondLength)
 	case !validTime.MatchString(this.RunBegin) && this.RunBegin != "":
 		err = errors.New("run_begin's formating is not vaild, please refer ex. 00:00")
 	case !validTime.MatchString(this.RunEnd) && this.RunEnd != "":
 		err = errors.New("run_end's formating is not vaild, please refer ex. 24:00")
+	default:
+		err = checkCond(this.Cond)
 	}
 	return
 }
@@ -178,6 +204,7 @@ func UpdateStrategy(c *gin.Context) {
 		"Func":       inputs.Func,
 		"Op":         inputs.Op,
 		"RightValue": inputs.RightValue,
+		"Cond":       inputs.Cond,
 		"Note":       inputs.Note,
 		"RunBegin":   inputs.RunBegin,
 		"RunEnd":     inputs.RunEnd}
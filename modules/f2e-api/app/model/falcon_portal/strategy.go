@@ -27,6 +27,7 @@ type Strategy struct {
 	Func       string `json:"func" gorm:"column:func"`
 	Op         string `json:"op" gorm:"column:op"`
 	RightValue string `json:"right_value" gorm:"column:right_value"`
+	Cond       string `json:"cond" gorm:"column:cond"`
 	Note       string `json:"note" gorm:"column:note"`
 	RunBegin   string `json:"run_begin" gorm:"column:run_begin"`
 	RunEnd     string `json:"run_end" gorm:"column:run_end"`
@@ -167,7 +167,7 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 
 	nowTs := time.Now().Unix()
 	lastUpTs := nowTs - nowTs%int64(step)
-	rra1StartTs := lastUpTs - int64(rrdtool.RRA1PointCnt*step)
+	rra1StartTs := lastUpTs - rrdtool.RawSpan(filename, param.Endpoint, param.Counter, step)
 
 	// consolidated, do not merge
 	if start_ts < rra1StartTs {
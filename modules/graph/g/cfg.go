@@ -34,13 +34,14 @@ type DBConfig struct {
 }
 
 type GlobalConfig struct {
-	Pid         string      `json:"pid"`
-	Debug       bool        `json:"debug"`
-	Http        *HttpConfig `json:"http"`
-	Rpc         *RpcConfig  `json:"rpc"`
-	RRD         *RRDConfig  `json:"rrd"`
-	DB          *DBConfig   `json:"db"`
-	CallTimeout int32       `json:"callTimeout"`
+	Pid         string           `json:"pid"`
+	Debug       bool             `json:"debug"`
+	Http        *HttpConfig      `json:"http"`
+	Rpc         *RpcConfig       `json:"rpc"`
+	RRD         *RRDConfig       `json:"rrd"`
+	DB          *DBConfig        `json:"db"`
+	CallTimeout int32            `json:"callTimeout"`
+	Retention   *RetentionConfig `json:"retention"`
 	Migrate     struct {
 		Concurrency int               `json:"concurrency"` //number of multiple worker per node
 		Enabled     bool              `json:"enabled"`
@@ -84,6 +85,13 @@ func ParseConfig(cfg string) {
 		c.Migrate.Enabled = false
 	}
 
+	if c.Retention == nil {
+		c.Retention = &RetentionConfig{}
+	}
+	if err := c.Retention.Init(); err != nil {
+		log.Fatalln("parse config file", cfg, "error:", err.Error())
+	}
+
 	// set config
 	atomic.StorePointer(&ptr, unsafe.Pointer(&c))
 
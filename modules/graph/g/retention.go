@@ -0,0 +1,165 @@
+package g
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// The name of builtin policy, which is used by the series matching no rule
+const DEFAULT_RETENTION_POLICY = "default"
+
+// An archive of rrd file, the data points are consolidated by "resolution" seconds and "rows" of them are kept
+type RRAConfig struct {
+	// Seconds of a data point, the step of series is used if it is 0
+	Resolution int      `json:"resolution"`
+	Rows       int      `json:"rows"`
+	CFs        []string `json:"cfs"`
+}
+
+type RetentionPolicy struct {
+	Name string       `json:"name"`
+	RRAs []*RRAConfig `json:"rras"`
+}
+
+// Selects the policy of series, the empty conditions match any series.
+// Endpoint, metric and the values of tags are regular expressions.
+type RetentionRule struct {
+	Policy   string            `json:"policy"`
+	Endpoint string            `json:"endpoint"`
+	Metric   string            `json:"metric"`
+	Tags     map[string]string `json:"tags"`
+	Step     int               `json:"step"`
+
+	endpoint *regexp.Regexp
+	metric   *regexp.Regexp
+	tags     map[string]*regexp.Regexp
+	policy   *RetentionPolicy
+}
+
+type RetentionConfig struct {
+	Policies []*RetentionPolicy `json:"policies"`
+	// The first matched rule is applied
+	Rules []*RetentionRule `json:"rules"`
+
+	policies map[string]*RetentionPolicy
+}
+
+var validCFs = map[string]bool{"AVERAGE": true, "MAX": true, "MIN": true, "LAST": true}
+
+// Validates the policies and compiles the patterns of rules
+func (this *RetentionConfig) Init() error {
+	this.policies = map[string]*RetentionPolicy{}
+	for _, policy := range this.Policies {
+		if err := policy.check(); err != nil {
+			return err
+		}
+		if policy.Name == DEFAULT_RETENTION_POLICY {
+			return fmt.Errorf("retention policy %q is builtin", policy.Name)
+		}
+		if this.policies[policy.Name] != nil {
+			return fmt.Errorf("duplicated retention policy %q", policy.Name)
+		}
+		this.policies[policy.Name] = policy
+	}
+
+	for i, rule := range this.Rules {
+		if err := rule.init(this.policies); err != nil {
+			return fmt.Errorf("retention rule[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (this *RetentionPolicy) check() error {
+	if this.Name == "" {
+		return fmt.Errorf("retention policy needs a name")
+	}
+	if len(this.RRAs) == 0 {
+		return fmt.Errorf("retention policy %q has no rra", this.Name)
+	}
+
+	hasAverage := false
+	for _, rra := range this.RRAs {
+		if rra.Resolution < 0 || rra.Rows <= 0 {
+			return fmt.Errorf("retention policy %q has invalid rra: resolution %d, rows %d", this.Name, rra.Resolution, rra.Rows)
+		}
+		if len(rra.CFs) == 0 {
+			rra.CFs = []string{"AVERAGE"}
+		}
+		for _, cf := range rra.CFs {
+			if !validCFs[cf] {
+				return fmt.Errorf("retention policy %q has invalid cf %q", this.Name, cf)
+			}
+			if cf == "AVERAGE" {
+				hasAverage = true
+			}
+		}
+	}
+	// The queries use AVERAGE by default
+	if !hasAverage {
+		return fmt.Errorf("retention policy %q has no AVERAGE rra", this.Name)
+	}
+	return nil
+}
+
+func (this *RetentionRule) init(policies map[string]*RetentionPolicy) (err error) {
+	if this.policy = policies[this.Policy]; this.policy == nil && this.Policy != DEFAULT_RETENTION_POLICY {
+		return fmt.Errorf("unknown policy %q", this.Policy)
+	}
+	if this.Endpoint != "" {
+		if this.endpoint, err = regexp.Compile(this.Endpoint); err != nil {
+			return
+		}
+	}
+	if this.Metric != "" {
+		if this.metric, err = regexp.Compile(this.Metric); err != nil {
+			return
+		}
+	}
+	this.tags = map[string]*regexp.Regexp{}
+	for key, pattern := range this.Tags {
+		if this.tags[key], err = regexp.Compile(pattern); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (this *RetentionRule) match(endpoint string, metric string, tags map[string]string, step int) bool {
+	if this.Step != 0 && this.Step != step {
+		return false
+	}
+	if this.endpoint != nil && !this.endpoint.MatchString(endpoint) {
+		return false
+	}
+	if this.metric != nil && !this.metric.MatchString(metric) {
+		return false
+	}
+	for key, pattern := range this.tags {
+		value, ok := tags[key]
+		if !ok || !pattern.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the policy of the first matched rule, nil for the builtin one
+func (this *RetentionConfig) PolicyOf(endpoint string, metric string, tags map[string]string, step int) *RetentionPolicy {
+	if this == nil {
+		return nil
+	}
+	for _, rule := range this.Rules {
+		if rule.match(endpoint, metric, tags, step) {
+			return rule.policy
+		}
+	}
+	return nil
+}
+
+func PolicyName(policy *RetentionPolicy) string {
+	if policy == nil {
+		return DEFAULT_RETENTION_POLICY
+	}
+	return policy.Name
+}
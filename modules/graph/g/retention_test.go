@@ -0,0 +1,77 @@
+package g
+
+import (
+	"testing"
+)
+
+func newTestRetention() *RetentionConfig {
+	return &RetentionConfig{
+		Policies: []*RetentionPolicy{
+			{Name: "kpi", RRAs: []*RRAConfig{{Resolution: 60, Rows: 20160}, {Resolution: 3600, Rows: 17520, CFs: []string{"AVERAGE", "MAX"}}}},
+			{Name: "short", RRAs: []*RRAConfig{{Rows: 720}}},
+		},
+		Rules: []*RetentionRule{
+			{Policy: "kpi", Metric: `^kpi\.`, Tags: map[string]string{"service": "^(order|pay)$"}},
+			{Policy: "short", Endpoint: `^test-`},
+			{Policy: "short", Step: 30},
+		},
+	}
+}
+
+func TestPolicyOf(t *testing.T) {
+	config := newTestRetention()
+	if err := config.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []*struct {
+		endpoint string
+		metric   string
+		tags     map[string]string
+		step     int
+		expected string
+	}{
+		{"host-1", "kpi.orders", map[string]string{"service": "order"}, 60, "kpi"},
+		{"host-1", "kpi.orders", map[string]string{"service": "search"}, 60, DEFAULT_RETENTION_POLICY},
+		{"host-1", "kpi.orders", map[string]string{}, 60, DEFAULT_RETENTION_POLICY},
+		{"test-1", "kpi.orders", map[string]string{"service": "pay"}, 60, "kpi"},
+		{"test-1", "cpu.idle", nil, 60, "short"},
+		{"host-1", "cpu.idle", nil, 30, "short"},
+		{"host-1", "cpu.idle", nil, 60, DEFAULT_RETENTION_POLICY},
+	}
+	for i, testCase := range testCases {
+		policy := config.PolicyOf(testCase.endpoint, testCase.metric, testCase.tags, testCase.step)
+		if PolicyName(policy) != testCase.expected {
+			t.Errorf("[%d] Expected policy: %s. Got: %s", i, testCase.expected, PolicyName(policy))
+		}
+	}
+
+	if config.Policies[1].RRAs[0].CFs[0] != "AVERAGE" {
+		t.Errorf("Expected AVERAGE as the default cf. Got: %v", config.Policies[1].RRAs[0].CFs)
+	}
+}
+
+func TestRetentionInit(t *testing.T) {
+	testCases := []*struct {
+		modify func(config *RetentionConfig)
+		valid  bool
+	}{
+		{func(config *RetentionConfig) {}, true},
+		{func(config *RetentionConfig) { config.Rules[0].Policy = DEFAULT_RETENTION_POLICY }, true},
+		{func(config *RetentionConfig) { config.Rules[0].Policy = "none" }, false},
+		{func(config *RetentionConfig) { config.Rules[0].Metric = "(" }, false},
+		{func(config *RetentionConfig) { config.Rules[0].Tags["service"] = "[" }, false},
+		{func(config *RetentionConfig) { config.Policies[1].Name = "kpi" }, false},
+		{func(config *RetentionConfig) { config.Policies[1].Name = DEFAULT_RETENTION_POLICY }, false},
+		{func(config *RetentionConfig) { config.Policies[1].RRAs[0].Rows = 0 }, false},
+		{func(config *RetentionConfig) { config.Policies[1].RRAs[0].CFs = []string{"MAX"} }, false},
+		{func(config *RetentionConfig) { config.Policies[1].RRAs[0].CFs = []string{"SUM"} }, false},
+	}
+	for i, testCase := range testCases {
+		config := newTestRetention()
+		testCase.modify(config)
+		if err := config.Init(); (err == nil) != testCase.valid {
+			t.Errorf("[%d] Expected valid: %v. Got: %v", i, testCase.valid, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	cutils "github.com/fwtpe/owl-backend/common/utils"
+	"github.com/fwtpe/owl-backend/modules/graph/g"
+	"github.com/fwtpe/owl-backend/modules/graph/index"
+	"github.com/fwtpe/owl-backend/modules/graph/rrdtool"
+)
+
+func configRetentionRoutes() {
+	// 查询一条曲线匹配的归档策略, 参数: e m t
+	http.HandleFunc("/retention", func(w http.ResponseWriter, r *http.Request) {
+		item, ok := retentionItem(w, r)
+		if !ok {
+			return
+		}
+		policy := g.Config().Retention.PolicyOf(item.Endpoint, item.Metric, item.Tags, item.Step)
+		if policy == nil {
+			policy = &g.RetentionPolicy{Name: g.DEFAULT_RETENTION_POLICY}
+		}
+		RenderDataJson(w, policy)
+	})
+
+	// 按当前匹配的策略重建一条曲线的rrd文件, 同步操作. 参数: e m t
+	http.HandleFunc("/relayout", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			RenderDataJson(w, "no privilege")
+			return
+		}
+		item, ok := retentionItem(w, r)
+		if !ok {
+			return
+		}
+
+		filename := g.RrdFileName(g.Config().RRD.Storage, item.Checksum(), item.DsType, item.Step)
+		if err := rrdtool.Relayout(filename, item); err != nil {
+			RenderDataJson(w, err.Error())
+			return
+		}
+		RenderDataJson(w, "ok")
+	})
+
+	// 重建索引缓存中归档与匹配的策略不同的rrd文件, 异步操作. 参数: dryRun
+	http.HandleFunc("/relayout/all", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			RenderDataJson(w, "no privilege")
+			return
+		}
+		r.ParseForm()
+		dryRun := r.Form.Get("dryRun") == "true"
+		if err := rrdtool.StartRelayoutAll(index.GetIndexedItems(), dryRun); err != nil {
+			RenderDataJson(w, err.Error())
+			return
+		}
+		RenderDataJson(w, "ok")
+	})
+
+	// 确认重建的结果, 删除保留的原文件(.bak). 参数: e m t, 未指定曲线时删除全部的备份
+	http.HandleFunc("/relayout/confirm", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			RenderDataJson(w, "no privilege")
+			return
+		}
+		r.ParseForm()
+		filename := ""
+		if r.Form.Get("e") != "" || r.Form.Get("m") != "" {
+			item, ok := retentionItem(w, r)
+			if !ok {
+				return
+			}
+			filename = g.RrdFileName(g.Config().RRD.Storage, item.Checksum(), item.DsType, item.Step)
+		}
+
+		removed, err := rrdtool.ConfirmRelayout(filename)
+		if err != nil {
+			RenderDataJson(w, err.Error())
+			return
+		}
+		RenderDataJson(w, removed)
+	})
+
+	http.HandleFunc("/relayout/status", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, rrdtool.GetRelayoutStatus())
+	})
+}
+
+// 由索引得到曲线的类型和step
+func retentionItem(w http.ResponseWriter, r *http.Request) (*cmodel.GraphItem, bool) {
+	r.ParseForm()
+	endpoint := r.Form.Get("e")
+	metric := r.Form.Get("m")
+	if endpoint == "" || metric == "" {
+		RenderDataJson(w, "bad args")
+		return nil, false
+	}
+	tags := cutils.DictedTagstring(r.Form.Get("t"))
+
+	dsType, step, found := index.GetTypeAndStep(endpoint, cutils.Counter(metric, tags))
+	if !found {
+		RenderDataJson(w, "not found")
+		return nil, false
+	}
+
+	item, err := convert2GraphItem(&cmodel.MetaData{
+		Endpoint: endpoint, Metric: metric, Tags: tags, Step: int64(step), CounterType: dsType,
+	})
+	if err != nil {
+		RenderDataJson(w, err.Error())
+		return nil, false
+	}
+	return item, true
+}
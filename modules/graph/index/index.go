@@ -74,3 +74,16 @@ func GetIndexedItemCache(endpoint string, metric string, tags map[string]string,
 	r = icitem.Item
 	return
 }
+
+// 索引缓存中的全部item
+func GetIndexedItems() []*cmodel.GraphItem {
+	items := []*cmodel.GraphItem{}
+	for _, key := range indexedItemCache.Keys() {
+		if cached := indexedItemCache.Get(key); cached != nil {
+			if item := cached.(*IndexCacheItem).Item; item != nil {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,494 @@
+package rrdtool
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	"github.com/open-falcon/rrdlite"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/fwtpe/owl-backend/modules/graph/g"
+)
+
+// 每次rrd update的点数
+const relayoutUpdateBatch = 1000
+
+// 重建时保留的原文件, 由ConfirmRelayout删除
+const relayoutBackupSuffix = ".bak"
+
+// 在io worker中补写快照之后的数据并替换原文件
+type relayout_t struct {
+	filename string
+	tmp      string
+	// 原文件的归档
+	archives []*archive
+	// 快照的结束时间
+	end      int64
+	replayer *replayer
+}
+
+// 一个归档点, 表示(ts-resolution, ts]的值.
+// max, min为同粒度的MAX、MIN归档的值, 没有时为NaN
+type relayoutPoint struct {
+	ts         int64
+	resolution int64
+	value      float64
+	max        float64
+	min        float64
+}
+
+type fetchFunc func(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error)
+
+// 正在重建的文件
+var (
+	relayoutingLock sync.Mutex
+	relayouting     = map[string]bool{}
+)
+
+// 按item当前匹配的策略重建rrd文件, 原文件的归档由文件本身读出.
+// 新文件由Fetch读出的快照在io worker之外建立, 只有补写快照之后的数据和替换文件在io worker中执行.
+// 原文件保留为filename.bak, 存在.bak时不重建
+func Relayout(filename string, item *cmodel.GraphItem) error {
+	if !g.IsRrdFileExist(filename) {
+		return fmt.Errorf("rrd file %s not found", filename)
+	}
+	if g.IsRrdFileExist(filename + relayoutBackupSuffix) {
+		return fmt.Errorf("backup of %s exists, confirm the last relayout first", filename)
+	}
+
+	relayoutingLock.Lock()
+	if relayouting[filename] {
+		relayoutingLock.Unlock()
+		return fmt.Errorf("relayout of %s is running", filename)
+	}
+	relayouting[filename] = true
+	relayoutingLock.Unlock()
+	defer func() {
+		relayoutingLock.Lock()
+		delete(relayouting, filename)
+		relayoutingLock.Unlock()
+	}()
+
+	from, err := fileArchives(filename)
+	if err != nil {
+		return err
+	}
+
+	step := int64(item.Step)
+	now := time.Now().Unix()
+	end := now - now%step
+
+	to := archivesOf(g.Config().Retention.PolicyOf(item.Endpoint, item.Metric, item.Tags, item.Step), item.Step)
+	points, err := readArchives(Fetch, filename, from, step, end, end-maxSpan(to, step))
+	if err != nil {
+		return err
+	}
+
+	tmp := filename + ".relayout"
+	start := time.Unix(end, 0).Add(time.Duration(-24) * time.Hour)
+	if len(points) > 0 {
+		start = time.Unix(points[0].ts-points[0].resolution-step, 0)
+	}
+	if err := createWith(tmp, item, to, start); err != nil {
+		return err
+	}
+	r := newReplayer(tmp, item)
+	if err := r.replay(points); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	done := make(chan error, 1)
+	io_task_chan <- &io_task_t{
+		method: IO_TASK_M_RELAYOUT,
+		args:   &relayout_t{filename: filename, tmp: tmp, archives: from, end: end, replayer: r},
+		done:   done,
+	}
+	if err := <-done; err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	log.Debugf("relayout %s with %d points", filename, len(points))
+	return nil
+}
+
+// 在io worker中执行, 期间不会有flush写入原文件
+func commitRelayout(c *relayout_t) error {
+	step := c.replayer.step
+	now := time.Now().Unix()
+	if end := now - now%step; end > c.end {
+		points, err := readArchives(fetch, c.filename, c.archives, step, end, c.end)
+		if err != nil {
+			return err
+		}
+		if err := c.replayer.replay(points); err != nil {
+			return err
+		}
+	}
+
+	backup := c.filename + relayoutBackupSuffix
+	if g.IsRrdFileExist(backup) {
+		return fmt.Errorf("backup of %s exists, confirm the last relayout first", c.filename)
+	}
+	if err := os.Rename(c.filename, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(c.tmp, c.filename); err != nil {
+		os.Rename(backup, c.filename)
+		return err
+	}
+	forgetRawSpan(c.filename)
+	return nil
+}
+
+// 归档能保存的最长时间(秒)
+func maxSpan(archives []*archive, step int64) int64 {
+	var span int64
+	for _, a := range archives {
+		if s := int64(a.pdp*a.rows) * step; s > span {
+			span = s
+		}
+	}
+	return span
+}
+
+// 从精细到粗糙读取AVERAGE归档, 粗糙的归档只补充更早的数据; 有同粒度的MAX、MIN归档时一并读出.
+// 返回(after, end]之间的非空点, 按时间排序
+func readArchives(fetchFn fetchFunc, filename string, archives []*archive, step int64, end int64, after int64) ([]*relayoutPoint, error) {
+	averages := []*archive{}
+	extremes := map[archive]bool{}
+	for _, a := range archives {
+		switch a.cf {
+		case "AVERAGE":
+			averages = append(averages, a)
+		case "MAX", "MIN":
+			extremes[archive{cf: a.cf, pdp: a.pdp}] = true
+		}
+	}
+	sort.Sort(byPdp(averages))
+
+	points := []*relayoutPoint{}
+	coveredEnd := end
+	for _, a := range averages {
+		if coveredEnd <= after {
+			break
+		}
+		resolution := int64(a.pdp) * step
+		start := end - int64(a.rows)*resolution
+		if start >= coveredEnd {
+			continue
+		}
+		fetchStart := start
+		if fetchStart < after {
+			fetchStart = after - after%resolution
+		}
+
+		values, actual, err := fetchValues(fetchFn, filename, "AVERAGE", fetchStart, coveredEnd, resolution)
+		if err != nil {
+			return nil, err
+		}
+		// 同一个区间的MAX、MIN, 粒度不同时不使用
+		maxes, mins := map[int64]float64{}, map[int64]float64{}
+		if extremes[archive{cf: "MAX", pdp: a.pdp}] && actual == resolution {
+			if maxes, err = fetchExtremes(fetchFn, filename, "MAX", fetchStart, coveredEnd, resolution); err != nil {
+				return nil, err
+			}
+		}
+		if extremes[archive{cf: "MIN", pdp: a.pdp}] && actual == resolution {
+			if mins, err = fetchExtremes(fetchFn, filename, "MIN", fetchStart, coveredEnd, resolution); err != nil {
+				return nil, err
+			}
+		}
+
+		for ts, value := range values {
+			if ts <= start || ts > coveredEnd || ts <= after {
+				continue
+			}
+			p := &relayoutPoint{ts: ts, resolution: actual, value: value, max: math.NaN(), min: math.NaN()}
+			if v, ok := maxes[ts]; ok {
+				p.max = v
+			}
+			if v, ok := mins[ts]; ok {
+				p.min = v
+			}
+			points = append(points, p)
+		}
+		coveredEnd = start
+	}
+
+	sort.Sort(byTs(points))
+	return points, nil
+}
+
+// 按时间戳返回非空的值, 以及实际读到的粒度(rrd可能选择其他粒度的归档)
+func fetchValues(fetchFn fetchFunc, filename string, cf string, start, end int64, resolution int64) (map[int64]float64, int64, error) {
+	datas, err := fetchFn(filename, cf, start, end, int(resolution))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	actual := resolution
+	if len(datas) > 1 {
+		actual = datas[1].Timestamp - datas[0].Timestamp
+	}
+	values := map[int64]float64{}
+	for _, d := range datas {
+		if value := float64(d.Value); !math.IsNaN(value) {
+			values[d.Timestamp] = value
+		}
+	}
+	return values, actual, nil
+}
+
+func fetchExtremes(fetchFn fetchFunc, filename string, cf string, start, end int64, resolution int64) (map[int64]float64, error) {
+	values, actual, err := fetchValues(fetchFn, filename, cf, start, end, resolution)
+	if err != nil || actual != resolution {
+		return map[int64]float64{}, err
+	}
+	return values, nil
+}
+
+// 一个归档点展开为n个step的值, 平均值不变.
+// 有MAX、MIN时第一个step为最大值, 最后一个step为最小值, 新文件的MAX、MIN归档由此还原
+func stepValues(p *relayoutPoint, n int) []float64 {
+	if n < 1 {
+		n = 1
+	}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = p.value
+	}
+
+	hasMax, hasMin := !math.IsNaN(p.max), !math.IsNaN(p.min)
+	extremes := 0
+	sum := p.value * float64(n)
+	if hasMax {
+		extremes++
+		sum -= p.max
+	}
+	if hasMin {
+		extremes++
+		sum -= p.min
+	}
+	if extremes == 0 || n <= extremes {
+		return values
+	}
+
+	rest := sum / float64(n-extremes)
+	if hasMax && rest > p.max {
+		rest = p.max
+	}
+	if hasMin && rest < p.min {
+		rest = p.min
+	}
+	for i := range values {
+		values[i] = rest
+	}
+	if hasMax {
+		values[0] = p.max
+	}
+	if hasMin {
+		values[n-1] = p.min
+	}
+	return values
+}
+
+// 把归档点展开为每个step的更新写入文件, 快照和之后补写的数据使用同一个replayer.
+// 相邻两次更新不超过heartbeat, 否则rrd会把区间记为unknown.
+// DERIVE/COUNTER写入由速率累加的计数
+type replayer struct {
+	filename   string
+	step       int64
+	cumulative bool
+	last       int64
+	counter    float64
+}
+
+func newReplayer(filename string, item *cmodel.GraphItem) *replayer {
+	return &replayer{
+		filename:   filename,
+		step:       int64(item.Step),
+		cumulative: item.DsType == g.DERIVE || item.DsType == g.COUNTER,
+	}
+}
+
+func (this *replayer) replay(points []*relayoutPoint) error {
+	u := rrdlite.NewUpdater(this.filename)
+	cached := 0
+	cache := func(ts int64, value float64) error {
+		if ts <= this.last {
+			return nil
+		}
+		this.last = ts
+		if this.cumulative {
+			u.Cache(ts, int(math.Floor(value)))
+		} else {
+			u.Cache(ts, value)
+		}
+		if cached++; cached >= relayoutUpdateBatch {
+			cached = 0
+			err := u.Update()
+			u = rrdlite.NewUpdater(this.filename)
+			return err
+		}
+		return nil
+	}
+
+	for _, p := range points {
+		begin := p.ts - p.resolution
+		// 与上一个点不连续时先写入区间起点
+		if begin > this.last {
+			if err := cache(begin, this.counter); err != nil {
+				return err
+			}
+		}
+		for i, value := range stepValues(p, int(p.resolution/this.step)) {
+			if this.cumulative {
+				this.counter += value * float64(this.step)
+			} else {
+				this.counter = value
+			}
+			if err := cache(begin+int64(i+1)*this.step, this.counter); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cached == 0 {
+		return nil
+	}
+	return u.Update()
+}
+
+type byPdp []*archive
+
+func (this byPdp) Len() int           { return len(this) }
+func (this byPdp) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this byPdp) Less(i, j int) bool { return this[i].pdp < this[j].pdp }
+
+type byTs []*relayoutPoint
+
+func (this byTs) Len() int           { return len(this) }
+func (this byTs) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this byTs) Less(i, j int) bool { return this[i].ts < this[j].ts }
+
+// 批量重建的进度
+type RelayoutStatus struct {
+	Running  bool      `json:"running"`
+	DryRun   bool      `json:"dryRun"`
+	Total    int       `json:"total"`
+	Done     int       `json:"done"`
+	Skipped  int       `json:"skipped"`
+	Failed   int       `json:"failed"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+var (
+	relayoutLock   sync.Mutex
+	relayoutStatus = &RelayoutStatus{}
+)
+
+func GetRelayoutStatus() RelayoutStatus {
+	relayoutLock.Lock()
+	defer relayoutLock.Unlock()
+	return *relayoutStatus
+}
+
+// 后台重建items中归档与匹配的策略不同的文件, 同时只能有一个批量任务.
+// dryRun时只统计需要重建的文件
+func StartRelayoutAll(items []*cmodel.GraphItem, dryRun bool) error {
+	relayoutLock.Lock()
+	defer relayoutLock.Unlock()
+	if relayoutStatus.Running {
+		return fmt.Errorf("relayout is running")
+	}
+
+	relayoutStatus = &RelayoutStatus{Running: true, DryRun: dryRun, Total: len(items), Started: time.Now()}
+	go relayoutAll(items, dryRun)
+	return nil
+}
+
+func relayoutAll(items []*cmodel.GraphItem, dryRun bool) {
+	cfg := g.Config()
+	for _, item := range items {
+		filename := g.RrdFileName(cfg.RRD.Storage, item.Checksum(), item.DsType, item.Step)
+
+		var err error
+		skipped := true
+		if g.IsRrdFileExist(filename) {
+			skipped, err = isLayoutOf(filename, item)
+		}
+		if err == nil && !skipped && !dryRun {
+			err = Relayout(filename, item)
+		}
+		if err != nil {
+			log.Errorf("relayout %s(%s) fail: %v", filename, item.PrimaryKey(), err)
+		}
+
+		relayoutLock.Lock()
+		switch {
+		case err != nil:
+			relayoutStatus.Failed++
+		case skipped:
+			relayoutStatus.Skipped++
+		default:
+			relayoutStatus.Done++
+		}
+		relayoutLock.Unlock()
+	}
+
+	relayoutLock.Lock()
+	relayoutStatus.Running = false
+	relayoutStatus.Finished = time.Now()
+	relayoutLock.Unlock()
+	log.Printf("relayout done: %+v", GetRelayoutStatus())
+}
+
+// 文件的归档是否与item当前匹配的策略相同
+func isLayoutOf(filename string, item *cmodel.GraphItem) (bool, error) {
+	archives, err := fileArchives(filename)
+	if err != nil {
+		return false, err
+	}
+	policy := g.Config().Retention.PolicyOf(item.Endpoint, item.Metric, item.Tags, item.Step)
+	return reflect.DeepEqual(archives, archivesOf(policy, item.Step)), nil
+}
+
+// 确认重建的结果, 删除保留的原文件. filename为空时删除存储目录下全部的备份, 返回删除的数量
+func ConfirmRelayout(filename string) (int, error) {
+	if filename != "" {
+		if err := os.Remove(filename + relayoutBackupSuffix); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	if GetRelayoutStatus().Running {
+		return 0, fmt.Errorf("relayout is running")
+	}
+
+	removed := 0
+	err := filepath.Walk(g.Config().RRD.Storage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".rrd"+relayoutBackupSuffix) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,103 @@
+package rrdtool
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+)
+
+func TestStepValues(t *testing.T) {
+	nan := math.NaN()
+	testCases := []*struct {
+		point    *relayoutPoint
+		n        int
+		expected []float64
+	}{
+		{&relayoutPoint{value: 10, max: nan, min: nan}, 3, []float64{10, 10, 10}},
+		{&relayoutPoint{value: 10, max: 15, min: 5}, 5, []float64{15, 10, 10, 10, 5}},
+		{&relayoutPoint{value: 20, max: 25, min: nan}, 5, []float64{25, 18.75, 18.75, 18.75, 18.75}},
+		{&relayoutPoint{value: 30, max: nan, min: 28}, 5, []float64{30.5, 30.5, 30.5, 30.5, 28}},
+		// 不足以放下最大值和最小值
+		{&relayoutPoint{value: 10, max: 15, min: 5}, 2, []float64{10, 10}},
+		{&relayoutPoint{value: 10, max: 15, min: 5}, 1, []float64{10}},
+		// 不一致的数据, 不超出最大值
+		{&relayoutPoint{value: 10, max: 10, min: 0}, 3, []float64{10, 10, 0}},
+	}
+
+	for i, testCase := range testCases {
+		if values := stepValues(testCase.point, testCase.n); !reflect.DeepEqual(values, testCase.expected) {
+			t.Errorf("[%d] Expected values: %v. Got: %v", i, testCase.expected, values)
+		}
+	}
+}
+
+func TestReadArchives(t *testing.T) {
+	archives := []*archive{
+		{"AVERAGE", 1, 4},
+		{"AVERAGE", 5, 4},
+		{"MAX", 5, 4},
+		{"MIN", 5, 4},
+	}
+	nan := math.NaN()
+	series := map[string]map[int][]float64{
+		"AVERAGE": {60: {1, 2, 3, 4}, 300: {10, 20, 30}},
+		"MAX":     {300: {15, 25, nan}},
+		"MIN":     {300: {5, nan, 28}},
+	}
+
+	// 每个粒度的第一个点的时间
+	firsts := map[int]int64{60: 5820, 300: 5100}
+
+	fetched := []int{}
+	fakeFetch := func(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+		fetched = append(fetched, step)
+		datas := []*cmodel.RRDData{}
+		for ts := start + int64(step); ts <= end; ts += int64(step) {
+			value := nan
+			if i := int((ts - firsts[step]) / int64(step)); i >= 0 && i < len(series[cf][step]) {
+				value = series[cf][step][i]
+			}
+			datas = append(datas, &cmodel.RRDData{Timestamp: ts, Value: cmodel.JsonFloat(value)})
+		}
+		return datas, nil
+	}
+
+	points, err := readArchives(fakeFetch, "test.rrd", archives, 60, 6000, 5200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*relayoutPoint{
+		{5400, 300, 20, 25, nan},
+		{5700, 300, 30, nan, 28},
+		{5820, 60, 1, nan, nan},
+		{5880, 60, 2, nan, nan},
+		{5940, 60, 3, nan, nan},
+		{6000, 60, 4, nan, nan},
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points. Got: %d", len(expected), len(points))
+	}
+	for i, p := range points {
+		e := expected[i]
+		if p.ts != e.ts || p.resolution != e.resolution || p.value != e.value ||
+			!sameValue(p.max, e.max) || !sameValue(p.min, e.min) {
+			t.Errorf("[%d] Expected point: %+v. Got: %+v", i, e, p)
+		}
+	}
+
+	// 补写快照之后的数据只读原始数据
+	fetched = []int{}
+	points, err = readArchives(fakeFetch, "test.rrd", archives, 60, 6000, 5880)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].ts != 5940 || points[1].ts != 6000 || !reflect.DeepEqual(fetched, []int{60}) {
+		t.Errorf("Unexpected points: %v, fetched: %v", points, fetched)
+	}
+}
+
+func sameValue(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
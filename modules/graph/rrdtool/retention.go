@@ -0,0 +1,171 @@
+package rrdtool
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	cutils "github.com/fwtpe/owl-backend/common/utils"
+	"github.com/fwtpe/owl-backend/modules/graph/g"
+)
+
+// 一个归档: 每pdp个step合并为一个点, 保存rows个点
+type archive struct {
+	cf   string
+	pdp  int
+	rows int
+}
+
+// 默认的归档策略
+func defaultArchives() []*archive {
+	return []*archive{
+		// 1分钟一个点存 12小时
+		{"AVERAGE", 1, RRA1PointCnt},
+
+		// 5m一个点存2d
+		{"AVERAGE", 5, RRA5PointCnt},
+		{"MAX", 5, RRA5PointCnt},
+		{"MIN", 5, RRA5PointCnt},
+
+		// 20m一个点存7d
+		{"AVERAGE", 20, RRA20PointCnt},
+		{"MAX", 20, RRA20PointCnt},
+		{"MIN", 20, RRA20PointCnt},
+
+		// 3小时一个点存3个月
+		{"AVERAGE", 180, RRA180PointCnt},
+		{"MAX", 180, RRA180PointCnt},
+		{"MIN", 180, RRA180PointCnt},
+
+		// 12小时一个点存1year
+		{"AVERAGE", 720, RRA720PointCnt},
+		{"MAX", 720, RRA720PointCnt},
+		{"MIN", 720, RRA720PointCnt},
+	}
+}
+
+// 按step计算策略的归档, policy为nil时使用默认策略.
+// resolution不足一个step的按一个step计算, 重复的归档只保留行数最多的一个
+func archivesOf(policy *g.RetentionPolicy, step int) []*archive {
+	if policy == nil {
+		return defaultArchives()
+	}
+
+	archives := []*archive{}
+	indexes := map[archive]int{}
+	for _, rra := range policy.RRAs {
+		pdp := rra.Resolution / step
+		if pdp < 1 {
+			pdp = 1
+		}
+		for _, cf := range rra.CFs {
+			key := archive{cf: cf, pdp: pdp}
+			if i, ok := indexes[key]; ok {
+				if archives[i].rows < rra.Rows {
+					archives[i].rows = rra.Rows
+				}
+				continue
+			}
+			indexes[key] = len(archives)
+			archives = append(archives, &archive{cf: cf, pdp: pdp, rows: rra.Rows})
+		}
+	}
+	return archives
+}
+
+// 由rrd文件的info得到文件实际的归档, 顺序与创建时相同
+func archivesOfInfo(info map[string]interface{}) ([]*archive, error) {
+	cfs, _ := info["rra.cf"].([]interface{})
+	pdps, _ := info["rra.pdp_per_row"].([]interface{})
+	rows, _ := info["rra.rows"].([]interface{})
+	if len(cfs) == 0 || len(pdps) != len(cfs) || len(rows) != len(cfs) {
+		return nil, fmt.Errorf("bad rra info: %d cf, %d pdp_per_row, %d rows", len(cfs), len(pdps), len(rows))
+	}
+
+	archives := make([]*archive, len(cfs))
+	for i := range cfs {
+		cf, ok := cfs[i].(string)
+		pdp, ok1 := infoInt(pdps[i])
+		row, ok2 := infoInt(rows[i])
+		if !ok || !ok1 || !ok2 {
+			return nil, fmt.Errorf("bad rra info of rra[%d]: %v %v %v", i, cfs[i], pdps[i], rows[i])
+		}
+		archives[i] = &archive{cf: cf, pdp: pdp, rows: row}
+	}
+	return archives, nil
+}
+
+func infoInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case uint:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// 原始数据(未归档)保存的时长(秒), 没有原始数据的归档时为0
+func rawSpanOf(archives []*archive, step int) int64 {
+	var span int64
+	for _, a := range archives {
+		if a.cf == "AVERAGE" && a.pdp == 1 && int64(a.rows*step) > span {
+			span = int64(a.rows * step)
+		}
+	}
+	return span
+}
+
+// 文件的原始数据时长, 由文件的归档得出(文件的归档可能与当前的策略不同).
+// 文件创建或被替换时清除
+var (
+	rawSpanLock sync.RWMutex
+	rawSpans    = map[string]int64{}
+)
+
+// 原始数据保存的时长(秒), 文件不存在时按当前匹配的策略计算
+func RawSpan(filename string, endpoint string, counter string, step int) int64 {
+	rawSpanLock.RLock()
+	span, ok := rawSpans[filename]
+	rawSpanLock.RUnlock()
+	if ok {
+		return span
+	}
+
+	if g.IsRrdFileExist(filename) {
+		archives, err := fileArchives(filename)
+		if err == nil {
+			span = rawSpanOf(archives, step)
+			rawSpanLock.Lock()
+			rawSpans[filename] = span
+			rawSpanLock.Unlock()
+			return span
+		}
+		log.Errorf("read rra info of %s fail: %v", filename, err)
+	}
+
+	metric, tags := splitCounter(counter)
+	return rawSpanOf(archivesOf(g.Config().Retention.PolicyOf(endpoint, metric, tags, step), step), step)
+}
+
+func forgetRawSpan(filename string) {
+	rawSpanLock.Lock()
+	delete(rawSpans, filename)
+	rawSpanLock.Unlock()
+}
+
+// counter的格式为 metric/tags
+func splitCounter(counter string) (string, map[string]string) {
+	if i := strings.Index(counter, "/"); i >= 0 {
+		return counter[:i], cutils.DictedTagstring(counter[i+1:])
+	}
+	return counter, map[string]string{}
+}
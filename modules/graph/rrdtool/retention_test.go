@@ -0,0 +1,72 @@
+package rrdtool
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/modules/graph/g"
+)
+
+func TestArchivesOf(t *testing.T) {
+	policy := &g.RetentionPolicy{
+		Name: "kpi",
+		RRAs: []*g.RRAConfig{
+			{Resolution: 0, Rows: 1440, CFs: []string{"AVERAGE"}},
+			{Resolution: 30, Rows: 2880, CFs: []string{"AVERAGE"}},
+			{Resolution: 3600, Rows: 8760, CFs: []string{"AVERAGE", "MAX"}},
+		},
+	}
+
+	expected := []*archive{
+		{"AVERAGE", 1, 2880},
+		{"AVERAGE", 60, 8760},
+		{"MAX", 60, 8760},
+	}
+	if archives := archivesOf(policy, 60); !reflect.DeepEqual(archives, expected) {
+		t.Errorf("Unexpected archives: %v", archives)
+	}
+
+	if archives := archivesOf(nil, 60); len(archives) != 13 || archives[0].pdp != 1 || archives[0].rows != RRA1PointCnt {
+		t.Errorf("Expected the default archives. Got: %v", archives)
+	}
+	if span := maxSpan(archivesOf(nil, 60), 60); span != 720*RRA720PointCnt*60 {
+		t.Errorf("Unexpected span of default archives: %d", span)
+	}
+}
+
+func TestArchivesOfInfo(t *testing.T) {
+	info := map[string]interface{}{
+		"step":            uint(60),
+		"rra.cf":          []interface{}{"AVERAGE", "AVERAGE", "MAX"},
+		"rra.pdp_per_row": []interface{}{uint(1), uint(60), uint(60)},
+		"rra.rows":        []interface{}{uint(2880), uint(8760), uint(8760)},
+	}
+
+	expected := []*archive{
+		{"AVERAGE", 1, 2880},
+		{"AVERAGE", 60, 8760},
+		{"MAX", 60, 8760},
+	}
+	archives, err := archivesOfInfo(info)
+	if err != nil || !reflect.DeepEqual(archives, expected) {
+		t.Errorf("Unexpected archives: %v, %v", archives, err)
+	}
+	if span := rawSpanOf(archives, 60); span != 2880*60 {
+		t.Errorf("Unexpected raw span: %d", span)
+	}
+
+	info["rra.rows"] = []interface{}{uint(2880)}
+	if _, err := archivesOfInfo(info); err == nil {
+		t.Errorf("Expected error of bad info")
+	}
+}
+
+func TestSplitCounter(t *testing.T) {
+	metric, tags := splitCounter("df.bytes.free.percent/fstype=ext4,mount=/home")
+	if metric != "df.bytes.free.percent" || !reflect.DeepEqual(tags, map[string]string{"fstype": "ext4", "mount": "/home"}) {
+		t.Errorf("Unexpected split: %s, %v", metric, tags)
+	}
+	if metric, tags := splitCounter("cpu.idle"); metric != "cpu.idle" || len(tags) != 0 {
+		t.Errorf("Unexpected split: %s, %v", metric, tags)
+	}
+}
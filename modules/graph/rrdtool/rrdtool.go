@@ -39,6 +39,11 @@ type readfile_t struct {
 	data     []byte
 }
 
+type info_t struct {
+	filename string
+	archives []*archive
+}
+
 func Start() {
 	cfg := g.Config()
 	var err error
@@ -65,36 +70,19 @@ const (
 )
 
 func create(filename string, item *cmodel.GraphItem) error {
-	now := time.Now()
-	start := now.Add(time.Duration(-24) * time.Hour)
-	step := uint(item.Step)
+	policy := g.Config().Retention.PolicyOf(item.Endpoint, item.Metric, item.Tags, item.Step)
+	return createWith(filename, item, archivesOf(policy, item.Step), time.Now().Add(time.Duration(-24)*time.Hour))
+}
 
-	c := rrdlite.NewCreator(filename, start, step)
+func createWith(filename string, item *cmodel.GraphItem, archives []*archive, start time.Time) error {
+	forgetRawSpan(filename)
+	c := rrdlite.NewCreator(filename, start, uint(item.Step))
 	c.DS("metric", item.DsType, item.Heartbeat, item.Min, item.Max)
 
 	// 设置各种归档策略
-	// 1分钟一个点存 12小时
-	c.RRA("AVERAGE", 0.5, 1, RRA1PointCnt)
-
-	// 5m一个点存2d
-	c.RRA("AVERAGE", 0.5, 5, RRA5PointCnt)
-	c.RRA("MAX", 0.5, 5, RRA5PointCnt)
-	c.RRA("MIN", 0.5, 5, RRA5PointCnt)
-
-	// 20m一个点存7d
-	c.RRA("AVERAGE", 0.5, 20, RRA20PointCnt)
-	c.RRA("MAX", 0.5, 20, RRA20PointCnt)
-	c.RRA("MIN", 0.5, 20, RRA20PointCnt)
-
-	// 3小时一个点存3个月
-	c.RRA("AVERAGE", 0.5, 180, RRA180PointCnt)
-	c.RRA("MAX", 0.5, 180, RRA180PointCnt)
-	c.RRA("MIN", 0.5, 180, RRA180PointCnt)
-
-	// 12小时一个点存1year
-	c.RRA("AVERAGE", 0.5, 720, RRA720PointCnt)
-	c.RRA("MAX", 0.5, 720, RRA720PointCnt)
-	c.RRA("MIN", 0.5, 720, RRA720PointCnt)
+	for _, a := range archives {
+		c.RRA(a.cf, 0.5, a.pdp, a.rows)
+	}
 
 	return c.Create(true)
 }
@@ -187,6 +175,27 @@ func Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RR
 	return task.args.(*fetch_t).data, err
 }
 
+// 文件实际的归档, 在io worker中读取
+func fileArchives(filename string) ([]*archive, error) {
+	done := make(chan error, 1)
+	task := &io_task_t{
+		method: IO_TASK_M_INFO,
+		args:   &info_t{filename: filename},
+		done:   done,
+	}
+	io_task_chan <- task
+	err := <-done
+	return task.args.(*info_t).archives, err
+}
+
+func info(filename string) ([]*archive, error) {
+	result, err := rrdlite.Info(filename)
+	if err != nil {
+		return nil, err
+	}
+	return archivesOfInfo(result)
+}
+
 func fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
 	start_t := time.Unix(start, 0)
 	end_t := time.Unix(end, 0)
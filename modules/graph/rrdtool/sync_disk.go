@@ -18,6 +18,8 @@ const (
 	IO_TASK_M_WRITE
 	IO_TASK_M_FLUSH
 	IO_TASK_M_FETCH
+	IO_TASK_M_INFO
+	IO_TASK_M_RELAYOUT
 )
 
 type io_task_t struct {
@@ -88,6 +90,7 @@ func ioWorker() {
 					if err = file.InsureDir(baseDir); err != nil {
 						task.done <- err
 					}
+					forgetRawSpan(args.Filename)
 					task.done <- writeFile(args.Filename, args.Body, 0644)
 				}
 			} else if task.method == IO_TASK_M_FLUSH {
@@ -99,6 +102,15 @@ func ioWorker() {
 					args.data, err = fetch(args.filename, args.cf, args.start, args.end, args.step)
 					task.done <- err
 				}
+			} else if task.method == IO_TASK_M_INFO {
+				if args, ok := task.args.(*info_t); ok {
+					args.archives, err = info(args.filename)
+					task.done <- err
+				}
+			} else if task.method == IO_TASK_M_RELAYOUT {
+				if args, ok := task.args.(*relayout_t); ok {
+					task.done <- commitRelayout(args)
+				}
 			}
 		}
 	}
@@ -52,6 +52,7 @@ func (t *Hbs) GetStrategies(req model.NullRpcRequest, reply *model.StrategiesRes
 				Func:       ns.Func,
 				Operator:   ns.Operator,
 				RightValue: ns.RightValue,
+				Condition:  ns.Condition,
 				MaxStep:    ns.MaxStep,
 				Priority:   ns.Priority,
 				Note:       ns.Note,
@@ -32,4 +32,6 @@ func cleanStale() {
 			store.HistoryBigMap[arr[i]+arr[j]].CleanStale(before)
 		}
 	}
+
+	store.CleanStaleBaselineHistory()
 }
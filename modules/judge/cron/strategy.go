@@ -8,6 +8,7 @@ import (
 
 	"github.com/fwtpe/owl-backend/common/model"
 	"github.com/fwtpe/owl-backend/modules/judge/g"
+	"github.com/fwtpe/owl-backend/modules/judge/store"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -76,11 +77,13 @@ func rebuildStrategyMap(strategiesResponse *model.StrategiesResponse) {
 			fmt.Println(string(bs))
 		}
 		for _, strategy := range hs.Strategies {
-			key := fmt.Sprintf("%s/%s", hostname, strategy.Metric)
-			if _, exists := m[key]; exists {
-				m[key] = append(m[key], strategy)
-			} else {
-				m[key] = []model.Strategy{strategy}
+			for _, metric := range strategyMetrics(strategy) {
+				key := fmt.Sprintf("%s/%s", hostname, metric)
+				if _, exists := m[key]; exists {
+					m[key] = append(m[key], strategy)
+				} else {
+					m[key] = []model.Strategy{strategy}
+				}
 			}
 		}
 	}
@@ -88,6 +91,27 @@ func rebuildStrategyMap(strategiesResponse *model.StrategiesResponse) {
 	g.StrategyMap.ReInit(m)
 }
 
+// 组合策略在条件中引用的曲线更新时也需要判断
+func strategyMetrics(strategy model.Strategy) []string {
+	metrics := []string{strategy.Metric}
+	if strategy.Condition == "" {
+		return metrics
+	}
+
+	cond, err := store.ParseCondition(strategy.Condition)
+	if err != nil {
+		log.Errorf("parse condition %q fail: %v. strategy id: %d", strategy.Condition, err, strategy.Id)
+		return metrics
+	}
+
+	for _, metric := range cond.Metrics() {
+		if metric != strategy.Metric {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
 func syncExpression() {
 	var expressionResponse model.ExpressionResponse
 	err := g.HbsClient.Call("Hbs.GetExpressions", model.NullRpcRequest{}, &expressionResponse)
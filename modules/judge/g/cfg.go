@@ -43,17 +43,76 @@ type AlarmConfig struct {
 	StoreEventToFile    bool         `json:"store_event_to_file"`
 	EventsStoreFilePath string       `json:"events_store_file_path"`
 	Redis               *RedisConfig `json:"redis"`
+	// The destinations of events, the default is redis(queuePattern)
+	Sinks []*EventSinkConfig `json:"sinks"`
+}
+
+const (
+	EventSinkRedis = "redis"
+	EventSinkHttp  = "http"
+	EventSinkFile  = "file"
+)
+
+type EventSinkConfig struct {
+	// redis, http or file
+	Type string `json:"type"`
+	// The name of counters, the default is type
+	Name string `json:"name"`
+	// http: the events are POSTed as JSON
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Timeout int               `json:"timeout"`
+	// file: the events are appended as NDJSON(one event per line)
+	File string `json:"file"`
+	// The times of retrying after failure and the interval(milliseconds) between retries
+	Retries       int `json:"retries"`
+	RetryInterval int `json:"retryInterval"`
+	// The events are dropped if the queue is full
+	QueueSize int `json:"queueSize"`
+}
+
+func (this *AlarmConfig) EventSinks() []*EventSinkConfig {
+	if len(this.Sinks) == 0 {
+		return []*EventSinkConfig{{Type: EventSinkRedis}}
+	}
+	return this.Sinks
+}
+
+func (this *AlarmConfig) HasEventSink(sinkType string) bool {
+	for _, sink := range this.EventSinks() {
+		if sink.Type == sinkType {
+			return true
+		}
+	}
+	return false
+}
+
+// The API of query("/graph/history") for the baseline functions of strategy
+type QueryConfig struct {
+	QueryAddr      string `json:"queryAddr"`
+	ConnectTimeout int    `json:"connectTimeout"`
+	RequestTimeout int    `json:"requestTimeout"`
+}
+
+// The snapshot of history and last events, which is saved at shutdown and restored at startup
+type SnapshotConfig struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"`
+	// The snapshot older than this(seconds) is not restored
+	MaxAge int64 `json:"maxAge"`
 }
 
 type GlobalConfig struct {
-	Debug     bool         `json:"debug"`
-	DebugHost string       `json:"debugHost"`
-	RootDir   string       `json:"root_dir"`
-	Remain    int          `json:"remain"`
-	Http      *HttpConfig  `json:"http"`
-	Rpc       *RpcConfig   `json:"rpc"`
-	Hbs       *HbsConfig   `json:"hbs"`
-	Alarm     *AlarmConfig `json:"alarm"`
+	Debug     bool            `json:"debug"`
+	DebugHost string          `json:"debugHost"`
+	RootDir   string          `json:"root_dir"`
+	Remain    int             `json:"remain"`
+	Http      *HttpConfig     `json:"http"`
+	Rpc       *RpcConfig      `json:"rpc"`
+	Hbs       *HbsConfig      `json:"hbs"`
+	Alarm     *AlarmConfig    `json:"alarm"`
+	Query     *QueryConfig    `json:"query"`
+	Snapshot  *SnapshotConfig `json:"snapshot"`
 }
 
 var (
@@ -99,6 +158,14 @@ func ParseConfig(cfg string) {
 	if !strings.HasPrefix(c.Alarm.EventsStoreFilePath, "/") {
 		c.Alarm.EventsStoreFilePath = c.RootDir + "/" + c.Alarm.EventsStoreFilePath
 	}
+	for _, sink := range c.Alarm.Sinks {
+		if sink.Type == EventSinkFile && !strings.HasPrefix(sink.File, "/") {
+			sink.File = c.RootDir + "/" + sink.File
+		}
+	}
+	if c.Snapshot != nil && !strings.HasPrefix(c.Snapshot.File, "/") {
+		c.Snapshot.File = c.RootDir + "/" + c.Snapshot.File
+	}
 
 	configLock.Lock()
 	defer configLock.Unlock()
@@ -7,8 +7,14 @@ import (
 // change log
 // 2.0.1: bugfix HistoryData limit
 // 2.0.2: clean stale data
+// 2.1.0: lookup, stddev, median, percentile, rate and baseline functions of strategy
+// 2.2.0: snapshot of history and last events at shutdown, restored at startup
+// 2.3.0: backtest of strategy and expression with history of graph
+// 2.4.0: composite condition of strategy with several metrics of the same endpoint
+// 2.5.0: sinks of events: redis, http webhook and NDJSON file
+// 2.6.0: http api of current alerts: /alerts, /alerts/count and /alerts/recovered
 const (
-	VERSION = "2.0.2"
+	VERSION = "2.6.0"
 )
 
 func init() {
@@ -0,0 +1,119 @@
+package g
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+)
+
+type graphHistoryParam struct {
+	Start            int64                  `json:"start"`
+	End              int64                  `json:"end"`
+	CF               string                 `json:"cf"`
+	EndpointCounters []model.GraphInfoParam `json:"endpoint_counters"`
+}
+
+// The value of "NaN" is rendered as null by query
+type graphHistoryResponse struct {
+	Step   int `json:"step"`
+	Values []*struct {
+		Timestamp int64    `json:"timestamp"`
+		Value     *float64 `json:"value"`
+	} `json:"Values"`
+}
+
+var (
+	queryClient     *http.Client
+	queryClientOnce sync.Once
+)
+
+func getQueryClient() *http.Client {
+	queryClientOnce.Do(func() {
+		cfg := Config().Query
+		connectTimeout := time.Duration(cfg.ConnectTimeout) * time.Millisecond
+
+		queryClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				Dial:                (&net.Dialer{Timeout: connectTimeout}).Dial,
+				MaxIdleConnsPerHost: 4,
+			},
+			Timeout: time.Duration(cfg.RequestTimeout) * time.Millisecond,
+		}
+	})
+
+	return queryClient
+}
+
+// Whether or not the history of graph could be queried("query" is configured)
+func IsQueryEnabled() bool {
+	cfg := Config().Query
+	return cfg != nil && cfg.QueryAddr != ""
+}
+
+// Queries the history(consolidated by "AVERAGE") of a counter from query("/graph/history"),
+// the points without value are excluded.
+func QueryGraphHistory(endpoint string, counter string, start int64, end int64) ([]*model.HistoryData, error) {
+	history, _, err := QueryGraphHistoryWithStep(endpoint, counter, start, end)
+	return history, err
+}
+
+// Same as QueryGraphHistory, but also returns the step of the counter reported by graph(0 if unknown).
+//
+// The points out of the raw archive of graph are consolidated, the interval between them is longer than the step.
+func QueryGraphHistoryWithStep(endpoint string, counter string, start int64, end int64) ([]*model.HistoryData, int, error) {
+	if !IsQueryEnabled() {
+		return nil, 0, fmt.Errorf("query is not configured")
+	}
+
+	queryUrl := fmt.Sprintf("http://%s/graph/history", Config().Query.QueryAddr)
+	args := &graphHistoryParam{
+		Start: start, End: end, CF: "AVERAGE",
+		EndpointCounters: []model.GraphInfoParam{{Endpoint: endpoint, Counter: counter}},
+	}
+
+	argsBody, err := json.Marshal(args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", queryUrl, bytes.NewBuffer(argsBody))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := getQueryClient().Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, 0, fmt.Errorf("%s has bad response. status code: %d", queryUrl, resp.StatusCode)
+	}
+
+	var result []*graphHistoryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, err
+	}
+
+	history := []*model.HistoryData{}
+	if len(result) == 0 || result[0] == nil {
+		return history, 0, nil
+	}
+	for _, data := range result[0].Values {
+		if data == nil || data.Value == nil {
+			continue
+		}
+		history = append(history, &model.HistoryData{Timestamp: data.Timestamp, Value: *data.Value})
+	}
+
+	return history, result[0].Step, nil
+}
@@ -9,7 +9,7 @@ import (
 var RedisConnPool *redis.Pool
 
 func InitRedisConnPool() {
-	if !Config().Alarm.Enabled {
+	if !Config().Alarm.Enabled || !Config().Alarm.HasEventSink(EventSinkRedis) {
 		return
 	}
 
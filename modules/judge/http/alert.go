@@ -0,0 +1,85 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/judge/store"
+)
+
+const defaultRecoveredWithin = 3600
+
+func configAlertRoutes() {
+	// e.g. /alerts?endpoint=host-1&strategy=3&expression=0&priority=0&template=12
+	http.HandleFunc("/alerts", func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseAlertFilter(r)
+		if err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		RenderDataJson(w, store.CurrentAlerts(filter))
+	})
+
+	http.HandleFunc("/alerts/count", func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseAlertFilter(r)
+		if err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		RenderDataJson(w, store.CountAlerts(filter))
+	})
+
+	// e.g. /alerts/recovered?within=3600, the events recovered in the last hour
+	http.HandleFunc("/alerts/recovered", func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseAlertFilter(r)
+		if err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		within, err := intParam(r, "within", defaultRecoveredWithin)
+		if err != nil || within <= 0 {
+			RenderMsgJson(w, "within must be a positive integer")
+			return
+		}
+
+		RenderDataJson(w, store.RecoveredAlerts(filter, time.Now().Unix()-int64(within)))
+	})
+}
+
+func parseAlertFilter(r *http.Request) (*store.AlertFilter, error) {
+	filter := store.NewAlertFilter()
+	filter.Endpoint = r.URL.Query().Get("endpoint")
+
+	var err error
+	if filter.StrategyId, err = intParam(r, "strategy", 0); err != nil {
+		return nil, err
+	}
+	if filter.ExpressionId, err = intParam(r, "expression", 0); err != nil {
+		return nil, err
+	}
+	if filter.Priority, err = intParam(r, "priority", -1); err != nil {
+		return nil, err
+	}
+	if filter.TemplateId, err = intParam(r, "template", 0); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func intParam(r *http.Request, name string, defaultValue int) (int, error) {
+	str := r.URL.Query().Get(name)
+	if str == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %q", name, str)
+	}
+	return value, nil
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fwtpe/owl-backend/modules/judge/store"
+)
+
+func configBacktestRoutes() {
+	// method: post, body: store.BacktestRequest
+	http.HandleFunc("/backtest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req store.BacktestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		result, err := store.Backtest(&req)
+		AutoRender(w, result, err)
+	})
+}
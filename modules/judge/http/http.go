@@ -17,6 +17,8 @@ type Dto struct {
 func init() {
 	configCommonRoutes()
 	configInfoRoutes()
+	configBacktestRoutes()
+	configAlertRoutes()
 }
 
 func RenderJson(w http.ResponseWriter, v interface{}) {
@@ -25,6 +25,10 @@ func configInfoRoutes() {
 		RenderDataJson(w, m[urlParam])
 	})
 
+	http.HandleFunc("/counter/all", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, store.GetSinkCounters())
+	})
+
 	http.HandleFunc("/count", func(w http.ResponseWriter, r *http.Request) {
 		sum := 0
 		arr := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "a", "b", "c", "d", "e", "f"}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/fwtpe/owl-backend/common/logruslog"
 	"github.com/fwtpe/owl-backend/common/vipercfg"
@@ -29,10 +30,12 @@ func main() {
 	logruslog.Init()
 
 	g.InitRedisConnPool()
+	store.InitEventSinks()
 	g.InitHbsClient()
 	g.InitLastEvents()
 
 	store.InitHistoryBigMap()
+	store.RestoreSnapshot()
 
 	supervisorChn := make(chan string)
 
@@ -43,10 +46,11 @@ func main() {
 	go cron.CleanStale(supervisorChn)
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	select {
 	case sig := <-c:
+		store.SaveSnapshot()
 		if sig.String() == "^C" {
 			os.Exit(3)
 		}
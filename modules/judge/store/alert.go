@@ -0,0 +1,88 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/fwtpe/owl-backend/common/model"
+)
+
+// 当前的报警状态，来自g.LastEvents：PROBLEM是正在报警的，OK是已经恢复的
+type AlertFilter struct {
+	Endpoint     string
+	StrategyId   int
+	ExpressionId int
+	// 小于0时不过滤
+	Priority   int
+	TemplateId int
+}
+
+func NewAlertFilter() *AlertFilter {
+	return &AlertFilter{Priority: -1}
+}
+
+func (this *AlertFilter) Match(event *model.Event) bool {
+	switch {
+	case this.Endpoint != "" && event.Endpoint != this.Endpoint:
+		return false
+	case this.StrategyId != 0 && event.StrategyId() != this.StrategyId:
+		return false
+	case this.ExpressionId != 0 && event.ExpressionId() != this.ExpressionId:
+		return false
+	case this.Priority >= 0 && event.Priority() != this.Priority:
+		return false
+	case this.TemplateId != 0 && eventTemplateId(event) != this.TemplateId:
+		return false
+	}
+	return true
+}
+
+// 正在报警的event，按照eventTime由新到旧排序
+func CurrentAlerts(filter *AlertFilter) []*model.Event {
+	return filterLastEvents(filter, func(event *model.Event) bool {
+		return event.Status == "PROBLEM"
+	})
+}
+
+// 在@since(含)之后恢复的event，按照eventTime由新到旧排序
+func RecoveredAlerts(filter *AlertFilter, since int64) []*model.Event {
+	return filterLastEvents(filter, func(event *model.Event) bool {
+		return event.Status == "OK" && event.EventTime >= since
+	})
+}
+
+// 正在报警的event的数量，按照模板和优先级分组，表达式的模板是0
+func CountAlerts(filter *AlertFilter) *model.AlertCounts {
+	counts := model.NewAlertCounts()
+	for _, event := range CurrentAlerts(filter) {
+		counts.Total++
+		counts.ByTemplate[strconv.Itoa(eventTemplateId(event))]++
+		counts.ByPriority[strconv.Itoa(event.Priority())]++
+	}
+	return counts
+}
+
+func filterLastEvents(filter *AlertFilter, accept func(event *model.Event) bool) []*model.Event {
+	events := []*model.Event{}
+	for _, event := range copyLastEvents() {
+		if accept(event) && filter.Match(event) {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].EventTime != events[j].EventTime {
+			return events[i].EventTime > events[j].EventTime
+		}
+		return events[i].Id < events[j].Id
+	})
+	return events
+}
+
+// model.Event.TplId()在策略没有模板时会panic
+func eventTemplateId(event *model.Event) int {
+	if event.Strategy == nil || event.Strategy.Tpl == nil {
+		return 0
+	}
+	return event.Strategy.Tpl.Id
+}
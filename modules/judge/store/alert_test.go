@@ -0,0 +1,72 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+)
+
+func TestCurrentAndRecoveredAlerts(t *testing.T) {
+	defer resetHistoryAndEvents()
+	resetHistoryAndEvents()
+
+	tpl := &model.Template{Id: 12}
+	for _, event := range []*model.Event{
+		{Id: "s_1_a", Status: "PROBLEM", Endpoint: "host-1", EventTime: 100, Strategy: &model.Strategy{Id: 1, Priority: 0, Tpl: tpl}},
+		{Id: "s_2_a", Status: "PROBLEM", Endpoint: "host-1", EventTime: 300, Strategy: &model.Strategy{Id: 2, Priority: 2, Tpl: tpl}},
+		{Id: "s_2_b", Status: "PROBLEM", Endpoint: "host-2", EventTime: 200, Strategy: &model.Strategy{Id: 2, Priority: 2}},
+		{Id: "e_3_a", Status: "PROBLEM", Endpoint: "host-2", EventTime: 200, Expression: &model.Expression{Id: 3, Priority: 0}},
+		{Id: "s_1_b", Status: "OK", Endpoint: "host-2", EventTime: 400, Strategy: &model.Strategy{Id: 1, Priority: 0, Tpl: tpl}},
+		{Id: "s_1_c", Status: "OK", Endpoint: "host-3", EventTime: 50, Strategy: &model.Strategy{Id: 1, Priority: 0, Tpl: tpl}},
+	} {
+		g.LastEvents.Set(event.Id, event)
+	}
+
+	testCases := []*struct {
+		filter      *AlertFilter
+		expectedIds []string
+	}{
+		{NewAlertFilter(), []string{"s_2_a", "e_3_a", "s_2_b", "s_1_a"}},
+		{&AlertFilter{Endpoint: "host-2", Priority: -1}, []string{"e_3_a", "s_2_b"}},
+		{&AlertFilter{StrategyId: 2, Priority: -1}, []string{"s_2_a", "s_2_b"}},
+		{&AlertFilter{ExpressionId: 3, Priority: -1}, []string{"e_3_a"}},
+		{&AlertFilter{Priority: 0}, []string{"e_3_a", "s_1_a"}},
+		{&AlertFilter{TemplateId: 12, Priority: -1}, []string{"s_2_a", "s_1_a"}},
+	}
+	for i, testCase := range testCases {
+		if ids := eventIds(CurrentAlerts(testCase.filter)); !equalStrings(ids, testCase.expectedIds) {
+			t.Errorf("[%d] Expected: %v. Got: %v", i, testCase.expectedIds, ids)
+		}
+	}
+
+	if ids := eventIds(RecoveredAlerts(NewAlertFilter(), 100)); !equalStrings(ids, []string{"s_1_b"}) {
+		t.Errorf("Unexpected recovered alerts: %v", ids)
+	}
+
+	counts := CountAlerts(NewAlertFilter())
+	if counts.Total != 4 || counts.ByTemplate["12"] != 2 || counts.ByTemplate["0"] != 2 ||
+		counts.ByPriority["0"] != 2 || counts.ByPriority["2"] != 2 {
+		t.Errorf("Unexpected counts: %#v", counts)
+	}
+}
+
+func eventIds(events []*model.Event) []string {
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
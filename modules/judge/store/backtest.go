@@ -0,0 +1,174 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/utils"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+)
+
+const (
+	maxBacktestEndpoints = 100
+	// graph默认只保存12小时的原始数据（720个点），更早的数据已经被归档，不能当作每个step一个点来重放
+	maxBacktestDuration = 12 * 3600
+)
+
+// 回测：用graph中的历史数据重放策略（或表达式），得到会产生的报警event
+type BacktestRequest struct {
+	// 策略和表达式二选一
+	Strategy   *model.Strategy   `json:"strategy"`
+	Expression *model.Expression `json:"expression"`
+	// 表达式的tags中有endpoint时可以省略
+	Endpoints []string `json:"endpoints"`
+	// 曲线的tags，默认是策略（表达式）的tags
+	Tags  map[string]string `json:"tags"`
+	Start int64             `json:"start"`
+	End   int64             `json:"end"`
+}
+
+type BacktestSeries struct {
+	Endpoint string `json:"endpoint"`
+	Counter  string `json:"counter"`
+	Points   int    `json:"points"`
+	// 曲线的step（graph返回）和数据中相邻两点的最小间隔，间隔大于step说明数据已经被归档
+	Step     int    `json:"step"`
+	Interval int64  `json:"interval"`
+	Error    string `json:"error,omitempty"`
+}
+
+type BacktestResult struct {
+	Series []*BacktestSeries `json:"series"`
+	// 按照曲线、时间排序
+	Events []*model.Event `json:"events"`
+}
+
+/**
+ * 每条曲线的数据依次放入独立的SafeLinkedList，与线上使用同样的Function和sendEventIfNeed做判断，
+ * 判断时的"当前时间"是数据的时间。
+ *
+ * graph中COUNTER类型的数据已经是速率，所以回测时数据都被当作GAUGE，rate()对这种数据没有意义
+ */
+func Backtest(req *BacktestRequest) (*BacktestResult, error) {
+	if (req.Strategy == nil) == (req.Expression == nil) {
+		return nil, fmt.Errorf("one of strategy and expression is required")
+	}
+	if req.End <= req.Start || req.End-req.Start > maxBacktestDuration {
+		return nil, fmt.Errorf("time range must be in (0, %d] seconds", maxBacktestDuration)
+	}
+	if req.Strategy != nil && req.Strategy.Condition != "" {
+		return nil, fmt.Errorf("composite strategy is not supported")
+	}
+	if !isQueryEnabled() {
+		return nil, fmt.Errorf("query is not configured")
+	}
+
+	metric, funcStr, operator, rightValue := "", "", "", 0.0
+	tags, endpoints := req.Tags, req.Endpoints
+	if req.Strategy != nil {
+		metric, funcStr, operator, rightValue = req.Strategy.Metric, req.Strategy.Func, req.Strategy.Operator, req.Strategy.RightValue
+		if tags == nil {
+			tags = req.Strategy.Tags
+		}
+	} else {
+		metric, funcStr, operator, rightValue = req.Expression.Metric, req.Expression.Func, req.Expression.Operator, req.Expression.RightValue
+		if tags == nil {
+			tags = expressionTagsWithoutEndpoint(req.Expression)
+		}
+		if endpoint, ok := req.Expression.Tags["endpoint"]; ok && len(endpoints) == 0 {
+			endpoints = []string{endpoint}
+		}
+	}
+
+	if _, err := ParseFuncFromString(funcStr, operator, rightValue); err != nil {
+		return nil, fmt.Errorf("invalid func %q: %v", funcStr, err)
+	}
+	if len(endpoints) == 0 || len(endpoints) > maxBacktestEndpoints {
+		return nil, fmt.Errorf("the number of endpoints must be in [1, %d]", maxBacktestEndpoints)
+	}
+
+	result := &BacktestResult{Series: []*BacktestSeries{}, Events: []*model.Event{}}
+	counter := utils.Counter(metric, tags)
+	for _, endpoint := range endpoints {
+		series := &BacktestSeries{Endpoint: endpoint, Counter: counter}
+		result.Series = append(result.Series, series)
+
+		history, step, err := queryGraphHistoryWithStep(endpoint, counter, req.Start, req.End)
+		if err != nil {
+			series.Error = err.Error()
+			continue
+		}
+		series.Points, series.Step, series.Interval = len(history), step, pointInterval(history)
+		if step > 0 && series.Interval > int64(step) {
+			series.Error = fmt.Sprintf("the data is consolidated(interval: %ds, step: %ds), the time range is out of the raw archive of graph", series.Interval, step)
+			continue
+		}
+
+		items := make([]*model.JudgeItem, 0, len(history))
+		for _, data := range history {
+			items = append(items, &model.JudgeItem{
+				Endpoint: endpoint, Metric: metric, Tags: tags, JudgeType: "GAUGE",
+				Value: data.Value, Timestamp: data.Timestamp, ReachTransferTime: data.Timestamp,
+			})
+		}
+
+		result.Events = append(result.Events, replay(req, items)...)
+	}
+
+	return result, nil
+}
+
+// 相邻两点的最小间隔，少于两个点时是0
+func pointInterval(history []*model.HistoryData) int64 {
+	interval := int64(0)
+	for i := 1; i < len(history); i++ {
+		if d := history[i].Timestamp - history[i-1].Timestamp; d > 0 && (interval == 0 || d < interval) {
+			interval = d
+		}
+	}
+	return interval
+}
+
+func expressionTagsWithoutEndpoint(expression *model.Expression) map[string]string {
+	tags := make(map[string]string, len(expression.Tags))
+	for k, v := range expression.Tags {
+		if k != "endpoint" {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+// 重放一条曲线的数据（时间由旧到新），返回产生的event
+func replay(req *BacktestRequest, items []*model.JudgeItem) []*model.Event {
+	events := []*model.Event{}
+	lastEvents := make(map[string]*model.Event)
+
+	judger := &eventJudger{
+		getLastEvent: func(id string) (*model.Event, bool) {
+			event, exists := lastEvents[id]
+			return event, exists
+		},
+		send: func(event *model.Event) {
+			lastEvents[event.Id] = event
+			events = append(events, event)
+		},
+	}
+
+	remain := g.Config().Remain
+	L := &SafeLinkedList{L: list.New()}
+	for _, item := range items {
+		if !L.PushFrontAndMaintain(item, remain) {
+			continue
+		}
+
+		if req.Strategy != nil {
+			judger.judgeItemWithStrategy(L, *req.Strategy, item, item.Timestamp)
+		} else {
+			judger.judgeItemWithExpression(L, req.Expression, item, item.Timestamp)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+)
+
+func TestBacktest(t *testing.T) {
+	initTestConfig(t)
+
+	defer func(oldIsQueryEnabled func() bool, oldQuery func(string, string, int64, int64) ([]*model.HistoryData, int, error)) {
+		isQueryEnabled, queryGraphHistoryWithStep = oldIsQueryEnabled, oldQuery
+	}(isQueryEnabled, queryGraphHistoryWithStep)
+
+	isQueryEnabled = func() bool { return true }
+	queryGraphHistoryWithStep = func(endpoint string, counter string, start int64, end int64) ([]*model.HistoryData, int, error) {
+		if endpoint == "host-down" {
+			return nil, 0, fmt.Errorf("connection refused")
+		}
+		if counter != "disk.io.util/device=sda" {
+			return nil, 0, fmt.Errorf("unexpected counter: %s", counter)
+		}
+
+		// The data out of the raw archive is consolidated by 5 minutes
+		interval := 60
+		if endpoint == "host-archived" {
+			interval = 300
+		}
+
+		history := []*model.HistoryData{}
+		for i, value := range []float64{95, 95, 95, 95, 10} {
+			history = append(history, &model.HistoryData{Timestamp: start + int64(i*interval), Value: value})
+		}
+		return history, 60, nil
+	}
+
+	start := int64(1600000000)
+	strategy := &model.Strategy{
+		Id: 7, Metric: "disk.io.util", Tags: map[string]string{"device": "sda"},
+		Func: "all(#3)", Operator: ">", RightValue: 90, MaxStep: 3,
+	}
+	result, err := Backtest(&BacktestRequest{
+		Strategy: strategy, Endpoints: []string{"host-1", "host-down", "host-archived"}, Start: start, End: start + 3600,
+	})
+	if err != nil {
+		t.Fatalf("Backtest() has error: %v", err)
+	}
+
+	if len(result.Series) != 3 {
+		t.Fatalf("Expected 3 series. Got: %v", result.Series)
+	}
+	if series := result.Series[0]; series.Points != 5 || series.Step != 60 || series.Interval != 60 || series.Error != "" {
+		t.Errorf("Unexpected series: %v", series)
+	}
+	if series := result.Series[1]; series.Error == "" {
+		t.Errorf("Expected error of series: %v", series)
+	}
+	// The consolidated data is not replayed
+	if series := result.Series[2]; series.Interval != 300 || series.Error == "" {
+		t.Errorf("Expected error of consolidated series: %v", series)
+	}
+
+	// The point which has produced an event is not used to judge again
+	expectedEvents := []*struct {
+		status    string
+		eventTime int64
+	}{
+		{"PROBLEM", start + 120},
+		{"OK", start + 240},
+	}
+	if len(result.Events) != len(expectedEvents) {
+		t.Fatalf("Expected %d events. Got: %v", len(expectedEvents), result.Events)
+	}
+	for i, expected := range expectedEvents {
+		event := result.Events[i]
+		if event.Status != expected.status || event.EventTime != expected.eventTime || event.Endpoint != "host-1" || event.Strategy.Id != 7 {
+			t.Errorf("[%d] Expected: %s at %d. Got: %v", i, expected.status, expected.eventTime, event)
+		}
+	}
+
+	// The endpoint is from tags of expression
+	result, err = Backtest(&BacktestRequest{
+		Expression: &model.Expression{
+			Id: 3, Metric: "disk.io.util", Tags: map[string]string{"endpoint": "host-1", "device": "sda"},
+			Func: "max(#1)", Operator: "<", RightValue: 50, MaxStep: 1,
+		},
+		Start: start, End: start + 3600,
+	})
+	item := &model.JudgeItem{Endpoint: "host-1", Metric: "disk.io.util", Tags: map[string]string{"device": "sda"}}
+	if err != nil || len(result.Events) != 1 || result.Events[0].Id != "e_3_"+item.PrimaryKey() {
+		t.Errorf("Unexpected result of expression: %v, %v", result, err)
+	}
+
+	invalidRequests := []*BacktestRequest{
+		{Endpoints: []string{"host-1"}, Start: start, End: start + 3600},
+		{Strategy: strategy, Expression: &model.Expression{}, Endpoints: []string{"host-1"}, Start: start, End: start + 3600},
+		{Strategy: strategy, Endpoints: []string{"host-1"}, Start: start, End: start},
+		{Strategy: strategy, Endpoints: []string{"host-1"}, Start: start, End: start + maxBacktestDuration + 1},
+		{Strategy: strategy, Start: start, End: start + 3600},
+		{Strategy: &model.Strategy{Metric: "disk.io.util", Func: "unknown(#3)"}, Endpoints: []string{"host-1"}, Start: start, End: start + 3600},
+	}
+	for i, req := range invalidRequests {
+		if _, err := Backtest(req); err == nil {
+			t.Errorf("[%d] Expected error for request: %#v", i, req)
+		}
+	}
+}
+
+func initTestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "judge-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "cfg.json")
+	cfg := `{"remain": 11, "root_dir": "/tmp", "alarm": {"minInterval": 300, "events_store_file_path": "events.json"}}`
+	if err := ioutil.WriteFile(cfgFile, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g.ParseConfig(cfgFile)
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/utils"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+)
+
+const (
+	// 每次从graph查询一个小时的历史数据，之后的判断尽量复用缓存
+	baselineFetchSpan = 3600
+	// 查询失败之后，至少间隔这么多秒才重新查询
+	baselineRetryInterval = 60
+	// 缓存中超过这么多秒没有被使用的历史数据会被清除
+	baselineCacheTtl = 2 * baselineFetchSpan
+	// 缓存剩余的时间少于这么多秒时，提前在后台查询之后的数据
+	baselinePrefetchAhead = baselineFetchSpan / 6
+	// 同时向graph查询历史数据的最大数量
+	baselineMaxConcurrentQueries = 16
+)
+
+// baseline(#3,7): 最新3个点的均值，与7天前同一时段的均值相比的变化率（百分比），
+// 7天前的数据从graph（经由query）获取，e.g. baseline(#3,1) > 50 表示比昨天同一时段高出50%
+type BaselineFunction struct {
+	Function
+	Limit      int
+	Days       int
+	Operator   string
+	RightValue float64
+}
+
+func (this BaselineFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	if !isQueryEnabled() {
+		log.Debugf("query is not configured, baseline is not judged")
+		isEnough = false
+		return
+	}
+
+	firstItem := L.Front().Value.(*model.JudgeItem)
+	offset := int64(this.Days) * 86400
+	history, ok := baselineHistory.get(
+		firstItem.Endpoint, utils.Counter(firstItem.Metric, firstItem.Tags), offset,
+		vs[this.Limit-1].Timestamp-offset, vs[0].Timestamp-offset,
+	)
+	// 没有可以比较的历史数据（包括正在后台查询），就不做判断
+	if !ok || len(history) == 0 {
+		isEnough = false
+		return
+	}
+
+	baseline := averageOf(history)
+	if baseline == 0 {
+		isEnough = false
+		return
+	}
+
+	leftValue = (averageOf(vs) - baseline) / baseline * 100.0
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+func averageOf(vs []*model.HistoryData) float64 {
+	sum := 0.0
+	for _, v := range vs {
+		sum += v.Value
+	}
+	return sum / float64(len(vs))
+}
+
+// 可以在测试中替换
+var (
+	isQueryEnabled            = g.IsQueryEnabled
+	queryGraphHistory         = g.QueryGraphHistory
+	queryGraphHistoryWithStep = g.QueryGraphHistoryWithStep
+)
+
+// 缓存从graph查询到的历史数据，key是"endpoint/counter/offset"。
+// 查询在后台进行，不会阻塞判断；同一个key同时只有一个查询
+type baselineHistoryCache struct {
+	sync.Mutex
+	M map[string]*baselineSeries
+
+	fetching  map[string]bool
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+}
+
+type baselineSeries struct {
+	start int64
+	end   int64
+	// 时间由小到大
+	values []*model.HistoryData
+
+	fetchTime  int64
+	accessTime int64
+	failed     bool
+}
+
+func newBaselineHistoryCache() *baselineHistoryCache {
+	return &baselineHistoryCache{
+		M:         make(map[string]*baselineSeries),
+		fetching:  make(map[string]bool),
+		semaphore: make(chan struct{}, baselineMaxConcurrentQueries),
+	}
+}
+
+var baselineHistory = newBaselineHistoryCache()
+
+// 获取[start, end]之间的历史数据，缓存没有覆盖这段时间时，会在后台从graph查询[start, start + baselineFetchSpan]，
+// 查询完成之前返回false
+func (this *baselineHistoryCache) get(endpoint string, counter string, offset int64, start int64, end int64) ([]*model.HistoryData, bool) {
+	key := fmt.Sprintf("%s/%s/%d", endpoint, counter, offset)
+	now := time.Now().Unix()
+
+	this.Lock()
+	defer this.Unlock()
+
+	series, exists := this.M[key]
+	if exists {
+		series.accessTime = now
+	}
+
+	switch {
+	case exists && series.failed && now-series.fetchTime < baselineRetryInterval:
+		return nil, false
+	case exists && !series.failed && series.start <= start && end <= series.end:
+		if series.end-end < baselinePrefetchAhead {
+			this.fetchInBackground(key, endpoint, counter, start, end)
+		}
+		return series.around(start, end), true
+	}
+
+	this.fetchInBackground(key, endpoint, counter, start, end)
+	return nil, false
+}
+
+// 必须在持有锁时调用
+func (this *baselineHistoryCache) fetchInBackground(key string, endpoint string, counter string, start int64, end int64) {
+	if this.fetching[key] {
+		return
+	}
+	this.fetching[key] = true
+
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+
+		this.semaphore <- struct{}{}
+		newSeries := fetchBaselineSeries(endpoint, counter, start, end)
+		<-this.semaphore
+
+		this.Lock()
+		defer this.Unlock()
+		this.M[key] = newSeries
+		delete(this.fetching, key)
+	}()
+}
+
+func fetchBaselineSeries(endpoint string, counter string, start int64, end int64) *baselineSeries {
+	fetchEnd := start + baselineFetchSpan
+	if fetchEnd < end {
+		fetchEnd = end
+	}
+
+	now := time.Now().Unix()
+	series := &baselineSeries{start: start, end: fetchEnd, fetchTime: now, accessTime: now}
+	values, err := queryGraphHistory(endpoint, counter, start, fetchEnd)
+	if err != nil {
+		log.Errorf("query history of baseline fail: %v. endpoint: %s, counter: %s", err, endpoint, counter)
+		series.failed = true
+	}
+	series.values = values
+	return series
+}
+
+// 一天以前的数据通常已经被graph归档（5分钟、20分钟甚至3小时一个点），[start, end]之间可能没有点，
+// 此时使用离这段时间最近的点
+func (this *baselineSeries) around(start int64, end int64) []*model.HistoryData {
+	vs := []*model.HistoryData{}
+	var nearest *model.HistoryData
+	var nearestDistance int64
+
+	for _, v := range this.values {
+		if v.Timestamp >= start && v.Timestamp <= end {
+			vs = append(vs, v)
+			continue
+		}
+
+		distance := start - v.Timestamp
+		if v.Timestamp > end {
+			distance = v.Timestamp - end
+		}
+		if nearest == nil || distance < nearestDistance {
+			nearest, nearestDistance = v, distance
+		}
+	}
+
+	if len(vs) == 0 && nearest != nil {
+		vs = append(vs, nearest)
+	}
+	return vs
+}
+
+func (this *baselineHistoryCache) CleanStale(before int64) {
+	this.Lock()
+	defer this.Unlock()
+
+	for key, series := range this.M {
+		if series.accessTime < before {
+			delete(this.M, key)
+		}
+	}
+}
+
+// 清除长时间没有被使用的历史数据
+func CleanStaleBaselineHistory() {
+	baselineHistory.CleanStale(time.Now().Unix() - baselineCacheTtl)
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+
+	ccondition "github.com/fwtpe/owl-backend/common/condition"
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/utils"
+)
+
+/**
+ * 组合策略的条件(model.Strategy.Condition)，与策略本身的条件(func operator rightValue)组合判断，
+ * 语法见common/condition，e.g. "and load.1min:avg(#3) > cpu.core:max(#1) * 2"
+ *
+ * 任何一条被引用的曲线的数据不够时都不做判断
+ */
+const (
+	conditionAnd = ccondition.OpAnd
+	conditionOr  = ccondition.OpOr
+)
+
+type Condition struct {
+	// 与策略本身的条件的组合方式：and、or
+	Combiner string
+	root     boolNode
+	refs     []*ccondition.SeriesRef
+}
+
+// 被引用的其他曲线的metric(不重复)
+func (this *Condition) Metrics() []string {
+	metrics := []string{}
+	existing := make(map[string]bool)
+	for _, ref := range this.refs {
+		if ref.Metric != "" && !existing[ref.Metric] {
+			existing[ref.Metric] = true
+			metrics = append(metrics, ref.Metric)
+		}
+	}
+	return metrics
+}
+
+// 曲线的数据是否是条件中引用的曲线
+func (this *Condition) References(item *model.JudgeItem) bool {
+	for _, ref := range this.refs {
+		if ref.Metric == item.Metric && utils.SortedTags(ref.Tags) == utils.SortedTags(item.Tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// @return isTriggered, isEnough, 参与判断的所有点
+func (this *Condition) Test(endpoint string, primary *SafeLinkedList) (bool, bool, []*model.HistoryData) {
+	ctx := &conditionContext{endpoint: endpoint, primary: primary}
+	isTriggered, isEnough := this.root.test(ctx)
+	return isTriggered, isEnough, ctx.historyData
+}
+
+// 解析过的条件，key是条件字符串
+var (
+	parsedConditions     = make(map[string]*Condition)
+	parsedConditionsLock = new(sync.RWMutex)
+)
+
+func ParseCondition(str string) (*Condition, error) {
+	parsedConditionsLock.RLock()
+	cond, ok := parsedConditions[str]
+	parsedConditionsLock.RUnlock()
+	if ok {
+		return cond, nil
+	}
+
+	tree, err := ccondition.Parse(str)
+	if err != nil {
+		return nil, err
+	}
+
+	cond = &Condition{Combiner: tree.Combiner}
+	if cond.root, err = (&conditionCompiler{cond: cond}).compileBool(tree.Root); err != nil {
+		return nil, err
+	}
+
+	parsedConditionsLock.Lock()
+	parsedConditions[str] = cond
+	parsedConditionsLock.Unlock()
+
+	return cond, nil
+}
+
+type conditionContext struct {
+	endpoint string
+	primary  *SafeLinkedList
+	// 参与判断的所有点
+	historyData []*model.HistoryData
+}
+
+func (this *conditionContext) series(ref *ccondition.SeriesRef) *SafeLinkedList {
+	if ref.Metric == "" {
+		return this.primary
+	}
+
+	pk := utils.Md5(utils.PK(this.endpoint, ref.Metric, ref.Tags))
+	L, exists := HistoryBigMap[pk[0:2]].Get(pk)
+	if !exists {
+		return nil
+	}
+	return L
+}
+
+func (this *conditionContext) compute(ref *ccondition.SeriesRef, fn Function) (leftValue float64, isTriggered bool, isEnough bool) {
+	L := this.series(ref)
+	if L == nil {
+		return
+	}
+
+	var vs []*model.HistoryData
+	vs, leftValue, isTriggered, isEnough = fn.Compute(L)
+	if isEnough {
+		this.historyData = append(this.historyData, vs...)
+	}
+	return
+}
+
+type numNode interface {
+	value(ctx *conditionContext) (float64, bool)
+}
+
+type boolNode interface {
+	test(ctx *conditionContext) (bool, bool)
+}
+
+type numConst float64
+
+func (this numConst) value(ctx *conditionContext) (float64, bool) {
+	return float64(this), true
+}
+
+// 函数的leftValue
+type numSeries struct {
+	ref *ccondition.SeriesRef
+	fn  Function
+}
+
+func (this *numSeries) value(ctx *conditionContext) (float64, bool) {
+	leftValue, _, isEnough := ctx.compute(this.ref, this.fn)
+	return leftValue, isEnough
+}
+
+type numBinary struct {
+	op          string
+	left, right numNode
+}
+
+func (this *numBinary) value(ctx *conditionContext) (float64, bool) {
+	left, leftIsEnough := this.left.value(ctx)
+	right, rightIsEnough := this.right.value(ctx)
+	if !leftIsEnough || !rightIsEnough {
+		return 0, false
+	}
+
+	switch this.op {
+	case "+":
+		return left + right, true
+	case "-":
+		return left - right, true
+	case "*":
+		return left * right, true
+	default:
+		// 除以0时无法判断
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	}
+}
+
+type numNegative struct {
+	node numNode
+}
+
+func (this *numNegative) value(ctx *conditionContext) (float64, bool) {
+	v, isEnough := this.node.value(ctx)
+	return -v, isEnough
+}
+
+type boolCompare struct {
+	op          string
+	left, right numNode
+}
+
+func (this *boolCompare) test(ctx *conditionContext) (bool, bool) {
+	left, leftIsEnough := this.left.value(ctx)
+	right, rightIsEnough := this.right.value(ctx)
+	if !leftIsEnough || !rightIsEnough {
+		return false, false
+	}
+	return checkIsTriggered(left, this.op, right), true
+}
+
+// "func > 数值"，使用函数本身的判断
+type boolSeries struct {
+	ref *ccondition.SeriesRef
+	fn  Function
+}
+
+func (this *boolSeries) test(ctx *conditionContext) (bool, bool) {
+	_, isTriggered, isEnough := ctx.compute(this.ref, this.fn)
+	return isTriggered, isEnough
+}
+
+// 不短路，以便所有曲线的数据不够时都不做判断
+type boolLogic struct {
+	op          string
+	left, right boolNode
+}
+
+func (this *boolLogic) test(ctx *conditionContext) (bool, bool) {
+	left, leftIsEnough := this.left.test(ctx)
+	right, rightIsEnough := this.right.test(ctx)
+	if !leftIsEnough || !rightIsEnough {
+		return false, false
+	}
+
+	if this.op == conditionAnd {
+		return left && right, true
+	}
+	return left || right, true
+}
+
+// 把语法树转换为可以判断的节点，函数的参数在这里检查
+type conditionCompiler struct {
+	cond *Condition
+}
+
+func (this *conditionCompiler) compileBool(node ccondition.BoolNode) (boolNode, error) {
+	switch node := node.(type) {
+	case *ccondition.SeriesTest:
+		fn, err := ParseFuncFromString(node.Func, node.Operator, node.RightValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function %q in condition: %v", node.Func, err)
+		}
+		this.cond.refs = append(this.cond.refs, node.Ref)
+		return &boolSeries{ref: node.Ref, fn: fn}, nil
+	case *ccondition.Compare:
+		left, err := this.compileNum(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := this.compileNum(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &boolCompare{op: node.Op, left: left, right: right}, nil
+	case *ccondition.Logic:
+		left, err := this.compileBool(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := this.compileBool(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &boolLogic{op: node.Op, left: left, right: right}, nil
+	}
+	return nil, fmt.Errorf("unknown node of condition: %T", node)
+}
+
+func (this *conditionCompiler) compileNum(node ccondition.NumNode) (numNode, error) {
+	switch node := node.(type) {
+	case ccondition.Number:
+		return numConst(node), nil
+	case *ccondition.Series:
+		fn, err := ParseFuncFromString(node.Func, "", 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function %q in condition: %v", node.Func, err)
+		}
+		this.cond.refs = append(this.cond.refs, node.Ref)
+		return &numSeries{ref: node.Ref, fn: fn}, nil
+	case *ccondition.Binary:
+		left, err := this.compileNum(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := this.compileNum(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &numBinary{op: node.Op, left: left, right: right}, nil
+	case *ccondition.Negative:
+		inner, err := this.compileNum(node.Node)
+		if err != nil {
+			return nil, err
+		}
+		return &numNegative{node: inner}, nil
+	}
+	return nil, fmt.Errorf("unknown node of condition: %T", node)
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/common/model"
+)
+
+func TestParseCondition(t *testing.T) {
+	testCases := []*struct {
+		str              string
+		expectedCombiner string
+		expectedMetrics  []string
+	}{
+		{"avg(#3) > 5", conditionAnd, []string{}},
+		{"or load.1min:avg(#3) > cpu.core:max(#1) * 2", conditionOr, []string{"load.1min", "cpu.core"}},
+		{"AND (mem.free/host=a,b=c:all(#3) < 5 || swap.free:max(#1) <= -10) && load.1min:avg(#3) != 0", conditionAnd, []string{"mem.free", "swap.free", "load.1min"}},
+		{"(net.in:lookup(#5, 3) + net.out:max(#1)) / 2 >= 100 and net.in:max(#1) > 1", conditionAnd, []string{"net.in", "net.out"}},
+	}
+	for i, testCase := range testCases {
+		cond, err := ParseCondition(testCase.str)
+		if err != nil {
+			t.Errorf("[%d] ParseCondition(%q) has error: %v", i, testCase.str, err)
+			continue
+		}
+		if cond.Combiner != testCase.expectedCombiner || !reflect.DeepEqual(cond.Metrics(), testCase.expectedMetrics) {
+			t.Errorf("[%d] Expected: %s %v. Got: %s %v", i, testCase.expectedCombiner, testCase.expectedMetrics, cond.Combiner, cond.Metrics())
+		}
+	}
+
+	invalidStrs := []string{
+		"", "and", "avg(#3)", "avg(#3) >", "avg(#3) > 5 and", "(avg(#3) > 5", "avg(#3) > 5)",
+		"cores > 5", "load.1min:unknown(#3) > 5", ":avg(#3) > 5", "avg(#3) ! 5", "avg(#3) > 1.2.3",
+	}
+	for _, str := range invalidStrs {
+		if _, err := ParseCondition(str); err == nil {
+			t.Errorf("Expected error for condition: %q", str)
+		}
+	}
+}
+
+func TestJudgeItemWithCompositeStrategy(t *testing.T) {
+	initTestConfig(t)
+	defer resetHistoryAndEvents()
+	resetHistoryAndEvents()
+
+	events := []*model.Event{}
+	lastEvents := make(map[string]*model.Event)
+	judger := &eventJudger{
+		getLastEvent: func(id string) (*model.Event, bool) {
+			event, exists := lastEvents[id]
+			return event, exists
+		},
+		send: func(event *model.Event) {
+			lastEvents[event.Id] = event
+			events = append(events, event)
+		},
+	}
+
+	strategy := model.Strategy{
+		Id: 9, Metric: "cpu.idle", Func: "all(#2)", Operator: "<", RightValue: 10, MaxStep: 3,
+		Condition: "and load.1min:avg(#2) > cpu.core:max(#1) * 2",
+	}
+
+	now := int64(1600000000)
+	push := func(metric string, value float64, timestamp int64) (*SafeLinkedList, *model.JudgeItem) {
+		item := &model.JudgeItem{
+			Endpoint: "host-1", Metric: metric, Tags: map[string]string{},
+			Value: value, JudgeType: "GAUGE", Timestamp: timestamp, ReachTransferTime: timestamp,
+		}
+		pk := item.PrimaryKey()
+		HistoryBigMap[pk[0:2]].PushFrontAndMaintain(pk, item, 11, now)
+		L, _ := HistoryBigMap[pk[0:2]].Get(pk)
+		return L, item
+	}
+
+	// There is no data of cpu.core
+	push("cpu.idle", 5, now-60)
+	L, item := push("cpu.idle", 3, now)
+	push("load.1min", 6, now-60)
+	push("load.1min", 12, now)
+	judger.judgeItemWithCompositeStrategy(L, strategy, item, now)
+	if len(events) != 0 {
+		t.Fatalf("Expected no event without data of cpu.core. Got: %v", events)
+	}
+
+	// avg(load.1min) is 9, which is greater than 4 * 2
+	L, item = push("cpu.core", 4, now)
+	judger.judgeItemWithCompositeStrategy(L, strategy, item, now)
+	primaryItem := &model.JudgeItem{Endpoint: "host-1", Metric: "cpu.idle", Tags: map[string]string{}}
+	if len(events) != 1 || events[0].Status != "PROBLEM" || events[0].Id != "s_9_"+primaryItem.PrimaryKey() ||
+		events[0].LeftValue != 3 || events[0].EventTime != now || events[0].Strategy.Id != 9 {
+		t.Fatalf("Expected a PROBLEM event of cpu.idle. Got: %v", events)
+	}
+
+	// avg(load.1min) is 7
+	L, item = push("load.1min", 2, now+60)
+	judger.judgeItemWithCompositeStrategy(L, strategy, item, now+60)
+	if len(events) != 2 || events[1].Status != "OK" {
+		t.Fatalf("Expected an OK event. Got: %v", events)
+	}
+
+	// The series which is not referenced is ignored
+	L, item = push("mem.free", 1, now+60)
+	judger.judgeItemWithCompositeStrategy(L, strategy, item, now+60)
+	if len(events) != 2 {
+		t.Errorf("Expected no event for unrelated series. Got: %v", events)
+	}
+
+	// The condition with "or" is triggered even if cpu.idle is not
+	strategy.Id, strategy.Condition = 10, "or load.1min:max(#1) < 5"
+	L, item = push("cpu.idle", 50, now+60)
+	judger.judgeItemWithCompositeStrategy(L, strategy, item, now+60)
+	if len(events) != 3 || events[2].Status != "PROBLEM" || events[2].LeftValue != 50 || events[2].Strategy.Id != 10 {
+		t.Errorf("Expected a PROBLEM event of \"or\". Got: %v", events)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/fwtpe/owl-backend/common/model"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -206,15 +207,183 @@ func (this PDiffFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, l
 	return
 }
 
-// @str: e.g. all(#3) sum(#3) avg(#10) diff(#10)
+// lookup(#5,3): 最新的5个点中至少有3个点触发阈值，就报警
+type LookupFunction struct {
+	Function
+	Limit      int
+	Count      int
+	Operator   string
+	RightValue float64
+}
+
+func (this LookupFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	matched := 0
+	for i := 0; i < this.Limit; i++ {
+		if checkIsTriggered(vs[i].Value, this.Operator, this.RightValue) {
+			matched++
+		}
+	}
+
+	leftValue = vs[0].Value
+	isTriggered = matched >= this.Count
+	return
+}
+
+// stddev(#10,3): 用当前点之前的10个点计算均值μ和标准差σ，当前点落在[μ-3σ, μ+3σ]之外，
+// 并且当前点也触发阈值时，就报警。阈值用来过滤掉数值很小的波动，e.g. stddev(#10,3) > 50
+type StdDeviationFunction struct {
+	Function
+	Limit      int
+	Factor     float64
+	Operator   string
+	RightValue float64
+}
+
+func (this StdDeviationFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	// 与diff一样，当前点不参与均值和标准差的计算
+	vs, isEnough = L.HistoryData(this.Limit + 1)
+	if !isEnough {
+		return
+	}
+
+	mean := 0.0
+	for i := 1; i < this.Limit+1; i++ {
+		mean += vs[i].Value
+	}
+	mean /= float64(this.Limit)
+
+	variance := 0.0
+	for i := 1; i < this.Limit+1; i++ {
+		variance += (vs[i].Value - mean) * (vs[i].Value - mean)
+	}
+	stddev := math.Sqrt(variance / float64(this.Limit))
+
+	leftValue = vs[0].Value
+	isTriggered = math.Abs(leftValue-mean) > this.Factor*stddev &&
+		checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+type MedianFunction struct {
+	Function
+	Limit      int
+	Operator   string
+	RightValue float64
+}
+
+func (this MedianFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	leftValue = percentileOf(vs, 50)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// percentile(#10,95): 最新10个点的95百分位数
+type PercentileFunction struct {
+	Function
+	Limit      int
+	Percent    float64
+	Operator   string
+	RightValue float64
+}
+
+func (this PercentileFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = L.HistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	leftValue = percentileOf(vs, this.Percent)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// 百分位数，在相邻的两个点之间线性插值
+func percentileOf(vs []*model.HistoryData, percent float64) float64 {
+	values := make([]float64, len(vs))
+	for i, v := range vs {
+		values[i] = v.Value
+	}
+	sort.Float64s(values)
+
+	rank := percent / 100.0 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	if lower >= len(values)-1 {
+		return values[len(values)-1]
+	}
+
+	return values[lower] + (rank-float64(lower))*(values[lower+1]-values[lower])
+}
+
+// rate(#5): 最新5个点的每秒增长量，用于上报为GAUGE的计数器。
+// 计数器被重置（数值变小）时，重置之后的数值就是增长量
+type RateFunction struct {
+	Function
+	Limit      int
+	Operator   string
+	RightValue float64
+}
+
+func (this RateFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	// 不论JudgeType是什么，都用原始值计算
+	vs, isEnough = L.RawHistoryData(this.Limit)
+	if !isEnough {
+		return
+	}
+
+	// 时间相同（或乱序）的点无法计算速率
+	span := vs[0].Timestamp - vs[this.Limit-1].Timestamp
+	if span <= 0 {
+		isEnough = false
+		return
+	}
+
+	increase := 0.0
+	for i := 0; i < this.Limit-1; i++ {
+		delta := vs[i].Value - vs[i+1].Value
+		if delta < 0 {
+			delta = vs[i].Value
+		}
+		increase += delta
+	}
+
+	leftValue = increase / float64(span)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// @str: e.g. all(#3) sum(#3) avg(#10) diff(#10) lookup(#5,3) stddev(#10,3) percentile(#10,95) baseline(#3,7)
 func ParseFuncFromString(str string, operator string, rightValue float64) (fn Function, err error) {
 	idx := strings.Index(str, "#")
-	limit, err := strconv.ParseInt(str[idx+1:len(str)-1], 10, 64)
+	if idx < 2 || !strings.HasSuffix(str, ")") {
+		return nil, fmt.Errorf("invalid func: %s", str)
+	}
+
+	args := strings.Split(str[idx+1:len(str)-1], ",")
+	limit, err := strconv.ParseInt(args[0], 10, 64)
 	if err != nil {
 		return nil, err
 	}
+	if limit < 1 {
+		return nil, fmt.Errorf("the number of points must be positive: %s", str)
+	}
 
-	switch str[:idx-1] {
+	name := str[:idx-1]
+	extraArgs, err := parseExtraArgs(name, args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
 	case "max":
 		fn = &MaxFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
 	case "min":
@@ -229,6 +398,35 @@ func ParseFuncFromString(str string, operator string, rightValue float64) (fn Fu
 		fn = &DiffFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
 	case "pdiff":
 		fn = &PDiffFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
+	case "lookup":
+		count := extraArgs[0]
+		if count != math.Trunc(count) || count < 1 || count > float64(limit) {
+			return nil, fmt.Errorf("the count of lookup must be an integer in [1, %d]: %s", limit, str)
+		}
+		fn = &LookupFunction{Limit: int(limit), Count: int(count), Operator: operator, RightValue: rightValue}
+	case "stddev":
+		if limit < 2 || extraArgs[0] <= 0 {
+			return nil, fmt.Errorf("stddev needs at least 2 points and a positive factor: %s", str)
+		}
+		fn = &StdDeviationFunction{Limit: int(limit), Factor: extraArgs[0], Operator: operator, RightValue: rightValue}
+	case "median":
+		fn = &MedianFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
+	case "percentile":
+		if extraArgs[0] <= 0 || extraArgs[0] > 100 {
+			return nil, fmt.Errorf("the percent of percentile must be in (0, 100]: %s", str)
+		}
+		fn = &PercentileFunction{Limit: int(limit), Percent: extraArgs[0], Operator: operator, RightValue: rightValue}
+	case "rate":
+		if limit < 2 {
+			return nil, fmt.Errorf("rate needs at least 2 points: %s", str)
+		}
+		fn = &RateFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
+	case "baseline":
+		days := extraArgs[0]
+		if days != math.Trunc(days) || days < 1 {
+			return nil, fmt.Errorf("the days of baseline must be a positive integer: %s", str)
+		}
+		fn = &BaselineFunction{Limit: int(limit), Days: int(days), Operator: operator, RightValue: rightValue}
 	default:
 		err = fmt.Errorf("not_supported_method")
 	}
@@ -236,6 +434,29 @@ func ParseFuncFromString(str string, operator string, rightValue float64) (fn Fu
 	return
 }
 
+// 除了点数之外的参数，e.g. lookup(#5,3)中的3
+func parseExtraArgs(name string, args []string) ([]float64, error) {
+	expected := 0
+	switch name {
+	case "lookup", "stddev", "percentile", "baseline":
+		expected = 1
+	}
+	if len(args) != expected {
+		return nil, fmt.Errorf("%s needs %d argument(s) besides the number of points. got: %d", name, expected, len(args))
+	}
+
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		value, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	return values, nil
+}
+
 func checkIsTriggered(leftValue float64, operator string, rightValue float64) (isTriggered bool) {
 	switch operator {
 	case "=", "==":
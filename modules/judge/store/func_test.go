@@ -0,0 +1,232 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/common/model"
+)
+
+func TestParseFuncFromString(t *testing.T) {
+	testCases := []*struct {
+		str      string
+		expected Function
+	}{
+		{"max(#3)", &MaxFunction{Limit: 3, Operator: ">", RightValue: 90}},
+		{"lookup(#5,3)", &LookupFunction{Limit: 5, Count: 3, Operator: ">", RightValue: 90}},
+		{"stddev(#10,2.5)", &StdDeviationFunction{Limit: 10, Factor: 2.5, Operator: ">", RightValue: 90}},
+		{"median(#5)", &MedianFunction{Limit: 5, Operator: ">", RightValue: 90}},
+		{"percentile(#10,95)", &PercentileFunction{Limit: 10, Percent: 95, Operator: ">", RightValue: 90}},
+		{"rate(#3)", &RateFunction{Limit: 3, Operator: ">", RightValue: 90}},
+		{"baseline(#3,7)", &BaselineFunction{Limit: 3, Days: 7, Operator: ">", RightValue: 90}},
+	}
+
+	for i, testCase := range testCases {
+		fn, err := ParseFuncFromString(testCase.str, ">", 90)
+		if err != nil {
+			t.Errorf("[%d] ParseFuncFromString(%q) has error: %v", i, testCase.str, err)
+			continue
+		}
+		if fmt.Sprintf("%#v", fn) != fmt.Sprintf("%#v", testCase.expected) {
+			t.Errorf("[%d] Expected: %#v. Got: %#v", i, testCase.expected, fn)
+		}
+	}
+
+	invalidStrs := []string{
+		"", "max", "max(#a)", "max(#0)", "max(#3,1)", "unknown(#3)",
+		"lookup(#5)", "lookup(#5,6)", "lookup(#5,1.5)",
+		"stddev(#1,3)", "stddev(#10,0)", "percentile(#10,101)", "rate(#1)", "baseline(#3,0)",
+	}
+	for _, str := range invalidStrs {
+		if _, err := ParseFuncFromString(str, ">", 90); err == nil {
+			t.Errorf("Expected error for func: %q", str)
+		}
+	}
+}
+
+func TestComputeOfFunctions(t *testing.T) {
+	// The latest value is the first one
+	gauges := newGaugeList(95, 10, 92, 99, 20, 30)
+
+	testCases := []*struct {
+		fn                  Function
+		expectedLeftValue   float64
+		expectedIsTriggered bool
+		expectedIsEnough    bool
+	}{
+		{&LookupFunction{Limit: 5, Count: 3, Operator: ">", RightValue: 90}, 95, true, true},
+		{&LookupFunction{Limit: 5, Count: 4, Operator: ">", RightValue: 90}, 95, false, true},
+		{&LookupFunction{Limit: 7, Count: 3, Operator: ">", RightValue: 90}, 95, false, false},
+		{&MedianFunction{Limit: 5, Operator: ">", RightValue: 90}, 92, true, true},
+		{&MedianFunction{Limit: 4, Operator: ">", RightValue: 90}, 93.5, true, true},
+		{&PercentileFunction{Limit: 5, Percent: 100, Operator: ">", RightValue: 90}, 99, true, true},
+		{&PercentileFunction{Limit: 5, Percent: 25, Operator: "<", RightValue: 30}, 20, true, true},
+		{&PercentileFunction{Limit: 6, Percent: 90, Operator: ">", RightValue: 98}, 97, false, true},
+		// mean: 50.2, standard deviation: 37.59
+		{&StdDeviationFunction{Limit: 5, Factor: 1, Operator: ">", RightValue: 0}, 95, true, true},
+		{&StdDeviationFunction{Limit: 5, Factor: 2, Operator: ">", RightValue: 0}, 95, false, true},
+		{&StdDeviationFunction{Limit: 5, Factor: 1, Operator: "<", RightValue: 90}, 95, false, true},
+	}
+
+	for i, testCase := range testCases {
+		_, leftValue, isTriggered, isEnough := testCase.fn.Compute(gauges)
+
+		if isEnough != testCase.expectedIsEnough {
+			t.Errorf("[%d] Expected isEnough: %v. Got: %v", i, testCase.expectedIsEnough, isEnough)
+			continue
+		}
+		if !isEnough {
+			continue
+		}
+		if math.Abs(leftValue-testCase.expectedLeftValue) > 0.0001 || isTriggered != testCase.expectedIsTriggered {
+			t.Errorf("[%d] Expected: %v, %v. Got: %v, %v",
+				i, testCase.expectedLeftValue, testCase.expectedIsTriggered, leftValue, isTriggered)
+		}
+	}
+}
+
+func TestComputeOfRate(t *testing.T) {
+	testCases := []*struct {
+		judgeType         string
+		values            []float64
+		expectedLeftValue float64
+	}{
+		{"GAUGE", []float64{300, 180, 60}, 2},
+		// The counter is reset
+		{"GAUGE", []float64{60, 300, 180}, 1.5},
+		// The raw values are used whatever the type is
+		{"COUNTER", []float64{300, 180, 60}, 2},
+	}
+
+	for i, testCase := range testCases {
+		L := newLinkedList(testCase.judgeType, testCase.values...)
+		vs, leftValue, isTriggered, isEnough := (&RateFunction{Limit: 3, Operator: ">", RightValue: 1}).Compute(L)
+
+		if !isEnough || len(vs) != 3 {
+			t.Errorf("[%d] Expected 3 points. Got: %d", i, len(vs))
+			continue
+		}
+		if leftValue != testCase.expectedLeftValue || !isTriggered {
+			t.Errorf("[%d] Expected rate: %v. Got: %v", i, testCase.expectedLeftValue, leftValue)
+		}
+	}
+
+	// The points of the same timestamp
+	L := newGaugeList(300, 180, 60)
+	setItemsOfList(L, 1000, "host-1", "metric-1", nil)
+	for e := L.L.Front(); e != nil; e = e.Next() {
+		e.Value.(*model.JudgeItem).Timestamp = 1000
+	}
+	if _, _, _, isEnough := (&RateFunction{Limit: 3, Operator: ">", RightValue: 1}).Compute(L); isEnough {
+		t.Errorf("Expected not enough data for the points of the same timestamp")
+	}
+}
+
+func TestComputeOfBaseline(t *testing.T) {
+	defer func(oldIsQueryEnabled func() bool, oldQuery func(string, string, int64, int64) ([]*model.HistoryData, error)) {
+		isQueryEnabled, queryGraphHistory = oldIsQueryEnabled, oldQuery
+		baselineHistory = newBaselineHistoryCache()
+	}(isQueryEnabled, queryGraphHistory)
+
+	isQueryEnabled = func() bool { return true }
+
+	queryCount := 0
+	var queryError error
+	// 50 a week ago
+	queryGraphHistory = func(endpoint string, counter string, start int64, end int64) ([]*model.HistoryData, error) {
+		queryCount++
+		if queryError != nil {
+			return nil, queryError
+		}
+		if endpoint != "host-1" || counter != "disk.io.await/device=sda" {
+			return nil, fmt.Errorf("unexpected counter: %s/%s", endpoint, counter)
+		}
+
+		return []*model.HistoryData{
+			{Timestamp: start - start%1200, Value: 50},
+			{Timestamp: start - start%1200 + 1200, Value: 50},
+		}, nil
+	}
+
+	now := int64(1600000020)
+	fn := &BaselineFunction{Limit: 3, Days: 7, Operator: ">", RightValue: 50}
+
+	// The average is 80
+	L := newGaugeList(90, 80, 70)
+	setItemsOfList(L, now, "host-1", "disk.io.await", map[string]string{"device": "sda"})
+
+	// The history is queried in background
+	if _, _, _, isEnough := fn.Compute(L); isEnough {
+		t.Errorf("Expected not enough data while history is being queried")
+	}
+	baselineHistory.wg.Wait()
+
+	_, leftValue, isTriggered, isEnough := fn.Compute(L)
+	if !isEnough || leftValue != 60 || !isTriggered {
+		t.Errorf("Expected 60%% higher than baseline. Got: %v, %v, %v", leftValue, isTriggered, isEnough)
+	}
+
+	// The cached history is used
+	L = newGaugeList(60, 50, 40)
+	setItemsOfList(L, now+60, "host-1", "disk.io.await", map[string]string{"device": "sda"})
+	_, leftValue, isTriggered, isEnough = fn.Compute(L)
+	if !isEnough || leftValue != 0 || isTriggered {
+		t.Errorf("Expected no change from baseline. Got: %v, %v, %v", leftValue, isTriggered, isEnough)
+	}
+	if queryCount != 1 {
+		t.Errorf("Expected history is queried once. Got: %d", queryCount)
+	}
+
+	// The history is prefetched before the cached one is used up
+	L = newGaugeList(60, 50, 40)
+	setItemsOfList(L, now+3000, "host-1", "disk.io.await", map[string]string{"device": "sda"})
+	if _, _, _, isEnough = fn.Compute(L); !isEnough {
+		t.Errorf("Expected the cached history is used while prefetching")
+	}
+	baselineHistory.wg.Wait()
+	if queryCount != 2 {
+		t.Errorf("Expected history is prefetched. Got: %d", queryCount)
+	}
+
+	// The failure of query is not retried immediately
+	queryError = fmt.Errorf("connection refused")
+	for i := 0; i < 2; i++ {
+		L = newGaugeList(90, 80, 70)
+		setItemsOfList(L, now, "host-2", "disk.io.await", nil)
+		if _, _, _, isEnough := fn.Compute(L); isEnough {
+			t.Errorf("Expected not enough data while history is unavailable")
+		}
+		baselineHistory.wg.Wait()
+	}
+	if queryCount != 3 {
+		t.Errorf("Expected history of host-2 is queried once. Got: %d", queryCount)
+	}
+}
+
+func newGaugeList(values ...float64) *SafeLinkedList {
+	return newLinkedList("GAUGE", values...)
+}
+
+// The values are from the latest to the oldest, the interval between values is 60 seconds
+func newLinkedList(judgeType string, values ...float64) *SafeLinkedList {
+	L := &SafeLinkedList{L: list.New()}
+	for i, value := range values {
+		L.L.PushBack(&model.JudgeItem{
+			Endpoint: "host-1", Metric: "metric-1", JudgeType: judgeType,
+			Value: value, Timestamp: int64(1000 - i*60),
+		})
+	}
+	return L
+}
+
+func setItemsOfList(L *SafeLinkedList, latestTimestamp int64, endpoint string, metric string, tags map[string]string) {
+	i := int64(0)
+	for e := L.L.Front(); e != nil; e = e.Next() {
+		item := e.Value.(*model.JudgeItem)
+		item.Endpoint, item.Metric, item.Tags = endpoint, metric, tags
+		item.Timestamp = latestTimestamp - i*60
+		i++
+	}
+}
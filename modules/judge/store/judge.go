@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/utils"
 	"github.com/fwtpe/owl-backend/modules/judge/g"
+	"sort"
 	"time"
 )
 
@@ -22,6 +24,11 @@ func CheckStrategy(L *SafeLinkedList, firstItem *model.JudgeItem, now int64) {
 	}
 
 	for _, s := range strategies {
+		if s.Condition != "" {
+			judgeItemWithCompositeStrategy(L, s, firstItem, now)
+			continue
+		}
+
 		// 因为key仅仅是endpoint和metric，所以得到的strategies并不一定是与当前judgeItem相关的
 		// 比如lg-dinp-docker01.bj配置了两个proc.num的策略，一个name=docker，一个name=agent
 		// 所以此处要排除掉一部分
@@ -41,7 +48,23 @@ func CheckStrategy(L *SafeLinkedList, firstItem *model.JudgeItem, now int64) {
 	}
 }
 
+// 判断并产生报警event的状态机，线上使用g.LastEvents，回测时使用独立的lastEvents
+type eventJudger struct {
+	getLastEvent func(id string) (*model.Event, bool)
+	// 需要更新lastEvents
+	send func(event *model.Event)
+}
+
+var liveJudger = &eventJudger{
+	getLastEvent: g.LastEvents.Get,
+	send:         sendEvent,
+}
+
 func judgeItemWithStrategy(L *SafeLinkedList, strategy model.Strategy, firstItem *model.JudgeItem, now int64) {
+	liveJudger.judgeItemWithStrategy(L, strategy, firstItem, now)
+}
+
+func (this *eventJudger) judgeItemWithStrategy(L *SafeLinkedList, strategy model.Strategy, firstItem *model.JudgeItem, now int64) {
 	fn, err := ParseFuncFromString(strategy.Func, strategy.Operator, strategy.RightValue)
 	if err != nil {
 		log.Errorf("[ERROR] parse func %s fail: %v. strategy id: %d", strategy.Func, err, strategy.Id)
@@ -63,7 +86,95 @@ func judgeItemWithStrategy(L *SafeLinkedList, strategy model.Strategy, firstItem
 		ReachTransferTime: firstItem.ReachTransferTime,
 	}
 
-	sendEventIfNeed(historyData, isTriggered, now, event, strategy.MaxStep)
+	this.sendEventIfNeed(historyData, isTriggered, now, event, strategy.MaxStep)
+}
+
+func judgeItemWithCompositeStrategy(L *SafeLinkedList, strategy model.Strategy, firstItem *model.JudgeItem, now int64) {
+	liveJudger.judgeItemWithCompositeStrategy(L, strategy, firstItem, now)
+}
+
+/**
+ * 组合策略：策略本身的曲线或者条件中引用的曲线更新时都会判断，
+ * 产生的event与普通策略相同，Id、LeftValue和PushedTags来自策略本身的曲线
+ */
+func (this *eventJudger) judgeItemWithCompositeStrategy(L *SafeLinkedList, strategy model.Strategy, firstItem *model.JudgeItem, now int64) {
+	fn, err := ParseFuncFromString(strategy.Func, strategy.Operator, strategy.RightValue)
+	if err != nil {
+		log.Errorf("[ERROR] parse func %s fail: %v. strategy id: %d", strategy.Func, err, strategy.Id)
+		return
+	}
+	cond, err := ParseCondition(strategy.Condition)
+	if err != nil {
+		log.Errorf("[ERROR] parse condition %q fail: %v. strategy id: %d", strategy.Condition, err, strategy.Id)
+		return
+	}
+
+	primary := L
+	if !isStrategySeries(strategy, firstItem) {
+		if !cond.References(firstItem) {
+			return
+		}
+
+		// 引用的曲线更新时，策略本身的曲线只能是tags与策略完全一致的那条
+		pk := utils.Md5(utils.PK(firstItem.Endpoint, strategy.Metric, strategy.Tags))
+		var exists bool
+		if primary, exists = HistoryBigMap[pk[0:2]].Get(pk); !exists {
+			return
+		}
+	}
+
+	front := primary.Front()
+	if front == nil {
+		return
+	}
+	primaryItem := front.Value.(*model.JudgeItem)
+
+	historyData, leftValue, isTriggered, isEnough := fn.Compute(primary)
+	if !isEnough {
+		return
+	}
+	condIsTriggered, isEnough, condHistoryData := cond.Test(firstItem.Endpoint, primary)
+	if !isEnough {
+		return
+	}
+
+	if cond.Combiner == conditionOr {
+		isTriggered = isTriggered || condIsTriggered
+	} else {
+		isTriggered = isTriggered && condIsTriggered
+	}
+
+	// sendEventIfNeed使用最后一个点作为最老的点
+	historyData = append(historyData, condHistoryData...)
+	sort.SliceStable(historyData, func(i, j int) bool {
+		return historyData[i].Timestamp > historyData[j].Timestamp
+	})
+
+	event := &model.Event{
+		Id:                fmt.Sprintf("s_%d_%s", strategy.Id, primaryItem.PrimaryKey()),
+		Strategy:          &strategy,
+		Endpoint:          firstItem.Endpoint,
+		LeftValue:         leftValue,
+		EventTime:         firstItem.Timestamp,
+		PushedTags:        primaryItem.Tags,
+		ReachTransferTime: firstItem.ReachTransferTime,
+	}
+
+	this.sendEventIfNeed(historyData, isTriggered, now, event, strategy.MaxStep)
+}
+
+// 曲线的tags包含策略的所有tags
+func isStrategySeries(strategy model.Strategy, item *model.JudgeItem) bool {
+	if item.Metric != strategy.Metric {
+		return false
+	}
+
+	for tagKey, tagVal := range strategy.Tags {
+		if myVal, exists := item.Tags[tagKey]; !exists || myVal != tagVal {
+			return false
+		}
+	}
+	return true
 }
 
 func sendEvent(event *model.Event) {
@@ -78,13 +189,8 @@ func sendEvent(event *model.Event) {
 		return
 	}
 
-	// send to redis
-	redisKey := fmt.Sprintf(g.Config().Alarm.QueuePattern, event.Priority())
-
-	rc := g.RedisConnPool.Get()
-	defer rc.Close()
-
-	rc.Do("LPUSH", redisKey, string(bs))
+	// send to sinks(redis by default)
+	dispatchEvent(event, bs)
 }
 
 func CheckExpression(L *SafeLinkedList, firstItem *model.JudgeItem, now int64) {
@@ -169,6 +275,10 @@ func copyItemTags(item *model.JudgeItem) map[string]string {
 }
 
 func judgeItemWithExpression(L *SafeLinkedList, expression *model.Expression, firstItem *model.JudgeItem, now int64) {
+	liveJudger.judgeItemWithExpression(L, expression, firstItem, now)
+}
+
+func (this *eventJudger) judgeItemWithExpression(L *SafeLinkedList, expression *model.Expression, firstItem *model.JudgeItem, now int64) {
 	fn, err := ParseFuncFromString(expression.Func, expression.Operator, expression.RightValue)
 	if err != nil {
 		log.Errorf("[ERROR] parse func %s fail: %v. expression id: %d", expression.Func, err, expression.Id)
@@ -190,12 +300,12 @@ func judgeItemWithExpression(L *SafeLinkedList, expression *model.Expression, fi
 		ReachTransferTime: firstItem.ReachTransferTime,
 	}
 
-	sendEventIfNeed(historyData, isTriggered, now, event, expression.MaxStep)
+	this.sendEventIfNeed(historyData, isTriggered, now, event, expression.MaxStep)
 
 }
 
-func sendEventIfNeed(historyData []*model.HistoryData, isTriggered bool, now int64, event *model.Event, maxStep int) {
-	lastEvent, exists := g.LastEvents.Get(event.Id)
+func (this *eventJudger) sendEventIfNeed(historyData []*model.HistoryData, isTriggered bool, now int64, event *model.Event, maxStep int) {
+	lastEvent, exists := this.getLastEvent(event.Id)
 	needSet := false
 	if g.Config().Alarm.AllowReSet && exists {
 		log.Debugf("lastEvent: %v", lastEvent)
@@ -214,7 +324,7 @@ func sendEventIfNeed(historyData []*model.HistoryData, isTriggered bool, now int
 				return
 			}
 
-			sendEvent(event)
+			this.send(event)
 			return
 		}
 
@@ -236,13 +346,13 @@ func sendEventIfNeed(historyData []*model.HistoryData, isTriggered bool, now int
 		}
 
 		event.CurrentStep = lastEvent.CurrentStep + 1
-		sendEvent(event)
+		this.send(event)
 	} else {
 		// 如果LastEvent是Problem，报OK，否则啥都不做
 		if exists && lastEvent.Status[0] == 'P' {
 			event.Status = "OK"
 			event.CurrentStep = 1
-			sendEvent(event)
+			this.send(event)
 		}
 	}
 }
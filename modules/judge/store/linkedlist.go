@@ -92,6 +92,32 @@ func (this *SafeLinkedList) HistoryData(limit int) ([]*model.HistoryData, bool)
 	return vs, isEnough
 }
 
+// 与HistoryData不同，无论JudgeType是什么，都返回原始值（不计算速率）
+// @param limit 至多返回这些，如果不够，有多少返回多少
+// @return bool isEnough
+func (this *SafeLinkedList) RawHistoryData(limit int) ([]*model.HistoryData, bool) {
+	if limit < 1 {
+		return []*model.HistoryData{}, false
+	}
+
+	this.RLock()
+	defer this.RUnlock()
+
+	isEnough := true
+	if size := this.L.Len(); size < limit {
+		limit = size
+		isEnough = false
+	}
+
+	vs := make([]*model.HistoryData, 0, limit)
+	for e := this.L.Front(); e != nil && len(vs) < limit; e = e.Next() {
+		item := e.Value.(*model.JudgeItem)
+		vs = append(vs, &model.HistoryData{Timestamp: item.Timestamp, Value: item.Value})
+	}
+
+	return vs, isEnough && len(vs) > 0
+}
+
 func (this *SafeLinkedList) PushFront(v interface{}) *list.Element {
 	this.Lock()
 	defer this.Unlock()
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+	nproc "github.com/toolkits/proc"
+)
+
+const (
+	defaultSinkQueueSize   = 10000
+	defaultSinkHttpTimeout = 3000
+)
+
+// event的目的地，@data是event的JSON
+type EventSink interface {
+	Send(event *model.Event, data []byte) error
+}
+
+// 每个sink有独立的队列和goroutine，发送失败时按照配置重试，一个sink慢或者不可用不影响其他sink
+type sinkWorker struct {
+	name  string
+	sink  EventSink
+	cfg   *g.EventSinkConfig
+	queue chan *sinkEvent
+	// 队列满时在调用者的goroutine中直接发送，而不是丢弃
+	syncWhenFull bool
+
+	sendCnt  *nproc.SCounterQps
+	retryCnt *nproc.SCounterQps
+	failCnt  *nproc.SCounterQps
+	dropCnt  *nproc.SCounterQps
+}
+
+type sinkEvent struct {
+	event *model.Event
+	data  []byte
+}
+
+var (
+	sinkWorkers     []*sinkWorker
+	sinkWorkersLock = new(sync.RWMutex)
+)
+
+// 根据alarm.sinks创建sink，alarm.enabled为false时event不发送到任何地方
+func InitEventSinks() {
+	if !g.Config().Alarm.Enabled {
+		return
+	}
+
+	workers := []*sinkWorker{}
+	for _, cfg := range g.Config().Alarm.EventSinks() {
+		sink, err := newEventSink(cfg)
+		if err != nil {
+			log.Fatalf("init sink of events fail: %v", err)
+		}
+
+		worker := newSinkWorker(cfg, sink)
+		go worker.run()
+		workers = append(workers, worker)
+
+		log.Infof("sink of events: %s(%s)", worker.name, cfg.Type)
+	}
+
+	sinkWorkersLock.Lock()
+	sinkWorkers = workers
+	sinkWorkersLock.Unlock()
+}
+
+func newEventSink(cfg *g.EventSinkConfig) (EventSink, error) {
+	switch cfg.Type {
+	case g.EventSinkRedis:
+		return &redisEventSink{queuePattern: g.Config().Alarm.QueuePattern}, nil
+	case g.EventSinkHttp:
+		if cfg.Url == "" {
+			return nil, fmt.Errorf("url of http sink is empty")
+		}
+
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = defaultSinkHttpTimeout
+		}
+		return &httpEventSink{
+			url:     cfg.Url,
+			headers: cfg.Headers,
+			client:  &http.Client{Timeout: time.Duration(timeout) * time.Millisecond},
+		}, nil
+	case g.EventSinkFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("file of file sink is empty")
+		}
+		return &fileEventSink{path: cfg.File}, nil
+	}
+
+	return nil, fmt.Errorf("unknown type of sink: %q", cfg.Type)
+}
+
+func newSinkWorker(cfg *g.EventSinkConfig, sink EventSink) *sinkWorker {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultSinkQueueSize
+	}
+
+	return &sinkWorker{
+		name:  name,
+		sink:  sink,
+		cfg:   cfg,
+		queue: make(chan *sinkEvent, queueSize),
+		// alarm只从redis获取event，而LastEvents已经更新，丢弃的event不会再被发送
+		syncWhenFull: cfg.Type == g.EventSinkRedis,
+		sendCnt:      nproc.NewSCounterQps("EventSinkSendCnt." + name),
+		retryCnt:     nproc.NewSCounterQps("EventSinkRetryCnt." + name),
+		failCnt:      nproc.NewSCounterQps("EventSinkFailCnt." + name),
+		dropCnt:      nproc.NewSCounterQps("EventSinkDropCnt." + name),
+	}
+}
+
+func (this *sinkWorker) offer(e *sinkEvent) {
+	select {
+	case this.queue <- e:
+	default:
+		if this.syncWhenFull {
+			log.Warnf("queue of sink %s is full, send event synchronously: %s", this.name, e.event.Id)
+			this.send(e)
+			return
+		}
+
+		this.dropCnt.Incr()
+		log.Errorf("queue of sink %s is full, drop event: %s", this.name, e.event.Id)
+	}
+}
+
+func (this *sinkWorker) run() {
+	for e := range this.queue {
+		this.send(e)
+	}
+}
+
+func (this *sinkWorker) send(e *sinkEvent) {
+	for i := 0; ; i++ {
+		err := this.sink.Send(e.event, e.data)
+		if err == nil {
+			this.sendCnt.Incr()
+			return
+		}
+
+		if i >= this.cfg.Retries {
+			this.failCnt.Incr()
+			log.Errorf("send event %s to sink %s fail: %v", e.event.Id, this.name, err)
+			return
+		}
+
+		this.retryCnt.Incr()
+		log.Debugf("send event %s to sink %s fail, retry: %v", e.event.Id, this.name, err)
+		time.Sleep(time.Duration(this.cfg.RetryInterval) * time.Millisecond)
+	}
+}
+
+func dispatchEvent(event *model.Event, data []byte) {
+	sinkWorkersLock.RLock()
+	defer sinkWorkersLock.RUnlock()
+
+	e := &sinkEvent{event: event, data: data}
+	for _, worker := range sinkWorkers {
+		worker.offer(e)
+	}
+}
+
+func GetSinkCounters() []interface{} {
+	sinkWorkersLock.RLock()
+	defer sinkWorkersLock.RUnlock()
+
+	ret := make([]interface{}, 0, len(sinkWorkers)*4)
+	for _, worker := range sinkWorkers {
+		ret = append(ret, worker.sendCnt.Get(), worker.retryCnt.Get(), worker.failCnt.Get(), worker.dropCnt.Get())
+	}
+	return ret
+}
+
+// LPUSH到alarm.queuePattern，由alarm消费
+type redisEventSink struct {
+	queuePattern string
+}
+
+func (this *redisEventSink) Send(event *model.Event, data []byte) error {
+	redisKey := fmt.Sprintf(this.queuePattern, event.Priority())
+
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+
+	_, err := rc.Do("LPUSH", redisKey, string(data))
+	return err
+}
+
+// POST event的JSON，2xx之外的状态码都当作失败
+type httpEventSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (this *httpEventSink) Send(event *model.Event, data []byte) error {
+	req, err := http.NewRequest("POST", this.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range this.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status code: %d, body: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// 每个event一行JSON，每次写入时打开文件，以便logrotate之类的工具切分文件
+type fileEventSink struct {
+	path string
+}
+
+func (this *fileEventSink) Send(event *model.Event, data []byte) error {
+	file, err := os.OpenFile(this.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	line := make([]byte, 0, len(data)+1)
+	line = append(append(line, data...), '\n')
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
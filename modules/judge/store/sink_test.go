@@ -0,0 +1,121 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+)
+
+func TestHttpAndFileEventSinks(t *testing.T) {
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Token") != "secret" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		received = append(received, string(body))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "judge-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.ndjson")
+
+	event := &model.Event{Id: "s_1_abc"}
+	for _, cfg := range []*g.EventSinkConfig{
+		{Type: g.EventSinkHttp, Url: server.URL, Headers: map[string]string{"X-Token": "secret"}},
+		{Type: g.EventSinkFile, File: path},
+	} {
+		sink, err := newEventSink(cfg)
+		if err != nil {
+			t.Fatalf("newEventSink(%s) has error: %v", cfg.Type, err)
+		}
+		for _, data := range []string{`{"id":"1"}`, `{"id":"2"}`} {
+			if err := sink.Send(event, []byte(data)); err != nil {
+				t.Errorf("Send() to %s sink has error: %v", cfg.Type, err)
+			}
+		}
+	}
+
+	if len(received) != 2 || received[0] != `{"id":"1"}` || received[1] != `{"id":"2"}` {
+		t.Errorf("Unexpected events received by http: %v", received)
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "{\"id\":\"1\"}\n{\"id\":\"2\"}\n" {
+		t.Errorf("Unexpected content of file: %q", content)
+	}
+
+	// Status code other than 2xx is failure
+	sink, _ := newEventSink(&g.EventSinkConfig{Type: g.EventSinkHttp, Url: server.URL})
+	if err := sink.Send(event, []byte(`{}`)); err == nil {
+		t.Errorf("Expected error for status code 403")
+	}
+
+	invalidConfigs := []*g.EventSinkConfig{
+		{Type: g.EventSinkHttp}, {Type: g.EventSinkFile}, {Type: "kafka"},
+	}
+	for _, cfg := range invalidConfigs {
+		if _, err := newEventSink(cfg); err == nil {
+			t.Errorf("Expected error for sink: %#v", cfg)
+		}
+	}
+}
+
+type failingEventSink struct {
+	failures int
+	calls    int
+}
+
+func (this *failingEventSink) Send(event *model.Event, data []byte) error {
+	this.calls++
+	if this.calls <= this.failures {
+		return fmt.Errorf("failure %d", this.calls)
+	}
+	return nil
+}
+
+func TestSinkWorkerRetriesAndDrops(t *testing.T) {
+	e := &sinkEvent{event: &model.Event{Id: "s_1_abc"}, data: []byte(`{}`)}
+
+	// Succeeded at the third time
+	sink := &failingEventSink{failures: 2}
+	worker := newSinkWorker(&g.EventSinkConfig{Type: "fake", Name: "retried", Retries: 2}, sink)
+	worker.send(e)
+	if sink.calls != 3 || worker.sendCnt.Cnt != 1 || worker.retryCnt.Cnt != 2 || worker.failCnt.Cnt != 0 {
+		t.Errorf("Unexpected counters: calls=%d send=%d retry=%d fail=%d", sink.calls, worker.sendCnt.Cnt, worker.retryCnt.Cnt, worker.failCnt.Cnt)
+	}
+
+	sink = &failingEventSink{failures: 2}
+	worker = newSinkWorker(&g.EventSinkConfig{Type: "fake", Name: "failed", Retries: 1, QueueSize: 1}, sink)
+	worker.send(e)
+	if sink.calls != 2 || worker.sendCnt.Cnt != 0 || worker.failCnt.Cnt != 1 {
+		t.Errorf("Unexpected counters: calls=%d send=%d fail=%d", sink.calls, worker.sendCnt.Cnt, worker.failCnt.Cnt)
+	}
+
+	// The queue is not consumed
+	worker.offer(e)
+	worker.offer(e)
+	if len(worker.queue) != 1 || worker.dropCnt.Cnt != 1 {
+		t.Errorf("Expected one event is dropped. Got: queue=%d drop=%d", len(worker.queue), worker.dropCnt.Cnt)
+	}
+
+	// The event is sent synchronously by redis sink if the queue is full
+	sink = &failingEventSink{}
+	worker = newSinkWorker(&g.EventSinkConfig{Type: g.EventSinkRedis, QueueSize: 1}, sink)
+	worker.offer(e)
+	worker.offer(e)
+	if len(worker.queue) != 1 || sink.calls != 1 || worker.sendCnt.Cnt != 1 || worker.dropCnt.Cnt != 0 {
+		t.Errorf("Expected one event is sent synchronously. Got: queue=%d calls=%d send=%d drop=%d",
+			len(worker.queue), sink.calls, worker.sendCnt.Cnt, worker.dropCnt.Cnt)
+	}
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+)
+
+/**
+ * 快照文件是gzip压缩的一连串json：
+ *
+ * 第一个是snapshotHeader，之后每个snapshotRecord是一条曲线的历史数据(HistoryBigMap)，或者一个LastEvents中的event
+ */
+const (
+	snapshotVersion       = 1
+	defaultSnapshotMaxAge = 600
+)
+
+type snapshotHeader struct {
+	Version int   `json:"version"`
+	Time    int64 `json:"time"`
+}
+
+type snapshotRecord struct {
+	Key string `json:"key,omitempty"`
+	// 由新到旧，与SafeLinkedList中的顺序一致
+	Items []*model.JudgeItem `json:"items,omitempty"`
+	Event *model.Event       `json:"event,omitempty"`
+}
+
+// 退出之前保存快照，没有启用快照时什么都不做
+func SaveSnapshot() {
+	cfg := g.Config().Snapshot
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	start := time.Now()
+	series, events, err := saveSnapshot(cfg.File, start.Unix())
+	if err != nil {
+		log.Errorf("save snapshot to %s fail: %v", cfg.File, err)
+		return
+	}
+
+	log.Infof("save snapshot to %s successfully. %d series and %d events. cost: %v", cfg.File, series, events, time.Since(start))
+}
+
+// 启动时恢复快照，必须在InitHistoryBigMap和InitLastEvents之后调用，没有启用快照时什么都不做
+func RestoreSnapshot() {
+	cfg := g.Config().Snapshot
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	maxAge := cfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultSnapshotMaxAge
+	}
+
+	series, events, err := restoreSnapshot(cfg.File, maxAge, time.Now().Unix())
+	if err != nil {
+		log.Errorf("restore snapshot from %s fail: %v", cfg.File, err)
+		return
+	}
+
+	log.Infof("restore snapshot from %s successfully. %d series and %d events", cfg.File, series, events)
+}
+
+// 先写到临时文件，再改名，避免写了一半的快照被恢复
+func saveSnapshot(path string, now int64) (series int, events int, err error) {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	bufWriter := bufio.NewWriter(file)
+	gzipWriter := gzip.NewWriter(bufWriter)
+	encoder := json.NewEncoder(gzipWriter)
+
+	if err = encoder.Encode(&snapshotHeader{Version: snapshotVersion, Time: now}); err != nil {
+		return
+	}
+
+	for _, m := range HistoryBigMap {
+		m.RLock()
+		records := make([]*snapshotRecord, 0, len(m.M))
+		for key, L := range m.M {
+			records = append(records, &snapshotRecord{Key: key, Items: L.ToSlice()})
+		}
+		m.RUnlock()
+
+		for _, record := range records {
+			if len(record.Items) == 0 {
+				continue
+			}
+			if err = encoder.Encode(record); err != nil {
+				return
+			}
+			series++
+		}
+	}
+
+	for _, event := range copyLastEvents() {
+		if err = encoder.Encode(&snapshotRecord{Event: event}); err != nil {
+			return
+		}
+		events++
+	}
+
+	if err = gzipWriter.Close(); err != nil {
+		return
+	}
+	if err = bufWriter.Flush(); err != nil {
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+
+	err = os.Rename(tmpPath, path)
+	return
+}
+
+func copyLastEvents() []*model.Event {
+	g.LastEvents.RLock()
+	defer g.LastEvents.RUnlock()
+
+	events := make([]*model.Event, 0, len(g.LastEvents.M))
+	for _, event := range g.LastEvents.M {
+		events = append(events, event)
+	}
+	return events
+}
+
+// 快照的版本不对，或者快照太旧时不做恢复。
+//
+// LastEvents可能已经从EventsStoreFilePath加载过了，同一个event以EventTime较新的为准
+func restoreSnapshot(path string, maxAge int64, now int64) (series int, events int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(gzipReader)
+
+	var header snapshotHeader
+	if err = decoder.Decode(&header); err != nil {
+		return
+	}
+	if header.Version != snapshotVersion {
+		err = fmt.Errorf("unsupported version of snapshot: %d", header.Version)
+		return
+	}
+	if now-header.Time > maxAge {
+		err = fmt.Errorf("snapshot is stale. saved at: %s", time.Unix(header.Time, 0).Format(time.RFC3339))
+		return
+	}
+
+	for {
+		var record snapshotRecord
+		if err = decoder.Decode(&record); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		switch {
+		case record.Event != nil:
+			if restoreEvent(record.Event) {
+				events++
+			}
+		case len(record.Key) >= 2 && len(record.Items) > 0:
+			if restoreHistory(record.Key, record.Items) {
+				series++
+			}
+		}
+	}
+}
+
+func restoreHistory(key string, items []*model.JudgeItem) bool {
+	m, ok := HistoryBigMap[key[0:2]]
+	if !ok {
+		return false
+	}
+
+	// 已经有新数据上来了，不再覆盖
+	if _, exists := m.Get(key); exists {
+		return false
+	}
+
+	L := list.New()
+	for _, item := range items {
+		L.PushBack(item)
+	}
+	m.Set(key, &SafeLinkedList{L: L})
+	return true
+}
+
+func restoreEvent(event *model.Event) bool {
+	if lastEvent, exists := g.LastEvents.Get(event.Id); exists && lastEvent.EventTime >= event.EventTime {
+		return false
+	}
+
+	g.LastEvents.Set(event.Id, event)
+	return true
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/judge/g"
+)
+
+func TestSaveAndRestoreSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "judge-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer resetHistoryAndEvents()
+
+	path := filepath.Join(dir, "snapshot.gz")
+	now := int64(1600000000)
+
+	resetHistoryAndEvents()
+	items := []*model.JudgeItem{
+		{Endpoint: "host-1", Metric: "cpu.idle", Value: 12, JudgeType: "GAUGE", Timestamp: now},
+		{Endpoint: "host-1", Metric: "cpu.idle", Value: 10, JudgeType: "GAUGE", Timestamp: now - 60},
+	}
+	pk := items[0].PrimaryKey()
+	for i := len(items) - 1; i >= 0; i-- {
+		HistoryBigMap[pk[0:2]].PushFrontAndMaintain(pk, items[i], 11, now)
+	}
+	problem := &model.Event{Id: "s_1_abc", Status: "PROBLEM", CurrentStep: 3, EventTime: now - 120}
+	resolved := &model.Event{Id: "s_2_abc", Status: "OK", CurrentStep: 1, EventTime: now - 60}
+	g.LastEvents.Set(problem.Id, problem)
+	g.LastEvents.Set(resolved.Id, resolved)
+
+	series, events, err := saveSnapshot(path, now)
+	if err != nil || series != 1 || events != 2 {
+		t.Fatalf("saveSnapshot() got: %d, %d, %v", series, events, err)
+	}
+
+	resetHistoryAndEvents()
+	// The event loaded from EventsStoreFilePath is newer
+	newerResolved := &model.Event{Id: "s_2_abc", Status: "PROBLEM", CurrentStep: 1, EventTime: now}
+	g.LastEvents.Set(newerResolved.Id, newerResolved)
+
+	series, events, err = restoreSnapshot(path, 600, now+300)
+	if err != nil || series != 1 || events != 1 {
+		t.Fatalf("restoreSnapshot() got: %d, %d, %v", series, events, err)
+	}
+
+	L, ok := HistoryBigMap[pk[0:2]].Get(pk)
+	if !ok || !reflect.DeepEqual(L.ToSlice(), items) {
+		t.Errorf("History is not restored. Got: %#v", L)
+	}
+	if event, _ := g.LastEvents.Get(problem.Id); !reflect.DeepEqual(event, problem) {
+		t.Errorf("Expected event: %v. Got: %v", problem, event)
+	}
+	if event, _ := g.LastEvents.Get(resolved.Id); event != newerResolved {
+		t.Errorf("Expected the newer event is kept. Got: %v", event)
+	}
+}
+
+func TestRestoreSnapshotWhichIsNotUsable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "judge-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer resetHistoryAndEvents()
+
+	now := int64(1600000000)
+	resetHistoryAndEvents()
+	g.LastEvents.Set("s_1_abc", &model.Event{Id: "s_1_abc", Status: "PROBLEM", EventTime: now})
+
+	stalePath := filepath.Join(dir, "stale.gz")
+	if _, _, err := saveSnapshot(stalePath, now-601); err != nil {
+		t.Fatal(err)
+	}
+	unknownPath := filepath.Join(dir, "unknown.gz")
+	writeSnapshotHeader(t, unknownPath, &snapshotHeader{Version: snapshotVersion + 1, Time: now})
+
+	resetHistoryAndEvents()
+
+	if _, _, err := restoreSnapshot(stalePath, 600, now); err == nil {
+		t.Errorf("Expected error for stale snapshot")
+	}
+	if _, _, err := restoreSnapshot(unknownPath, 600, now); err == nil {
+		t.Errorf("Expected error for unknown version of snapshot")
+	}
+	if len(g.LastEvents.GetAll()) != 0 {
+		t.Errorf("Expected nothing is restored")
+	}
+
+	// No snapshot is fine
+	if series, events, err := restoreSnapshot(filepath.Join(dir, "none.gz"), 600, now); series != 0 || events != 0 || err != nil {
+		t.Errorf("restoreSnapshot() of absent file got: %d, %d, %v", series, events, err)
+	}
+}
+
+func resetHistoryAndEvents() {
+	HistoryBigMap = make(map[string]*JudgeItemMap)
+	InitHistoryBigMap()
+
+	g.LastEvents.Lock()
+	g.LastEvents.M = make(map[string]*model.Event)
+	g.LastEvents.Unlock()
+}
+
+func writeSnapshotHeader(t *testing.T, path string, header *snapshotHeader) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+
+	if err := json.NewEncoder(gzipWriter).Encode(header); err != nil {
+		t.Fatal(err)
+	}
+}
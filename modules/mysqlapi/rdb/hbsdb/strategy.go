@@ -21,7 +21,7 @@ func QueryStrategies(tpls map[int]*model.NewTemplate) (map[int]*model.NewStrateg
 	now := time.Now().Format("15:04")
 	sql := fmt.Sprintf(
 		"select %s from strategy as s where (s.run_begin='' and s.run_end='') or (s.run_begin <= '%s' and s.run_end > '%s')",
-		"s.id, s.metric, s.tags, s.func, s.op, s.right_value, s.max_step, s.priority, s.note, s.tpl_id",
+		"s.id, s.metric, s.tags, s.func, s.op, s.right_value, s.cond, s.max_step, s.priority, s.note, s.tpl_id",
 		now,
 		now,
 	)
@@ -37,7 +37,7 @@ func QueryStrategies(tpls map[int]*model.NewTemplate) (map[int]*model.NewStrateg
 		s := model.NewStrategy{}
 		var tags string
 		var tid int
-		err = rows.Scan(&s.ID, &s.Metric, &tags, &s.Func, &s.Operator, &s.RightValue, &s.MaxStep, &s.Priority, &s.Note, &tid)
+		err = rows.Scan(&s.ID, &s.Metric, &tags, &s.Func, &s.Operator, &s.RightValue, &s.Condition, &s.MaxStep, &s.Priority, &s.Note, &tid)
 		if err != nil {
 			log.Println("ERROR:", err)
 			continue
@@ -97,7 +97,7 @@ func QueryStrategies(tpls map[int]*model.NewTemplate) (map[int]*model.NewStrateg
 
 func QueryBuiltinMetrics(tids string) ([]*model.NewBuiltinMetric, error) {
 	sql := fmt.Sprintf(
-		"select metric, tags from strategy where tpl_id in (%s) and metric in ('net.port.listen', 'proc.num', 'du.bs', 'url.check.health')",
+		"select metric, tags from strategy where tpl_id in (%s) and metric in ('net.port.listen', 'proc.num', 'du.bs', 'url.check.health', 'log.match')",
 		tids,
 	)
 
@@ -45,6 +45,13 @@ type GraphConfig struct {
 	Cluster     map[string]string `json:"cluster"`
 }
 
+// The HTTP addresses of judge nodes, which are used to merge the current alerts
+type JudgeConfig struct {
+	// Milliseconds
+	Timeout int               `json:"timeout"`
+	Cluster map[string]string `json:"cluster"`
+}
+
 type ApiConfig struct {
 	Name      string `json:"name"`
 	Token     string `json:"token"`
@@ -97,6 +104,7 @@ type GlobalConfig struct {
 	Speed      *NetConfig      `json:"speed"`
 	Api        *ApiConfig      `json:"api"`
 	Graph      *GraphConfig    `json:"graph"`
+	Judge      *JudgeConfig    `json:"judge"`
 	Db         *DbConfig       `json:"db"`
 	ApolloDB   *DbConfig       `json:"apollodb"`
 	BossDB     *DbConfig       `json:"bossdb"`
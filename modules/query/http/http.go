@@ -68,6 +68,7 @@ func Start() {
 	configCommonRoutes()
 	configProcHttpRoutes()
 	configGraphRoutes()
+	configJudgeRoutes()
 	configAPIRoutes()
 	configAlertRoutes()
 	configGrafanaRoutes()
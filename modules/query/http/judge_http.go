@@ -0,0 +1,26 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/fwtpe/owl-backend/modules/query/judge"
+)
+
+// The current alerts merged from all judge nodes(judge.cluster),
+// the parameters are the same as judge: endpoint, strategy, expression, priority, template and within
+func configJudgeRoutes() {
+	http.HandleFunc("/judge/alerts", func(w http.ResponseWriter, r *http.Request) {
+		result, err := judge.CurrentAlerts(r.URL.Query())
+		AutoRender(w, result, err)
+	})
+
+	http.HandleFunc("/judge/alerts/count", func(w http.ResponseWriter, r *http.Request) {
+		result, err := judge.CountAlerts(r.URL.Query())
+		AutoRender(w, result, err)
+	})
+
+	http.HandleFunc("/judge/alerts/recovered", func(w http.ResponseWriter, r *http.Request) {
+		result, err := judge.RecoveredAlerts(r.URL.Query())
+		AutoRender(w, result, err)
+	})
+}
@@ -0,0 +1,154 @@
+package judge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/query/g"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultTimeout = 3000
+
+// The merged events of all judge nodes, errors are keyed by the name of node
+type AlertsResult struct {
+	Events []*cmodel.Event   `json:"events"`
+	Errors map[string]string `json:"errors"`
+}
+
+type AlertCountsResult struct {
+	Counts *cmodel.AlertCounts `json:"counts"`
+	Errors map[string]string   `json:"errors"`
+}
+
+// Lists the current alerts(PROBLEM events) of all judge nodes, sorted by event time(latest first).
+//
+// The filters(endpoint, strategy, expression, priority and template) are passed to judge as they are.
+func CurrentAlerts(query url.Values) (*AlertsResult, error) {
+	return queryEvents("/alerts", query)
+}
+
+// Lists the alerts recovered in "within" seconds of all judge nodes
+func RecoveredAlerts(query url.Values) (*AlertsResult, error) {
+	return queryEvents("/alerts/recovered", query)
+}
+
+// Sums the counts of current alerts of all judge nodes
+func CountAlerts(query url.Values) (*AlertCountsResult, error) {
+	result := &AlertCountsResult{Counts: cmodel.NewAlertCounts()}
+
+	var err error
+	result.Errors, err = fanOut("/alerts/count", query,
+		func() interface{} {
+			return cmodel.NewAlertCounts()
+		},
+		func(data interface{}) {
+			result.Counts.Merge(data.(*cmodel.AlertCounts))
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func queryEvents(path string, query url.Values) (*AlertsResult, error) {
+	result := &AlertsResult{Events: []*cmodel.Event{}}
+
+	var err error
+	result.Errors, err = fanOut(path, query,
+		func() interface{} {
+			return &[]*cmodel.Event{}
+		},
+		func(data interface{}) {
+			result.Events = append(result.Events, *data.(*[]*cmodel.Event)...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result.Events, func(i, j int) bool {
+		left, right := result.Events[i], result.Events[j]
+		if left.EventTime != right.EventTime {
+			return left.EventTime > right.EventTime
+		}
+		return left.Id < right.Id
+	})
+	return result, nil
+}
+
+// Queries every judge node concurrently, @merge is called serially with the data of each node.
+//
+// The nodes which fail are reported in the returned errors, other nodes are still merged.
+func fanOut(path string, query url.Values, newData func() interface{}, merge func(data interface{})) (map[string]string, error) {
+	config := g.Config().Judge
+	if config == nil || len(config.Cluster) == 0 {
+		return nil, fmt.Errorf("judge cluster is not configured")
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Millisecond}
+
+	errors := make(map[string]string)
+	lock := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+
+	for name, addr := range config.Cluster {
+		wg.Add(1)
+		go func(name string, addr string) {
+			defer wg.Done()
+
+			data := newData()
+			err := getFromJudge(client, fmt.Sprintf("http://%s%s?%s", addr, path, query.Encode()), data)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err != nil {
+				log.Warnf("query %s of judge %s(%s) fail: %v", path, name, addr, err)
+				errors[name] = err.Error()
+				return
+			}
+			merge(data)
+		}(name, addr)
+	}
+	wg.Wait()
+
+	return errors, nil
+}
+
+// The response of judge is {"msg": "success", "data": ...}, or {"msg": "<error>"}
+func getFromJudge(client *http.Client, url string, data interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	dto := &struct {
+		Msg  string      `json:"msg"`
+		Data interface{} `json:"data"`
+	}{Data: data}
+	if err := json.NewDecoder(resp.Body).Decode(dto); err != nil {
+		return err
+	}
+	if dto.Msg != "success" {
+		return fmt.Errorf("%s", dto.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package judge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/query/g"
+)
+
+func TestFanOutToJudgeCluster(t *testing.T) {
+	judge1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("priority") != "0" {
+			w.Write([]byte(`{"msg": "priority is not passed"}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/alerts":
+			w.Write([]byte(`{"msg": "success", "data": [{"id": "s_1_a", "eventTime": 100}, {"id": "s_1_c", "eventTime": 300}]}`))
+		case "/alerts/count":
+			w.Write([]byte(`{"msg": "success", "data": {"total": 2, "byTemplate": {"12": 2}, "byPriority": {"0": 2}}}`))
+		}
+	}))
+	defer judge1.Close()
+	judge2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/alerts":
+			w.Write([]byte(`{"msg": "success", "data": [{"id": "s_1_b", "eventTime": 200}]}`))
+		case "/alerts/count":
+			w.Write([]byte(`{"msg": "success", "data": {"total": 1, "byTemplate": {"12": 1}, "byPriority": {"0": 1}}}`))
+		}
+	}))
+	defer judge2.Close()
+
+	defer g.SetConfig(g.Config())
+	g.SetConfig(&g.GlobalConfig{Judge: &g.JudgeConfig{Cluster: map[string]string{
+		"judge-00": strings.TrimPrefix(judge1.URL, "http://"),
+		"judge-01": strings.TrimPrefix(judge2.URL, "http://"),
+		"judge-02": "127.0.0.1:1",
+	}}})
+
+	query := url.Values{"priority": []string{"0"}}
+
+	alerts, err := CurrentAlerts(query)
+	if err != nil {
+		t.Fatalf("CurrentAlerts() has error: %v", err)
+	}
+	ids := []string{}
+	for _, event := range alerts.Events {
+		ids = append(ids, event.Id)
+	}
+	if strings.Join(ids, ",") != "s_1_c,s_1_b,s_1_a" {
+		t.Errorf("Unexpected events: %v", ids)
+	}
+	if _, ok := alerts.Errors["judge-02"]; !ok || len(alerts.Errors) != 1 {
+		t.Errorf("Expected error of judge-02. Got: %v", alerts.Errors)
+	}
+
+	counts, err := CountAlerts(query)
+	if err != nil {
+		t.Fatalf("CountAlerts() has error: %v", err)
+	}
+	expected := &cmodel.AlertCounts{Total: 3, ByTemplate: map[string]int{"12": 3}, ByPriority: map[string]int{"0": 3}}
+	if counts.Counts.Total != expected.Total || counts.Counts.ByTemplate["12"] != 3 || counts.Counts.ByPriority["0"] != 3 {
+		t.Errorf("Expected: %#v. Got: %#v", expected, counts.Counts)
+	}
+
+	// The error message of judge
+	alerts, _ = CurrentAlerts(url.Values{})
+	if alerts.Errors["judge-00"] != "priority is not passed" {
+		t.Errorf("Expected error message of judge-00. Got: %v", alerts.Errors)
+	}
+
+	g.SetConfig(&g.GlobalConfig{})
+	if _, err := CurrentAlerts(query); err == nil {
+		t.Errorf("Expected error if judge cluster is not configured")
+	}
+}
@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+// The response kept for audit records is truncated to this size
+const maxResponse = 1024
+
+// Builds the request to the webhook(of route) of a chat tool, and checks the response of it
+type Formatter interface {
+	Request(route *g.ChatRoute, msg *model.Chat, now time.Time) (webhook string, body []byte, err error)
+	// Called with the response of 2xx, some of the tools respond errors with 200
+	Check(response []byte) error
+}
+
+var formatters = map[string]Formatter{}
+
+// Registers the formatter of type, which is called in init() of the formatters
+func Register(name string, formatter Formatter) {
+	formatters[name] = formatter
+}
+
+func Get(name string) Formatter {
+	return formatters[name]
+}
+
+func Names() []string {
+	names := []string{}
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Posts the message to the webhook of route, returns the response
+func Send(client *http.Client, formatter Formatter, route *g.ChatRoute, msg *model.Chat, now time.Time) (string, error) {
+	webhook, body, err := formatter.Request(route, msg, now)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return string(respBody), fmt.Errorf("status: %d, response: %s", resp.StatusCode, respBody)
+	}
+	return string(respBody), formatter.Check(respBody)
+}
+
+// The target shown in audit records, the name of route if the target is empty
+func TargetOf(msg *model.Chat) string {
+	if msg.Target != "" {
+		return msg.Target
+	}
+	if msg.Route != "" {
+		return msg.Route
+	}
+	return "unknown"
+}
+
+// The subject followed by content, the content of combined alarms contains the subject
+func textOf(msg *model.Chat) string {
+	if msg.Subject == "" || strings.HasPrefix(msg.Content, msg.Subject) {
+		return msg.Content
+	}
+	return msg.Subject + "\n" + msg.Content
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+func TestSignDingtalk(t *testing.T) {
+	if sign := SignDingtalk("SEC000", "1500000000000"); sign != "Hpf/o9PpsfQpbsSt4XkF18ZAGoTIvRCp9Crs1886UPI=" {
+		t.Errorf("Unexpected sign: %s", sign)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	route := &g.ChatRoute{Url: "https://robot.example.com/send?access_token=abc", Secret: "SEC000"}
+	msg := &model.Chat{
+		Route:  "ops",
+		Status: "OK", Subject: "[P0][OK] cpu.idle", Content: "[P0][OK] cpu.idle\nEndpoint:host-1",
+	}
+	now := time.Unix(1500000000, 0)
+
+	testCases := []*struct {
+		formatter string
+		webhook   string
+		body      string
+	}{
+		{"slack", route.Url, `{"text":"*[P0][OK] cpu.idle*\n[P0][OK] cpu.idle\nEndpoint:host-1"}`},
+		{
+			"dingtalk",
+			"https://robot.example.com/send?access_token=abc&sign=Hpf%2Fo9PpsfQpbsSt4XkF18ZAGoTIvRCp9Crs1886UPI%3D&timestamp=1500000000000",
+			`{"msgtype":"text","text":{"content":"[P0][OK] cpu.idle\nEndpoint:host-1"}}`,
+		},
+		{"wecom", route.Url, `{"msgtype":"text","text":{"content":"[P0][OK] cpu.idle\nEndpoint:host-1"}}`},
+		{
+			"teams", route.Url,
+			`{"@context":"https://schema.org/extensions","@type":"MessageCard","summary":"[P0][OK] cpu.idle","text":"[P0][OK] cpu.idle\n\nEndpoint:host-1","themeColor":"5CB85C","title":"[P0][OK] cpu.idle"}`,
+		},
+	}
+	for _, testCase := range testCases {
+		webhook, body, err := Get(testCase.formatter).Request(route, msg, now)
+		if err != nil {
+			t.Errorf("[%s] Request fail: %v", testCase.formatter, err)
+			continue
+		}
+		if webhook != testCase.webhook {
+			t.Errorf("[%s] Expected webhook: %s. Got: %s", testCase.formatter, testCase.webhook, webhook)
+		}
+		if string(body) != testCase.body {
+			t.Errorf("[%s] Expected body: %s. Got: %s", testCase.formatter, testCase.body, body)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	responses := []*struct {
+		code int
+		body string
+	}{
+		{http.StatusOK, `{"errcode":0,"errmsg":"ok"}`},
+		{http.StatusOK, `{"errcode":130101,"errmsg":"send too fast"}`},
+		{http.StatusBadGateway, `bad gateway`},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &map[string]interface{}{}) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response := responses[0]
+		responses = responses[1:]
+		w.WriteHeader(response.code)
+		w.Write([]byte(response.body))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	route := &g.ChatRoute{Url: server.URL}
+	msg := &model.Chat{Route: "ops", Subject: "PROBLEM", Content: "cpu.idle"}
+
+	for i, success := range []bool{true, false, false} {
+		if _, err := Send(client, Get("wecom"), route, msg, time.Now()); (err == nil) != success {
+			t.Errorf("[%d] Expected success: %v. Got: %v", i, success, err)
+		}
+	}
+}
+
+func TestTargetOf(t *testing.T) {
+	if target := TargetOf(&model.Chat{Target: "ops", Route: "ops-slack"}); target != "ops" {
+		t.Errorf("Expected ops. Got: %s", target)
+	}
+	if target := TargetOf(&model.Chat{Route: "ops-slack"}); target != "ops-slack" {
+		t.Errorf("Expected ops-slack. Got: %s", target)
+	}
+}
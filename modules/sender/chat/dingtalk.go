@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+// Robots of DingTalk, the request is signed if the secret of route is set
+type dingtalkFormatter struct{}
+
+func init() {
+	Register("dingtalk", &dingtalkFormatter{})
+}
+
+// Both of DingTalk and WeCom respond errors by "errcode" with 200
+type robotResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func checkRobotResponse(response []byte) error {
+	result := &robotResponse{}
+	if err := json.Unmarshal(response, result); err != nil {
+		return fmt.Errorf("response is not valid: %s", response)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("errcode: %d, errmsg: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+func (this *dingtalkFormatter) Request(route *g.ChatRoute, msg *model.Chat, now time.Time) (string, []byte, error) {
+	webhook := route.Url
+	if route.Secret != "" {
+		u, err := url.Parse(route.Url)
+		if err != nil {
+			return "", nil, err
+		}
+
+		timestamp := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+		query := u.Query()
+		query.Set("timestamp", timestamp)
+		query.Set("sign", SignDingtalk(route.Secret, timestamp))
+		u.RawQuery = query.Encode()
+		webhook = u.String()
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": textOf(msg)},
+	})
+	return webhook, body, err
+}
+
+func (this *dingtalkFormatter) Check(response []byte) error {
+	return checkRobotResponse(response)
+}
+
+// Base64 of HmacSHA256("timestamp\nsecret") by the secret
+func SignDingtalk(secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
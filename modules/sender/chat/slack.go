@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+// Incoming webhooks of Slack, also supported by Mattermost and Rocket.Chat
+type slackFormatter struct{}
+
+func init() {
+	Register("slack", &slackFormatter{})
+}
+
+func (this *slackFormatter) Request(route *g.ChatRoute, msg *model.Chat, now time.Time) (string, []byte, error) {
+	text := msg.Content
+	if msg.Subject != "" {
+		text = "*" + msg.Subject + "*\n" + msg.Content
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	return route.Url, body, err
+}
+
+func (this *slackFormatter) Check(response []byte) error {
+	return nil
+}
@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+const (
+	teamsColorProblem = "D9534F"
+	teamsColorOk      = "5CB85C"
+)
+
+// Incoming webhooks of Microsoft Teams, the message is sent as a MessageCard
+type teamsFormatter struct{}
+
+func init() {
+	Register("teams", &teamsFormatter{})
+}
+
+func (this *teamsFormatter) Request(route *g.ChatRoute, msg *model.Chat, now time.Time) (string, []byte, error) {
+	color := teamsColorProblem
+	if msg.Status == "OK" {
+		color = teamsColorOk
+	}
+	summary := msg.Subject
+	if summary == "" {
+		summary = msg.Status
+	}
+
+	// The text is markdown, a single newline is not a line break
+	body, err := json.Marshal(map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": color,
+		"summary":    summary,
+		"title":      msg.Subject,
+		"text":       strings.Replace(msg.Content, "\n", "\n\n", -1),
+	})
+	return route.Url, body, err
+}
+
+func (this *teamsFormatter) Check(response []byte) error {
+	return nil
+}
@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+// Group robots of WeCom(WeChat Work)
+type wecomFormatter struct{}
+
+func init() {
+	Register("wecom", &wecomFormatter{})
+}
+
+func (this *wecomFormatter) Request(route *g.ChatRoute, msg *model.Chat, now time.Time) (string, []byte, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": textOf(msg)},
+	})
+	return route.Url, body, err
+}
+
+func (this *wecomFormatter) Check(response []byte) error {
+	return checkRobotResponse(response)
+}
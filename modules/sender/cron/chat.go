@@ -0,0 +1,72 @@
+package cron
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/chat"
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+	"github.com/fwtpe/owl-backend/modules/sender/proc"
+	"github.com/fwtpe/owl-backend/modules/sender/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// Every channel of chat has its own queue and workers
+func ConsumeChats() {
+	for _, config := range g.Config().Chat {
+		formatter := chat.Get(config.Type)
+		if formatter == nil {
+			log.Errorf("type of chat %s is not supported: %s. supported: %v", config.Name, config.Type, chat.Names())
+			continue
+		}
+		go consumeChat(config, formatter)
+	}
+}
+
+func consumeChat(config *g.ChatConfig, formatter chat.Formatter) {
+	workerChan := make(chan int, config.Workers)
+	client := &http.Client{Timeout: time.Duration(config.Timeout) * time.Millisecond}
+
+	for {
+		L := redis.PopAllChat(config.Queue)
+		if len(L) == 0 {
+			time.Sleep(time.Millisecond * 200)
+			continue
+		}
+		for _, msg := range L {
+			// The recipient of chat is the room(route)
+			if len(limitRecipients(config.Name, msg, []string{msg.Route})) == 0 {
+				continue
+			}
+
+			workerChan <- 1
+			go SendChat(config, formatter, client, workerChan, msg)
+		}
+	}
+}
+
+func SendChat(config *g.ChatConfig, formatter chat.Formatter, client *http.Client, workerChan chan int, msg *model.Chat) {
+	defer func() {
+		<-workerChan
+	}()
+
+	route := config.Routes[msg.Route]
+	if route == nil {
+		// Not retried, the route would not show up until the config is changed
+		err := fmt.Errorf("route of chat %s is not configured: %q", config.Name, msg.Route)
+		afterSend(config.Name, msg, chat.TargetOf(msg), msg.Subject, &sendResult{err: err, permanent: true})
+		return
+	}
+
+	resp, err := chat.Send(client, formatter, route, msg, time.Now())
+
+	proc.IncreChatCount()
+	afterSend(config.Name, msg, chat.TargetOf(msg), msg.Subject, &sendResult{response: resp, err: err})
+
+	if g.Config().Debug {
+		log.Println("==chat==>>>>", config.Name, msg)
+		log.Println("<<<<==chat==", resp)
+	}
+}
@@ -0,0 +1,91 @@
+package cron
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/chat"
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+	"github.com/fwtpe/owl-backend/modules/sender/redis"
+	redigo "github.com/garyburd/redigo/redis"
+)
+
+func TestSendChatByRoute(t *testing.T) {
+	posted := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted <- r.URL.Path
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfgFile, err := ioutil.TempFile("", "sender-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cfgFile.Name())
+	cfgFile.WriteString(`{
+		"chat": [{"name": "slack", "type": "slack", "routes": {"ops": {"url": "` + server.URL + `/ops"}}}]
+	}`)
+	cfgFile.Close()
+	g.ParseConfig(cfgFile.Name())
+
+	var lock sync.Mutex
+	commands := [][]interface{}{}
+	defer func(old *redigo.Pool) { redis.ConnPool = old }(redis.ConnPool)
+	redis.ConnPool = &redigo.Pool{Dial: func() (redigo.Conn, error) {
+		return &fakeRedisConn{lock: &lock, commands: &commands}, nil
+	}}
+
+	config := g.Config().Chat[0]
+	client := &http.Client{Timeout: time.Second}
+	workerChan := make(chan int, 2)
+
+	workerChan <- 1
+	SendChat(config, chat.Get("slack"), client, workerChan, &model.Chat{Target: "ops", Route: "ops", Subject: "PROBLEM"})
+	if path := <-posted; path != "/ops" {
+		t.Errorf("Expected the webhook of route ops. Got: %s", path)
+	}
+
+	// The unknown route is moved to dead-letter without retries
+	workerChan <- 1
+	SendChat(config, chat.Get("slack"), client, workerChan, &model.Chat{Target: "dba", Route: "dba", Subject: "PROBLEM"})
+	select {
+	case path := <-posted:
+		t.Errorf("Unexpected post: %s", path)
+	default:
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	deadLetters := 0
+	for _, command := range commands {
+		switch command[0] {
+		case "ZADD":
+			t.Errorf("Unexpected retry: %v", command)
+		case "LPUSH":
+			value := command[2].(string)
+			if strings.Contains(value, server.URL) {
+				t.Errorf("The webhook is leaked: %s", value)
+			}
+			if command[1] == g.Config().Delivery.DeadLetterOf("slack") {
+				deadLetters++
+				msg := &model.Chat{}
+				if err := json.Unmarshal([]byte(value), msg); err != nil || msg.Route != "dba" {
+					t.Errorf("Unexpected dead-letter: %s, %v", value, err)
+				}
+			}
+		}
+	}
+	if deadLetters != 1 {
+		t.Errorf("Expected 1 dead-letter. Got: %d", deadLetters)
+	}
+}
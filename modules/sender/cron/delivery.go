@@ -0,0 +1,169 @@
+package cron
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+	"github.com/fwtpe/owl-backend/modules/sender/proc"
+	"github.com/fwtpe/owl-backend/modules/sender/redis"
+	log "github.com/sirupsen/logrus"
+	"github.com/toolkits/net/httplib"
+)
+
+// The response kept in audit records is truncated to this size
+const maxDeliveryResponse = 1024
+
+type sendResult struct {
+	response string
+	err      error
+	// The failure is not retried, e.g. the recipients are rejected
+	permanent bool
+}
+
+// The messages waiting for retry are pushed back to their queues when they are due
+func RetryDeliveries() {
+	for {
+		time.Sleep(time.Second)
+		redis.RequeueDueRetries(g.Config().Delivery.RetryQueue, time.Now())
+	}
+}
+
+// Records the result of the attempt, a failed message is retried later or moved to dead-letter
+func afterSend(channel string, msg model.Message, tos string, subject string, result *sendResult) {
+	config := g.Config().Delivery
+	now := time.Now()
+
+	state := msg.State()
+	if state.Id == "" {
+		state.Id = newDeliveryId()
+	}
+	state.Attempts++
+
+	status := deliveryStatus(config.RetryOf(channel), state.Attempts, result)
+	response := result.response
+	if result.err != nil {
+		response = result.err.Error()
+		log.Errorf("send %s(%s) to %s fail(attempts: %d): %v", channel, state.Id, tos, state.Attempts, result.err)
+	}
+
+	record, err := json.Marshal(&model.DeliveryRecord{
+		Id: state.Id, Channel: channel, Tos: tos, Subject: subject, Status: status,
+		Attempts: state.Attempts, Response: truncateResponse(response), Time: now.Unix(),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if err := redis.PushLimited(config.Audit, record, config.AuditSize); err != nil {
+		log.Errorf("push audit record of %s(%s) fail: %v", channel, state.Id, err)
+	}
+
+	if status == model.DeliverySuccess {
+		return
+	}
+
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if status == model.DeliveryRetrying {
+		proc.IncreRetryCount()
+		next := now.Add(deliveryBackoff(config.RetryOf(channel), state.Attempts))
+		if err := redis.ScheduleRetry(config.RetryQueue, queueOf(channel), bs, next); err != nil {
+			log.Errorf("schedule retry of %s(%s) fail: %v. message: %s", channel, state.Id, err, bs)
+		}
+		return
+	}
+
+	proc.IncreDeadLetterCount()
+	if err := redis.PushLimited(config.DeadLetterOf(channel), bs, config.DeadLetterSize); err != nil {
+		log.Errorf("push dead-letter of %s(%s) fail: %v. message: %s", channel, state.Id, err, bs)
+	}
+}
+
+func deliveryStatus(retry *g.RetryConfig, attempts int, result *sendResult) string {
+	switch {
+	case result.err == nil:
+		return model.DeliverySuccess
+	case !result.permanent && attempts < retry.MaxAttempts:
+		return model.DeliveryRetrying
+	}
+	return model.DeliveryFailed
+}
+
+func deliveryBackoff(retry *g.RetryConfig, attempts int) time.Duration {
+	backoff := retry.Backoff
+	for i := 1; i < attempts && backoff < retry.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > retry.MaxBackoff {
+		backoff = retry.MaxBackoff
+	}
+	return time.Duration(backoff) * time.Second
+}
+
+func queueOf(channel string) string {
+	queue := g.Config().Queue
+	switch channel {
+	case model.ChannelSms:
+		return queue.Sms
+	case model.ChannelMail:
+		return queue.Mail
+	case model.ChannelQQ:
+		return queue.QQ
+	case model.ChannelServerchan:
+		return queue.Serverchan
+	}
+	for _, chat := range g.Config().Chat {
+		if chat.Name == channel {
+			return chat.Queue
+		}
+	}
+	return ""
+}
+
+// The status other than 2xx is an error
+func postForm(r *httplib.BeegoHttpRequest) *sendResult {
+	resp, err := r.Response()
+	if err != nil {
+		return &sendResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDeliveryResponse))
+	if err != nil {
+		return &sendResult{err: err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &sendResult{response: string(body), err: fmt.Errorf("status: %d, response: %s", resp.StatusCode, body)}
+	}
+	return &sendResult{response: string(body)}
+}
+
+func truncateResponse(response string) string {
+	if len(response) > maxDeliveryResponse {
+		response = response[:maxDeliveryResponse]
+	}
+	for !utf8.ValidString(response) {
+		response = response[:len(response)-1]
+	}
+	return response
+}
+
+func newDeliveryId() string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(bs)
+}
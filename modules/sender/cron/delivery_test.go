@@ -0,0 +1,75 @@
+package cron
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+func TestDeliveryStatus(t *testing.T) {
+	retry := &g.RetryConfig{MaxAttempts: 3}
+	fail := errors.New("timeout")
+
+	testCases := []*struct {
+		attempts int
+		result   *sendResult
+		expected string
+	}{
+		{1, &sendResult{}, model.DeliverySuccess},
+		{3, &sendResult{}, model.DeliverySuccess},
+		{1, &sendResult{err: fail}, model.DeliveryRetrying},
+		{2, &sendResult{err: fail}, model.DeliveryRetrying},
+		{3, &sendResult{err: fail}, model.DeliveryFailed},
+		{1, &sendResult{err: fail, permanent: true}, model.DeliveryFailed},
+	}
+	for i, testCase := range testCases {
+		if status := deliveryStatus(retry, testCase.attempts, testCase.result); status != testCase.expected {
+			t.Errorf("[%d] Expected: %s. Got: %s", i, testCase.expected, status)
+		}
+	}
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	retry := &g.RetryConfig{Backoff: 10, MaxBackoff: 60}
+	for i, expected := range []int{10, 20, 40, 60, 60} {
+		attempts := i + 1
+		if backoff := deliveryBackoff(retry, attempts); backoff != time.Duration(expected)*time.Second {
+			t.Errorf("[%d] Expected: %ds. Got: %v", attempts, expected, backoff)
+		}
+	}
+}
+
+func TestDeliveryState(t *testing.T) {
+	// The message from alarm has no state
+	sms := &model.Sms{}
+	if err := json.Unmarshal([]byte(`{"tos":"123","content":"PROBLEM"}`), sms); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg model.Message = sms
+	msg.State().Id, msg.State().Attempts = "d1", 2
+
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != `{"tos":"123","content":"PROBLEM","deliveryId":"d1","attempts":2}` {
+		t.Errorf("Unexpected JSON: %s", bs)
+	}
+}
+
+func TestTruncateResponse(t *testing.T) {
+	response := strings.Repeat("a", maxDeliveryResponse-1) + "告警"
+	truncated := truncateResponse(response)
+	if truncated != strings.Repeat("a", maxDeliveryResponse-1) {
+		t.Errorf("Unexpected length of truncated response: %d", len(truncated))
+	}
+	if truncateResponse("ok") != "ok" {
+		t.Errorf("Short response should not be truncated")
+	}
+}
@@ -0,0 +1,138 @@
+package cron
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/limiter"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+	"github.com/fwtpe/owl-backend/modules/sender/proc"
+	"github.com/fwtpe/owl-backend/modules/sender/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+var RateLimiter = limiter.NewLimiter()
+
+// Returns the recipients to send, the others are coalesced into digests.
+// The retries and digests are not limited, which have passed the limits.
+func limitRecipients(channel string, msg model.Message, tos []string) []string {
+	config := g.Config().RateLimit
+	state := msg.State()
+	if config == nil || !config.Enabled || state.Attempts > 0 || state.Digest {
+		return tos
+	}
+
+	allowed := RateLimiter.Allow(config, channel, tos, msg, time.Now())
+	if suppressed := len(tos) - len(allowed); suppressed > 0 {
+		proc.IncreSuppressedCount(uint32(suppressed))
+		if g.Config().Debug {
+			log.Printf("%d recipients of %s are suppressed: %v", suppressed, channel, msg)
+		}
+	}
+	return allowed
+}
+
+// The comma separated recipients to send, false if all of them are suppressed
+func limitTos(channel string, msg model.Message, tos string) (string, bool) {
+	recipients := splitTos(tos)
+	allowed := limitRecipients(channel, msg, recipients)
+	if len(allowed) == len(recipients) {
+		return tos, true
+	}
+	return strings.Join(allowed, ","), len(allowed) > 0
+}
+
+// The digests are pushed to the queues of channels when the buckets are refilled
+func SendDigests() {
+	for {
+		time.Sleep(time.Second)
+
+		config := g.Config().RateLimit
+		pushDigests(RateLimiter.DueDigests(config, time.Now()), config)
+	}
+}
+
+// The digests are kept in memory, all of the waiting ones are pushed to the queues at shutdown
+// so they are sent after restart(the digests are not limited)
+func FlushDigests() {
+	digests := RateLimiter.DueDigests(nil, time.Now())
+	pushDigests(digests, g.Config().RateLimit)
+	if len(digests) > 0 {
+		log.Infof("%d digests are flushed to the queues", len(digests))
+	}
+}
+
+func pushDigests(digests []*limiter.Digest, config *g.RateLimitConfig) {
+	link := ""
+	if config != nil {
+		link = config.Link
+	}
+
+	for _, digest := range digests {
+		msg := BuildDigest(digest, link)
+		if msg == nil {
+			continue
+		}
+		bs, err := json.Marshal(msg)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		if err := redis.Push(queueOf(digest.Channel), bs); err != nil {
+			log.Errorf("push digest of %s to %s fail: %v", digest.Channel, digest.Recipient, err)
+			continue
+		}
+		proc.IncreDigestCount()
+	}
+}
+
+// The message of the channel sent to the recipient instead of the suppressed ones
+func BuildDigest(digest *limiter.Digest, link string) model.Message {
+	subject := fmt.Sprintf("[OWL] %d more alerts suppressed", digest.Count)
+	content := fmt.Sprintf("%s since %s", subject, digest.Since.Format("2006-01-02 15:04:05"))
+
+	latest := ""
+	switch last := digest.Last.(type) {
+	case *model.Sms:
+		latest = last.Content
+	case *model.Mail:
+		latest = last.Subject
+	case *model.QQ:
+		latest = last.Subject
+	case *model.Serverchan:
+		latest = last.Subject
+	case *model.Chat:
+		latest = last.Subject
+	}
+	if latest != "" {
+		content += ", latest: " + latest
+	}
+	if link != "" {
+		content += ", see " + link
+	}
+
+	var msg model.Message
+	switch last := digest.Last.(type) {
+	case *model.Sms:
+		msg = &model.Sms{Tos: digest.Recipient, Content: content}
+	case *model.Mail:
+		msg = &model.Mail{Tos: digest.Recipient, Subject: subject, Content: content}
+	case *model.QQ:
+		msg = &model.QQ{Tos: digest.Recipient, Subject: subject, Content: content}
+	case *model.Serverchan:
+		msg = &model.Serverchan{Tos: digest.Recipient, Subject: subject, Content: content}
+	case *model.Chat:
+		msg = &model.Chat{
+			Target: last.Target, Route: last.Route,
+			Status: "PROBLEM", Subject: subject, Content: content,
+		}
+	default:
+		log.Errorf("digest of %s is not supported: %T", digest.Channel, digest.Last)
+		return nil
+	}
+	msg.State().Digest = true
+	return msg
+}
@@ -0,0 +1,83 @@
+package cron
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/limiter"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+	"github.com/fwtpe/owl-backend/modules/sender/redis"
+	redigo "github.com/garyburd/redigo/redis"
+)
+
+func TestBuildDigest(t *testing.T) {
+	since := time.Date(2017, 7, 14, 10, 40, 0, 0, time.Local)
+
+	msg := BuildDigest(&limiter.Digest{
+		Channel: model.ChannelSms, Recipient: "123", Count: 37, Since: since,
+		Last: &model.Sms{Tos: "123,456", Content: "[P0][PROBLEM] cpu.idle"},
+	}, "http://alarm.example.com")
+	sms, ok := msg.(*model.Sms)
+	if !ok || sms.Tos != "123" || !sms.Digest ||
+		sms.Content != "[OWL] 37 more alerts suppressed since 2017-07-14 10:40:00, latest: [P0][PROBLEM] cpu.idle, see http://alarm.example.com" {
+		t.Errorf("Unexpected digest: %#v", msg)
+	}
+
+	msg = BuildDigest(&limiter.Digest{
+		Channel: "dingtalk", Recipient: "ops-robot", Count: 2, Since: since,
+		Last: &model.Chat{Target: "ops", Route: "ops-robot", Status: "OK", Subject: "[P0][OK]"},
+	}, "")
+	chat, ok := msg.(*model.Chat)
+	if !ok || chat.Target != "ops" || chat.Route != "ops-robot" || chat.Subject != "[OWL] 2 more alerts suppressed" || !chat.Digest {
+		t.Errorf("Unexpected digest: %#v", msg)
+	}
+}
+
+func TestFlushDigests(t *testing.T) {
+	cfgFile, err := ioutil.TempFile("", "sender-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cfgFile.Name())
+	cfgFile.WriteString(`{"queue": {"sms": "/sms"}}`)
+	cfgFile.Close()
+	g.ParseConfig(cfgFile.Name())
+
+	var lock sync.Mutex
+	commands := [][]interface{}{}
+	defer func(old *redigo.Pool) { redis.ConnPool = old }(redis.ConnPool)
+	redis.ConnPool = &redigo.Pool{Dial: func() (redigo.Conn, error) {
+		return &fakeRedisConn{lock: &lock, commands: &commands}, nil
+	}}
+	defer func(old *limiter.Limiter) { RateLimiter = old }(RateLimiter)
+	RateLimiter = limiter.NewLimiter()
+
+	config := &g.RateLimitConfig{
+		Enabled: true,
+		Channels: map[string]*g.ChannelLimitConfig{
+			model.ChannelSms: {Recipient: &g.LimitConfig{Rate: 1, Burst: 1}},
+		},
+	}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		RateLimiter.Allow(config, model.ChannelSms, []string{"123"}, &model.Sms{Tos: "123", Content: "cpu.idle"}, now)
+	}
+
+	FlushDigests()
+	if digests := RateLimiter.Digests(); len(digests) != 0 {
+		t.Errorf("Expected no digests after flushing. Got: %v", digests)
+	}
+
+	if len(commands) != 1 || commands[0][0] != "LPUSH" || commands[0][1] != "/sms" {
+		t.Fatalf("Expected the digest is pushed to the queue of sms. Got: %v", commands)
+	}
+	sms := &model.Sms{}
+	if err := json.Unmarshal([]byte(commands[0][2].(string)), sms); err != nil || sms.Tos != "123" || !sms.Digest {
+		t.Errorf("Unexpected digest: %s, %v", commands[0][2], err)
+	}
+}
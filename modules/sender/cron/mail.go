@@ -1,13 +1,23 @@
 package cron
 
 import (
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/mailer"
 	"github.com/fwtpe/owl-backend/modules/sender/model"
 	"github.com/fwtpe/owl-backend/modules/sender/proc"
 	"github.com/fwtpe/owl-backend/modules/sender/redis"
 	log "github.com/sirupsen/logrus"
 	"github.com/toolkits/net/httplib"
-	"time"
+)
+
+var (
+	smtpLock   sync.Mutex
+	smtpConfig *g.SmtpConfig
+	smtpSender *mailer.Sender
 )
 
 func ConsumeMail() {
@@ -24,6 +34,12 @@ func ConsumeMail() {
 
 func SendMailList(L []*model.Mail) {
 	for _, mail := range L {
+		tos, ok := limitTos(model.ChannelMail, mail, mail.Tos)
+		if !ok {
+			continue
+		}
+		mail.Tos = tos
+
 		MailWorkerChan <- 1
 		go SendMail(mail)
 	}
@@ -34,21 +50,85 @@ func SendMail(mail *model.Mail) {
 		<-MailWorkerChan
 	}()
 
-	url := g.Config().Api.Mail
-	r := httplib.Post(url).SetTimeout(5*time.Second, 2*time.Minute)
-	r.Param("tos", mail.Tos)
-	r.Param("subject", mail.Subject)
-	r.Param("content", mail.Content)
-	resp, err := r.String()
-	if err != nil {
-		log.Println(err)
+	tos := mail.Tos
+	var result *sendResult
+	if sender := getSmtpSender(); sender != nil {
+		result = sendMailBySmtp(sender, mail)
+	} else {
+		url := g.Config().Api.Mail
+		r := httplib.Post(url).SetTimeout(5*time.Second, 2*time.Minute)
+		r.Param("tos", mail.Tos)
+		r.Param("subject", mail.Subject)
+		r.Param("content", mail.Content)
+		result = postForm(r)
 	}
 
 	proc.IncreMailCount()
+	if result.err != nil {
+		proc.IncreMailFailCount()
+	} else {
+		proc.IncreMailSuccessCount()
+	}
+	afterSend(model.ChannelMail, mail, tos, mail.Subject, result)
 
 	if g.Config().Debug {
 		log.Println("==mail==>>>>", mail)
-		log.Println("<<<<==mail==", resp)
+		log.Println("<<<<==mail==", result.response)
+	}
+
+}
+
+// Only the failed recipients are kept in the mail to be retried, the mail has been sent to the others.
+// Sending to the rejected recipients again is useless, so the failure is permanent if all of them are rejected.
+func sendMailBySmtp(sender *mailer.Sender, mail *model.Mail) *sendResult {
+	err := sender.Send(splitTos(mail.Tos), mail.Subject, mail.Content)
+	sendErr, ok := err.(*mailer.SendError)
+	if !ok {
+		return &sendResult{err: err}
+	}
+
+	if transient := sendErr.Tos(mailer.FailureTransient); len(transient) > 0 {
+		mail.Tos = strings.Join(transient, ",")
+		return &sendResult{err: err}
+	}
+	mail.Tos = strings.Join(sendErr.Tos(mailer.FailureRejected), ",")
+	return &sendResult{err: err, permanent: true}
+}
+
+// The sender is re-created if the config is reloaded, nil if SMTP is not enabled
+func getSmtpSender() *mailer.Sender {
+	config := g.Config().Smtp
+
+	smtpLock.Lock()
+	defer smtpLock.Unlock()
+
+	if config == smtpConfig {
+		return smtpSender
 	}
 
+	if smtpSender != nil {
+		smtpSender.Close()
+	}
+	smtpConfig, smtpSender = config, nil
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	sender, err := mailer.NewSender(config)
+	if err != nil {
+		log.Errorf("SMTP is not available, mails are sent through api: %v", err)
+		return nil
+	}
+	smtpSender = sender
+	return smtpSender
+}
+
+func splitTos(tos string) []string {
+	result := []string{}
+	for _, to := range strings.Split(tos, ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			result = append(result, to)
+		}
+	}
+	return result
 }
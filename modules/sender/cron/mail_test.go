@@ -0,0 +1,188 @@
+package cron
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+	"github.com/fwtpe/owl-backend/modules/sender/redis"
+	redigo "github.com/garyburd/redigo/redis"
+)
+
+// Records the commands instead of sending them to redis
+type fakeRedisConn struct {
+	lock     *sync.Mutex
+	commands *[][]interface{}
+}
+
+func (this *fakeRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		return nil, nil
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	*this.commands = append(*this.commands, append([]interface{}{cmd}, args...))
+	return int64(1), nil
+}
+func (this *fakeRedisConn) Close() error                      { return nil }
+func (this *fakeRedisConn) Err() error                        { return nil }
+func (this *fakeRedisConn) Send(string, ...interface{}) error { return nil }
+func (this *fakeRedisConn) Flush() error                      { return nil }
+func (this *fakeRedisConn) Receive() (interface{}, error)     { return nil, nil }
+
+// A minimal SMTP server without authentication, which rejects recipients of "rejected.com" permanently
+// and the ones of "busy.com" temporarily. Returns the recipients of received mails.
+func serveFakeSmtp(listener net.Listener) chan []string {
+	received := make(chan []string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+				reply("220 localhost ESMTP")
+				tos := []string{}
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+
+					switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+					case "EHLO":
+						reply("250 localhost")
+					case "RCPT":
+						to := strings.Trim(line[len("RCPT TO:"):], "<>")
+						switch {
+						case strings.HasSuffix(to, "@rejected.com"):
+							reply("550 No such user")
+						case strings.HasSuffix(to, "@busy.com"):
+							reply("450 Mailbox busy")
+						default:
+							tos = append(tos, to)
+							reply("250 OK")
+						}
+					case "DATA":
+						reply("354 End data with <CR><LF>.<CR><LF>")
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+						}
+						received <- tos
+						reply("250 OK")
+					case "MAIL", "RSET":
+						tos = []string{}
+						reply("250 OK")
+					case "QUIT":
+						reply("221 Bye")
+						return
+					default:
+						reply("502 Command not implemented")
+					}
+				}
+			}()
+		}
+	}()
+	return received
+}
+
+func TestSendMailRetriesFailedRecipients(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := serveFakeSmtp(listener)
+
+	cfgFile, err := ioutil.TempFile("", "sender-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cfgFile.Name())
+	fmt.Fprintf(cfgFile, `{
+		"queue": {"mail": "/mail"},
+		"smtp": {"enabled": true, "addr": "%s", "tls": "none", "from": "owl@example.com", "batchSize": 2, "timeout": 3000}
+	}`, listener.Addr())
+	cfgFile.Close()
+	g.ParseConfig(cfgFile.Name())
+
+	var lock sync.Mutex
+	commands := [][]interface{}{}
+	defer func(old *redigo.Pool) { redis.ConnPool = old }(redis.ConnPool)
+	redis.ConnPool = &redigo.Pool{Dial: func() (redigo.Conn, error) {
+		return &fakeRedisConn{lock: &lock, commands: &commands}, nil
+	}}
+	MailWorkerChan = make(chan int, 1)
+
+	// The first batch is sent to a@example.com, all of the second one are failed
+	MailWorkerChan <- 1
+	SendMail(&model.Mail{Tos: "a@example.com,b@rejected.com,c@busy.com,d@rejected.com", Subject: "PROBLEM", Content: "cpu.idle"})
+	getSmtpSender().Close()
+
+	if tos := <-received; strings.Join(tos, ",") != "a@example.com" {
+		t.Errorf("Expected mail is sent to a@example.com. Got: %v", tos)
+	}
+	select {
+	case tos := <-received:
+		t.Errorf("Unexpected mail: %v", tos)
+	default:
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	var retried *model.Mail
+	var record *model.DeliveryRecord
+	for _, command := range commands {
+		switch command[0] {
+		case "ZADD":
+			item := &struct {
+				Queue   string `json:"queue"`
+				Message string `json:"message"`
+			}{}
+			if err := json.Unmarshal([]byte(command[3].(string)), item); err != nil || item.Queue != "/mail" {
+				t.Fatalf("Unexpected retry item: %v, %v", command[3], err)
+			}
+			retried = &model.Mail{}
+			if err := json.Unmarshal([]byte(item.Message), retried); err != nil {
+				t.Fatal(err)
+			}
+		case "LPUSH":
+			if command[1] == g.Config().Delivery.Audit {
+				record = &model.DeliveryRecord{}
+				if err := json.Unmarshal([]byte(command[2].(string)), record); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	// Only the transient one is retried
+	if retried == nil || retried.Tos != "c@busy.com" || retried.Attempts != 1 {
+		t.Errorf("Expected only c@busy.com is retried. Got: %#v", retried)
+	}
+	if record == nil || record.Status != model.DeliveryRetrying ||
+		record.Tos != "a@example.com,b@rejected.com,c@busy.com,d@rejected.com" ||
+		!strings.Contains(record.Response, "b@rejected.com(rejected") {
+		t.Errorf("Unexpected audit record: %#v", record)
+	}
+}
@@ -25,6 +25,12 @@ func ConsumeQQ() {
 
 func SendQQList(L []*model.QQ) {
 	for _, qq := range L {
+		tos, ok := limitTos(model.ChannelQQ, qq, qq.Tos)
+		if !ok {
+			continue
+		}
+		qq.Tos = tos
+
 		QQWorkerChan <- 1
 		go SendQQ(qq)
 	}
@@ -37,12 +43,10 @@ func SendQQ(qq *model.QQ) {
 
 	url := g.Config().Api.QQ
 	cmd := exec.Command("/bin/bash", "./qq_sms.sh", url, qq.Subject, qq.Content)
-	err := cmd.Run()
-	if err != nil {
-		log.Println(err)
-	}
+	output, err := cmd.CombinedOutput()
 
 	proc.IncreQQCount()
+	afterSend(model.ChannelQQ, qq, qq.Tos, qq.Subject, &sendResult{response: string(output), err: err})
 
 	if g.Config().Debug {
 		log.Println("==qq==>>>>", qq.Subject)
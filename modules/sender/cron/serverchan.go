@@ -24,6 +24,12 @@ func ConsumeServerchan() {
 
 func SendServerchanList(L []*model.Serverchan) {
 	for _, serverchan := range L {
+		tos, ok := limitTos(model.ChannelServerchan, serverchan, serverchan.Tos)
+		if !ok {
+			continue
+		}
+		serverchan.Tos = tos
+
 		ServerchanWorkerChan <- 1
 		go SendServerchan(serverchan)
 	}
@@ -41,14 +47,12 @@ func SendServerchan(serverchan *model.Serverchan) {
 		r := httplib.Post(url).SetTimeout(5*time.Second, 2*time.Minute)
 		r.Param("text", serverchan.Subject)
 		r.Param("desp", serverchan.Content)
-		resp, err := r.String()
-		if err != nil {
-			log.Println(err)
-		}
+		result := postForm(r)
+		afterSend(model.ChannelServerchan, serverchan, serverchan.Tos, serverchan.Subject, result)
 
 		if g.Config().Debug {
 			log.Println("==serverchan==>>>>", serverchan)
-			log.Println("<<<<==serverchan==", resp)
+			log.Println("<<<<==serverchan==", result.response)
 		}
 	}
 	proc.IncreServerchanCount()
@@ -24,6 +24,12 @@ func ConsumeSms() {
 
 func SendSmsList(L []*model.Sms) {
 	for _, sms := range L {
+		tos, ok := limitTos(model.ChannelSms, sms, sms.Tos)
+		if !ok {
+			continue
+		}
+		sms.Tos = tos
+
 		SmsWorkerChan <- 1
 		go SendSms(sms)
 	}
@@ -38,16 +44,14 @@ func SendSms(sms *model.Sms) {
 	r := httplib.Post(url).SetTimeout(5*time.Second, 2*time.Minute)
 	r.Param("tos", sms.Tos)
 	r.Param("content", sms.Content)
-	resp, err := r.String()
-	if err != nil {
-		log.Println(err)
-	}
+	result := postForm(r)
 
 	proc.IncreSmsCount()
+	afterSend(model.ChannelSms, sms, sms.Tos, "", result)
 
 	if g.Config().Debug {
 		log.Println("==sms==>>>>", sms)
-		log.Println("<<<<==sms==", resp)
+		log.Println("<<<<==sms==", result.response)
 	}
 
 }
@@ -2,6 +2,7 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/toolkits/file"
 	"sync"
@@ -38,13 +39,210 @@ type ApiConfig struct {
 	Serverchan string `json:"serverchan"`
 }
 
+const (
+	SmtpTlsNone     = "none"
+	SmtpTlsStartTls = "starttls"
+	// implicit TLS(SMTPS), usually on port 465
+	SmtpTlsImplicit = "tls"
+
+	SmtpAuthPlain = "plain"
+	SmtpAuthLogin = "login"
+)
+
+// If enabled, mails are sent through the SMTP server instead of Api.Mail
+type SmtpConfig struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`
+	// "none", "starttls"(default) or "tls"
+	Tls                string `json:"tls"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	// "plain"(default) or "login", no authentication if username is empty
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	// The max number of recipients of a message
+	BatchSize int `json:"batchSize"`
+	// The max number of idle connections kept for reuse
+	MaxIdle int `json:"maxIdle"`
+	// Seconds
+	IdleTimeout int `json:"idleTimeout"`
+	// Milliseconds
+	Timeout int `json:"timeout"`
+}
+
+func (this *SmtpConfig) fillDefaults() {
+	if this.Tls == "" {
+		this.Tls = SmtpTlsStartTls
+	}
+	if this.Auth == "" {
+		this.Auth = SmtpAuthPlain
+	}
+	if this.BatchSize <= 0 {
+		this.BatchSize = 50
+	}
+	if this.MaxIdle <= 0 {
+		this.MaxIdle = 2
+	}
+	if this.IdleTimeout <= 0 {
+		this.IdleTimeout = 60
+	}
+	if this.Timeout <= 0 {
+		this.Timeout = 10000
+	}
+}
+
+type RetryConfig struct {
+	// Including the first attempt, the message is moved to dead-letter after that
+	MaxAttempts int `json:"maxAttempts"`
+	// Seconds, doubled by each retry up to MaxBackoff
+	Backoff    int `json:"backoff"`
+	MaxBackoff int `json:"maxBackoff"`
+}
+
+// Retries, dead-letters and audit records of the messages of all channels
+type DeliveryConfig struct {
+	// By channel("sms", "mail", "qq" or "serverchan"), "default" is used for the channels not listed
+	Retry map[string]*RetryConfig `json:"retry"`
+	// The sorted set of the messages waiting for retry
+	RetryQueue string `json:"retryQueue"`
+	// The prefix of the dead-letter lists, e.g. "/sender/dead/sms"
+	DeadLetter     string `json:"deadLetter"`
+	DeadLetterSize int    `json:"deadLetterSize"`
+	// The list of audit records, latest first
+	Audit     string `json:"audit"`
+	AuditSize int    `json:"auditSize"`
+}
+
+func (this *DeliveryConfig) fillDefaults() {
+	if this.Retry == nil {
+		this.Retry = map[string]*RetryConfig{}
+	}
+	if this.Retry["default"] == nil {
+		this.Retry["default"] = &RetryConfig{}
+	}
+	for _, retry := range this.Retry {
+		if retry.MaxAttempts <= 0 {
+			retry.MaxAttempts = 5
+		}
+		if retry.Backoff <= 0 {
+			retry.Backoff = 10
+		}
+		if retry.MaxBackoff <= 0 {
+			retry.MaxBackoff = 300
+		}
+		if retry.MaxBackoff < retry.Backoff {
+			retry.MaxBackoff = retry.Backoff
+		}
+	}
+	if this.RetryQueue == "" {
+		this.RetryQueue = "/sender/retry"
+	}
+	if this.DeadLetter == "" {
+		this.DeadLetter = "/sender/dead"
+	}
+	if this.DeadLetterSize <= 0 {
+		this.DeadLetterSize = 10000
+	}
+	if this.Audit == "" {
+		this.Audit = "/sender/audit"
+	}
+	if this.AuditSize <= 0 {
+		this.AuditSize = 10000
+	}
+}
+
+func (this *DeliveryConfig) RetryOf(channel string) *RetryConfig {
+	if retry, ok := this.Retry[channel]; ok {
+		return retry
+	}
+	return this.Retry["default"]
+}
+
+func (this *DeliveryConfig) DeadLetterOf(channel string) string {
+	return this.DeadLetter + "/" + channel
+}
+
+// A channel of chat tool, the messages of the queue are posted to the webhooks of robots
+type ChatConfig struct {
+	// Used as the channel in retries, dead-letters and audit records
+	Name string `json:"name"`
+	// The formatter: "slack", "dingtalk", "wecom" or "teams"
+	Type    string `json:"type"`
+	Queue   string `json:"queue"`
+	Workers int    `json:"workers"`
+	// Milliseconds
+	Timeout int `json:"timeout"`
+	// By name of route, which is referenced by the messages. The webhooks contain tokens
+	// so they are kept here rather than in the queued messages
+	Routes map[string]*ChatRoute `json:"routes"`
+}
+
+// A chat room, e.g. a robot of DingTalk
+type ChatRoute struct {
+	Url string `json:"url"`
+	// The sign secret of DingTalk robot
+	Secret string `json:"secret"`
+}
+
+func (this *ChatConfig) fillDefaults() {
+	if this.Queue == "" {
+		this.Queue = "/chat/" + this.Name
+	}
+	if this.Workers <= 0 {
+		this.Workers = 10
+	}
+	if this.Timeout <= 0 {
+		this.Timeout = 5000
+	}
+}
+
+// A token bucket, which is full at first
+type LimitConfig struct {
+	// Tokens added per minute
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// No limit if the bucket is not set
+type ChannelLimitConfig struct {
+	// Shared by all of the recipients of the channel
+	Channel *LimitConfig `json:"channel"`
+	// Of every recipient
+	Recipient *LimitConfig `json:"recipient"`
+}
+
+// The messages exceeding the limits are coalesced into a digest of the recipient,
+// which is sent when the buckets are refilled.
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled"`
+	// By channel, the channels not listed are not limited
+	Channels map[string]*ChannelLimitConfig `json:"channels"`
+	// Shown in digests, e.g. the page of alarm
+	Link string `json:"link"`
+}
+
+func (this *LimitConfig) check() error {
+	if this.Rate <= 0 {
+		return fmt.Errorf("rate must be positive: %v", this.Rate)
+	}
+	if this.Burst < 1 {
+		this.Burst = 1
+	}
+	return nil
+}
+
 type GlobalConfig struct {
-	Debug  bool          `json:"debug"`
-	Http   *HttpConfig   `json:"http"`
-	Redis  *RedisConfig  `json:"redis"`
-	Queue  *QueueConfig  `json:"queue"`
-	Worker *WorkerConfig `json:"worker"`
-	Api    *ApiConfig    `json:"api"`
+	Debug     bool             `json:"debug"`
+	Http      *HttpConfig      `json:"http"`
+	Redis     *RedisConfig     `json:"redis"`
+	Queue     *QueueConfig     `json:"queue"`
+	Worker    *WorkerConfig    `json:"worker"`
+	Api       *ApiConfig       `json:"api"`
+	Smtp      *SmtpConfig      `json:"smtp"`
+	Delivery  *DeliveryConfig  `json:"delivery"`
+	Chat      []*ChatConfig    `json:"chat"`
+	RateLimit *RateLimitConfig `json:"rateLimit"`
 }
 
 var (
@@ -81,6 +279,48 @@ func ParseConfig(cfg string) {
 		log.Fatalln("parse config file:", cfg, "fail:", err)
 	}
 
+	if c.Smtp != nil {
+		c.Smtp.fillDefaults()
+	}
+	// Retries are enabled without the config
+	if c.Delivery == nil {
+		c.Delivery = &DeliveryConfig{}
+	}
+	c.Delivery.fillDefaults()
+
+	chatNames := map[string]bool{"sms": true, "mail": true, "qq": true, "serverchan": true}
+	for _, chat := range c.Chat {
+		if chat.Name == "" || chat.Type == "" {
+			log.Fatalln("parse config file:", cfg, "fail: name and type of chat are required")
+		}
+		if chatNames[chat.Name] {
+			log.Fatalln("parse config file:", cfg, "fail: name of chat is duplicated:", chat.Name)
+		}
+		chatNames[chat.Name] = true
+		for name, route := range chat.Routes {
+			if route == nil || route.Url == "" {
+				log.Fatalln("parse config file:", cfg, "fail: url of chat route is required:", chat.Name, name)
+			}
+		}
+		chat.fillDefaults()
+	}
+
+	if c.RateLimit != nil {
+		for channel, limit := range c.RateLimit.Channels {
+			if limit == nil {
+				continue
+			}
+			for _, bucket := range []*LimitConfig{limit.Channel, limit.Recipient} {
+				if bucket == nil {
+					continue
+				}
+				if err := bucket.check(); err != nil {
+					log.Fatalln("parse config file:", cfg, "fail: rate limit of", channel, err)
+				}
+			}
+		}
+	}
+
 	configLock.Lock()
 	defer configLock.Unlock()
 	config = &c
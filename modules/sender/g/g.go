@@ -5,7 +5,7 @@ import (
 )
 
 const (
-	VERSION = "0.0.1"
+	VERSION = "0.4.0"
 )
 
 func init() {
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fwtpe/owl-backend/modules/sender/cron"
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+	"github.com/fwtpe/owl-backend/modules/sender/redis"
+)
+
+const defaultDeliveryLimit = 100
+
+func configDeliveryRoutes() {
+	// The audit records, latest first. Filtered by "id", "channel", "status" and "to"(one of the recipients)
+	http.HandleFunc("/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		config := g.Config().Delivery
+		limit, err := parseLimit(r)
+		if err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		values, err := redis.Range(config.Audit, 0, config.AuditSize-1)
+		if err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		query := r.URL.Query()
+		records := []*model.DeliveryRecord{}
+		for _, value := range values {
+			if len(records) >= limit {
+				break
+			}
+
+			record := &model.DeliveryRecord{}
+			if err := json.Unmarshal([]byte(value), record); err != nil {
+				continue
+			}
+			if matchRecord(record, query.Get("id"), query.Get("channel"), query.Get("status"), query.Get("to")) {
+				records = append(records, record)
+			}
+		}
+		RenderDataJson(w, records)
+	})
+
+	// The digests waiting for the buckets of rate limits
+	http.HandleFunc("/limit/digests", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, cron.RateLimiter.Digests())
+	})
+
+	// The messages moved to dead-letter of the channel, latest first.
+	// Only for local access since the messages have the full contents and recipients
+	http.HandleFunc("/deadletters", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			w.Write([]byte("no privilege"))
+			return
+		}
+
+		channel := r.URL.Query().Get("channel")
+		if !isChannel(channel) {
+			RenderMsgJson(w, fmt.Sprintf("channel is not supported: %q", channel))
+			return
+		}
+		limit, err := parseLimit(r)
+		if err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		values, err := redis.Range(g.Config().Delivery.DeadLetterOf(channel), 0, limit-1)
+		if err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		messages := []json.RawMessage{}
+		for _, value := range values {
+			var message json.RawMessage
+			if err := json.Unmarshal([]byte(value), &message); err == nil {
+				messages = append(messages, message)
+			}
+		}
+		RenderDataJson(w, messages)
+	})
+}
+
+func isChannel(name string) bool {
+	switch name {
+	case model.ChannelSms, model.ChannelMail, model.ChannelQQ, model.ChannelServerchan:
+		return true
+	}
+	for _, chat := range g.Config().Chat {
+		if chat.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultDeliveryLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("limit is not valid: %q", value)
+	}
+	return limit, nil
+}
+
+func matchRecord(record *model.DeliveryRecord, id string, channel string, status string, to string) bool {
+	if id != "" && record.Id != id {
+		return false
+	}
+	if channel != "" && record.Channel != channel {
+		return false
+	}
+	if status != "" && record.Status != status {
+		return false
+	}
+	if to == "" {
+		return true
+	}
+	for _, t := range strings.Split(record.Tos, ",") {
+		if strings.TrimSpace(t) == to {
+			return true
+		}
+	}
+	return false
+}
@@ -12,4 +12,30 @@ func configProcRoutes() {
 		w.Write([]byte(fmt.Sprintf("sms:%v, mail:%v, qq:%v", proc.GetSmsCount(), proc.GetMailCount(), proc.GetQQCount())))
 	})
 
+	http.HandleFunc("/count/mail", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, map[string]uint32{
+			"total":   proc.GetMailCount(),
+			"success": proc.GetMailSuccessCount(),
+			"fail":    proc.GetMailFailCount(),
+		})
+	})
+
+	http.HandleFunc("/count/delivery", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, map[string]uint32{
+			"retry":      proc.GetRetryCount(),
+			"deadLetter": proc.GetDeadLetterCount(),
+		})
+	})
+
+	http.HandleFunc("/count/chat", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, map[string]uint32{"total": proc.GetChatCount()})
+	})
+
+	http.HandleFunc("/count/limit", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, map[string]uint32{
+			"suppressed": proc.GetSuppressedCount(),
+			"digest":     proc.GetDigestCount(),
+		})
+	})
+
 }
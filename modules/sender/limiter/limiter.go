@@ -0,0 +1,201 @@
+package limiter
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+type bucket struct {
+	channel string
+	tokens  float64
+	updated time.Time
+}
+
+func (this *bucket) refill(config *g.LimitConfig, now time.Time) {
+	if elapsed := now.Sub(this.updated); elapsed > 0 {
+		this.tokens += elapsed.Minutes() * config.Rate
+		this.updated = now
+	}
+	if this.tokens > float64(config.Burst) {
+		this.tokens = float64(config.Burst)
+	}
+}
+
+// The messages of a recipient suppressed by the limits
+type Digest struct {
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Count     int       `json:"count"`
+	Since     time.Time `json:"since"`
+	// The latest suppressed message
+	Last model.Message `json:"-"`
+}
+
+// Token buckets by channel and by recipient, the state is kept in memory of the sender.
+// The waiting digests are flushed to the queues at shutdown(see cron.FlushDigests)
+type Limiter struct {
+	lock       sync.Mutex
+	channels   map[string]*bucket
+	recipients map[string]*bucket
+	digests    map[string]*Digest
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		channels:   map[string]*bucket{},
+		recipients: map[string]*bucket{},
+		digests:    map[string]*Digest{},
+	}
+}
+
+func recipientKey(channel string, recipient string) string {
+	return channel + "\x00" + recipient
+}
+
+// Returns the recipients allowed to send, the others are counted into their digests.
+//
+// A recipient having a digest waiting is suppressed, so the digest is sent first when the buckets are refilled.
+func (this *Limiter) Allow(config *g.RateLimitConfig, channel string, tos []string, msg model.Message, now time.Time) []string {
+	limit := config.Channels[channel]
+	if limit == nil {
+		return tos
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	allowed := []string{}
+	for _, to := range tos {
+		key := recipientKey(channel, to)
+		if this.digests[key] == nil && this.take(limit, channel, to, now) {
+			allowed = append(allowed, to)
+			continue
+		}
+
+		digest := this.digests[key]
+		if digest == nil {
+			digest = &Digest{Channel: channel, Recipient: to, Since: now}
+			this.digests[key] = digest
+		}
+		digest.Count++
+		digest.Last = msg
+	}
+	return allowed
+}
+
+// Takes a token from both of the buckets of channel and recipient, nothing is taken if any of them is empty
+func (this *Limiter) take(limit *g.ChannelLimitConfig, channel string, to string, now time.Time) bool {
+	var channelBucket, recipientBucket *bucket
+	if limit.Channel != nil {
+		channelBucket = getBucket(this.channels, channel, channel, limit.Channel, now)
+		if channelBucket.tokens < 1 {
+			return false
+		}
+	}
+	if limit.Recipient != nil {
+		recipientBucket = getBucket(this.recipients, recipientKey(channel, to), channel, limit.Recipient, now)
+		if recipientBucket.tokens < 1 {
+			return false
+		}
+	}
+
+	if channelBucket != nil {
+		channelBucket.tokens--
+	}
+	if recipientBucket != nil {
+		recipientBucket.tokens--
+	}
+	return true
+}
+
+// A new bucket is full
+func getBucket(buckets map[string]*bucket, key string, channel string, config *g.LimitConfig, now time.Time) *bucket {
+	b, ok := buckets[key]
+	if !ok {
+		b = &bucket{channel: channel, tokens: float64(config.Burst), updated: now}
+		buckets[key] = b
+	}
+	b.refill(config, now)
+	return b
+}
+
+// Removes and returns the digests of which the buckets have a token(which is taken by the digest).
+// All of the digests are returned if the limits are disabled.
+func (this *Limiter) DueDigests(config *g.RateLimitConfig, now time.Time) []*Digest {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	// The older digests take the tokens of channel first
+	digests := []*Digest{}
+	for _, digest := range this.digests {
+		digests = append(digests, digest)
+	}
+	sort.Sort(bySince(digests))
+
+	due := []*Digest{}
+	for _, digest := range digests {
+		if config != nil && config.Enabled {
+			limit := config.Channels[digest.Channel]
+			if limit != nil && !this.take(limit, digest.Channel, digest.Recipient, now) {
+				continue
+			}
+		}
+		due = append(due, digest)
+		delete(this.digests, recipientKey(digest.Channel, digest.Recipient))
+	}
+
+	this.removeFullBuckets(config, now)
+	return due
+}
+
+// The full buckets of recipients are removed, which are the same as the new ones
+func (this *Limiter) removeFullBuckets(config *g.RateLimitConfig, now time.Time) {
+	for key, b := range this.recipients {
+		if this.digests[key] != nil {
+			continue
+		}
+
+		var limit *g.ChannelLimitConfig
+		if config != nil && config.Enabled {
+			limit = config.Channels[b.channel]
+		}
+		if limit == nil || limit.Recipient == nil {
+			delete(this.recipients, key)
+			continue
+		}
+
+		b.refill(limit.Recipient, now)
+		if b.tokens >= float64(limit.Recipient.Burst) {
+			delete(this.recipients, key)
+		}
+	}
+}
+
+// The digests waiting for the buckets
+func (this *Limiter) Digests() []*Digest {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	digests := []*Digest{}
+	for _, digest := range this.digests {
+		copied := *digest
+		digests = append(digests, &copied)
+	}
+	sort.Sort(bySince(digests))
+	return digests
+}
+
+type bySince []*Digest
+
+func (this bySince) Len() int      { return len(this) }
+func (this bySince) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this bySince) Less(i, j int) bool {
+	if this[i].Since.Equal(this[j].Since) {
+		return recipientKey(this[i].Channel, this[i].Recipient) < recipientKey(this[j].Channel, this[j].Recipient)
+	}
+	return this[i].Since.Before(this[j].Since)
+}
@@ -0,0 +1,118 @@
+package limiter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+	"github.com/fwtpe/owl-backend/modules/sender/model"
+)
+
+func TestAllowByRecipient(t *testing.T) {
+	config := &g.RateLimitConfig{
+		Enabled: true,
+		Channels: map[string]*g.ChannelLimitConfig{
+			"sms": {Recipient: &g.LimitConfig{Rate: 1, Burst: 2}},
+		},
+	}
+	limiter := NewLimiter()
+	now := time.Unix(1500000000, 0)
+
+	testCases := []*struct {
+		tos     []string
+		allowed []string
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"a"}, []string{"a"}},
+		{[]string{"a", "b"}, []string{"b"}},
+		{[]string{"a", "b"}, []string{}},
+	}
+	for i, testCase := range testCases {
+		allowed := limiter.Allow(config, "sms", testCase.tos, &model.Sms{Content: "alarm"}, now)
+		if strings.Join(allowed, ",") != strings.Join(testCase.allowed, ",") {
+			t.Errorf("[%d] Expected: %v. Got: %v", i, testCase.allowed, allowed)
+		}
+	}
+
+	// Not limited
+	if allowed := limiter.Allow(config, "mail", []string{"a"}, &model.Mail{}, now); len(allowed) != 1 {
+		t.Errorf("Expected mail is not limited. Got: %v", allowed)
+	}
+
+	digests := limiter.Digests()
+	if len(digests) != 2 || digests[0].Recipient != "a" || digests[0].Count != 2 || digests[1].Recipient != "b" || digests[1].Count != 1 {
+		t.Fatalf("Unexpected digests: %v", digests)
+	}
+
+	// Not refilled yet
+	if due := limiter.DueDigests(config, now.Add(30*time.Second)); len(due) != 0 {
+		t.Errorf("Expected no digests. Got: %v", due)
+	}
+	// The recipient having a digest is suppressed even if the bucket is refilled
+	if allowed := limiter.Allow(config, "sms", []string{"a"}, &model.Sms{Content: "latest"}, now.Add(time.Minute)); len(allowed) != 0 {
+		t.Errorf("Expected suppressed. Got: %v", allowed)
+	}
+
+	due := limiter.DueDigests(config, now.Add(time.Minute))
+	if len(due) != 2 || due[0].Count != 3 || due[0].Last.(*model.Sms).Content != "latest" {
+		t.Fatalf("Unexpected due digests: %v", due)
+	}
+	if digests := limiter.Digests(); len(digests) != 0 {
+		t.Errorf("Expected no digests. Got: %v", digests)
+	}
+
+	// The tokens are taken by the digests
+	if allowed := limiter.Allow(config, "sms", []string{"a"}, &model.Sms{}, now.Add(time.Minute)); len(allowed) != 0 {
+		t.Errorf("Expected suppressed. Got: %v", allowed)
+	}
+}
+
+func TestAllowByChannel(t *testing.T) {
+	config := &g.RateLimitConfig{
+		Enabled: true,
+		Channels: map[string]*g.ChannelLimitConfig{
+			"sms": {
+				Channel:   &g.LimitConfig{Rate: 60, Burst: 3},
+				Recipient: &g.LimitConfig{Rate: 60, Burst: 10},
+			},
+		},
+	}
+	limiter := NewLimiter()
+	now := time.Unix(1500000000, 0)
+
+	if allowed := limiter.Allow(config, "sms", []string{"a", "b", "c", "d"}, &model.Sms{}, now); strings.Join(allowed, ",") != "a,b,c" {
+		t.Errorf("Expected a,b,c. Got: %v", allowed)
+	}
+	// One token per second
+	if allowed := limiter.Allow(config, "sms", []string{"e"}, &model.Sms{}, now.Add(time.Second)); len(allowed) != 1 {
+		t.Errorf("Expected e. Got: %v", allowed)
+	}
+
+	due := limiter.DueDigests(config, now.Add(2*time.Second))
+	if len(due) != 1 || due[0].Recipient != "d" {
+		t.Errorf("Unexpected due digests: %v", due)
+	}
+}
+
+func TestDueDigestsDisabled(t *testing.T) {
+	config := &g.RateLimitConfig{
+		Enabled: true,
+		Channels: map[string]*g.ChannelLimitConfig{
+			"sms": {Recipient: &g.LimitConfig{Rate: 1, Burst: 1}},
+		},
+	}
+	limiter := NewLimiter()
+	now := time.Unix(1500000000, 0)
+
+	limiter.Allow(config, "sms", []string{"a"}, &model.Sms{}, now)
+	limiter.Allow(config, "sms", []string{"a"}, &model.Sms{}, now)
+
+	config.Enabled = false
+	if due := limiter.DueDigests(config, now); len(due) != 1 {
+		t.Errorf("Expected all of the digests are sent. Got: %v", due)
+	}
+	if len(limiter.recipients) != 0 {
+		t.Errorf("Expected the buckets are removed. Got: %d", len(limiter.recipients))
+	}
+}
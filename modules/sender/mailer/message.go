@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	htmlPattern    = regexp.MustCompile(`(?i)<(html|body|table|div|p|br|a)[\s/>]`)
+	tagPattern     = regexp.MustCompile(`(?s)<[^>]*>`)
+	breakPattern   = regexp.MustCompile(`(?i)<(br\s*/?|/p|/tr|/div|/h\d)>`)
+	spacePattern   = regexp.MustCompile(`[ \t]+`)
+	newlinePattern = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// The content of mails from alarm is HTML(or plain text for the combined ones)
+func IsHTML(content string) bool {
+	return htmlPattern.MatchString(content)
+}
+
+// A rough plain text of HTML, used as the alternative part of message
+func HTMLToText(content string) string {
+	text := breakPattern.ReplaceAllString(content, "\n")
+	text = tagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = spacePattern.ReplaceAllString(text, " ")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(newlinePattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// Builds the message with the headers, HTML content is sent as multipart/alternative(plain + HTML)
+func BuildMessage(from string, tos []string, subject string, content string, now time.Time) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	writeHeader(buf, "From", from)
+	writeHeader(buf, "To", strings.Join(tos, ", "))
+	writeHeader(buf, "Subject", mime.QEncoding.Encode("utf-8", subject))
+	writeHeader(buf, "Date", now.Format(time.RFC1123Z))
+	writeHeader(buf, "Message-ID", fmt.Sprintf("<%s@%s>", randomId(), domainOf(from)))
+	writeHeader(buf, "MIME-Version", "1.0")
+
+	if !IsHTML(content) {
+		writeHeader(buf, "Content-Type", "text/plain; charset=utf-8")
+		writeHeader(buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(buf, content); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(buf)
+	writeHeader(buf, "Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+
+	for _, part := range []*struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", HTMLToText(content)},
+		{"text/html; charset=utf-8", content},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func randomId() string {
+	bs := make([]byte, 12)
+	if _, err := rand.Read(bs); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(bs)
+}
+
+func domainOf(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return strings.TrimRight(address[i+1:], ">")
+	}
+	return "localhost"
+}
@@ -0,0 +1,346 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+)
+
+// The kinds of failed recipients
+const (
+	// The recipient is rejected by the server permanently(5xx), sending it again is useless
+	FailureRejected = "rejected"
+	// The recipient is rejected temporarily(4xx), or the batch of it is failed(e.g. connection error)
+	FailureTransient = "transient"
+)
+
+type FailedRecipient struct {
+	To   string
+	Kind string
+	Err  error
+}
+
+// Some of the recipients are failed, the mail is sent to the others
+type SendError struct {
+	Failed []*FailedRecipient
+}
+
+func (this *SendError) Error() string {
+	failures := make([]string, 0, len(this.Failed))
+	for _, failed := range this.Failed {
+		failures = append(failures, fmt.Sprintf("%s(%s: %v)", failed.To, failed.Kind, failed.Err))
+	}
+	return fmt.Sprintf("recipients are failed: %s", strings.Join(failures, ", "))
+}
+
+// The failed recipients of the kind
+func (this *SendError) Tos(kind string) []string {
+	tos := []string{}
+	for _, failed := range this.Failed {
+		if failed.Kind == kind {
+			tos = append(tos, failed.To)
+		}
+	}
+	return tos
+}
+
+func (this *SendError) add(to string, kind string, err error) {
+	this.Failed = append(this.Failed, &FailedRecipient{To: to, Kind: kind, Err: err})
+}
+
+// The recipient is rejected permanently by 5xx
+func failureKindOf(err error) string {
+	if protoErr, ok := err.(*textproto.Error); ok && protoErr.Code >= 500 {
+		return FailureRejected
+	}
+	return FailureTransient
+}
+
+type client struct {
+	*smtp.Client
+	conn  net.Conn
+	since time.Time
+}
+
+// Sends mails through the SMTP server, the connections are reused if possible
+type Sender struct {
+	config *g.SmtpConfig
+	host   string
+	// The address of "From", e.g. "owl@example.com" of "Owl <owl@example.com>"
+	from string
+	// The "From" header, the name is encoded if it is not ASCII
+	fromHeader string
+
+	lock sync.Mutex
+	idle []*client
+}
+
+func NewSender(config *g.SmtpConfig) (*Sender, error) {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("address of SMTP server is not valid: %v", err)
+	}
+	switch config.Tls {
+	case g.SmtpTlsNone, g.SmtpTlsStartTls, g.SmtpTlsImplicit:
+	default:
+		return nil, fmt.Errorf("tls of SMTP is not supported: %s", config.Tls)
+	}
+	switch config.Auth {
+	case g.SmtpAuthPlain, g.SmtpAuthLogin:
+	default:
+		return nil, fmt.Errorf("auth of SMTP is not supported: %s", config.Auth)
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("from address of SMTP is not valid: %v", err)
+	}
+
+	return &Sender{config: config, host: host, from: from.Address, fromHeader: from.String()}, nil
+}
+
+// Sends the mail in batches of recipients(BatchSize).
+// The error is *SendError if any of the recipients is failed, the mail has been sent to the others.
+func (this *Sender) Send(tos []string, subject string, content string) error {
+	batchSize := this.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(tos)
+	}
+
+	sendErr := &SendError{}
+	for start := 0; start < len(tos); start += batchSize {
+		end := start + batchSize
+		if end > len(tos) {
+			end = len(tos)
+		}
+		this.sendBatch(tos[start:end], subject, content, sendErr)
+	}
+
+	if len(sendErr.Failed) > 0 {
+		return sendErr
+	}
+	return nil
+}
+
+// The failed recipients are added to @sendErr, all of them are failed if the batch is failed
+func (this *Sender) sendBatch(tos []string, subject string, content string, sendErr *SendError) {
+	failBatch := func(err error) {
+		for _, to := range tos {
+			sendErr.add(to, FailureTransient, err)
+		}
+	}
+
+	msg, err := BuildMessage(this.fromHeader, tos, subject, content, time.Now())
+	if err != nil {
+		failBatch(err)
+		return
+	}
+
+	c, err := this.getClient()
+	if err != nil {
+		failBatch(err)
+		return
+	}
+
+	rejected, err := this.deliver(c, tos, msg)
+	if err != nil {
+		c.Close()
+	} else {
+		this.putClient(c)
+	}
+	if rejected == nil {
+		failBatch(err)
+		return
+	}
+
+	for _, to := range tos {
+		if rcptErr, ok := rejected[to]; ok {
+			sendErr.add(to, failureKindOf(rcptErr), rcptErr)
+		}
+	}
+}
+
+// Returns the recipients rejected by RCPT(nil if the delivery is failed),
+// the connection should not be reused if the error is not nil
+func (this *Sender) deliver(c *client, tos []string, msg []byte) (map[string]error, error) {
+	c.conn.SetDeadline(time.Now().Add(this.timeout()))
+
+	if err := c.Mail(this.from); err != nil {
+		return nil, err
+	}
+
+	rejected := make(map[string]error)
+	for _, to := range tos {
+		if err := c.Rcpt(to); err != nil {
+			rejected[to] = err
+		}
+	}
+	if len(rejected) == len(tos) {
+		return rejected, c.Reset()
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return rejected, nil
+}
+
+// The idle connection is checked by RSET before reuse
+func (this *Sender) getClient() (*client, error) {
+	idleTimeout := time.Duration(this.config.IdleTimeout) * time.Second
+	for {
+		c := this.popIdle()
+		if c == nil {
+			break
+		}
+
+		c.conn.SetDeadline(time.Now().Add(this.timeout()))
+		if time.Since(c.since) < idleTimeout && c.Reset() == nil {
+			return c, nil
+		}
+		c.Close()
+	}
+
+	return this.dial()
+}
+
+func (this *Sender) popIdle() *client {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if len(this.idle) == 0 {
+		return nil
+	}
+	c := this.idle[len(this.idle)-1]
+	this.idle = this.idle[:len(this.idle)-1]
+	return c
+}
+
+func (this *Sender) putClient(c *client) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if len(this.idle) >= this.config.MaxIdle {
+		c.Quit()
+		return
+	}
+	c.since = time.Now()
+	this.idle = append(this.idle, c)
+}
+
+// Closes the idle connections
+func (this *Sender) Close() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for _, c := range this.idle {
+		c.Quit()
+	}
+	this.idle = nil
+}
+
+func (this *Sender) dial() (*client, error) {
+	dialer := &net.Dialer{Timeout: this.timeout()}
+	tlsConfig := &tls.Config{ServerName: this.host, InsecureSkipVerify: this.config.InsecureSkipVerify}
+
+	var conn net.Conn
+	var err error
+	if this.config.Tls == g.SmtpTlsImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", this.config.Addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", this.config.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(this.timeout()))
+
+	c, err := smtp.NewClient(conn, this.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if this.config.Tls == g.SmtpTlsStartTls {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if this.config.Username != "" {
+		if err := c.Auth(this.auth()); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return &client{Client: c, conn: conn}, nil
+}
+
+func (this *Sender) auth() smtp.Auth {
+	if this.config.Auth == g.SmtpAuthLogin {
+		return &loginAuth{this.config.Username, this.config.Password, this.host}
+	}
+	return smtp.PlainAuth("", this.config.Username, this.config.Password, this.host)
+}
+
+func (this *Sender) timeout() time.Duration {
+	return time.Duration(this.config.Timeout) * time.Millisecond
+}
+
+// AUTH LOGIN, which is not provided by net/smtp.
+// As smtp.PlainAuth, the password is only sent over TLS or to localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (this *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != this.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (this *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(this.username), nil
+	case "password:":
+		return []byte(this.password), nil
+	}
+	return nil, fmt.Errorf("unexpected challenge of AUTH LOGIN: %s", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,313 @@
+package mailer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwtpe/owl-backend/modules/sender/g"
+)
+
+type receivedMail struct {
+	from string
+	tos  []string
+	data string
+}
+
+// A minimal SMTP server which accepts "user"/"pass",
+// rejects recipients of "rejected.com" permanently and the ones of "busy.com" temporarily
+type fakeServer struct {
+	listener net.Listener
+
+	lock  sync.Mutex
+	conns int
+	auths []string
+	mails []*receivedMail
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.lock.Lock()
+			server.conns++
+			server.lock.Unlock()
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (this *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	decode := func(s string) string {
+		bs, _ := base64.StdEncoding.DecodeString(s)
+		return string(bs)
+	}
+
+	reply("220 localhost ESMTP")
+	current := &receivedMail{}
+	for {
+		line, err := readLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch {
+		case cmd == "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN LOGIN")
+		case strings.HasPrefix(strings.ToUpper(line), "AUTH PLAIN "):
+			fields := strings.Split(decode(line[len("AUTH PLAIN "):]), "\x00")
+			this.auth("plain", len(fields) == 3 && fields[1] == "user" && fields[2] == "pass", reply)
+		case strings.ToUpper(line) == "AUTH LOGIN":
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+			username, _ := readLine()
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+			password, _ := readLine()
+			this.auth("login", decode(username) == "user" && decode(password) == "pass", reply)
+		case cmd == "MAIL":
+			current = &receivedMail{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			reply("250 OK")
+		case cmd == "RCPT":
+			to := strings.Trim(line[len("RCPT TO:"):], "<>")
+			if strings.HasSuffix(to, "@rejected.com") {
+				reply("550 No such user")
+				continue
+			}
+			if strings.HasSuffix(to, "@busy.com") {
+				reply("450 Mailbox busy")
+				continue
+			}
+			current.tos = append(current.tos, to)
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			lines := []string{}
+			for {
+				line, err := readLine()
+				if err != nil {
+					return
+				}
+				if line == "." {
+					break
+				}
+				lines = append(lines, strings.TrimPrefix(line, "."))
+			}
+			current.data = strings.Join(lines, "\r\n")
+			this.lock.Lock()
+			this.mails = append(this.mails, current)
+			this.lock.Unlock()
+			reply("250 OK")
+		case cmd == "RSET":
+			current = &receivedMail{}
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (this *fakeServer) auth(mechanism string, ok bool, reply func(string)) {
+	if !ok {
+		reply("535 Authentication failed")
+		return
+	}
+	this.lock.Lock()
+	this.auths = append(this.auths, mechanism)
+	this.lock.Unlock()
+	reply("235 Authentication successful")
+}
+
+func newTestConfig(addr string) *g.SmtpConfig {
+	return &g.SmtpConfig{
+		Enabled: true, Addr: addr, Tls: g.SmtpTlsNone, Auth: g.SmtpAuthPlain,
+		Username: "user", Password: "pass", From: "Owl <owl@example.com>",
+		BatchSize: 2, MaxIdle: 1, IdleTimeout: 60, Timeout: 3000,
+	}
+}
+
+func TestSend(t *testing.T) {
+	for _, auth := range []string{g.SmtpAuthPlain, g.SmtpAuthLogin} {
+		server := newFakeServer(t)
+		defer server.listener.Close()
+
+		config := newTestConfig(server.listener.Addr().String())
+		config.Auth = auth
+		sender, err := NewSender(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tos := []string{"a@example.com", "b@example.com", "c@example.com"}
+		if err := sender.Send(tos, "Subject", "content"); err != nil {
+			t.Fatalf("[%s] Send fail: %v", auth, err)
+		}
+		if err := sender.Send(tos[:1], "Subject", "content"); err != nil {
+			t.Fatalf("[%s] Send fail: %v", auth, err)
+		}
+		sender.Close()
+
+		server.lock.Lock()
+		if server.conns != 1 || len(server.auths) != 1 || server.auths[0] != auth {
+			t.Errorf("[%s] Expected one connection authenticated. Got: %d connections, auths: %v", auth, server.conns, server.auths)
+		}
+		if len(server.mails) != 3 ||
+			strings.Join(server.mails[0].tos, ",") != "a@example.com,b@example.com" ||
+			strings.Join(server.mails[1].tos, ",") != "c@example.com" ||
+			server.mails[0].from != "owl@example.com" {
+			t.Errorf("[%s] Unexpected mails: %#v", auth, server.mails)
+		}
+		server.lock.Unlock()
+	}
+}
+
+func TestSendRejected(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	config := newTestConfig(server.listener.Addr().String())
+	config.BatchSize = 10
+	sender, err := NewSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	err = sender.Send([]string{"a@example.com", "b@rejected.com", "e@busy.com"}, "Subject", "content")
+	sendErr, ok := err.(*SendError)
+	if !ok || strings.Join(sendErr.Tos(FailureRejected), ",") != "b@rejected.com" ||
+		strings.Join(sendErr.Tos(FailureTransient), ",") != "e@busy.com" {
+		t.Errorf("Expected b@rejected.com is rejected and e@busy.com is transient. Got: %v", err)
+	}
+	if err := sender.Send([]string{"c@rejected.com"}, "Subject", "content"); err == nil {
+		t.Errorf("Expected error if all of the recipients are rejected")
+	}
+	if err := sender.Send([]string{"d@example.com"}, "Subject", "content"); err != nil {
+		t.Errorf("Send fail: %v", err)
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.conns != 1 || len(server.mails) != 2 {
+		t.Errorf("Expected 2 mails sent by one connection. Got: %d connections, %d mails", server.conns, len(server.mails))
+	}
+}
+
+func TestSendAuthFail(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	config := newTestConfig(server.listener.Addr().String())
+	config.Password = "wrong"
+	sender, err := NewSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// All of the recipients are failed
+	err = sender.Send([]string{"a@example.com", "b@example.com"}, "Subject", "content")
+	sendErr, ok := err.(*SendError)
+	if !ok || strings.Join(sendErr.Tos(FailureTransient), ",") != "a@example.com,b@example.com" {
+		t.Errorf("Expected authentication error of all recipients. Got: %v", err)
+	}
+}
+
+func TestNewSender(t *testing.T) {
+	testCases := []*struct {
+		modify func(config *g.SmtpConfig)
+		valid  bool
+	}{
+		{func(config *g.SmtpConfig) {}, true},
+		{func(config *g.SmtpConfig) { config.Addr = "localhost" }, false},
+		{func(config *g.SmtpConfig) { config.Tls = "ssl" }, false},
+		{func(config *g.SmtpConfig) { config.Auth = "cram-md5" }, false},
+		{func(config *g.SmtpConfig) { config.From = "" }, false},
+	}
+	for i, testCase := range testCases {
+		config := newTestConfig("localhost:25")
+		testCase.modify(config)
+		if _, err := NewSender(config); (err == nil) != testCase.valid {
+			t.Errorf("[%d] Expected valid: %v. Got: %v", i, testCase.valid, err)
+		}
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	content := "<html><body><p>PROBLEM</p>Endpoint:host-1<br/>Metric:cpu.idle</body></html>"
+	bs, err := BuildMessage("owl@example.com", []string{"a@example.com"}, "告警", content, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(bs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Subject") != "=?utf-8?q?=E5=91=8A=E8=AD=A6?=" || msg.Header.Get("Message-ID") == "" {
+		t.Errorf("Unexpected header: %v", msg.Header)
+	}
+
+	contentType := msg.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/alternative; boundary=") {
+		t.Fatalf("Unexpected content type: %s", contentType)
+	}
+	parts := multipart.NewReader(msg.Body, strings.TrimPrefix(contentType, "multipart/alternative; boundary="))
+
+	expected := []*struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", "PROBLEM\r\nEndpoint:host-1\r\nMetric:cpu.idle"},
+		{"text/html; charset=utf-8", content},
+	}
+	for i, e := range expected {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The quoted-printable part(with CRLF line breaks) is decoded by multipart.Reader
+		body, _ := ioutil.ReadAll(part)
+		if part.Header.Get("Content-Type") != e.contentType || string(body) != e.content {
+			t.Errorf("[%d] Unexpected part: %v, %q", i, part.Header, body)
+		}
+	}
+}
+
+func TestBuildPlainMessage(t *testing.T) {
+	bs, err := BuildMessage("owl@example.com", []string{"a@example.com"}, "Subject", "PROBLEM\ncpu.idle < 10", time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), "Content-Type: text/plain; charset=utf-8\r\n") {
+		t.Errorf("Unexpected message: %s", bs)
+	}
+}
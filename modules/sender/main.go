@@ -39,12 +39,16 @@ func main() {
 	go cron.ConsumeMail()
 	go cron.ConsumeQQ()
 	go cron.ConsumeServerchan()
+	go cron.ConsumeChats()
+	go cron.RetryDeliveries()
+	go cron.SendDigests()
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigs
 		fmt.Println()
+		cron.FlushDigests()
 		redis.ConnPool.Close()
 		os.Exit(0)
 	}()
@@ -4,27 +4,86 @@ import (
 	"fmt"
 )
 
+const (
+	ChannelSms        = "sms"
+	ChannelMail       = "mail"
+	ChannelQQ         = "qq"
+	ChannelServerchan = "serverchan"
+)
+
+const (
+	DeliverySuccess  = "success"
+	DeliveryRetrying = "retrying"
+	DeliveryFailed   = "failed"
+)
+
+// Kept in the message for retries, empty for the messages from alarm
+type DeliveryState struct {
+	Id       string `json:"deliveryId,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	// The digest of the messages suppressed by rate limits
+	Digest bool `json:"digest,omitempty"`
+}
+
+func (this *DeliveryState) State() *DeliveryState {
+	return this
+}
+
+// The messages of all channels, which are retried with the state
+type Message interface {
+	State() *DeliveryState
+}
+
+// The result of an attempt to send a message
+type DeliveryRecord struct {
+	Id       string `json:"id"`
+	Channel  string `json:"channel"`
+	Tos      string `json:"tos"`
+	Subject  string `json:"subject,omitempty"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Response string `json:"response"`
+	Time     int64  `json:"time"`
+}
+
 type Sms struct {
 	Tos     string `json:"tos"`
 	Content string `json:"content"`
+	DeliveryState
 }
 
 type Mail struct {
 	Tos     string `json:"tos"`
 	Subject string `json:"subject"`
 	Content string `json:"content"`
+	DeliveryState
 }
 
 type QQ struct {
 	Tos     string `json:"tos"`
 	Subject string `json:"subject"`
 	Content string `json:"content"`
+	DeliveryState
 }
 
 type Serverchan struct {
 	Tos     string `json:"tos"`
 	Subject string `json:"subject"`
 	Content string `json:"content"`
+	DeliveryState
+}
+
+// The message to chat tools, which is posted to the webhook of robot
+type Chat struct {
+	// The name of target(e.g. the team) shown in audit records
+	Target string `json:"target"`
+	// The name of route in the config of chat channel, which has the webhook and secret
+	Route string `json:"route"`
+	// "PROBLEM" or "OK"
+	Status  string `json:"status"`
+	Subject string `json:"subject"`
+	Content string `json:"content"`
+	DeliveryState
 }
 
 func (this *Sms) String() string {
@@ -43,3 +102,13 @@ func (this *Mail) String() string {
 		this.Content,
 	)
 }
+
+func (this *Chat) String() string {
+	return fmt.Sprintf(
+		"<Target:%s, Status:%s, Subject:%s, Content:%s>",
+		this.Target,
+		this.Status,
+		this.Subject,
+		this.Content,
+	)
+}
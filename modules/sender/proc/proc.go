@@ -5,6 +5,10 @@ import (
 )
 
 var smsCount, mailCount, qqCount, serverchanCount uint32
+var mailSuccessCount, mailFailCount uint32
+var retryCount, deadLetterCount uint32
+var chatCount uint32
+var suppressedCount, digestCount uint32
 
 func GetSmsCount() uint32 {
 	return atomic.LoadUint32(&smsCount)
@@ -14,6 +18,14 @@ func GetMailCount() uint32 {
 	return atomic.LoadUint32(&mailCount)
 }
 
+func GetMailSuccessCount() uint32 {
+	return atomic.LoadUint32(&mailSuccessCount)
+}
+
+func GetMailFailCount() uint32 {
+	return atomic.LoadUint32(&mailFailCount)
+}
+
 func GetQQCount() uint32 {
 	return atomic.LoadUint32(&qqCount)
 }
@@ -30,6 +42,14 @@ func IncreMailCount() {
 	atomic.AddUint32(&mailCount, 1)
 }
 
+func IncreMailSuccessCount() {
+	atomic.AddUint32(&mailSuccessCount, 1)
+}
+
+func IncreMailFailCount() {
+	atomic.AddUint32(&mailFailCount, 1)
+}
+
 func IncreQQCount() {
 	atomic.AddUint32(&qqCount, 1)
 }
@@ -37,3 +57,43 @@ func IncreQQCount() {
 func IncreServerchanCount() {
 	atomic.AddUint32(&serverchanCount, 1)
 }
+
+func GetRetryCount() uint32 {
+	return atomic.LoadUint32(&retryCount)
+}
+
+func GetDeadLetterCount() uint32 {
+	return atomic.LoadUint32(&deadLetterCount)
+}
+
+func IncreRetryCount() {
+	atomic.AddUint32(&retryCount, 1)
+}
+
+func IncreDeadLetterCount() {
+	atomic.AddUint32(&deadLetterCount, 1)
+}
+
+func GetChatCount() uint32 {
+	return atomic.LoadUint32(&chatCount)
+}
+
+func IncreChatCount() {
+	atomic.AddUint32(&chatCount, 1)
+}
+
+func GetSuppressedCount() uint32 {
+	return atomic.LoadUint32(&suppressedCount)
+}
+
+func GetDigestCount() uint32 {
+	return atomic.LoadUint32(&digestCount)
+}
+
+func IncreSuppressedCount(delta uint32) {
+	atomic.AddUint32(&suppressedCount, delta)
+}
+
+func IncreDigestCount() {
+	atomic.AddUint32(&digestCount, 1)
+}
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// The member of retry queue, the message is pushed back to the queue when it is due
+type retryItem struct {
+	Queue   string `json:"queue"`
+	Message string `json:"message"`
+}
+
+func ScheduleRetry(retryQueue string, queue string, message []byte, at time.Time) error {
+	bs, err := json.Marshal(&retryItem{Queue: queue, Message: string(message)})
+	if err != nil {
+		return err
+	}
+
+	rc := ConnPool.Get()
+	defer rc.Close()
+
+	_, err = rc.Do("ZADD", retryQueue, at.Unix(), string(bs))
+	return err
+}
+
+// Only the ones removed by ZREM successfully are pushed back, the queue may be shared by senders
+func RequeueDueRetries(retryQueue string, now time.Time) int {
+	rc := ConnPool.Get()
+	defer rc.Close()
+
+	members, err := redis.Strings(rc.Do("ZRANGEBYSCORE", retryQueue, "-inf", now.Unix(), "LIMIT", 0, 100))
+	if err != nil {
+		log.Errorf("[REDIS ZRANGEBYSCORE] %s has error: %v", retryQueue, err)
+		return 0
+	}
+
+	count := 0
+	for _, member := range members {
+		removed, err := redis.Int(rc.Do("ZREM", retryQueue, member))
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		var item retryItem
+		if err := json.Unmarshal([]byte(member), &item); err != nil {
+			log.Println(err, member)
+			continue
+		}
+		if _, err := rc.Do("LPUSH", item.Queue, item.Message); err != nil {
+			log.Errorf("LPUSH redis %s fail: %v. message: %s", item.Queue, err, item.Message)
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// LPUSH and keeps the latest "size" elements of the list
+func PushLimited(key string, value []byte, size int) error {
+	rc := ConnPool.Get()
+	defer rc.Close()
+
+	if _, err := rc.Do("LPUSH", key, string(value)); err != nil {
+		return err
+	}
+	_, err := rc.Do("LTRIM", key, 0, size-1)
+	return err
+}
+
+func Range(key string, start int, stop int) ([]string, error) {
+	rc := ConnPool.Get()
+	defer rc.Close()
+
+	return redis.Strings(rc.Do("LRANGE", key, start, stop))
+}
+
+func Push(queue string, message []byte) error {
+	rc := ConnPool.Get()
+	defer rc.Close()
+
+	_, err := rc.Do("LPUSH", queue, string(message))
+	return err
+}
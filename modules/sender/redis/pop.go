@@ -132,3 +132,34 @@ func PopAllServerchan(queue string) []*model.Serverchan {
 	}
 	return ret
 }
+
+func PopAllChat(queue string) []*model.Chat {
+	ret := []*model.Chat{}
+
+	rc := ConnPool.Get()
+	defer rc.Close()
+
+	for {
+		reply, err := redis.String(rc.Do("RPOP", queue))
+		if err != nil {
+			if err != redis.ErrNil {
+				log.Println(err)
+			}
+			break
+		}
+
+		if reply == "" || reply == "nil" {
+			continue
+		}
+
+		var chat model.Chat
+		err = json.Unmarshal([]byte(reply), &chat)
+		if err != nil {
+			log.Println(err, reply)
+			continue
+		}
+
+		ret = append(ret, &chat)
+	}
+	return ret
+}
@@ -2,6 +2,7 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"sync"
 
@@ -36,6 +37,8 @@ type JudgeConfig struct {
 	Replicas    int                     `json:"replicas"`
 	Cluster     map[string]string       `json:"cluster"`
 	ClusterList map[string]*ClusterNode `json:"clusterList"`
+	// Seconds to wait for sending remained data of a node removed by reloading
+	DrainTimeout int `json:"drainTimeout"`
 }
 
 type GraphConfig struct {
@@ -49,6 +52,8 @@ type GraphConfig struct {
 	Replicas    int                     `json:"replicas"`
 	Cluster     map[string]string       `json:"cluster"`
 	ClusterList map[string]*ClusterNode `json:"clusterList"`
+	// Seconds to wait for sending remained data of a node removed by reloading
+	DrainTimeout int `json:"drainTimeout"`
 }
 
 type TsdbConfig struct {
@@ -96,17 +101,105 @@ type StagingConfig struct {
 	Filters     []string `json:"filters"`
 }
 
+// Publishing the data to a topic of Kafka(or any broker compatible with its protocol)
+type KafkaConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Brokers     []string `json:"brokers"`
+	Topic       string   `json:"topic"`
+	ClientId    string   `json:"clientId"`
+	Batch       int      `json:"batch"`
+	ConnTimeout int      `json:"connTimeout"`
+	CallTimeout int      `json:"callTimeout"`
+	MaxConns    int      `json:"maxConns"`
+	MaxRetry    int      `json:"retry"`
+	// -1: all in-sync replicas, 0: no acknowledgement, 1: leader only
+	RequiredAcks int `json:"requiredAcks"`
+	// "json" or "protobuf"
+	Encoding string `json:"encoding"`
+	// "endpoint" or "counter"(endpoint/metric/tags), the data having the same key goes to the same partition
+	PartitionKey string `json:"partitionKey"`
+}
+
+// Ingestion adapters for data in foreign format, which are served by HTTP service
+type IngestConfig struct {
+	// The limit(KB) of request body, 0 means the default one
+	MaxBodySizeKB int64                   `json:"maxBodySizeKB"`
+	Prometheus    *PrometheusIngestConfig `json:"prometheus"`
+	OpenTsdb      *OpenTsdbIngestConfig   `json:"opentsdb"`
+	Graphite      *GraphiteIngestConfig   `json:"graphite"`
+}
+
+const defaultIngestMaxBodySizeKB = 10 * 1024
+
+func (this *IngestConfig) MaxBodyBytes() int64 {
+	if this.MaxBodySizeKB <= 0 {
+		return defaultIngestMaxBodySizeKB * 1024
+	}
+	return this.MaxBodySizeKB * 1024
+}
+
+type PrometheusIngestConfig struct {
+	Enabled bool `json:"enabled"`
+	// Step of every series, since remote_write carries no such information
+	Step int64 `json:"step"`
+	// Labels(by order) used as endpoint, the first one having value wins
+	EndpointLabels []string `json:"endpointLabels"`
+}
+
+type OpenTsdbIngestConfig struct {
+	Enabled bool  `json:"enabled"`
+	Step    int64 `json:"step"`
+	// Tags(by order) used as endpoint, the first one having value wins
+	EndpointTags []string `json:"endpointTags"`
+}
+
+type GraphiteIngestConfig struct {
+	Enabled bool  `json:"enabled"`
+	Step    int64 `json:"step"`
+	// Tags(by order) used as endpoint, the first one having value wins
+	EndpointTags []string `json:"endpointTags"`
+	// 1-based index of node in path used as endpoint if there is no tag for endpoint,
+	// 0 means disabled.
+	EndpointNode int `json:"endpointNode"`
+}
+
+// Spilling the data to disk while sending to judge/graph fails,
+// the spilled data is sent by order once the backend is reachable.
+type SpillConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`
+	// The limit(MB) of spilled data for each backend node, the new data would be dropped if exceeded
+	MaxSizeMB int64 `json:"maxSizeMB"`
+	// The size(MB) of a segment file
+	SegmentSizeMB int64 `json:"segmentSizeMB"`
+	// The interval(ms) to retry sending spilled data if the backend is still unreachable
+	RetryInterval int `json:"retryInterval"`
+}
+
+type RewriteConfig struct {
+	Enabled bool `json:"enabled"`
+	// JSON file of rules to rewrite or drop metrics
+	RulesFile string `json:"rulesFile"`
+	// Interval(seconds) to check modification of rules file, 0 means no auto-reloading
+	ReloadInterval int `json:"reloadInterval"`
+}
+
 type GlobalConfig struct {
 	Debug    bool            `json:"debug"`
 	MinStep  int             `json:"minStep"` //最小周期,单位sec
 	Http     *HttpConfig     `json:"http"`
 	Rpc      *RpcConfig      `json:"rpc"`
+	Socket   *SocketConfig   `json:"socket"`
 	Judge    *JudgeConfig    `json:"judge"`
 	Graph    *GraphConfig    `json:"graph"`
 	Tsdb     *TsdbConfig     `json:"tsdb"`
 	Influxdb *InfluxdbConfig `json:"influxdb"`
 	NqmRest  *NqmRestConfig  `json:"nqmRest"`
 	Staging  *StagingConfig  `json:"staging"`
+	Kafka    *KafkaConfig    `json:"kafka"`
+	Ingest   *IngestConfig   `json:"ingest"`
+	Rewrite  *RewriteConfig  `json:"rewrite"`
+	Spill    *SpillConfig    `json:"spill"`
 }
 
 var (
@@ -132,27 +225,49 @@ func ParseConfig(cfg string) {
 
 	ConfigFile = cfg
 
+	c, err := LoadConfig(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	SetConfig(c)
+
+	log.Println("g.ParseConfig ok, file ", cfg)
+}
+
+// Loads configuration from file without applying it
+func LoadConfig(cfg string) (*GlobalConfig, error) {
 	configContent, err := file.ToTrimString(cfg)
 	if err != nil {
-		log.Fatalln("read config file:", cfg, "fail:", err)
+		return nil, fmt.Errorf("read config file: %s fail: %v", cfg, err)
 	}
 
 	var c GlobalConfig
 	err = json.Unmarshal([]byte(configContent), &c)
 	if err != nil {
-		log.Fatalln("parse config file:", cfg, "fail:", err)
+		return nil, fmt.Errorf("parse config file: %s fail: %v", cfg, err)
+	}
+
+	if c.Judge == nil || c.Graph == nil {
+		return nil, fmt.Errorf("config file: %s has no judge or graph", cfg)
 	}
 
 	// split cluster config
 	c.Judge.ClusterList = formatClusterItems(c.Judge.Cluster)
 	c.Graph.ClusterList = formatClusterItems(c.Graph.Cluster)
 
+	return &c, nil
+}
+
+// Applies the configuration with lock, which is used on reloading
+func ReplaceConfig(newConfig *GlobalConfig) {
 	configLock.Lock()
 	defer configLock.Unlock()
 
-	SetConfig(&c)
-
-	log.Println("g.ParseConfig ok, file ", cfg)
+	SetConfig(newConfig)
 }
 
 func SetConfig(newConfig *GlobalConfig) {
@@ -2,10 +2,14 @@ package http
 
 import (
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
 
 	cmodel "github.com/fwtpe/owl-backend/common/model"
 
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+	"github.com/fwtpe/owl-backend/modules/transfer/receiver/adapter"
 	"github.com/fwtpe/owl-backend/modules/transfer/service"
 )
 
@@ -29,4 +33,105 @@ func configApiHttpRoutes() {
 
 		RenderDataJson(w, reply)
 	})
+
+	configIngestHttpRoutes()
+}
+
+// Routes for data in foreign formats, only enabled adapters are registered
+func configIngestHttpRoutes() {
+	ingestConfig := g.Config().Ingest
+	if ingestConfig == nil {
+		return
+	}
+
+	// Prometheus remote_write
+	if ingestConfig.Prometheus != nil && ingestConfig.Prometheus.Enabled {
+		http.HandleFunc("/api/prometheus/write", func(w http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(limitBody(w, req))
+			if err != nil {
+				http.Error(w, "read body error: "+err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if len(body) == 0 {
+				http.Error(w, "blank body", http.StatusBadRequest)
+				return
+			}
+
+			metrics, err := adapter.ParsePrometheusWriteRequest(body, g.Config().Ingest.Prometheus)
+			if err != nil {
+				http.Error(w, "decode error: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			reply := &cmodel.TransferResponse{}
+			service.RecvMetricValues(metrics, reply, "prometheus")
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	// OpenTSDB "/api/put"
+	if ingestConfig.OpenTsdb != nil && ingestConfig.OpenTsdb.Enabled {
+		http.HandleFunc("/api/put", func(w http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(limitBody(w, req))
+			if err != nil {
+				http.Error(w, "read body error: "+err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if len(body) == 0 {
+				http.Error(w, "blank body", http.StatusBadRequest)
+				return
+			}
+
+			metrics, err := adapter.ParseOpenTsdbPut(body, g.Config().Ingest.OpenTsdb)
+			if err != nil {
+				http.Error(w, "decode error: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			reply := &cmodel.TransferResponse{}
+			service.RecvMetricValues(metrics, reply, "opentsdb")
+
+			/**
+			 * Same as OpenTSDB, 204 for all of the data points are accepted,
+			 * otherwise responds the summary with 400.
+			 */
+			if reply.Invalid == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]int{
+				"success": reply.Total - reply.Invalid,
+				"failed":  reply.Invalid,
+			})
+			// :~)
+		})
+	}
+
+	// Graphite plaintext protocol
+	if ingestConfig.Graphite != nil && ingestConfig.Graphite.Enabled {
+		http.HandleFunc("/api/graphite", func(w http.ResponseWriter, req *http.Request) {
+			metrics, failedCount, err := adapter.ParseGraphitePlaintext(limitBody(w, req), g.Config().Ingest.Graphite)
+			if err != nil {
+				http.Error(w, "decode error: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			reply := &cmodel.TransferResponse{}
+			service.RecvMetricValues(metrics, reply, "graphite")
+
+			reply.Total += failedCount
+			reply.Invalid += failedCount
+
+			RenderDataJson(w, reply)
+		})
+	}
+}
+
+// The body exceeding the limit is an error on reading
+func limitBody(w http.ResponseWriter, req *http.Request) io.Reader {
+	return http.MaxBytesReader(w, req.Body, g.Config().Ingest.MaxBodyBytes())
 }
@@ -3,8 +3,10 @@ package http
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/fwtpe/owl-backend/modules/transfer/g"
+	"github.com/fwtpe/owl-backend/modules/transfer/sender"
 	"github.com/toolkits/file"
 )
 
@@ -25,7 +27,14 @@ func configCommonRoutes() {
 		RenderDataJson(w, g.Config())
 	})
 
+	// Only the membership of judge/graph cluster is reloaded, other configuration needs restarting
 	http.HandleFunc("/config/reload", func(w http.ResponseWriter, r *http.Request) {
-		RenderDataJson(w, "/config/reload is not suppored in transfer now. Please use restart instead.")
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			RenderMsgJson(w, "no privilege")
+			return
+		}
+
+		migration, err := sender.ReloadClusterFromFile(g.ConfigFile)
+		AutoRender(w, migration, err)
 	})
 }
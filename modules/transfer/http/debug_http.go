@@ -31,4 +31,9 @@ func configDebugHttpRoutes() {
 		}
 		w.Write([]byte(result))
 	})
+
+	// membership of judge/graph cluster and the nodes being drained after reloading
+	http.HandleFunc("/debug/cluster", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, sender.GetClusterStatus())
+	})
 }
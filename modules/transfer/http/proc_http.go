@@ -7,13 +7,39 @@ import (
 
 	cutils "github.com/fwtpe/owl-backend/common/utils"
 	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+	"github.com/fwtpe/owl-backend/modules/transfer/rewrite"
 	"github.com/fwtpe/owl-backend/modules/transfer/sender"
 )
 
 func configProcHttpRoutes() {
 	// counter
 	http.HandleFunc("/counter/all", func(w http.ResponseWriter, r *http.Request) {
-		RenderDataJson(w, proc.GetAll())
+		RenderDataJson(w, append(proc.GetAll(), rewrite.GetCounters()...))
+	})
+
+	// rewrite rules
+	http.HandleFunc("/rewrite/rules", func(w http.ResponseWriter, r *http.Request) {
+		configs := make([]*rewrite.RuleConfig, 0)
+		if chain := rewrite.CurrentChain(); chain != nil {
+			for _, rule := range chain.Rules() {
+				configs = append(configs, rule.Config())
+			}
+		}
+
+		RenderDataJson(w, configs)
+	})
+	http.HandleFunc("/rewrite/reload", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			RenderMsgJson(w, "no privilege")
+			return
+		}
+
+		if err := rewrite.Reload(); err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+
+		RenderDataJson(w, "ok")
 	})
 
 	// TO BE DISCARDed
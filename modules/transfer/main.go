@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/fwtpe/owl-backend/common/logruslog"
 	"github.com/fwtpe/owl-backend/common/vipercfg"
@@ -10,6 +12,7 @@ import (
 	"github.com/fwtpe/owl-backend/modules/transfer/http"
 	"github.com/fwtpe/owl-backend/modules/transfer/proc"
 	"github.com/fwtpe/owl-backend/modules/transfer/receiver"
+	"github.com/fwtpe/owl-backend/modules/transfer/rewrite"
 	"github.com/fwtpe/owl-backend/modules/transfer/sender"
 	"github.com/fwtpe/owl-backend/modules/transfer/service"
 )
@@ -41,10 +44,16 @@ func main() {
 	proc.Start()
 
 	sender.Start()
+	rewrite.Start()
 	receiver.Start()
 
 	// http
 	http.Start()
 
-	select {}
+	// reloads the membership of judge/graph cluster on SIGHUP
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	for range sigs {
+		sender.ReloadClusterFromFile(g.ConfigFile)
+	}
 }
@@ -23,6 +23,21 @@ var (
 	HttpRecvCnt   = nproc.NewSCounterQps("HttpRecvCnt")
 	SocketRecvCnt = nproc.NewSCounterQps("SocketRecvCnt")
 
+	// 行协议(socket)中无法解析或被判定无效的数据
+	SocketInvalidCnt = nproc.NewSCounterQps("SocketInvalidCnt")
+	// 当前 socket 连接数
+	SocketConnCnt = nproc.NewSCounterBase("SocketConnCnt")
+
+	// 外部格式(Prometheus, OpenTSDB, Graphite)的接收计数
+	PrometheusRecvCnt = nproc.NewSCounterQps("PrometheusRecvCnt")
+	OpenTsdbRecvCnt   = nproc.NewSCounterQps("OpenTsdbRecvCnt")
+	GraphiteRecvCnt   = nproc.NewSCounterQps("GraphiteRecvCnt")
+
+	// 被改写规则丢弃的数据
+	RewriteDropCnt = nproc.NewSCounterQps("RewriteDropCnt")
+	// 改写后不合法(metric为空或过长)而丢弃的数据
+	RewriteInvalidCnt = nproc.NewSCounterQps("RewriteInvalidCnt")
+
 	SendToJudgeCnt      = nproc.NewSCounterQps("SendToJudgeCnt")
 	SendToTsdbCnt       = nproc.NewSCounterQps("SendToTsdbCnt")
 	SendToGraphCnt      = nproc.NewSCounterQps("SendToGraphCnt")
@@ -31,6 +46,7 @@ var (
 	SendToNqmTcpCnt     = nproc.NewSCounterQps("SendToNqmTcpCnt")
 	SendToNqmTcpconnCnt = nproc.NewSCounterQps("SendToNqmTcpconnCnt")
 	SendToStagingCnt    = nproc.NewSCounterQps("SendToStagingCnt")
+	SendToKafkaCnt      = nproc.NewSCounterQps("SendToKafkaCnt")
 
 	SendToJudgeDropCnt      = nproc.NewSCounterQps("SendToJudgeDropCnt")
 	SendToTsdbDropCnt       = nproc.NewSCounterQps("SendToTsdbDropCnt")
@@ -40,6 +56,7 @@ var (
 	SendToNqmTcpDropCnt     = nproc.NewSCounterQps("SendToNqmTcpDropCnt")
 	SendToNqmTcpconnDropCnt = nproc.NewSCounterQps("SendToNqmTcpconnDropCnt")
 	SendToStagingDropCnt    = nproc.NewSCounterQps("SendToStagingDropCnt")
+	SendToKafkaDropCnt      = nproc.NewSCounterQps("SendToKafkaDropCnt")
 
 	SendToJudgeFailCnt      = nproc.NewSCounterQps("SendToJudgeFailCnt")
 	SendToTsdbFailCnt       = nproc.NewSCounterQps("SendToTsdbFailCnt")
@@ -49,6 +66,13 @@ var (
 	SendToNqmTcpFailCnt     = nproc.NewSCounterQps("SendToNqmTcpFailCnt")
 	SendToNqmTcpconnFailCnt = nproc.NewSCounterQps("SendToNqmTcpconnFailCnt")
 	SendToStagingFailCnt    = nproc.NewSCounterQps("SendToStagingFailCnt")
+	SendToKafkaFailCnt      = nproc.NewSCounterQps("SendToKafkaFailCnt")
+
+	// 发送失败后写入磁盘(spill)的数据, 以及因磁盘空间已满而丢弃的数据
+	SendToJudgeSpillCnt     = nproc.NewSCounterQps("SendToJudgeSpillCnt")
+	SendToGraphSpillCnt     = nproc.NewSCounterQps("SendToGraphSpillCnt")
+	SendToJudgeSpillDropCnt = nproc.NewSCounterQps("SendToJudgeSpillDropCnt")
+	SendToGraphSpillDropCnt = nproc.NewSCounterQps("SendToGraphSpillDropCnt")
 
 	// 发送缓存大小
 	JudgeQueuesCnt    = nproc.NewSCounterBase("JudgeSendCacheCnt")
@@ -57,6 +81,11 @@ var (
 	InfluxdbQueuesCnt = nproc.NewSCounterBase("InfluxdbSendCacheCnt")
 	NqmRpcQueuesCnt   = nproc.NewSCounterBase("NqmRpcSendCacheCnt")
 	StagingQueuesCnt  = nproc.NewSCounterBase("StagingSendCacheCnt")
+	KafkaQueuesCnt    = nproc.NewSCounterBase("KafkaSendCacheCnt")
+
+	// 磁盘(spill)中待发送数据的大小(bytes)
+	JudgeSpillBytesCnt = nproc.NewSCounterBase("JudgeSpillBytesCnt")
+	GraphSpillBytesCnt = nproc.NewSCounterBase("GraphSpillBytesCnt")
 )
 
 func Start() {
@@ -71,6 +100,13 @@ func GetAll() []interface{} {
 	ret = append(ret, RpcRecvCnt.Get())
 	ret = append(ret, HttpRecvCnt.Get())
 	ret = append(ret, SocketRecvCnt.Get())
+	ret = append(ret, SocketInvalidCnt.Get())
+	ret = append(ret, SocketConnCnt.Get())
+	ret = append(ret, PrometheusRecvCnt.Get())
+	ret = append(ret, OpenTsdbRecvCnt.Get())
+	ret = append(ret, GraphiteRecvCnt.Get())
+	ret = append(ret, RewriteDropCnt.Get())
+	ret = append(ret, RewriteInvalidCnt.Get())
 
 	// send cnt
 	ret = append(ret, SendToJudgeCnt.Get())
@@ -81,6 +117,7 @@ func GetAll() []interface{} {
 	ret = append(ret, SendToNqmTcpCnt.Get())
 	ret = append(ret, SendToNqmTcpconnCnt.Get())
 	ret = append(ret, SendToStagingCnt.Get())
+	ret = append(ret, SendToKafkaCnt.Get())
 
 	// drop cnt
 	ret = append(ret, SendToJudgeDropCnt.Get())
@@ -91,6 +128,7 @@ func GetAll() []interface{} {
 	ret = append(ret, SendToNqmTcpDropCnt.Get())
 	ret = append(ret, SendToNqmTcpconnDropCnt.Get())
 	ret = append(ret, SendToStagingDropCnt.Get())
+	ret = append(ret, SendToKafkaDropCnt.Get())
 
 	// send fail cnt
 	ret = append(ret, SendToJudgeFailCnt.Get())
@@ -101,6 +139,13 @@ func GetAll() []interface{} {
 	ret = append(ret, SendToNqmTcpFailCnt.Get())
 	ret = append(ret, SendToNqmTcpconnFailCnt.Get())
 	ret = append(ret, SendToStagingFailCnt.Get())
+	ret = append(ret, SendToKafkaFailCnt.Get())
+
+	// spill cnt
+	ret = append(ret, SendToJudgeSpillCnt.Get())
+	ret = append(ret, SendToGraphSpillCnt.Get())
+	ret = append(ret, SendToJudgeSpillDropCnt.Get())
+	ret = append(ret, SendToGraphSpillDropCnt.Get())
 
 	// cache cnt
 	ret = append(ret, JudgeQueuesCnt.Get())
@@ -109,6 +154,9 @@ func GetAll() []interface{} {
 	ret = append(ret, InfluxdbQueuesCnt.Get())
 	ret = append(ret, NqmRpcQueuesCnt.Get())
 	ret = append(ret, StagingQueuesCnt.Get())
+	ret = append(ret, KafkaQueuesCnt.Get())
+	ret = append(ret, JudgeSpillBytesCnt.Get())
+	ret = append(ret, GraphSpillBytesCnt.Get())
 
 	return ret
 }
@@ -0,0 +1,75 @@
+// Converts data in foreign formats(Prometheus, OpenTSDB, Graphite) to "*cmodel.MetricValue".
+//
+// The converted metrics are still needed to be checked by "service.RecvMetricValues()",
+// this package doesn't validate anything except the format of data.
+package adapter
+
+import (
+	"sort"
+	"strings"
+)
+
+const defaultStep = 60
+
+var tagCharReplacer = strings.NewReplacer(",", "_", "=", "_", " ", "_")
+
+// Picks the value of first matched key as endpoint, the key would be removed from tags.
+//
+// Empty string is returned if nothing matched.
+func pickEndpoint(tags map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value := tags[key]; value != "" {
+			delete(tags, key)
+			return value
+		}
+	}
+
+	return ""
+}
+
+// Builds the tag string("k1=v1,k2=v2") sorted by key.
+//
+// Characters of "," and "=" in name or value are replaced by "_".
+func buildTagString(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if k == "" || v == "" {
+			continue
+		}
+
+		pairs = append(pairs, tagCharReplacer.Replace(k)+"="+tagCharReplacer.Replace(v))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// Normalizes timestamp to seconds, values which look like milliseconds are divided by 1000.
+func toUnixSeconds(timestamp int64) int64 {
+	if timestamp > 1e11 {
+		return timestamp / 1000
+	}
+
+	return timestamp
+}
+
+func stepOrDefault(step int64) int64 {
+	if step <= 0 {
+		return defaultStep
+	}
+
+	return step
+}
+
+// Returns the names if there is any of them, otherwise returns the default names
+func namesOrDefault(names []string, defaultNames ...string) []string {
+	if len(names) > 0 {
+		return names
+	}
+
+	return defaultNames
+}
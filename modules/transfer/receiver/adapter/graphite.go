@@ -0,0 +1,91 @@
+package adapter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+)
+
+// Converts the plaintext protocol of Graphite to metrics, one data point per line:
+//
+//	<path>[;tag1=v1;tag2=v2] <value> <timestamp>
+//
+// The endpoint is picked from tags by "EndpointTags" first; if nothing is found,
+// the node of path indicated by "EndpointNode" is taken out as endpoint.
+// The rest of path(joined by ".") is the metric.
+//
+// The number of lines failed to be parsed is returned as well.
+func ParseGraphitePlaintext(reader io.Reader, config *g.GraphiteIngestConfig) ([]*cmodel.MetricValue, int, error) {
+	step := stepOrDefault(config.Step)
+	endpointTags := namesOrDefault(config.EndpointTags, "endpoint", "host")
+
+	metrics := make([]*cmodel.MetricValue, 0)
+	failedCount := 0
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		metric, err := parseGraphiteLine(line, config.EndpointNode, endpointTags)
+		if err != nil {
+			failedCount++
+			continue
+		}
+
+		metric.Step = step
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, failedCount, scanner.Err()
+}
+
+func parseGraphiteLine(line string, endpointNode int, endpointTags []string) (*cmodel.MetricValue, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("need 3 fields, got %d", len(fields))
+	}
+
+	timestamp, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad timestamp %q: %v", fields[2], err)
+	}
+
+	/**
+	 * Splits the tags from path
+	 */
+	tags := make(map[string]string)
+	pathAndTags := strings.Split(fields[0], ";")
+	for _, tag := range pathAndTags[1:] {
+		pair := strings.SplitN(tag, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("bad tag %q", tag)
+		}
+		tags[pair[0]] = pair[1]
+	}
+	// :~)
+
+	nodes := strings.Split(pathAndTags[0], ".")
+	endpoint := pickEndpoint(tags, endpointTags)
+	if endpoint == "" && endpointNode > 0 && endpointNode <= len(nodes) {
+		endpoint = nodes[endpointNode-1]
+		nodes = append(nodes[:endpointNode-1], nodes[endpointNode:]...)
+	}
+
+	return &cmodel.MetricValue{
+		Endpoint:  endpoint,
+		Metric:    strings.Join(nodes, "."),
+		Value:     fields[1],
+		Type:      g.GAUGE,
+		Tags:      buildTagString(tags),
+		Timestamp: int64(timestamp),
+	}, nil
+}
@@ -0,0 +1,59 @@
+package adapter
+
+import (
+	"strings"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("ParseGraphitePlaintext()", func() {
+	Context("Lines with and without tags", func() {
+		It("Metrics should be converted as expected", func() {
+			testedMetrics, failedCount, err := ParseGraphitePlaintext(
+				strings.NewReader(
+					"servers.web01.cpu.idle 87 1500000000\n"+
+						"\n"+
+						"disk.used;host=web02;mount=/data 33.5 1500000000.5\n"+
+						"bad line\n",
+				),
+				&g.GraphiteIngestConfig{EndpointNode: 2},
+			)
+
+			Expect(err).To(Succeed())
+			Expect(failedCount).To(Equal(1))
+			Expect(testedMetrics).To(HaveLen(2))
+
+			Expect(testedMetrics[0]).To(PointTo(MatchAllFields(Fields{
+				"Endpoint":  Equal("web01"),
+				"Metric":    Equal("servers.cpu.idle"),
+				"Value":     Equal("87"),
+				"Step":      BeEquivalentTo(60),
+				"Type":      Equal("GAUGE"),
+				"Tags":      Equal(""),
+				"Timestamp": BeEquivalentTo(1500000000),
+			})))
+			Expect(testedMetrics[1]).To(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Endpoint": Equal("web02"),
+				"Metric":   Equal("disk.used"),
+				"Tags":     Equal("mount=/data"),
+			})))
+		})
+	})
+
+	Context("No endpoint could be found", func() {
+		It("The endpoint should be empty", func() {
+			testedMetrics, _, err := ParseGraphitePlaintext(
+				strings.NewReader("servers.web01.cpu.idle 87 1500000000\n"),
+				&g.GraphiteIngestConfig{},
+			)
+
+			Expect(err).To(Succeed())
+			Expect(testedMetrics[0].Endpoint).To(BeEmpty())
+			Expect(testedMetrics[0].Metric).To(Equal("servers.web01.cpu.idle"))
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+)
+
+// The data point of "/api/put" of OpenTSDB
+type openTsdbDataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     json.Number       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// Converts the body of "/api/put"(of OpenTSDB) to metrics, the body could be
+// a single data point or an array of data points.
+//
+// The tag picked by "EndpointTags" is the endpoint, rest of tags are kept as tags.
+// Timestamps in milliseconds are converted to seconds.
+func ParseOpenTsdbPut(body []byte, config *g.OpenTsdbIngestConfig) ([]*cmodel.MetricValue, error) {
+	dataPoints := make([]*openTsdbDataPoint, 0)
+
+	trimmedBody := bytes.TrimSpace(body)
+	if len(trimmedBody) > 0 && trimmedBody[0] == '[' {
+		if err := json.Unmarshal(trimmedBody, &dataPoints); err != nil {
+			return nil, err
+		}
+	} else {
+		dataPoint := &openTsdbDataPoint{}
+		if err := json.Unmarshal(trimmedBody, dataPoint); err != nil {
+			return nil, err
+		}
+		dataPoints = append(dataPoints, dataPoint)
+	}
+
+	step := stepOrDefault(config.Step)
+	endpointTags := namesOrDefault(config.EndpointTags, "endpoint", "host")
+
+	metrics := make([]*cmodel.MetricValue, 0, len(dataPoints))
+	for _, dataPoint := range dataPoints {
+		if dataPoint == nil {
+			continue
+		}
+
+		tags := make(map[string]string)
+		for k, v := range dataPoint.Tags {
+			tags[k] = v
+		}
+
+		metrics = append(metrics, &cmodel.MetricValue{
+			Endpoint:  pickEndpoint(tags, endpointTags),
+			Metric:    dataPoint.Metric,
+			Value:     dataPoint.Value.String(),
+			Step:      step,
+			Type:      g.GAUGE,
+			Tags:      buildTagString(tags),
+			Timestamp: toUnixSeconds(dataPoint.Timestamp),
+		})
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,62 @@
+package adapter
+
+import (
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("ParseOpenTsdbPut()", func() {
+	Context("Array of data points", func() {
+		It("Metrics should be converted as expected", func() {
+			testedMetrics, err := ParseOpenTsdbPut(
+				[]byte(`[
+					{ "metric": "sys.cpu.nice", "timestamp": 1500000000123, "value": 18.5, "tags": { "host": "web01", "dc": "lga" } },
+					{ "metric": "sys.cpu.idle", "timestamp": 1500000000, "value": "3", "tags": { "endpoint": "web02", "host": "web99" } }
+				]`),
+				&g.OpenTsdbIngestConfig{},
+			)
+
+			Expect(err).To(Succeed())
+			Expect(testedMetrics).To(HaveLen(2))
+			Expect(testedMetrics[0]).To(PointTo(MatchAllFields(Fields{
+				"Endpoint":  Equal("web01"),
+				"Metric":    Equal("sys.cpu.nice"),
+				"Value":     Equal("18.5"),
+				"Step":      BeEquivalentTo(60),
+				"Type":      Equal("GAUGE"),
+				"Tags":      Equal("dc=lga"),
+				"Timestamp": BeEquivalentTo(1500000000),
+			})))
+			Expect(testedMetrics[1]).To(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Endpoint": Equal("web02"),
+				"Tags":     Equal("host=web99"),
+			})))
+		})
+	})
+
+	Context("Single data point", func() {
+		It("Metric should be converted as expected", func() {
+			testedMetrics, err := ParseOpenTsdbPut(
+				[]byte(` { "metric": "m1", "timestamp": 1500000000, "value": 1, "tags": { "node": "n1" } }`),
+				&g.OpenTsdbIngestConfig{Step: 10, EndpointTags: []string{"node"}},
+			)
+
+			Expect(err).To(Succeed())
+			Expect(testedMetrics).To(HaveLen(1))
+			Expect(testedMetrics[0]).To(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Endpoint": Equal("n1"),
+				"Step":     BeEquivalentTo(10),
+			})))
+		})
+	})
+
+	Context("Bad JSON", func() {
+		It("There should be error", func() {
+			_, err := ParseOpenTsdbPut([]byte(`[{ "metric": `), &g.OpenTsdbIngestConfig{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,242 @@
+package adapter
+
+import (
+	"math"
+	"net"
+	"strings"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+)
+
+type promLabel struct {
+	name  string
+	value string
+}
+
+type promSample struct {
+	value     float64
+	timestamp int64
+}
+
+// Converts the body(snappy compressed "prometheus.WriteRequest") of remote_write to metrics.
+//
+// The label of "__name__" is the metric, the label picked by "EndpointLabels" is the endpoint
+// (port is removed if the value is formatted as "host:port"), rest of labels become tags.
+//
+// Series named as "*_total", "*_count", "*_sum" or "*_bucket" are treated as COUNTER,
+// others are GAUGE. Samples of NaN or Inf(e.g. staleness markers) are skipped.
+func ParsePrometheusWriteRequest(body []byte, config *g.PrometheusIngestConfig) ([]*cmodel.MetricValue, error) {
+	data, err := decodeSnappy(body)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]*cmodel.MetricValue, 0)
+	step := stepOrDefault(config.Step)
+	endpointLabels := namesOrDefault(config.EndpointLabels, "endpoint", "instance")
+
+	/**
+	 * message WriteRequest {
+	 *   repeated TimeSeries timeseries = 1;
+	 * }
+	 */
+	reader := &protoReader{buf: data}
+	for !reader.done() {
+		field, wireType, err := reader.key()
+		if err != nil {
+			return nil, err
+		}
+
+		if field != 1 || wireType != wireBytes {
+			if err = reader.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		seriesData, err := reader.bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		labels, samples, err := decodePromTimeSeries(seriesData)
+		if err != nil {
+			return nil, err
+		}
+
+		metrics = append(metrics, promSeriesToMetrics(labels, samples, step, endpointLabels)...)
+	}
+	// :~)
+
+	return metrics, nil
+}
+
+func promSeriesToMetrics(labels []promLabel, samples []promSample, step int64, endpointLabels []string) []*cmodel.MetricValue {
+	tags := make(map[string]string)
+	metricName := ""
+	for _, label := range labels {
+		if label.name == "__name__" {
+			metricName = label.value
+			continue
+		}
+
+		tags[label.name] = label.value
+	}
+
+	endpoint := pickEndpoint(tags, endpointLabels)
+	if host, _, err := net.SplitHostPort(endpoint); err == nil {
+		endpoint = host
+	}
+
+	counterType := g.GAUGE
+	for _, suffix := range []string{"_total", "_count", "_sum", "_bucket"} {
+		if strings.HasSuffix(metricName, suffix) {
+			counterType = g.COUNTER
+			break
+		}
+	}
+
+	tagString := buildTagString(tags)
+
+	metrics := make([]*cmodel.MetricValue, 0, len(samples))
+	for _, sample := range samples {
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			continue
+		}
+
+		metrics = append(metrics, &cmodel.MetricValue{
+			Endpoint:  endpoint,
+			Metric:    metricName,
+			Value:     sample.value,
+			Step:      step,
+			Type:      counterType,
+			Tags:      tagString,
+			Timestamp: sample.timestamp / 1000,
+		})
+	}
+
+	return metrics
+}
+
+/**
+ * message TimeSeries {
+ *   repeated Label labels = 1;
+ *   repeated Sample samples = 2;
+ * }
+ */
+func decodePromTimeSeries(data []byte) ([]promLabel, []promSample, error) {
+	labels := make([]promLabel, 0)
+	samples := make([]promSample, 0)
+
+	reader := &protoReader{buf: data}
+	for !reader.done() {
+		field, wireType, err := reader.key()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if wireType != wireBytes || (field != 1 && field != 2) {
+			if err = reader.skip(wireType); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		content, err := reader.bytes()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch field {
+		case 1:
+			label, err := decodePromLabel(content)
+			if err != nil {
+				return nil, nil, err
+			}
+			labels = append(labels, label)
+		case 2:
+			sample, err := decodePromSample(content)
+			if err != nil {
+				return nil, nil, err
+			}
+			samples = append(samples, sample)
+		}
+	}
+
+	return labels, samples, nil
+}
+
+/**
+ * message Label {
+ *   string name  = 1;
+ *   string value = 2;
+ * }
+ */
+func decodePromLabel(data []byte) (promLabel, error) {
+	label := promLabel{}
+
+	reader := &protoReader{buf: data}
+	for !reader.done() {
+		field, wireType, err := reader.key()
+		if err != nil {
+			return label, err
+		}
+
+		if wireType != wireBytes || (field != 1 && field != 2) {
+			if err = reader.skip(wireType); err != nil {
+				return label, err
+			}
+			continue
+		}
+
+		content, err := reader.bytes()
+		if err != nil {
+			return label, err
+		}
+
+		if field == 1 {
+			label.name = string(content)
+		} else {
+			label.value = string(content)
+		}
+	}
+
+	return label, nil
+}
+
+/**
+ * message Sample {
+ *   double value    = 1;
+ *   int64 timestamp = 2;
+ * }
+ */
+func decodePromSample(data []byte) (promSample, error) {
+	sample := promSample{}
+
+	reader := &protoReader{buf: data}
+	for !reader.done() {
+		field, wireType, err := reader.key()
+		if err != nil {
+			return sample, err
+		}
+
+		switch {
+		case field == 1 && wireType == wireFixed64:
+			sample.value, err = reader.double()
+		case field == 2 && wireType == wireVarint:
+			var timestamp uint64
+			timestamp, err = reader.varint()
+			sample.timestamp = int64(timestamp)
+		default:
+			err = reader.skip(wireType)
+		}
+
+		if err != nil {
+			return sample, err
+		}
+	}
+
+	return sample, nil
+}
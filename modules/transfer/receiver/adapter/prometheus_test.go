@@ -0,0 +1,114 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("ParsePrometheusWriteRequest()", func() {
+	Context("Request of two series", func() {
+		body := snappyLiteral(protoMessage(
+			protoBytesField(1, protoMessage(
+				protoLabel("__name__", "http_requests_total"),
+				protoLabel("instance", "pc01.it.cepave.com:9100"),
+				protoLabel("code", "200"),
+				protoLabel("path", "/a,b"),
+				protoSample(31.5, 1500000000123),
+				protoSample(math.NaN(), 1500000060123),
+				protoSample(40, 1500000060123),
+			)),
+			protoBytesField(1, protoMessage(
+				protoLabel("__name__", "go_goroutines"),
+				protoLabel("endpoint", "pc02.it.cepave.com"),
+				protoLabel("instance", "10.1.1.1:9100"),
+				protoSample(12, 1500000000000),
+			)),
+		))
+
+		It("Metrics should be converted as expected", func() {
+			testedMetrics, err := ParsePrometheusWriteRequest(body, &g.PrometheusIngestConfig{Step: 30})
+
+			Expect(err).To(Succeed())
+			Expect(testedMetrics).To(HaveLen(3))
+
+			Expect(testedMetrics[0]).To(PointTo(MatchAllFields(Fields{
+				"Endpoint":  Equal("pc01.it.cepave.com"),
+				"Metric":    Equal("http_requests_total"),
+				"Value":     Equal(31.5),
+				"Step":      BeEquivalentTo(30),
+				"Type":      Equal("COUNTER"),
+				"Tags":      Equal("code=200,path=/a_b"),
+				"Timestamp": BeEquivalentTo(1500000000),
+			})))
+			Expect(testedMetrics[1].Value).To(Equal(40.0))
+
+			Expect(testedMetrics[2]).To(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Endpoint": Equal("pc02.it.cepave.com"),
+				"Type":     Equal("GAUGE"),
+				"Tags":     Equal("instance=10.1.1.1:9100"),
+				"Step":     BeEquivalentTo(30),
+			})))
+		})
+	})
+
+	Context("Data which is not snappy compressed", func() {
+		It("There should be error", func() {
+			_, err := ParsePrometheusWriteRequest([]byte{0xff, 0xff, 0xff}, &g.PrometheusIngestConfig{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+/**
+ * Helpers to build protobuf messages and snappy block
+ */
+func protoVarint(value uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, value)]
+}
+func protoBytesField(field int, content []byte) []byte {
+	data := protoVarint(uint64(field<<3 | wireBytes))
+	data = append(data, protoVarint(uint64(len(content)))...)
+	return append(data, content...)
+}
+func protoMessage(fields ...[]byte) []byte {
+	data := make([]byte, 0)
+	for _, field := range fields {
+		data = append(data, field...)
+	}
+	return data
+}
+func protoLabel(name string, value string) []byte {
+	return protoBytesField(1, protoMessage(
+		protoBytesField(1, []byte(name)),
+		protoBytesField(2, []byte(value)),
+	))
+}
+func protoSample(value float64, timestamp int64) []byte {
+	valueField := protoVarint(uint64(1<<3 | wireFixed64))
+	valueBits := make([]byte, 8)
+	binary.LittleEndian.PutUint64(valueBits, math.Float64bits(value))
+	valueField = append(valueField, valueBits...)
+
+	timestampField := append(protoVarint(uint64(2<<3|wireVarint)), protoVarint(uint64(timestamp))...)
+
+	return protoBytesField(2, protoMessage(valueField, timestampField))
+}
+
+// Encodes the data as a single literal of snappy block
+func snappyLiteral(data []byte) []byte {
+	encoded := protoVarint(uint64(len(data)))
+
+	length := uint32(len(data) - 1)
+	encoded = append(encoded, 62<<2, byte(length), byte(length>>8), byte(length>>16))
+
+	return append(encoded, data...)
+}
+
+// :~)
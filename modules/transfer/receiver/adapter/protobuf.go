@@ -0,0 +1,99 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncatedProtobuf = errors.New("protobuf: truncated message")
+
+// A minimal reader of protobuf wire format, which is only used to decode the
+// few messages of Prometheus' remote_write.
+type protoReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *protoReader) done() bool {
+	return r.pos >= len(r.buf)
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	value, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errTruncatedProtobuf
+	}
+
+	r.pos += n
+	return value, nil
+}
+
+// Reads the key of a field, returns number of field and wire type
+func (r *protoReader) key() (int, int, error) {
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(key >> 3), int(key & 0x7), nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	length, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(r.buf)-r.pos) {
+		return nil, errTruncatedProtobuf
+	}
+
+	data := r.buf[r.pos : r.pos+int(length)]
+	r.pos += int(length)
+	return data, nil
+}
+
+func (r *protoReader) fixed64() (uint64, error) {
+	if len(r.buf)-r.pos < 8 {
+		return 0, errTruncatedProtobuf
+	}
+
+	value := binary.LittleEndian.Uint64(r.buf[r.pos:])
+	r.pos += 8
+	return value, nil
+}
+
+func (r *protoReader) double() (float64, error) {
+	bits, err := r.fixed64()
+	return math.Float64frombits(bits), err
+}
+
+func (r *protoReader) skip(wireType int) error {
+	var err error
+
+	switch wireType {
+	case wireVarint:
+		_, err = r.varint()
+	case wireFixed64:
+		_, err = r.fixed64()
+	case wireBytes:
+		_, err = r.bytes()
+	case wireFixed32:
+		if len(r.buf)-r.pos < 4 {
+			return errTruncatedProtobuf
+		}
+		r.pos += 4
+	default:
+		err = fmt.Errorf("protobuf: unsupported wire type %d", wireType)
+	}
+
+	return err
+}
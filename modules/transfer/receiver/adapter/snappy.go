@@ -0,0 +1,122 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Decompressed data larger than this would be rejected
+const maxSnappyDecodedLen = 64 << 20
+
+var errCorruptSnappy = errors.New("snappy: corrupt input")
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy1   = 0x01
+	snappyTagCopy2   = 0x02
+	snappyTagCopy4   = 0x03
+)
+
+// Decodes data of snappy "block" format(not the framing format),
+// which is used by remote_write of Prometheus.
+//
+// See https://github.com/google/snappy/blob/master/format_description.txt
+func decodeSnappy(src []byte) ([]byte, error) {
+	decodedLen, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errCorruptSnappy
+	}
+	if decodedLen > maxSnappyDecodedLen {
+		return nil, errors.New("snappy: decoded block is too large")
+	}
+
+	dst := make([]byte, decodedLen)
+	d, s := 0, n
+
+	for s < len(src) {
+		var length, offset int
+
+		switch src[s] & 0x03 {
+		case snappyTagLiteral:
+			x := uint32(src[s] >> 2)
+			switch {
+			case x < 60:
+				s++
+			case x == 60:
+				s += 2
+				if s > len(src) {
+					return nil, errCorruptSnappy
+				}
+				x = uint32(src[s-1])
+			case x == 61:
+				s += 3
+				if s > len(src) {
+					return nil, errCorruptSnappy
+				}
+				x = uint32(src[s-2]) | uint32(src[s-1])<<8
+			case x == 62:
+				s += 4
+				if s > len(src) {
+					return nil, errCorruptSnappy
+				}
+				x = uint32(src[s-3]) | uint32(src[s-2])<<8 | uint32(src[s-1])<<16
+			case x == 63:
+				s += 5
+				if s > len(src) {
+					return nil, errCorruptSnappy
+				}
+				x = uint32(src[s-4]) | uint32(src[s-3])<<8 | uint32(src[s-2])<<16 | uint32(src[s-1])<<24
+			}
+
+			length = int(x) + 1
+			if length <= 0 || length > len(dst)-d || length > len(src)-s {
+				return nil, errCorruptSnappy
+			}
+
+			copy(dst[d:], src[s:s+length])
+			d += length
+			s += length
+			continue
+		case snappyTagCopy1:
+			s += 2
+			if s > len(src) {
+				return nil, errCorruptSnappy
+			}
+			length = 4 + int(src[s-2])>>2&0x7
+			offset = int(uint32(src[s-2])&0xe0<<3 | uint32(src[s-1]))
+		case snappyTagCopy2:
+			s += 3
+			if s > len(src) {
+				return nil, errCorruptSnappy
+			}
+			length = 1 + int(src[s-3])>>2
+			offset = int(uint32(src[s-2]) | uint32(src[s-1])<<8)
+		case snappyTagCopy4:
+			s += 5
+			if s > len(src) {
+				return nil, errCorruptSnappy
+			}
+			length = 1 + int(src[s-5])>>2
+			offset = int(uint32(src[s-4]) | uint32(src[s-3])<<8 | uint32(src[s-2])<<16 | uint32(src[s-1])<<24)
+		}
+
+		if offset <= 0 || d < offset || length > len(dst)-d {
+			return nil, errCorruptSnappy
+		}
+
+		/**
+		 * The copied range may overlap with the destination,
+		 * so bytes must be copied one by one.
+		 */
+		for end := d + length; d != end; d++ {
+			dst[d] = dst[d-offset]
+		}
+		// :~)
+	}
+
+	if d != len(dst) {
+		return nil, errCorruptSnappy
+	}
+
+	return dst, nil
+}
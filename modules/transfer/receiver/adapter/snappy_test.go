@@ -0,0 +1,40 @@
+package adapter
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("decodeSnappy()", func() {
+	DescribeTable("The decoded data should be as expected",
+		func(encoded []byte, expected string) {
+			decoded, err := decodeSnappy(encoded)
+
+			Expect(err).To(Succeed())
+			Expect(string(decoded)).To(Equal(expected))
+		},
+		Entry("Literal only", []byte{0x05, 0x04 << 2, 'h', 'e', 'l', 'l', 'o'}, "hello"),
+		Entry("Literal with overlapped copy(1-byte offset)",
+			// "ab" + copy(length=6, offset=2)
+			[]byte{0x08, 0x01 << 2, 'a', 'b', (6-4)<<2 | 0x01, 0x02},
+			"abababab",
+		),
+		Entry("Literal with copy(2-byte offset)",
+			// "xyz" + copy(length=3, offset=3)
+			[]byte{0x06, 0x02 << 2, 'x', 'y', 'z', (3-1)<<2 | 0x02, 0x03, 0x00},
+			"xyzxyz",
+		),
+		Entry("Empty block", []byte{0x00}, ""),
+	)
+
+	DescribeTable("Corrupt data should result in error",
+		func(encoded []byte) {
+			_, err := decodeSnappy(encoded)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("Empty input", []byte{}),
+		Entry("Shorter than declared length", []byte{0x06, 0x01 << 2, 'a', 'b'}),
+		Entry("Offset beyond decoded data", []byte{0x08, 0x01 << 2, 'a', 'b', (6-4)<<2 | 0x01, 0x05}),
+	)
+})
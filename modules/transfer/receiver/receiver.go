@@ -2,8 +2,10 @@ package receiver
 
 import (
 	"github.com/fwtpe/owl-backend/modules/transfer/receiver/rpc"
+	"github.com/fwtpe/owl-backend/modules/transfer/receiver/socket"
 )
 
 func Start() {
 	go rpc.StartRpc()
+	go socket.StartSocket()
 }
@@ -0,0 +1,7 @@
+package socket
+
+import (
+	log "github.com/fwtpe/owl-backend/common/logruslog"
+)
+
+var logger = log.NewDefaultLogger("INFO")
@@ -0,0 +1,54 @@
+package socket
+
+import (
+	"net"
+	"time"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	onet "github.com/fwtpe/owl-backend/common/net"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+	"github.com/fwtpe/owl-backend/modules/transfer/service"
+)
+
+// Default idle timeout of a connection if "socket.timeout" is not set
+const defaultTimeoutSeconds = 3600
+
+func StartSocket() {
+	socketConfig := g.Config().Socket
+	if socketConfig == nil || !socketConfig.Enabled {
+		logger.Info("Socket(line protocol) service is disabled")
+		return
+	}
+
+	address := socketConfig.Listen
+	logger.Infof("Initializes Socket(line protocol) service: %s", address)
+
+	timeout := time.Duration(socketConfig.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeoutSeconds * time.Second
+	}
+
+	listener := onet.MustInitTcpListener(address)
+	listenerCtrl := onet.NewListenerController(listener)
+	defer listenerCtrl.Close()
+
+	listenerCtrl.AcceptLoop(
+		func(conn net.Conn) {
+			proc.SocketConnCnt.Incr()
+			defer proc.SocketConnCnt.IncrBy(-1)
+
+			handleConnection(conn, timeout, recvBySocket)
+		},
+	)
+}
+
+func recvBySocket(metrics []*cmodel.MetricValue) {
+	reply := &cmodel.TransferResponse{}
+	service.RecvMetricValues(metrics, reply, "socket")
+
+	if reply.Invalid > 0 {
+		proc.SocketInvalidCnt.IncrBy(int64(reply.Invalid))
+	}
+}
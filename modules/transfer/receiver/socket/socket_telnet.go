@@ -0,0 +1,126 @@
+package socket
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+)
+
+// The maximum number of metrics relayed by one call of "RecvMetricValues"
+const maxBatchSize = 200
+
+// The maximum length of a line(including the newline), the connection is closed if it is exceeded
+const maxLineSize = 16 * 1024
+
+// Reads lines of metrics from the connection until the client sends "quit",
+// closes the connection, stays idle longer than "timeout", or sends a line longer than "maxLineSize".
+//
+// Parsed metrics are fed into "recv" whenever there is no more buffered data
+// from the client or the batch reaches "maxBatchSize".
+func handleConnection(conn net.Conn, timeout time.Duration, recv func([]*cmodel.MetricValue)) {
+	defer conn.Close()
+
+	metrics := make([]*cmodel.MetricValue, 0)
+	flush := func() {
+		if len(metrics) == 0 {
+			return
+		}
+
+		recv(metrics)
+		metrics = make([]*cmodel.MetricValue, 0)
+	}
+	defer flush()
+
+	reader := bufio.NewReaderSize(conn, maxLineSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+
+		// The slice is only valid until the next read
+		slice, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			logger.Warnf("[Socket] Line from %s exceeds %d bytes. Closing the connection", conn.RemoteAddr(), maxLineSize)
+			proc.SocketInvalidCnt.Incr()
+			return
+		}
+		line := strings.TrimSpace(string(slice))
+
+		if line == "quit" {
+			return
+		}
+
+		if line != "" {
+			metric, parseErr := parseLine(line)
+			if parseErr != nil {
+				logger.Debugf("[Socket] Bad line from %s: %q. Error: %v", conn.RemoteAddr(), line, parseErr)
+				proc.SocketInvalidCnt.Incr()
+			} else if metric != nil {
+				metrics = append(metrics, metric)
+			}
+		}
+
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				logger.Debugf("[Socket] Connection from %s is idle for %v. Closing it", conn.RemoteAddr(), timeout)
+			}
+			return
+		}
+
+		if len(metrics) >= maxBatchSize || reader.Buffered() == 0 {
+			flush()
+		}
+	}
+}
+
+// Parses a line of Open-Falcon style:
+//
+//	update <endpoint> <metric> <timestamp> <step> <value> [<type>] [<tags>]
+//
+// The type is "GAUGE" if it is omitted; tags are formatted as "k1=v1,k2=v2".
+//
+// Lines of other commands are ignored(nil metric and nil error).
+func parseLine(line string) (*cmodel.MetricValue, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "update" {
+		return nil, nil
+	}
+
+	fields = fields[1:]
+	if len(fields) < 5 || len(fields) > 7 {
+		return nil, fmt.Errorf("need 5 to 7 fields after \"update\", got %d", len(fields))
+	}
+
+	timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad timestamp %q: %v", fields[2], err)
+	}
+
+	step, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad step %q: %v", fields[3], err)
+	}
+
+	metric := &cmodel.MetricValue{
+		Endpoint:  fields[0],
+		Metric:    fields[1],
+		Timestamp: timestamp,
+		Step:      step,
+		Value:     fields[4],
+		Type:      "GAUGE",
+	}
+
+	if len(fields) > 5 {
+		metric.Type = fields[5]
+	}
+	if len(fields) > 6 {
+		metric.Tags = fields[6]
+	}
+
+	return metric, nil
+}
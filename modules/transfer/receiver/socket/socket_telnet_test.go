@@ -0,0 +1,173 @@
+package socket
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("parseLine()", func() {
+	Context("Valid lines", func() {
+		DescribeTable("The parsed metric should be as expected",
+			func(line string, expectedType string, expectedTags string) {
+				testedMetric, err := parseLine(line)
+
+				Expect(err).To(Succeed())
+				Expect(testedMetric).To(PointTo(MatchAllFields(Fields{
+					"Endpoint":  Equal("pc01.it.cepave.com"),
+					"Metric":    Equal("cpu.idle"),
+					"Timestamp": BeEquivalentTo(1500000000),
+					"Step":      BeEquivalentTo(60),
+					"Value":     Equal("87.5"),
+					"Type":      Equal(expectedType),
+					"Tags":      Equal(expectedTags),
+				})))
+			},
+			Entry("Full fields",
+				"update pc01.it.cepave.com cpu.idle 1500000000 60 87.5 COUNTER core=1,socket=0",
+				"COUNTER", "core=1,socket=0",
+			),
+			Entry("Without tags",
+				"update pc01.it.cepave.com cpu.idle 1500000000 60 87.5 DERIVE",
+				"DERIVE", "",
+			),
+			Entry("Without type and tags",
+				"update  pc01.it.cepave.com\tcpu.idle 1500000000 60 87.5",
+				"GAUGE", "",
+			),
+		)
+	})
+
+	Context("Invalid lines", func() {
+		DescribeTable("There should be error",
+			func(line string) {
+				testedMetric, err := parseLine(line)
+
+				Expect(err).To(HaveOccurred())
+				Expect(testedMetric).To(BeNil())
+			},
+			Entry("Not enough fields", "update pc01.it.cepave.com cpu.idle 1500000000 60"),
+			Entry("Too many fields", "update pc01 cpu.idle 1500000000 60 87.5 GAUGE a=1 b=2"),
+			Entry("Bad timestamp", "update pc01 cpu.idle 15000x0000 60 87.5"),
+			Entry("Bad step", "update pc01 cpu.idle 1500000000 ab 87.5"),
+		)
+	})
+
+	Context("Other commands", func() {
+		It("The line should be ignored", func() {
+			testedMetric, err := parseLine("ping 1 2 3")
+
+			Expect(err).To(Succeed())
+			Expect(testedMetric).To(BeNil())
+		})
+	})
+})
+
+var _ = Describe("handleConnection()", func() {
+	var (
+		clientConn net.Conn
+		serverConn net.Conn
+
+		lock     *sync.Mutex
+		received []*cmodel.MetricValue
+		done     chan bool
+	)
+
+	recv := func(metrics []*cmodel.MetricValue) {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, metrics...)
+	}
+	startHandler := func(timeout time.Duration) {
+		go func() {
+			defer GinkgoRecover()
+			handleConnection(serverConn, timeout, recv)
+			close(done)
+		}()
+	}
+
+	BeforeEach(func() {
+		/**
+		 * Uses loopback TCP connection since deadlines of "net.Pipe()"
+		 * are not supported before Go 1.10
+		 */
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(Succeed())
+		defer listener.Close()
+
+		clientConn, err = net.Dial("tcp", listener.Addr().String())
+		Expect(err).To(Succeed())
+		serverConn, err = listener.Accept()
+		Expect(err).To(Succeed())
+		// :~)
+
+		lock = &sync.Mutex{}
+		received = make([]*cmodel.MetricValue, 0)
+		done = make(chan bool)
+	})
+	AfterEach(func() {
+		clientConn.Close()
+	})
+
+	Context("Client sends metrics and \"quit\"", func() {
+		It("Every valid metric should be received", func() {
+			startHandler(5 * time.Second)
+
+			_, err := clientConn.Write([]byte(
+				"update pc01 m01 1500000000 60 1\n" +
+					"update pc01 m02 1500000000 60 2 GAUGE t1=v1\n" +
+					"bad line\n" +
+					"update pc01 m03 1500000000\n" +
+					"\n" +
+					"update pc01 m04 1500000000 60 4 COUNTER\n" +
+					"quit\n",
+			))
+			Expect(err).To(Succeed())
+
+			Eventually(done, 3*time.Second).Should(BeClosed())
+
+			lock.Lock()
+			defer lock.Unlock()
+			Expect(received).To(HaveLen(3))
+			Expect(received[0].Metric).To(Equal("m01"))
+			Expect(received[1].Tags).To(Equal("t1=v1"))
+			Expect(received[2].Type).To(Equal("COUNTER"))
+		})
+	})
+
+	Context("Client sends a line longer than the limit", func() {
+		It("The connection should be closed", func() {
+			startHandler(5 * time.Second)
+
+			_, err := clientConn.Write([]byte("update pc01 m01 1500000000 60 1\n"))
+			Expect(err).To(Succeed())
+			go clientConn.Write(make([]byte, maxLineSize+1))
+
+			Eventually(done, 3*time.Second).Should(BeClosed())
+
+			lock.Lock()
+			defer lock.Unlock()
+			Expect(received).To(HaveLen(1))
+		})
+	})
+
+	Context("Client keeps idle", func() {
+		It("The connection should be closed after timeout", func() {
+			startHandler(200 * time.Millisecond)
+
+			Eventually(done, 3*time.Second).Should(BeClosed())
+
+			clientConn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err := clientConn.Read(make([]byte, 1))
+			Expect(err).To(Equal(io.EOF))
+		})
+	})
+})
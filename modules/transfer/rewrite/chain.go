@@ -0,0 +1,223 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	cutils "github.com/fwtpe/owl-backend/common/utils"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+)
+
+// Same as the limit of length for metric and tags(as string) on receiving
+const maxMetricAndTagsLength = 510
+
+// The content of rules file
+type RulesFile struct {
+	Rules []*RuleConfig `json:"rules"`
+}
+
+// Rules are applied by order, the applying stops once a rule drops the metric.
+type Chain struct {
+	rules []*Rule
+}
+
+// Builds the chain by configurations of rules, any bad rule results in error.
+func NewChain(configs []*RuleConfig) (*Chain, error) {
+	chain := &Chain{rules: make([]*Rule, 0, len(configs))}
+
+	for _, config := range configs {
+		rule, err := NewRule(config)
+		if err != nil {
+			return nil, err
+		}
+
+		chain.rules = append(chain.rules, rule)
+	}
+
+	return chain, nil
+}
+
+// Returns false if the metric should be dropped, including the one becoming invalid after rewriting
+func (c *Chain) Apply(metric *cmodel.MetaData) bool {
+	rewritten := false
+	for _, rule := range c.rules {
+		if !rule.Match(metric) {
+			continue
+		}
+
+		if !rule.Apply(metric) {
+			return false
+		}
+		rewritten = true
+	}
+
+	if rewritten && !isValidMetric(metric) {
+		proc.RewriteInvalidCnt.Incr()
+		return false
+	}
+
+	return true
+}
+
+// The same limits checked on receiving metrics
+func isValidMetric(metric *cmodel.MetaData) bool {
+	if metric.Metric == "" {
+		return false
+	}
+
+	return len(metric.Metric)+len(cutils.SortedTags(metric.Tags)) <= maxMetricAndTagsLength
+}
+
+func (c *Chain) Rules() []*Rule {
+	return c.rules
+}
+
+var (
+	currentChain *Chain
+	chainLock    = new(sync.RWMutex)
+
+	rulesFileModTime time.Time
+)
+
+func CurrentChain() *Chain {
+	chainLock.RLock()
+	defer chainLock.RUnlock()
+	return currentChain
+}
+
+func SetChain(newChain *Chain) {
+	chainLock.Lock()
+	defer chainLock.Unlock()
+	currentChain = newChain
+}
+
+// Applies current chain of rules on the metric, returns false if the metric should be dropped.
+//
+// The metric is untouched if there is no chain.
+func Apply(metric *cmodel.MetaData) bool {
+	chain := CurrentChain()
+	if chain == nil {
+		return true
+	}
+
+	if !chain.Apply(metric) {
+		proc.RewriteDropCnt.Incr()
+		return false
+	}
+
+	return true
+}
+
+// Gets counters of hits for rules of current chain
+func GetCounters() []interface{} {
+	ret := make([]interface{}, 0)
+
+	chain := CurrentChain()
+	if chain == nil {
+		return ret
+	}
+
+	for _, rule := range chain.rules {
+		ret = append(ret, rule.hitCnt.Get())
+	}
+
+	return ret
+}
+
+// Loads the rules file and replaces current chain.
+//
+// The current chain is kept if there is any error.
+func LoadRulesFile(filePath string) error {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	rulesFile := &RulesFile{}
+	if err = json.Unmarshal(content, rulesFile); err != nil {
+		return err
+	}
+
+	newChain, err := NewChain(rulesFile.Rules)
+	if err != nil {
+		return err
+	}
+
+	SetChain(newChain)
+	setRulesFileModTime(fileInfo.ModTime())
+
+	logger.Infof("[Rewrite] Loaded %d rule(s) from file: %s", len(newChain.rules), filePath)
+	return nil
+}
+
+// Reloads rules by current configuration
+func Reload() error {
+	rewriteConfig := g.Config().Rewrite
+	if rewriteConfig == nil || !rewriteConfig.Enabled {
+		SetChain(nil)
+		return nil
+	}
+
+	return LoadRulesFile(rewriteConfig.RulesFile)
+}
+
+func Start() {
+	rewriteConfig := g.Config().Rewrite
+	if rewriteConfig == nil || !rewriteConfig.Enabled {
+		logger.Info("Rewrite rules are disabled")
+		return
+	}
+
+	if err := LoadRulesFile(rewriteConfig.RulesFile); err != nil {
+		logger.Errorf("[Rewrite] Cannot load rules file[%s]: %v", rewriteConfig.RulesFile, err)
+	}
+
+	if rewriteConfig.ReloadInterval > 0 {
+		go watchRulesFile(rewriteConfig.RulesFile, time.Duration(rewriteConfig.ReloadInterval)*time.Second)
+	}
+}
+
+// Reloads the rules file if the modification time of it is changed
+func watchRulesFile(filePath string, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			logger.Warnf("[Rewrite] Cannot stat rules file[%s]: %v", filePath, err)
+			continue
+		}
+
+		if fileInfo.ModTime().Equal(getRulesFileModTime()) {
+			continue
+		}
+
+		if err = LoadRulesFile(filePath); err != nil {
+			logger.Errorf("[Rewrite] Cannot reload rules file[%s]: %v", filePath, err)
+			// Prevents the same error from being logged repeatedly
+			setRulesFileModTime(fileInfo.ModTime())
+		}
+	}
+}
+
+func getRulesFileModTime() time.Time {
+	chainLock.RLock()
+	defer chainLock.RUnlock()
+	return rulesFileModTime
+}
+func setRulesFileModTime(modTime time.Time) {
+	chainLock.Lock()
+	defer chainLock.Unlock()
+	rulesFileModTime = modTime
+}
@@ -0,0 +1,96 @@
+package rewrite
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chain", func() {
+	Context("Apply() by order", func() {
+		chain, err := NewChain([]*RuleConfig{
+			{Name: "c-rename", Action: ActionRename, Metric: "^old\\.metric$", Rename: "new.metric"},
+			{Name: "c-drop", Action: ActionDrop, Metric: "^new\\.metric$", Tags: map[string]string{"env": "^test$"}},
+			{Name: "c-add", Action: ActionAddTag, AddTags: map[string]string{"checked": "1"}},
+		})
+
+		It("The renamed metric should be matched by following rules", func() {
+			Expect(err).To(Succeed())
+
+			dropped := &cmodel.MetaData{Metric: "old.metric", Tags: map[string]string{"env": "test"}}
+			Expect(chain.Apply(dropped)).To(BeFalse())
+			Expect(dropped.Tags).NotTo(HaveKey("checked"))
+
+			kept := &cmodel.MetaData{Metric: "old.metric", Tags: map[string]string{"env": "prod"}}
+			Expect(chain.Apply(kept)).To(BeTrue())
+			Expect(kept.Metric).To(Equal("new.metric"))
+			Expect(kept.Tags).To(HaveKeyWithValue("checked", "1"))
+		})
+	})
+
+	Context("Metric becomes invalid after rewriting", func() {
+		chain, err := NewChain([]*RuleConfig{
+			{Name: "i-empty", Action: ActionRename, Metric: "^empty\\.(.*)$", Rename: "$1"},
+			{Name: "i-long", Action: ActionAddTag, Metric: "^long$", AddTags: map[string]string{"padding": strings.Repeat("x", 510)}},
+		})
+
+		It("The metric should be dropped", func() {
+			Expect(err).To(Succeed())
+
+			Expect(chain.Apply(&cmodel.MetaData{Metric: "empty."})).To(BeFalse())
+			Expect(chain.Apply(&cmodel.MetaData{Metric: "long"})).To(BeFalse())
+			Expect(chain.Apply(&cmodel.MetaData{Metric: "empty.cpu"})).To(BeTrue())
+		})
+	})
+
+	Context("Bad rule", func() {
+		It("There should be error", func() {
+			_, err := NewChain([]*RuleConfig{{Name: "c-bad", Action: "unknown"}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("LoadRulesFile()", func() {
+	var rulesFile string
+
+	BeforeEach(func() {
+		file, err := ioutil.TempFile("", "rewrite-rules")
+		Expect(err).To(Succeed())
+		rulesFile = file.Name()
+		file.Close()
+	})
+	AfterEach(func() {
+		os.Remove(rulesFile)
+		SetChain(nil)
+	})
+
+	It("Rules should be loaded as current chain", func() {
+		Expect(ioutil.WriteFile(rulesFile, []byte(`{
+			"rules": [
+				{ "name": "f-drop", "action": "drop", "metric": "^noisy\\." }
+			]
+		}`), 0644)).To(Succeed())
+
+		Expect(LoadRulesFile(rulesFile)).To(Succeed())
+
+		Expect(Apply(&cmodel.MetaData{Metric: "noisy.metric"})).To(BeFalse())
+		Expect(Apply(&cmodel.MetaData{Metric: "good.metric"})).To(BeTrue())
+		Expect(GetCounters()).To(HaveLen(1))
+	})
+
+	It("Current chain should be kept if the file is bad", func() {
+		Expect(ioutil.WriteFile(rulesFile, []byte(`{ "rules": [ { "name": "f-bad", "action": "drop", "metric": "(" } ] }`), 0644)).To(Succeed())
+
+		previousChain, _ := NewChain([]*RuleConfig{})
+		SetChain(previousChain)
+
+		Expect(LoadRulesFile(rulesFile)).NotTo(Succeed())
+		Expect(CurrentChain()).To(BeIdenticalTo(previousChain))
+	})
+})
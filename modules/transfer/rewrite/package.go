@@ -0,0 +1,11 @@
+// Provides the chain of rules to rewrite or drop metrics before they are dispatched
+// to "RelayStation".
+//
+// The rules are loaded from a JSON file, which could be reloaded without restarting transfer.
+package rewrite
+
+import (
+	log "github.com/fwtpe/owl-backend/common/logruslog"
+)
+
+var logger = log.NewDefaultLogger("INFO")
@@ -0,0 +1,241 @@
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	nproc "github.com/toolkits/proc"
+)
+
+// Supported actions of rule
+const (
+	ActionRename   = "rename"
+	ActionDrop     = "drop"
+	ActionAddTag   = "addTag"
+	ActionStripTag = "stripTag"
+	ActionCapTags  = "capTags"
+)
+
+const defaultOverflowValue = "_other_"
+
+// The configuration of a rule, the matching conditions are "AND"-ed.
+type RuleConfig struct {
+	Name string `json:"name"`
+
+	// Regular expression on endpoint, empty means any
+	Endpoint string `json:"endpoint"`
+	// Regular expression on metric, empty means any
+	Metric string `json:"metric"`
+	// Tag name to regular expression on value of tag, the tag must exist
+	Tags map[string]string `json:"tags"`
+
+	Action string `json:"action"`
+
+	// [rename] New name of metric, "$1" style references to groups of "metric" are supported
+	Rename string `json:"rename"`
+	// [addTag] Tags to be added(or overridden)
+	AddTags map[string]string `json:"addTags"`
+	// [stripTag, capTags] Names of affected tags
+	TagKeys []string `json:"tagKeys"`
+	// [capTags] The maximum number of distinct values for each tag
+	MaxValues int `json:"maxValues"`
+	// [capTags] The value used for values beyond the limit, default is "_other_"
+	OverflowValue string `json:"overflowValue"`
+}
+
+type Rule struct {
+	config *RuleConfig
+
+	endpointRegexp *regexp.Regexp
+	metricRegexp   *regexp.Regexp
+	tagRegexps     map[string]*regexp.Regexp
+
+	hitCnt *nproc.SCounterQps
+
+	// [capTags] tag name -> seen values
+	seenValuesLock *sync.Mutex
+	seenValues     map[string]map[string]bool
+}
+
+// Compiles the configuration of rule
+func NewRule(config *RuleConfig) (*Rule, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("name of rule is empty")
+	}
+
+	rule := &Rule{
+		config:     config,
+		tagRegexps: make(map[string]*regexp.Regexp),
+		hitCnt:     hitCounter(config.Name),
+	}
+
+	var err error
+	if rule.endpointRegexp, err = compileOptional(config.Endpoint); err != nil {
+		return nil, fmt.Errorf("rule[%s] has bad regexp of endpoint: %v", config.Name, err)
+	}
+	if rule.metricRegexp, err = compileOptional(config.Metric); err != nil {
+		return nil, fmt.Errorf("rule[%s] has bad regexp of metric: %v", config.Name, err)
+	}
+	for tagName, expr := range config.Tags {
+		if rule.tagRegexps[tagName], err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("rule[%s] has bad regexp of tag[%s]: %v", config.Name, tagName, err)
+		}
+	}
+
+	switch config.Action {
+	case ActionDrop:
+	case ActionRename:
+		if config.Rename == "" {
+			return nil, fmt.Errorf("rule[%s] needs \"rename\"", config.Name)
+		}
+	case ActionAddTag:
+		if len(config.AddTags) == 0 {
+			return nil, fmt.Errorf("rule[%s] needs \"addTags\"", config.Name)
+		}
+	case ActionStripTag:
+		if len(config.TagKeys) == 0 {
+			return nil, fmt.Errorf("rule[%s] needs \"tagKeys\"", config.Name)
+		}
+	case ActionCapTags:
+		if len(config.TagKeys) == 0 || config.MaxValues <= 0 {
+			return nil, fmt.Errorf("rule[%s] needs \"tagKeys\" and positive \"maxValues\"", config.Name)
+		}
+		if config.OverflowValue == "" {
+			config.OverflowValue = defaultOverflowValue
+		}
+
+		rule.seenValuesLock = &sync.Mutex{}
+		rule.seenValues = make(map[string]map[string]bool)
+	default:
+		return nil, fmt.Errorf("rule[%s] has unknown action: %q", config.Name, config.Action)
+	}
+
+	return rule, nil
+}
+
+func (r *Rule) Name() string {
+	return r.config.Name
+}
+
+func (r *Rule) Config() *RuleConfig {
+	return r.config
+}
+
+// Checks whether or not the metric is matched by this rule
+func (r *Rule) Match(metric *cmodel.MetaData) bool {
+	if r.endpointRegexp != nil && !r.endpointRegexp.MatchString(metric.Endpoint) {
+		return false
+	}
+	if r.metricRegexp != nil && !r.metricRegexp.MatchString(metric.Metric) {
+		return false
+	}
+
+	for tagName, tagRegexp := range r.tagRegexps {
+		value, ok := metric.Tags[tagName]
+		if !ok || !tagRegexp.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Performs the action of rule on the metric(which should be matched).
+//
+// Returns false if the metric should be dropped.
+func (r *Rule) Apply(metric *cmodel.MetaData) bool {
+	r.hitCnt.Incr()
+
+	switch r.config.Action {
+	case ActionDrop:
+		return false
+	case ActionRename:
+		newName := r.config.Rename
+		if r.metricRegexp != nil {
+			newName = string(r.metricRegexp.ExpandString(
+				nil, r.config.Rename, metric.Metric,
+				r.metricRegexp.FindStringSubmatchIndex(metric.Metric),
+			))
+		}
+
+		// An empty name is dropped by the checking of chain
+		metric.Metric = newName
+	case ActionAddTag:
+		if metric.Tags == nil {
+			metric.Tags = make(map[string]string)
+		}
+		for k, v := range r.config.AddTags {
+			metric.Tags[k] = v
+		}
+	case ActionStripTag:
+		for _, tagName := range r.config.TagKeys {
+			delete(metric.Tags, tagName)
+		}
+	case ActionCapTags:
+		r.capTags(metric)
+	}
+
+	return true
+}
+
+func (r *Rule) capTags(metric *cmodel.MetaData) {
+	r.seenValuesLock.Lock()
+	defer r.seenValuesLock.Unlock()
+
+	for _, tagName := range r.config.TagKeys {
+		value, ok := metric.Tags[tagName]
+		if !ok {
+			continue
+		}
+
+		seen, ok := r.seenValues[tagName]
+		if !ok {
+			seen = make(map[string]bool)
+			r.seenValues[tagName] = seen
+		}
+
+		if seen[value] {
+			continue
+		}
+
+		if len(seen) < r.config.MaxValues {
+			seen[value] = true
+			continue
+		}
+
+		metric.Tags[tagName] = r.config.OverflowValue
+	}
+}
+
+func compileOptional(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(expr)
+}
+
+/**
+ * Counters of hits are kept by name of rule, so reloading of rules wouldn't reset them.
+ */
+var (
+	hitCountersLock = &sync.Mutex{}
+	hitCounters     = make(map[string]*nproc.SCounterQps)
+)
+
+func hitCounter(ruleName string) *nproc.SCounterQps {
+	hitCountersLock.Lock()
+	defer hitCountersLock.Unlock()
+
+	counter, ok := hitCounters[ruleName]
+	if !ok {
+		counter = nproc.NewSCounterQps("RewriteHitCnt." + ruleName)
+		hitCounters[ruleName] = counter
+	}
+
+	return counter
+}
+
+// :~)
@@ -0,0 +1,93 @@
+package rewrite
+
+import (
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewRule()", func() {
+	DescribeTable("Bad configuration should result in error",
+		func(config *RuleConfig) {
+			_, err := NewRule(config)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("No name", &RuleConfig{Action: ActionDrop}),
+		Entry("Unknown action", &RuleConfig{Name: "r1", Action: "explode"}),
+		Entry("Bad regexp", &RuleConfig{Name: "r1", Action: ActionDrop, Metric: "cpu.(idle"}),
+		Entry("Rename without new name", &RuleConfig{Name: "r1", Action: ActionRename}),
+		Entry("Add tag without tags", &RuleConfig{Name: "r1", Action: ActionAddTag}),
+		Entry("Strip tag without names", &RuleConfig{Name: "r1", Action: ActionStripTag}),
+		Entry("Cap tags without maximum", &RuleConfig{Name: "r1", Action: ActionCapTags, TagKeys: []string{"a"}}),
+	)
+})
+
+var _ = Describe("Rule.Match()", func() {
+	rule, _ := NewRule(&RuleConfig{
+		Name: "r1", Action: ActionDrop,
+		Endpoint: "^pc\\d+", Metric: "^disk\\.", Tags: map[string]string{"mount": "^/data"},
+	})
+
+	DescribeTable("The result of matching should be as expected",
+		func(metric *cmodel.MetaData, expected bool) {
+			Expect(rule.Match(metric)).To(Equal(expected))
+		},
+		Entry("Matched", &cmodel.MetaData{
+			Endpoint: "pc01", Metric: "disk.used", Tags: map[string]string{"mount": "/data1"},
+		}, true),
+		Entry("Endpoint is not matched", &cmodel.MetaData{
+			Endpoint: "gk01", Metric: "disk.used", Tags: map[string]string{"mount": "/data1"},
+		}, false),
+		Entry("Metric is not matched", &cmodel.MetaData{
+			Endpoint: "pc01", Metric: "cpu.idle", Tags: map[string]string{"mount": "/data1"},
+		}, false),
+		Entry("Tag doesn't exist", &cmodel.MetaData{
+			Endpoint: "pc01", Metric: "disk.used", Tags: map[string]string{},
+		}, false),
+	)
+})
+
+var _ = Describe("Rule.Apply()", func() {
+	It("Rename with reference to groups", func() {
+		rule, err := NewRule(&RuleConfig{
+			Name: "rename-1", Action: ActionRename,
+			Metric: "^jvm\\.(\\w+)\\.used$", Rename: "java.$1.used",
+		})
+		Expect(err).To(Succeed())
+
+		metric := &cmodel.MetaData{Metric: "jvm.heap.used"}
+		Expect(rule.Apply(metric)).To(BeTrue())
+		Expect(metric.Metric).To(Equal("java.heap.used"))
+	})
+
+	It("Drop", func() {
+		rule, _ := NewRule(&RuleConfig{Name: "drop-1", Action: ActionDrop})
+		Expect(rule.Apply(&cmodel.MetaData{})).To(BeFalse())
+	})
+
+	It("Add tag and strip tag", func() {
+		addRule, _ := NewRule(&RuleConfig{Name: "add-1", Action: ActionAddTag, AddTags: map[string]string{"dc": "tpe"}})
+		stripRule, _ := NewRule(&RuleConfig{Name: "strip-1", Action: ActionStripTag, TagKeys: []string{"request_id"}})
+
+		metric := &cmodel.MetaData{Tags: map[string]string{"request_id": "a1b2", "api": "/v1"}}
+		addRule.Apply(metric)
+		stripRule.Apply(metric)
+
+		Expect(metric.Tags).To(Equal(map[string]string{"dc": "tpe", "api": "/v1"}))
+	})
+
+	It("Cap tags", func() {
+		rule, _ := NewRule(&RuleConfig{Name: "cap-1", Action: ActionCapTags, TagKeys: []string{"uid"}, MaxValues: 2})
+
+		values := make([]string, 0)
+		for _, uid := range []string{"u1", "u2", "u1", "u3", "u2", "u4"} {
+			metric := &cmodel.MetaData{Tags: map[string]string{"uid": uid}}
+			rule.Apply(metric)
+			values = append(values, metric.Tags["uid"])
+		}
+
+		Expect(values).To(Equal([]string{"u1", "u2", "u1", "_other_", "u2", "_other_"}))
+	})
+})
@@ -0,0 +1,407 @@
+package sender
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	nlist "github.com/toolkits/container/list"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+	cpool "github.com/fwtpe/owl-backend/modules/transfer/sender/conn_pool"
+)
+
+const (
+	defaultDrainTimeout = 300 // seconds
+)
+
+// The report of reloading on membership of judge/graph cluster
+type ClusterMigration struct {
+	Time  time.Time  `json:"time"`
+	Judge *NodesDiff `json:"judge"`
+	Graph *NodesDiff `json:"graph"`
+}
+
+// For graph, the node is shown as "<node>:<addr>" since every address has its own queue
+type NodesDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	// The nodes(judge only) whose address is changed
+	Changed []string `json:"changed"`
+}
+
+// A removed node which is still sending its remained data
+type DrainingNode struct {
+	Backend  string    `json:"backend"`
+	Node     string    `json:"node"`
+	Addr     string    `json:"addr"`
+	Since    time.Time `json:"since"`
+	QueueLen int       `json:"queueLen"`
+	// Number of spilled batches
+	SpillLen int64 `json:"spillLen"`
+}
+
+type ClusterStatus struct {
+	Judge         map[string]string   `json:"judge"`
+	Graph         map[string][]string `json:"graph"`
+	Draining      []*DrainingNode     `json:"draining"`
+	LastMigration *ClusterMigration   `json:"lastMigration"`
+}
+
+// Serializes the reloading
+var reloadLock = new(sync.Mutex)
+
+// Protected by "nodesLock"
+var (
+	drainingWorkers = make(map[*nodeWorker]bool)
+	lastMigration   *ClusterMigration
+)
+
+// Reloads the membership of judge/graph cluster from configuration file
+func ReloadClusterFromFile(configFile string) (*ClusterMigration, error) {
+	newConfig, err := g.LoadConfig(configFile)
+	if err == nil {
+		var migration *ClusterMigration
+		if migration, err = ReloadCluster(newConfig.Judge, newConfig.Graph); err == nil {
+			return migration, nil
+		}
+	}
+
+	log.Errorf("Reloading cluster from %s has error: %v", configFile, err)
+	return nil, err
+}
+
+// Applies the membership of judge/graph cluster at runtime:
+//
+// 1. Builds and starts workers(queue, spill queue, and send goroutines) for added nodes
+// 2. Swaps the rings, queues, and configuration of cluster atomically
+// 3. Drains and stops the workers of removed nodes(in background)
+//
+// Only "cluster", "replicas", and "drainTimeout" are applied, other properties need restarting.
+func ReloadCluster(newJudge *g.JudgeConfig, newGraph *g.GraphConfig) (*ClusterMigration, error) {
+	if newJudge == nil || newGraph == nil {
+		return nil, fmt.Errorf("configuration of judge and graph must be present")
+	}
+
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	oldConfig := g.Config()
+
+	judgeConfig := *oldConfig.Judge
+	judgeConfig.Replicas = newJudge.Replicas
+	judgeConfig.Cluster = newJudge.Cluster
+	judgeConfig.ClusterList = newJudge.ClusterList
+	judgeConfig.DrainTimeout = newJudge.DrainTimeout
+
+	graphConfig := *oldConfig.Graph
+	graphConfig.Replicas = newGraph.Replicas
+	graphConfig.Cluster = newGraph.Cluster
+	graphConfig.ClusterList = newGraph.ClusterList
+	graphConfig.DrainTimeout = newGraph.DrainTimeout
+
+	migration := &ClusterMigration{
+		Time:  time.Now(),
+		Judge: &NodesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}},
+		Graph: &NodesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}},
+	}
+
+	/**
+	 * Diffs the nodes and builds workers of added nodes,
+	 * the workers are only modified by reloading(which is serialized)
+	 */
+	addedWorkers := make([]*nodeWorker, 0)
+	addWorker := func(backend string, node string, addr string) (*nodeWorker, error) {
+		worker, err := buildWorkerOfAddedNode(backend, node, addr)
+		if err != nil {
+			closeSpillQueues(addedWorkers)
+			return nil, err
+		}
+
+		addedWorkers = append(addedWorkers, worker)
+		return worker, nil
+	}
+
+	newJudgeWorkers := make(map[string]*nodeWorker)
+	changedAddrs := make(map[*nodeWorker]string)
+	for node, addr := range judgeConfig.Cluster {
+		if worker, ok := judgeWorkers[node]; ok {
+			newJudgeWorkers[node] = worker
+			if worker.addr != addr {
+				changedAddrs[worker] = addr
+				migration.Judge.Changed = append(migration.Judge.Changed, node)
+			}
+			continue
+		}
+
+		worker, err := addWorker(backendJudge, node, addr)
+		if err != nil {
+			return nil, err
+		}
+		newJudgeWorkers[node] = worker
+		migration.Judge.Added = append(migration.Judge.Added, node)
+	}
+
+	newGraphWorkers := make(map[string]*nodeWorker)
+	for node, nitem := range graphConfig.ClusterList {
+		for _, addr := range nitem.Addrs {
+			if worker, ok := graphWorkers[node+addr]; ok {
+				newGraphWorkers[node+addr] = worker
+				continue
+			}
+
+			worker, err := addWorker(backendGraph, node, addr)
+			if err != nil {
+				return nil, err
+			}
+			newGraphWorkers[node+addr] = worker
+			migration.Graph.Added = append(migration.Graph.Added, node+":"+addr)
+		}
+	}
+
+	removedWorkers := make([]*nodeWorker, 0)
+	for node, worker := range judgeWorkers {
+		if _, ok := newJudgeWorkers[node]; !ok {
+			removedWorkers = append(removedWorkers, worker)
+			migration.Judge.Removed = append(migration.Judge.Removed, node)
+		}
+	}
+	for key, worker := range graphWorkers {
+		if _, ok := newGraphWorkers[key]; !ok {
+			removedWorkers = append(removedWorkers, worker)
+			migration.Graph.Removed = append(migration.Graph.Removed, worker.node+":"+worker.addr)
+		}
+	}
+
+	for _, diff := range []*NodesDiff{migration.Judge, migration.Graph} {
+		sort.Strings(diff.Added)
+		sort.Strings(diff.Removed)
+		sort.Strings(diff.Changed)
+	}
+	// :~)
+
+	for _, worker := range addedWorkers {
+		switch worker.backend {
+		case backendJudge:
+			JudgeConnPools.Add(worker.addr)
+		case backendGraph:
+			GraphConnPools.Add(worker.addr)
+		}
+	}
+	for _, addr := range changedAddrs {
+		JudgeConnPools.Add(addr)
+	}
+
+	newJudgeRing := newConsistentHashNodesRing(judgeConfig.Replicas, KeysOfMap(judgeConfig.Cluster))
+	newGraphRing := newConsistentHashNodesRing(graphConfig.Replicas, KeysOfMap(graphConfig.Cluster))
+
+	newGlobalConfig := *oldConfig
+	newGlobalConfig.Judge = &judgeConfig
+	newGlobalConfig.Graph = &graphConfig
+
+	/**
+	 * Swaps the rings, queues, and configuration atomically
+	 */
+	nodesLock.Lock()
+
+	judgeWorkers = newJudgeWorkers
+	graphWorkers = newGraphWorkers
+	JudgeQueues = buildQueuesOfWorkers(newJudgeWorkers)
+	GraphQueues = buildQueuesOfWorkers(newGraphWorkers)
+	for worker, addr := range changedAddrs {
+		worker.addr = addr
+	}
+
+	JudgeNodeRing = newJudgeRing
+	GraphNodeRing = newGraphRing
+
+	g.ReplaceConfig(&newGlobalConfig)
+
+	for _, worker := range removedWorkers {
+		worker.retireTime = migration.Time
+		drainingWorkers[worker] = true
+	}
+	lastMigration = migration
+
+	nodesLock.Unlock()
+	// :~)
+
+	for _, worker := range addedWorkers {
+		worker.start()
+	}
+	for _, worker := range removedWorkers {
+		timeout := drainTimeout(judgeConfig.DrainTimeout)
+		if worker.backend == backendGraph {
+			timeout = drainTimeout(graphConfig.DrainTimeout)
+		}
+
+		go retireWorker(worker, timeout)
+	}
+	if len(changedAddrs) > 0 {
+		// Waits for in-flight sending on old addresses
+		go func(delay time.Duration) {
+			time.Sleep(delay)
+			releaseUnusedConnPools()
+		}(time.Duration(judgeConfig.CallTimeout*3)*time.Millisecond + time.Second)
+	}
+
+	log.Infof(
+		"Cluster is reloaded. Judge: +%v -%v ~%v. Graph: +%v -%v",
+		migration.Judge.Added, migration.Judge.Removed, migration.Judge.Changed,
+		migration.Graph.Added, migration.Graph.Removed,
+	)
+
+	return migration, nil
+}
+
+// Gets the current membership of cluster and the draining nodes
+func GetClusterStatus() *ClusterStatus {
+	nodesLock.RLock()
+	defer nodesLock.RUnlock()
+
+	status := &ClusterStatus{
+		Judge:         make(map[string]string),
+		Graph:         make(map[string][]string),
+		Draining:      make([]*DrainingNode, 0),
+		LastMigration: lastMigration,
+	}
+
+	for node, worker := range judgeWorkers {
+		status.Judge[node] = worker.addr
+	}
+	for _, worker := range graphWorkers {
+		status.Graph[worker.node] = append(status.Graph[worker.node], worker.addr)
+	}
+	for _, addrs := range status.Graph {
+		sort.Strings(addrs)
+	}
+
+	for worker := range drainingWorkers {
+		drainingNode := &DrainingNode{
+			Backend:  worker.backend,
+			Node:     worker.node,
+			Addr:     worker.addr,
+			Since:    worker.retireTime,
+			QueueLen: worker.queue.Len(),
+		}
+		if worker.spill != nil {
+			drainingNode.SpillLen = worker.spill.Len()
+		}
+
+		status.Draining = append(status.Draining, drainingNode)
+	}
+	sort.Slice(status.Draining, func(i, j int) bool {
+		left, right := status.Draining[i], status.Draining[j]
+		if left.Backend != right.Backend {
+			return left.Backend < right.Backend
+		}
+		return left.Node+left.Addr < right.Node+right.Addr
+	})
+
+	return status
+}
+
+// The spill queue of a re-added node may be still used by the draining worker,
+// so the node cannot be added until the draining is finished.
+func buildWorkerOfAddedNode(backend string, node string, addr string) (*nodeWorker, error) {
+	key := node
+	if backend == backendGraph {
+		key = node + addr
+	}
+
+	nodesLock.RLock()
+	for draining := range drainingWorkers {
+		if draining.backend == backend && draining.key() == key {
+			nodesLock.RUnlock()
+			return nil, fmt.Errorf("%s[%s] is still draining, please try again later", backend, key)
+		}
+	}
+	nodesLock.RUnlock()
+
+	return newNodeWorker(backend, node, addr)
+}
+
+func closeSpillQueues(workers []*nodeWorker) {
+	for _, worker := range workers {
+		if worker.spill != nil {
+			worker.spill.Close()
+		}
+	}
+}
+
+func retireWorker(worker *nodeWorker, timeout time.Duration) {
+	log.Infof("[%s] Draining %s:%s(timeout: %v)", worker.backend, worker.node, worker.addr, timeout)
+
+	worker.retire(timeout)
+
+	nodesLock.Lock()
+	delete(drainingWorkers, worker)
+	nodesLock.Unlock()
+
+	releaseUnusedConnPools()
+
+	log.Infof("[%s] %s:%s is stopped", worker.backend, worker.node, worker.addr)
+}
+
+// Destroys the connection pools whose address is not used by any worker
+func releaseUnusedConnPools() {
+	judgeAddrs := make(map[string]bool)
+	graphAddrs := make(map[string]bool)
+
+	nodesLock.RLock()
+	for _, worker := range judgeWorkers {
+		judgeAddrs[worker.addr] = true
+	}
+	for _, worker := range graphWorkers {
+		graphAddrs[worker.addr] = true
+	}
+	for worker := range drainingWorkers {
+		switch worker.backend {
+		case backendJudge:
+			judgeAddrs[worker.addr] = true
+		case backendGraph:
+			graphAddrs[worker.addr] = true
+		}
+	}
+	judgePools, graphPools := JudgeConnPools, GraphConnPools
+	nodesLock.RUnlock()
+
+	removeConnPoolsExcept(judgePools, judgeAddrs)
+	removeConnPoolsExcept(graphPools, graphAddrs)
+}
+
+func removeConnPoolsExcept(pools *cpool.SafeRpcConnPools, usedAddrs map[string]bool) {
+	if pools == nil {
+		return
+	}
+
+	unusedAddrs := make([]string, 0)
+
+	pools.RLock()
+	for addr := range pools.M {
+		if !usedAddrs[addr] {
+			unusedAddrs = append(unusedAddrs, addr)
+		}
+	}
+	pools.RUnlock()
+
+	for _, addr := range unusedAddrs {
+		pools.Remove(addr)
+	}
+}
+
+func buildQueuesOfWorkers(workers map[string]*nodeWorker) map[string]*nlist.SafeListLimited {
+	queues := make(map[string]*nlist.SafeListLimited, len(workers))
+	for key, worker := range workers {
+		queues[key] = worker.queue
+	}
+	return queues
+}
+
+func drainTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		seconds = defaultDrainTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
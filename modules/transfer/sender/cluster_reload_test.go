@@ -0,0 +1,123 @@
+package sender
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	nlist "github.com/toolkits/container/list"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+	cpool "github.com/fwtpe/owl-backend/modules/transfer/sender/conn_pool"
+)
+
+func TestReloadCluster(t *testing.T) {
+	g.SetConfig(&g.GlobalConfig{
+		Judge: &g.JudgeConfig{
+			Enabled: true, Batch: 10, MaxConns: 1, CallTimeout: 100, Replicas: 10,
+			Cluster: map[string]string{"j1": "127.0.0.1:1"},
+		},
+		Graph: &g.GraphConfig{
+			Enabled: true, Batch: 10, MaxConns: 1, CallTimeout: 100, Replicas: 10,
+			Cluster: map[string]string{"g1": "127.0.0.1:2"},
+			ClusterList: map[string]*g.ClusterNode{
+				"g1": {Addrs: []string{"127.0.0.1:2"}},
+			},
+		},
+	})
+	JudgeConnPools = cpool.CreateSafeRpcConnPools(1, 1, 100, 100, []string{"127.0.0.1:1"})
+	GraphConnPools = cpool.CreateSafeRpcConnPools(1, 1, 100, 100, []string{"127.0.0.1:2"})
+	initNodeRings()
+	startNodeWorkers()
+
+	defer func() {
+		for _, workers := range []map[string]*nodeWorker{judgeWorkers, graphWorkers} {
+			for _, worker := range workers {
+				worker.retire(time.Second)
+			}
+		}
+
+		g.SetConfig(nil)
+		SetNodeRings(nil, nil)
+
+		nodesLock.Lock()
+		defer nodesLock.Unlock()
+		JudgeConnPools = nil
+		GraphConnPools = nil
+		JudgeQueues = make(map[string]*nlist.SafeListLimited)
+		GraphQueues = make(map[string]*nlist.SafeListLimited)
+		judgeWorkers = make(map[string]*nodeWorker)
+		graphWorkers = make(map[string]*nodeWorker)
+		lastMigration = nil
+	}()
+
+	migration, err := ReloadCluster(
+		&g.JudgeConfig{
+			Replicas: 10,
+			Cluster:  map[string]string{"j1": "127.0.0.1:3", "j2": "127.0.0.1:4"},
+		},
+		&g.GraphConfig{
+			Replicas: 10, DrainTimeout: 5,
+			Cluster: map[string]string{"g2": "127.0.0.1:5"},
+			ClusterList: map[string]*g.ClusterNode{
+				"g2": {Addrs: []string{"127.0.0.1:5"}},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("ReloadCluster() has error: %v", err)
+	}
+
+	/**
+	 * Asserts the report of migration
+	 */
+	expectedJudge := &NodesDiff{Added: []string{"j2"}, Removed: []string{}, Changed: []string{"j1"}}
+	if !reflect.DeepEqual(migration.Judge, expectedJudge) {
+		t.Errorf("Unexpected diff of judge: %#v", migration.Judge)
+	}
+	expectedGraph := &NodesDiff{Added: []string{"g2:127.0.0.1:5"}, Removed: []string{"g1:127.0.0.1:2"}, Changed: []string{}}
+	if !reflect.DeepEqual(migration.Graph, expectedGraph) {
+		t.Errorf("Unexpected diff of graph: %#v", migration.Graph)
+	}
+	// :~)
+
+	/**
+	 * Asserts the swapped rings, queues, and configuration
+	 */
+	if len(JudgeQueues) != 2 || JudgeQueues["j1"] == nil || JudgeQueues["j2"] == nil {
+		t.Errorf("Unexpected queues of judge: %v", JudgeQueues)
+	}
+	if len(GraphQueues) != 1 || GraphQueues["g2127.0.0.1:5"] == nil {
+		t.Errorf("Unexpected queues of graph: %v", GraphQueues)
+	}
+	if node, _ := GraphNodeRing.GetNode("pc01/cpu.idle"); node != "g2" {
+		t.Errorf("Graph ring should have only \"g2\". Got: %s", node)
+	}
+	if addr := judgeWorkers["j1"].getAddr(); addr != "127.0.0.1:3" {
+		t.Errorf("Address of \"j1\" should be changed. Got: %s", addr)
+	}
+	if g.Config().Judge.Batch != 10 || g.Config().Judge.Cluster["j2"] != "127.0.0.1:4" {
+		t.Errorf("Unexpected configuration of judge: %#v", g.Config().Judge)
+	}
+	if _, ok := JudgeConnPools.Get("127.0.0.1:4"); !ok {
+		t.Errorf("Connection pool of added judge should be created")
+	}
+	// :~)
+
+	/**
+	 * The removed graph should be stopped after its queue is drained
+	 */
+	for i := 0; i < 50; i++ {
+		if len(GetClusterStatus().Draining) == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if draining := GetClusterStatus().Draining; len(draining) != 0 {
+		t.Fatalf("Removed node should be stopped. Draining: %v", draining)
+	}
+	if _, ok := GraphConnPools.Get("127.0.0.1:2"); ok {
+		t.Errorf("Connection pool of removed graph should be destroyed")
+	}
+	// :~)
+}
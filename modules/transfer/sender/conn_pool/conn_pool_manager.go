@@ -60,7 +60,34 @@ func CreateSafeRpcConnPools(maxConns, maxIdle, connTimeout, callTimeout int, clu
 	return cp
 }
 
+// Adds the connection pool of the address if it is absent
+func (this *SafeRpcConnPools) Add(address string) {
+	this.Lock()
+	defer this.Unlock()
+
+	if _, exist := this.M[address]; exist {
+		return
+	}
+
+	ct := time.Duration(this.ConnTimeout) * time.Millisecond
+	this.M[address] = createOnePool(address, address, ct, this.MaxConns, this.MaxIdle)
+}
+
+// Removes and destroys the connection pool of the address
+func (this *SafeRpcConnPools) Remove(address string) {
+	this.Lock()
+	defer this.Unlock()
+
+	if p, exist := this.M[address]; exist {
+		p.Destroy()
+		delete(this.M, address)
+	}
+}
+
 func (this *SafeRpcConnPools) Proc() []string {
+	this.RLock()
+	defer this.RUnlock()
+
 	procs := []string{}
 	for _, cp := range this.M {
 		procs = append(procs, cp.Proc())
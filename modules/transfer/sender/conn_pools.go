@@ -3,9 +3,11 @@ package sender
 import (
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/fwtpe/owl-backend/modules/transfer/g"
 	cpool "github.com/fwtpe/owl-backend/modules/transfer/sender/conn_pool"
+	"github.com/fwtpe/owl-backend/modules/transfer/sender/kafka"
 	nset "github.com/toolkits/container/set"
 )
 
@@ -119,6 +121,23 @@ func initConnPools() {
 	GraphConnPools = cpool.CreateSafeRpcConnPools(cfg.Graph.MaxConns, cfg.Graph.MaxIdle,
 		cfg.Graph.ConnTimeout, cfg.Graph.CallTimeout, graphInstances.ToSlice())
 
+	// kafka
+	if cfg.Kafka != nil && cfg.Kafka.Enabled {
+		var err error
+		KafkaProducer, err = kafka.NewProducer(kafka.Config{
+			Brokers:      cfg.Kafka.Brokers,
+			Topic:        cfg.Kafka.Topic,
+			ClientId:     cfg.Kafka.ClientId,
+			RequiredAcks: int16(cfg.Kafka.RequiredAcks),
+			ConnTimeout:  time.Duration(cfg.Kafka.ConnTimeout) * time.Millisecond,
+			CallTimeout:  time.Duration(cfg.Kafka.CallTimeout) * time.Millisecond,
+		})
+		// The metrics would be routed to the queue of kafka without consumer, so it is fatal
+		if err != nil {
+			log.Fatalf("Cannot create producer of kafka: %v", err)
+		}
+	}
+
 	influxdbInstances := make([]cpool.InfluxdbConnection, 1)
 	dsn, err := parseDSN(cfg.Influxdb.Address)
 	if err != nil {
@@ -136,4 +155,7 @@ func DestroyConnPools() {
 	TsdbConnPoolHelper.Destroy()
 	InfluxdbConnPools.Destroy()
 	StagingConnPoolHelper.Destroy()
+	if KafkaProducer != nil {
+		KafkaProducer.Close()
+	}
 }
@@ -0,0 +1,244 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// In-process broker, which serves Metadata(v1) and Produce(v3) of single topic
+// and is the leader of all partitions.
+type fakeBroker struct {
+	topic      string
+	partitions int32
+
+	listener net.Listener
+	host     string
+	port     int32
+
+	lock          *sync.Mutex
+	records       map[int32][]*Message
+	produceError  KError
+	metadataCalls int
+	produceCalls  int
+}
+
+func newFakeBroker(topic string, partitions int32) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	broker := &fakeBroker{
+		topic:      topic,
+		partitions: partitions,
+		listener:   listener,
+		host:       host,
+		port:       int32(portNumber),
+		lock:       &sync.Mutex{},
+		records:    make(map[int32][]*Message),
+	}
+	go broker.serve()
+
+	return broker
+}
+
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+func (b *fakeBroker) close() {
+	b.listener.Close()
+}
+func (b *fakeBroker) setProduceError(errorCode KError) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.produceError = errorCode
+}
+func (b *fakeBroker) getRecords(partition int32) []*Message {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.records[partition]
+}
+func (b *fakeBroker) getMetadataCalls() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.metadataCalls
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var sizeBytes [4]byte
+		if _, err := io.ReadFull(conn, sizeBytes[:]); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(sizeBytes[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+
+		d := &decoder{buf: request}
+		apiKey := d.getInt16()
+		apiVersion := d.getInt16()
+		correlationId := d.getInt32()
+		d.getString() // client_id
+
+		var respBody []byte
+		switch {
+		case apiKey == apiKeyMetadata && apiVersion == apiVersionMetadata:
+			respBody = b.handleMetadata()
+		case apiKey == apiKeyProduce && apiVersion == apiVersionProduce:
+			var err error
+			if respBody, err = b.handleProduce(d); err != nil {
+				return
+			}
+		default:
+			return
+		}
+
+		if respBody == nil {
+			continue
+		}
+
+		e := &encoder{}
+		e.putInt32(int32(4 + len(respBody)))
+		e.putInt32(correlationId)
+		e.buf = append(e.buf, respBody...)
+		if _, err := conn.Write(e.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) handleMetadata() []byte {
+	b.lock.Lock()
+	b.metadataCalls++
+	b.lock.Unlock()
+
+	e := &encoder{}
+	e.putArrayLength(1)
+	e.putInt32(1) // node_id
+	e.putString(b.host)
+	e.putInt32(b.port)
+	e.putNullableString("") // rack
+	e.putInt32(1)           // controller_id
+
+	e.putArrayLength(1)
+	e.putInt16(0)
+	e.putString(b.topic)
+	e.putInt8(0)
+	e.putArrayLength(int(b.partitions))
+	for i := int32(0); i < b.partitions; i++ {
+		e.putInt16(0)
+		e.putInt32(i)
+		e.putInt32(1) // leader
+		e.putArrayLength(1)
+		e.putInt32(1)
+		e.putArrayLength(1)
+		e.putInt32(1)
+	}
+
+	return e.buf
+}
+
+// Returns nil response if acks is 0
+func (b *fakeBroker) handleProduce(d *decoder) ([]byte, error) {
+	d.getString() // transactional_id
+	acks := d.getInt16()
+	d.getInt32() // timeout
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.produceCalls++
+
+	e := &encoder{}
+	topicCount := d.getArrayLength()
+	e.putArrayLength(topicCount)
+	for i := 0; i < topicCount; i++ {
+		e.putString(d.getString())
+
+		partitionCount := d.getArrayLength()
+		e.putArrayLength(partitionCount)
+		for j := 0; j < partitionCount; j++ {
+			partition := d.getInt32()
+			messages, err := decodeRecordBatch(d.getBytes())
+			if err != nil {
+				return nil, err
+			}
+			if b.produceError == 0 {
+				b.records[partition] = append(b.records[partition], messages...)
+			}
+
+			e.putInt32(partition)
+			e.putInt16(int16(b.produceError))
+			e.putInt64(int64(len(b.records[partition])))
+			e.putInt64(-1)
+		}
+	}
+	e.putInt32(0) // throttle_time_ms
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if acks == 0 {
+		return nil, nil
+	}
+	return e.buf, nil
+}
+
+func decodeRecordBatch(batch []byte) ([]*Message, error) {
+	d := &decoder{buf: batch}
+	d.getInt64() // base_offset
+	if batchLength := d.getInt32(); int(batchLength) != len(batch)-12 {
+		return nil, fmt.Errorf("unexpected batch length: %d", batchLength)
+	}
+	d.getInt32() // partition_leader_epoch
+	if magic := d.getInt8(); magic != recordBatchMagic {
+		return nil, fmt.Errorf("unexpected magic: %d", magic)
+	}
+	if crc := uint32(d.getInt32()); crc != crc32.Checksum(batch[21:], crc32cTable) {
+		return nil, fmt.Errorf("mismatched CRC")
+	}
+	d.getInt16() // attributes
+	d.getInt32() // last_offset_delta
+	d.getInt64() // first_timestamp
+	d.getInt64() // max_timestamp
+	d.getInt64() // producer_id
+	d.getInt16() // producer_epoch
+	d.getInt32() // base_sequence
+
+	count := d.getArrayLength()
+	messages := make([]*Message, 0, count)
+	for i := 0; i < count; i++ {
+		d.getVarint() // length
+		d.getInt8()   // attributes
+		d.getVarint() // timestamp_delta
+		if offsetDelta := d.getVarint(); offsetDelta != int64(i) {
+			return nil, fmt.Errorf("unexpected offset delta: %d", offsetDelta)
+		}
+		key := d.getVarBytes()
+		value := d.getVarBytes()
+		d.getVarint() // headers
+
+		messages = append(messages, &Message{Key: key, Value: value})
+	}
+
+	return messages, d.err
+}
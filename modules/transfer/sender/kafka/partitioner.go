@@ -0,0 +1,51 @@
+package kafka
+
+// Chooses partition by murmur2 hash of key, which is compatible with
+// the default partitioner of Java client.
+func Partition(key []byte, numPartitions int32) int32 {
+	if numPartitions <= 0 {
+		return 0
+	}
+
+	return int32(murmur2(key)&0x7fffffff) % numPartitions
+}
+
+// The variant of murmur2 used by Java client of Kafka
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length & 3 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return h
+}
@@ -0,0 +1,32 @@
+package kafka
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("murmur2()", func() {
+	DescribeTable("The hash should be the same as Java client",
+		func(key string, expected int32) {
+			Expect(int32(murmur2([]byte(key)))).To(Equal(expected))
+		},
+		Entry("2 bytes", "21", int32(-973932308)),
+		Entry("3 bytes", "abc", int32(479470107)),
+		Entry("6 bytes", "foobar", int32(-790332482)),
+		Entry("24 bytes", "a-little-bit-long-string", int32(-985981536)),
+		Entry("26 bytes", "a-little-bit-longer-string", int32(-1486304829)),
+		Entry("47 bytes", "lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", int32(-58897971)),
+	)
+})
+
+var _ = Describe("Partition()", func() {
+	It("The partition should be stable and in range", func() {
+		for _, key := range []string{"pc01", "pc02", "pc03/cpu.idle", ""} {
+			partition := Partition([]byte(key), 7)
+
+			Expect(partition).To(And(BeNumerically(">=", 0), BeNumerically("<", 7)))
+			Expect(Partition([]byte(key), 7)).To(Equal(partition))
+		}
+	})
+})
@@ -0,0 +1,365 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConnTimeout     = 3 * time.Second
+	defaultCallTimeout     = 10 * time.Second
+	defaultMetadataRefresh = 5 * time.Minute
+
+	// Protects from allocating huge buffer for corrupted size of response
+	maxResponseSize = 64 * 1024 * 1024
+)
+
+type Config struct {
+	// Bootstrap brokers("host:port")
+	Brokers  []string
+	Topic    string
+	ClientId string
+	// -1: all in-sync replicas, 0: no response, 1: leader only
+	RequiredAcks int16
+
+	ConnTimeout time.Duration
+	CallTimeout time.Duration
+	// Interval to refresh the leaders of partitions
+	MetadataRefresh time.Duration
+}
+
+type Message struct {
+	// Used to choose partition, nil key leads to round-robin over partitions
+	Key   []byte
+	Value []byte
+}
+
+// The producer is safe for concurrent use, each broker has single connection
+// and the requests on the same broker are serialized.
+type Producer struct {
+	config Config
+
+	lock          *sync.Mutex
+	correlationId int32
+	// partition id -> address of leader broker, the index is partition id
+	leaders        []string
+	metadataTime   time.Time
+	conns          map[string]*brokerConn
+	roundRobinNext uint32
+}
+
+func NewProducer(config Config) (*Producer, error) {
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka: no broker is configured")
+	}
+	if config.Topic == "" {
+		return nil, fmt.Errorf("kafka: topic is empty")
+	}
+
+	if config.ConnTimeout <= 0 {
+		config.ConnTimeout = defaultConnTimeout
+	}
+	if config.CallTimeout <= 0 {
+		config.CallTimeout = defaultCallTimeout
+	}
+	if config.MetadataRefresh <= 0 {
+		config.MetadataRefresh = defaultMetadataRefresh
+	}
+
+	return &Producer{
+		config: config,
+		lock:   &sync.Mutex{},
+		conns:  make(map[string]*brokerConn),
+	}, nil
+}
+
+// Publishes the messages to the topic, the messages are dispatched to partitions by
+// murmur2 hash of key(the same as default partitioner of Java client).
+//
+// If some of partitions fail, the error is returned and the messages may be
+// published partially(at-least-once semantics on retrying).
+func (p *Producer) Send(messages []*Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	leaders, err := p.getLeaders()
+	if err != nil {
+		return err
+	}
+
+	/**
+	 * Groups the messages by leader and partition
+	 */
+	byLeader := make(map[string]map[int32][]*Message)
+	for _, message := range messages {
+		partition := p.choosePartition(message.Key, int32(len(leaders)))
+
+		leader := leaders[partition]
+		if leader == "" {
+			p.invalidateMetadata()
+			return fmt.Errorf("kafka: no leader for partition %d of topic %s", partition, p.config.Topic)
+		}
+
+		byPartition, ok := byLeader[leader]
+		if !ok {
+			byPartition = make(map[int32][]*Message)
+			byLeader[leader] = byPartition
+		}
+		byPartition[partition] = append(byPartition[partition], message)
+	}
+	// :~)
+
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+
+	var firstErr error
+	for leader, byPartition := range byLeader {
+		recordSets := make(map[int32][]byte, len(byPartition))
+		for partition, partitionMessages := range byPartition {
+			recordSets[partition] = encodeRecordBatch(partitionMessages, timestamp)
+		}
+
+		if err := p.produce(leader, recordSets); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Closes all of the connections to brokers
+func (p *Producer) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, conn := range p.conns {
+		conn.close()
+	}
+	p.conns = make(map[string]*brokerConn)
+}
+
+func (p *Producer) produce(leader string, recordSets map[int32][]byte) error {
+	body := encodeProduceRequest(
+		p.config.RequiredAcks, int32(p.config.CallTimeout/time.Millisecond),
+		p.config.Topic, recordSets,
+	)
+
+	respBody, err := p.call(leader, apiKeyProduce, apiVersionProduce, body, p.config.RequiredAcks != 0)
+	if err != nil {
+		p.invalidateMetadata()
+		return err
+	}
+	if p.config.RequiredAcks == 0 {
+		return nil
+	}
+
+	errorCodes, err := decodeProduceResponse(respBody)
+	if err != nil {
+		return err
+	}
+	for partition := range recordSets {
+		errorCode, ok := errorCodes[partition]
+		if !ok {
+			return fmt.Errorf("kafka: no response for partition %d of topic %s", partition, p.config.Topic)
+		}
+		if errorCode != 0 {
+			if errorCode.isStaleMetadata() {
+				p.invalidateMetadata()
+			}
+			return fmt.Errorf("kafka: produce to partition %d of topic %s has error: %v", partition, p.config.Topic, errorCode)
+		}
+	}
+
+	return nil
+}
+
+func (p *Producer) choosePartition(key []byte, numPartitions int32) int32 {
+	if key == nil {
+		p.lock.Lock()
+		next := p.roundRobinNext
+		p.roundRobinNext++
+		p.lock.Unlock()
+
+		return int32(next % uint32(numPartitions))
+	}
+
+	return Partition(key, numPartitions)
+}
+
+func (p *Producer) getLeaders() ([]string, error) {
+	p.lock.Lock()
+	leaders := p.leaders
+	fresh := time.Since(p.metadataTime) < p.config.MetadataRefresh
+	p.lock.Unlock()
+
+	if leaders != nil && fresh {
+		return leaders, nil
+	}
+
+	return p.refreshMetadata()
+}
+
+func (p *Producer) invalidateMetadata() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.leaders = nil
+}
+
+// Fetches metadata of the topic by trying bootstrap brokers one by one
+func (p *Producer) refreshMetadata() ([]string, error) {
+	body := encodeMetadataRequest([]string{p.config.Topic})
+
+	var lastErr error
+	for _, broker := range p.config.Brokers {
+		respBody, err := p.call(broker, apiKeyMetadata, apiVersionMetadata, body, true)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		leaders, err := p.buildLeaders(respBody)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		p.lock.Lock()
+		p.leaders = leaders
+		p.metadataTime = time.Now()
+		p.lock.Unlock()
+
+		return leaders, nil
+	}
+
+	return nil, fmt.Errorf("kafka: cannot fetch metadata of topic %s: %v", p.config.Topic, lastErr)
+}
+
+func (p *Producer) buildLeaders(respBody []byte) ([]string, error) {
+	resp, err := decodeMetadataResponse(respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	brokerAddrs := make(map[int32]string, len(resp.brokers))
+	for _, broker := range resp.brokers {
+		brokerAddrs[broker.nodeId] = broker.addr
+	}
+
+	for _, topic := range resp.topics {
+		if topic.name != p.config.Topic {
+			continue
+		}
+		if topic.errorCode != 0 {
+			return nil, topic.errorCode
+		}
+		if len(topic.partitions) == 0 {
+			return nil, fmt.Errorf("kafka: topic %s has no partition", p.config.Topic)
+		}
+
+		leaders := make([]string, len(topic.partitions))
+		for _, partition := range topic.partitions {
+			if partition.partition < 0 || int(partition.partition) >= len(leaders) {
+				return nil, fmt.Errorf("kafka: unexpected partition %d of topic %s", partition.partition, p.config.Topic)
+			}
+			if partition.leader >= 0 {
+				leaders[partition.partition] = brokerAddrs[partition.leader]
+			}
+		}
+
+		return leaders, nil
+	}
+
+	return nil, fmt.Errorf("kafka: topic %s is absent from metadata", p.config.Topic)
+}
+
+// Sends the request and reads response body(without correlation id)
+func (p *Producer) call(addr string, apiKey int16, apiVersion int16, body []byte, expectResponse bool) ([]byte, error) {
+	p.lock.Lock()
+	p.correlationId++
+	correlationId := p.correlationId
+	conn, ok := p.conns[addr]
+	if !ok {
+		conn = &brokerConn{addr: addr, lock: &sync.Mutex{}}
+		p.conns[addr] = conn
+	}
+	p.lock.Unlock()
+
+	request := encodeRequest(apiKey, apiVersion, correlationId, p.config.ClientId, body)
+	return conn.roundTrip(request, correlationId, expectResponse, p.config.ConnTimeout, p.config.CallTimeout)
+}
+
+type brokerConn struct {
+	addr string
+	lock *sync.Mutex
+	conn net.Conn
+}
+
+func (c *brokerConn) roundTrip(
+	request []byte, correlationId int32, expectResponse bool,
+	connTimeout time.Duration, callTimeout time.Duration,
+) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.addr, connTimeout)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	resp, err := c.doRoundTrip(request, correlationId, expectResponse, callTimeout)
+	if err != nil {
+		// The stream is out of sync, makes a new connection for next request
+		c.conn.Close()
+		c.conn = nil
+		return nil, fmt.Errorf("kafka: call broker %s has error: %v", c.addr, err)
+	}
+
+	return resp, nil
+}
+func (c *brokerConn) doRoundTrip(request []byte, correlationId int32, expectResponse bool, callTimeout time.Duration) ([]byte, error) {
+	c.conn.SetDeadline(time.Now().Add(callTimeout))
+
+	if _, err := c.conn.Write(request); err != nil {
+		return nil, err
+	}
+	if !expectResponse {
+		return nil, nil
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := int32(binary.BigEndian.Uint32(header[0:4]))
+	if size < 4 || size > maxResponseSize {
+		return nil, fmt.Errorf("invalid size of response: %d", size)
+	}
+	if respCorrelationId := int32(binary.BigEndian.Uint32(header[4:8])); respCorrelationId != correlationId {
+		return nil, fmt.Errorf("correlation id mismatched. Expected: %d. Got: %d", correlationId, respCorrelationId)
+	}
+
+	body := make([]byte, size-4)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+func (c *brokerConn) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Producer", func() {
+	const topic = "owl-metrics"
+
+	var (
+		broker         *fakeBroker
+		testedProducer *Producer
+	)
+
+	newProducer := func(brokers []string, acks int16) {
+		var err error
+		testedProducer, err = NewProducer(Config{
+			Brokers:      brokers,
+			Topic:        topic,
+			ClientId:     "owl-transfer",
+			RequiredAcks: acks,
+			ConnTimeout:  time.Second,
+			CallTimeout:  2 * time.Second,
+		})
+		Expect(err).To(Succeed())
+	}
+	buildMessages := func(keys ...string) []*Message {
+		messages := make([]*Message, 0, len(keys))
+		for i, key := range keys {
+			messages = append(messages, &Message{
+				Key:   []byte(key),
+				Value: []byte(fmt.Sprintf("%s-%d", key, i)),
+			})
+		}
+		return messages
+	}
+
+	BeforeEach(func() {
+		broker = newFakeBroker(topic, 3)
+	})
+	AfterEach(func() {
+		if testedProducer != nil {
+			testedProducer.Close()
+			testedProducer = nil
+		}
+		broker.close()
+	})
+
+	Context("Publishes messages with keys", func() {
+		It("Messages should be partitioned by hash of key and keep the order", func() {
+			newProducer([]string{broker.addr()}, 1)
+
+			keys := []string{"pc01", "pc02", "pc03", "pc01", "pc04", "pc02", "pc01"}
+			Expect(testedProducer.Send(buildMessages(keys...))).To(Succeed())
+
+			total := 0
+			for partition := int32(0); partition < 3; partition++ {
+				lastIndex := -1
+				for _, message := range broker.getRecords(partition) {
+					Expect(Partition(message.Key, 3)).To(Equal(partition))
+
+					var index int
+					fmt.Sscanf(string(message.Value[len(message.Key)+1:]), "%d", &index)
+					Expect(index).To(BeNumerically(">", lastIndex))
+					lastIndex = index
+
+					total++
+				}
+			}
+			Expect(total).To(Equal(len(keys)))
+		})
+	})
+
+	Context("Publishes messages without key", func() {
+		It("Messages should be distributed to every partition", func() {
+			newProducer([]string{broker.addr()}, 1)
+
+			messages := make([]*Message, 0)
+			for i := 0; i < 6; i++ {
+				messages = append(messages, &Message{Value: []byte("v")})
+			}
+			Expect(testedProducer.Send(messages)).To(Succeed())
+
+			for partition := int32(0); partition < 3; partition++ {
+				Expect(broker.getRecords(partition)).To(HaveLen(2))
+			}
+		})
+	})
+
+	Context("No acknowledgement is required", func() {
+		It("Messages should be published", func() {
+			newProducer([]string{broker.addr()}, 0)
+
+			Expect(testedProducer.Send(buildMessages("pc01"))).To(Succeed())
+
+			partition := Partition([]byte("pc01"), 3)
+			Eventually(func() int {
+				return len(broker.getRecords(partition))
+			}).Should(Equal(1))
+		})
+	})
+
+	Context("Broker responds error of stale leader", func() {
+		It("The error should be returned and metadata should be fetched again", func() {
+			newProducer([]string{broker.addr()}, 1)
+
+			broker.setProduceError(6)
+			err := testedProducer.Send(buildMessages("pc01"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("NOT_LEADER_FOR_PARTITION"))
+			Expect(broker.getMetadataCalls()).To(Equal(1))
+
+			broker.setProduceError(0)
+			Expect(testedProducer.Send(buildMessages("pc01"))).To(Succeed())
+			Expect(broker.getMetadataCalls()).To(Equal(2))
+		})
+	})
+
+	Context("The first bootstrap broker is unreachable", func() {
+		It("Metadata should be fetched from next broker", func() {
+			deadBroker := newFakeBroker(topic, 1)
+			deadBroker.close()
+
+			newProducer([]string{deadBroker.addr(), broker.addr()}, 1)
+
+			Expect(testedProducer.Send(buildMessages("pc01"))).To(Succeed())
+		})
+	})
+
+	Context("All of the brokers are unreachable", func() {
+		It("The error should be returned", func() {
+			broker.close()
+			newProducer([]string{broker.addr()}, 1)
+
+			Expect(testedProducer.Send(buildMessages("pc01"))).NotTo(Succeed())
+		})
+	})
+})
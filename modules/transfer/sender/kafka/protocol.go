@@ -0,0 +1,397 @@
+// Provides minimal producer of Kafka protocol, which supports only:
+//
+//	Metadata(v1) - to discover the leaders of partitions of a topic
+//	Produce(v3)  - to publish records by "RecordBatch"(magic 2), without compression
+//
+// See https://kafka.apache.org/protocol for detail of the protocol.
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	apiKeyProduce  int16 = 0
+	apiKeyMetadata int16 = 3
+
+	apiVersionProduce  int16 = 3
+	apiVersionMetadata int16 = 1
+
+	recordBatchMagic int8 = 2
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errMalformed = errors.New("kafka: malformed response")
+
+// Error code responded by broker
+type KError int16
+
+var kErrorNames = map[KError]string{
+	-1: "UNKNOWN_SERVER_ERROR",
+	1:  "OFFSET_OUT_OF_RANGE",
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_FOR_PARTITION",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+}
+
+func (e KError) Error() string {
+	if name, ok := kErrorNames[e]; ok {
+		return fmt.Sprintf("kafka: %s(%d)", name, int16(e))
+	}
+
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+// Whether or not the error could be recovered by refreshing metadata
+func (e KError) isStaleMetadata() bool {
+	switch e {
+	case 3, 5, 6:
+		return true
+	}
+
+	return false
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) putInt8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+func (e *encoder) putInt16(v int16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+func (e *encoder) putInt32(v int32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+func (e *encoder) putInt64(v int64) {
+	e.putInt32(int32(v >> 32))
+	e.putInt32(int32(v))
+}
+func (e *encoder) putString(v string) {
+	e.putInt16(int16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Puts nullable string, empty string is treated as null
+func (e *encoder) putNullableString(v string) {
+	if v == "" {
+		e.putInt16(-1)
+		return
+	}
+	e.putString(v)
+}
+func (e *encoder) putBytes(v []byte) {
+	if v == nil {
+		e.putInt32(-1)
+		return
+	}
+	e.putInt32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+func (e *encoder) putArrayLength(n int) {
+	e.putInt32(int32(n))
+}
+
+// Puts zig-zag encoded variable-length integer, which is used by "RecordBatch"
+func (e *encoder) putVarint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+func (e *encoder) putVarBytes(v []byte) {
+	if v == nil {
+		e.putVarint(-1)
+		return
+	}
+	e.putVarint(int64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Decodes the content sequentially, the first error is kept and
+// following reading gets zero values.
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.off+n > len(d.buf) {
+		d.err = errMalformed
+		return nil
+	}
+
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+func (d *decoder) getInt8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+func (d *decoder) getInt16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+func (d *decoder) getInt32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+func (d *decoder) getInt64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+func (d *decoder) getString() string {
+	n := d.getInt16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+func (d *decoder) getBytes() []byte {
+	n := d.getInt32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// Gets length of array, the negative length(null array) is returned as 0
+func (d *decoder) getArrayLength() int {
+	n := d.getInt32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.buf)-d.off {
+		d.err = errMalformed
+		return 0
+	}
+	return int(n)
+}
+func (d *decoder) getVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.buf[d.off:])
+	if n <= 0 {
+		d.err = errMalformed
+		return 0
+	}
+	d.off += n
+	return v
+}
+func (d *decoder) getVarBytes() []byte {
+	n := d.getVarint()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// Builds a request with header(v1), the leading 4 bytes of size is included.
+func encodeRequest(apiKey int16, apiVersion int16, correlationId int32, clientId string, body []byte) []byte {
+	e := &encoder{buf: make([]byte, 4, 64+len(body))}
+	e.putInt16(apiKey)
+	e.putInt16(apiVersion)
+	e.putInt32(correlationId)
+	e.putNullableString(clientId)
+	e.buf = append(e.buf, body...)
+
+	binary.BigEndian.PutUint32(e.buf[0:4], uint32(len(e.buf)-4))
+	return e.buf
+}
+
+type brokerMeta struct {
+	nodeId int32
+	addr   string
+}
+
+type partitionMeta struct {
+	errorCode KError
+	partition int32
+	leader    int32
+}
+
+type topicMeta struct {
+	errorCode  KError
+	name       string
+	partitions []*partitionMeta
+}
+
+type metadataResponse struct {
+	brokers []*brokerMeta
+	topics  []*topicMeta
+}
+
+func encodeMetadataRequest(topics []string) []byte {
+	e := &encoder{}
+	e.putArrayLength(len(topics))
+	for _, topic := range topics {
+		e.putString(topic)
+	}
+
+	return e.buf
+}
+
+func decodeMetadataResponse(body []byte) (*metadataResponse, error) {
+	d := &decoder{buf: body}
+	resp := &metadataResponse{}
+
+	brokerCount := d.getArrayLength()
+	for i := 0; i < brokerCount && d.err == nil; i++ {
+		nodeId := d.getInt32()
+		host := d.getString()
+		port := d.getInt32()
+		d.getString() // rack
+
+		resp.brokers = append(resp.brokers, &brokerMeta{
+			nodeId: nodeId,
+			addr:   fmt.Sprintf("%s:%d", host, port),
+		})
+	}
+
+	d.getInt32() // controller_id
+
+	topicCount := d.getArrayLength()
+	for i := 0; i < topicCount && d.err == nil; i++ {
+		topic := &topicMeta{
+			errorCode: KError(d.getInt16()),
+			name:      d.getString(),
+		}
+		d.getInt8() // is_internal
+
+		partitionCount := d.getArrayLength()
+		for j := 0; j < partitionCount && d.err == nil; j++ {
+			partition := &partitionMeta{
+				errorCode: KError(d.getInt16()),
+				partition: d.getInt32(),
+				leader:    d.getInt32(),
+			}
+			for k, n := 0, d.getArrayLength(); k < n; k++ { // replicas
+				d.getInt32()
+			}
+			for k, n := 0, d.getArrayLength(); k < n; k++ { // isr
+				d.getInt32()
+			}
+
+			topic.partitions = append(topic.partitions, partition)
+		}
+
+		resp.topics = append(resp.topics, topic)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return resp, nil
+}
+
+// Encodes the messages as a "RecordBatch"(magic 2), the timestamp is in milliseconds.
+func encodeRecordBatch(messages []*Message, timestamp int64) []byte {
+	e := &encoder{}
+	e.putInt64(0)  // base_offset
+	e.putInt32(0)  // batch_length, filled later
+	e.putInt32(-1) // partition_leader_epoch
+	e.putInt8(recordBatchMagic)
+	e.putInt32(0) // crc, filled later
+
+	crcStart := len(e.buf)
+	e.putInt16(0) // attributes: no compression, create time
+	e.putInt32(int32(len(messages) - 1))
+	e.putInt64(timestamp) // first_timestamp
+	e.putInt64(timestamp) // max_timestamp
+	e.putInt64(-1)        // producer_id
+	e.putInt16(-1)        // producer_epoch
+	e.putInt32(-1)        // base_sequence
+	e.putArrayLength(len(messages))
+
+	record := &encoder{}
+	for i, message := range messages {
+		record.buf = record.buf[:0]
+		record.putInt8(0)          // attributes
+		record.putVarint(0)        // timestamp_delta
+		record.putVarint(int64(i)) // offset_delta
+		record.putVarBytes(message.Key)
+		record.putVarBytes(message.Value)
+		record.putVarint(0) // headers
+
+		e.putVarint(int64(len(record.buf)))
+		e.buf = append(e.buf, record.buf...)
+	}
+
+	binary.BigEndian.PutUint32(e.buf[8:12], uint32(len(e.buf)-12))
+	binary.BigEndian.PutUint32(e.buf[17:21], crc32.Checksum(e.buf[crcStart:], crc32cTable))
+
+	return e.buf
+}
+
+// Produce(v3) request on single topic
+func encodeProduceRequest(acks int16, timeoutMs int32, topic string, recordSets map[int32][]byte) []byte {
+	e := &encoder{}
+	e.putNullableString("") // transactional_id
+	e.putInt16(acks)
+	e.putInt32(timeoutMs)
+
+	e.putArrayLength(1)
+	e.putString(topic)
+	e.putArrayLength(len(recordSets))
+	for partition, recordSet := range recordSets {
+		e.putInt32(partition)
+		e.putBytes(recordSet)
+	}
+
+	return e.buf
+}
+
+// Decodes Produce(v3) response as map of partition to error code
+func decodeProduceResponse(body []byte) (map[int32]KError, error) {
+	d := &decoder{buf: body}
+	result := make(map[int32]KError)
+
+	topicCount := d.getArrayLength()
+	for i := 0; i < topicCount && d.err == nil; i++ {
+		d.getString() // topic
+
+		partitionCount := d.getArrayLength()
+		for j := 0; j < partitionCount && d.err == nil; j++ {
+			partition := d.getInt32()
+			result[partition] = KError(d.getInt16())
+			d.getInt64() // base_offset
+			d.getInt64() // log_append_time
+		}
+	}
+
+	d.getInt32() // throttle_time_ms
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package sender
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/modules/transfer/sender/kafka"
+)
+
+const (
+	kafkaEncodingJson     = "json"
+	kafkaEncodingProtobuf = "protobuf"
+
+	kafkaPartitionKeyEndpoint = "endpoint"
+	kafkaPartitionKeyCounter  = "counter"
+)
+
+// Converts the data to message of kafka, the default encoding is "json" and
+// the default partition key is "endpoint".
+func convert2KafkaMessage(d *cmodel.MetaData, encoding string, partitionKey string) (*kafka.Message, error) {
+	message := &kafka.Message{}
+
+	switch partitionKey {
+	case "", kafkaPartitionKeyEndpoint:
+		message.Key = []byte(d.Endpoint)
+	case kafkaPartitionKeyCounter:
+		message.Key = []byte(d.PK())
+	default:
+		return nil, fmt.Errorf("not_supported_partition_key: %s", partitionKey)
+	}
+
+	switch encoding {
+	case "", kafkaEncodingJson:
+		value, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		message.Value = value
+	case kafkaEncodingProtobuf:
+		message.Value = encodeMetaDataByProtobuf(d)
+	default:
+		return nil, fmt.Errorf("not_supported_encoding: %s", encoding)
+	}
+
+	return message, nil
+}
+
+// Encodes the data by protobuf, the schema is:
+//
+//	message MetaData {
+//		string endpoint = 1;
+//		string metric = 2;
+//		int64 timestamp = 3;
+//		int64 step = 4;
+//		double value = 5;
+//		string counterType = 6;
+//		map<string, string> tags = 7;
+//	}
+func encodeMetaDataByProtobuf(d *cmodel.MetaData) []byte {
+	buf := make([]byte, 0, 128)
+
+	buf = appendProtoString(buf, 1, d.Endpoint)
+	buf = appendProtoString(buf, 2, d.Metric)
+	buf = appendProtoVarint(buf, 3, uint64(d.Timestamp))
+	buf = appendProtoVarint(buf, 4, uint64(d.Step))
+
+	buf = appendProtoTag(buf, 5, 1)
+	var fixed [8]byte
+	binary.LittleEndian.PutUint64(fixed[:], math.Float64bits(d.Value))
+	buf = append(buf, fixed[:]...)
+
+	buf = appendProtoString(buf, 6, d.CounterType)
+
+	tagKeys := make([]string, 0, len(d.Tags))
+	for k := range d.Tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		entry := appendProtoString(nil, 1, k)
+		entry = appendProtoString(entry, 2, d.Tags[k])
+
+		buf = appendProtoTag(buf, 7, 2)
+		buf = appendUvarint(buf, uint64(len(entry)))
+		buf = append(buf, entry...)
+	}
+
+	return buf
+}
+
+func appendProtoTag(buf []byte, field int, wireType int) []byte {
+	return appendUvarint(buf, uint64(field<<3|wireType))
+}
+func appendProtoVarint(buf []byte, field int, v uint64) []byte {
+	buf = appendProtoTag(buf, field, 0)
+	return appendUvarint(buf, v)
+}
+func appendProtoString(buf []byte, field int, v string) []byte {
+	buf = appendProtoTag(buf, field, 2)
+	buf = appendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return append(buf, b[:n]...)
+}
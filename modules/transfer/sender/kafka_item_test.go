@@ -0,0 +1,73 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+)
+
+func TestConvert2KafkaMessage(t *testing.T) {
+	item := &cmodel.MetaData{
+		Endpoint:    "h",
+		Metric:      "m",
+		Timestamp:   1,
+		Step:        60,
+		Value:       1.5,
+		CounterType: "GAUGE",
+		Tags:        map[string]string{"a": "b"},
+	}
+
+	/**
+	 * JSON encoding with endpoint as key
+	 */
+	message, err := convert2KafkaMessage(item, "", "")
+	if err != nil {
+		t.Fatalf("convert2KafkaMessage() has error: %v", err)
+	}
+	if string(message.Key) != "h" {
+		t.Errorf("Key should be endpoint. Got: %s", message.Key)
+	}
+
+	decoded := &cmodel.MetaData{}
+	if err := json.Unmarshal(message.Value, decoded); err != nil {
+		t.Fatalf("Cannot unmarshal JSON: %v", err)
+	}
+	if decoded.Metric != "m" || decoded.Value != 1.5 || decoded.Tags["a"] != "b" {
+		t.Errorf("Unexpected JSON: %s", message.Value)
+	}
+	// :~)
+
+	/**
+	 * Protobuf encoding with counter as key
+	 */
+	message, err = convert2KafkaMessage(item, "protobuf", "counter")
+	if err != nil {
+		t.Fatalf("convert2KafkaMessage() has error: %v", err)
+	}
+	if string(message.Key) != item.PK() {
+		t.Errorf("Key should be counter. Got: %s", message.Key)
+	}
+
+	expected := []byte{
+		0x0a, 0x01, 'h',
+		0x12, 0x01, 'm',
+		0x18, 0x01,
+		0x20, 0x3c,
+		0x29, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f,
+		0x32, 0x05, 'G', 'A', 'U', 'G', 'E',
+		0x3a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b',
+	}
+	if !bytes.Equal(message.Value, expected) {
+		t.Errorf("Unexpected protobuf. Expected: %x. Got: %x", expected, message.Value)
+	}
+	// :~)
+
+	if _, err := convert2KafkaMessage(item, "avro", ""); err == nil {
+		t.Errorf("Unsupported encoding should cause error")
+	}
+	if _, err := convert2KafkaMessage(item, "", "metric"); err == nil {
+		t.Errorf("Unsupported partition key should cause error")
+	}
+}
@@ -0,0 +1,215 @@
+package sender
+
+import (
+	"sync"
+	"time"
+
+	nlist "github.com/toolkits/container/list"
+	nproc "github.com/toolkits/proc"
+
+	"github.com/fwtpe/owl-backend/common/spill"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+)
+
+const (
+	backendJudge = "judge"
+	backendGraph = "graph"
+)
+
+// The workers sending data to a judge node or an address of graph node.
+// The key is the same as the one of "JudgeQueues" and "GraphQueues"
+var (
+	judgeWorkers = make(map[string]*nodeWorker)
+	graphWorkers = make(map[string]*nodeWorker)
+)
+
+// Protects the rings, queues, and workers of judge/graph, which are replaced on reloading of cluster.
+var nodesLock = new(sync.RWMutex)
+
+// A worker owns the sending queue(and spill queue) of a backend node,
+// the send goroutines of the worker could be stopped after the queues are drained.
+type nodeWorker struct {
+	backend string
+	node    string
+	// Protected by "nodesLock" since address of judge node could be changed on reloading
+	addr string
+
+	queue *nlist.SafeListLimited
+	spill *spill.Queue
+
+	// Closed to stop the worker after the queues are drained
+	stop chan bool
+	// Closed to stop the worker immediately, the data remained in memory is dropped
+	abort chan bool
+
+	forwardDone chan bool
+	spillDone   chan bool
+
+	// The time of retiring
+	retireTime time.Time
+}
+
+func newNodeWorker(backend string, node string, addr string) (*nodeWorker, error) {
+	worker := &nodeWorker{
+		backend:     backend,
+		node:        node,
+		addr:        addr,
+		queue:       nlist.NewSafeListLimited(DefaultSendQueueMaxSize),
+		stop:        make(chan bool),
+		abort:       make(chan bool),
+		forwardDone: make(chan bool),
+		spillDone:   make(chan bool),
+	}
+
+	if spillConfig := g.Config().Spill; spillConfig != nil && spillConfig.Enabled {
+		spillName := node
+		if backend == backendGraph {
+			spillName = node + addr
+		}
+		spillQueue, err := openSpillQueue(spillConfig, backend, spillName)
+		if err != nil {
+			return nil, err
+		}
+		worker.spill = spillQueue
+	}
+
+	return worker, nil
+}
+
+func (w *nodeWorker) key() string {
+	if w.backend == backendGraph {
+		return w.node + w.addr
+	}
+	return w.node
+}
+
+func (w *nodeWorker) getAddr() string {
+	nodesLock.RLock()
+	defer nodesLock.RUnlock()
+	return w.addr
+}
+
+// Starts the goroutines of sending data and draining spilled data
+func (w *nodeWorker) start() {
+	switch w.backend {
+	case backendJudge:
+		go forward2JudgeTask(w, judgeConcurrent())
+	case backendGraph:
+		go forward2GraphTask(w, graphConcurrent())
+	}
+
+	if w.spill == nil {
+		close(w.spillDone)
+		return
+	}
+
+	switch w.backend {
+	case backendJudge:
+		go drainSpillTask(w, sendSpilledJudgeItems(w), proc.SendToJudgeCnt, proc.SendToJudgeSpillDropCnt)
+	case backendGraph:
+		go drainSpillTask(w, sendSpilledGraphItems(w), proc.SendToGraphCnt, proc.SendToGraphSpillDropCnt)
+	}
+}
+
+// Stops the worker after the queues are drained, or the timeout is reached.
+//
+// After the timeout, the data remained in memory is dropped and the spilled data is kept
+// on disk, which would be sent if the node is added again.
+func (w *nodeWorker) retire(timeout time.Duration) {
+	close(w.stop)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for _, done := range []chan bool{w.forwardDone, w.spillDone} {
+		select {
+		case <-done:
+		case <-timer.C:
+			log.Warnf("[%s] Draining of %s:%s is timeout(%v), gives up the remained data", w.backend, w.node, w.addr, timeout)
+			close(w.abort)
+			<-done
+		}
+	}
+
+	if w.spill != nil {
+		if err := w.spill.Close(); err != nil {
+			log.Warnf("[%s] Closing spill queue of %s:%s has error: %v", w.backend, w.node, w.addr, err)
+		}
+	}
+}
+
+func (w *nodeWorker) isStopped() bool {
+	return isClosed(w.stop)
+}
+func (w *nodeWorker) isAborted() bool {
+	return isClosed(w.abort)
+}
+
+// Drops the data in memory, which is called after the worker is aborted
+func (w *nodeWorker) dropQueue(dropCnt *nproc.SCounterQps) {
+	items := w.queue.PopBackBy(w.queue.Len())
+	if len(items) > 0 {
+		dropCnt.IncrBy(int64(len(items)))
+	}
+}
+
+func isClosed(c chan bool) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func judgeConcurrent() int {
+	concurrent := g.Config().Judge.MaxConns
+	if concurrent < 1 {
+		concurrent = 1
+	}
+	return concurrent
+}
+func graphConcurrent() int {
+	concurrent := g.Config().Graph.MaxConns
+	if concurrent < 1 {
+		concurrent = 1
+	}
+	return concurrent
+}
+
+// Builds workers by current configuration of judge/graph cluster and starts them
+func startNodeWorkers() {
+	cfg := g.Config()
+
+	nodesLock.Lock()
+	defer nodesLock.Unlock()
+
+	for node, addr := range cfg.Judge.Cluster {
+		worker, err := newNodeWorker(backendJudge, node, addr)
+		if err != nil {
+			log.Fatalf("Cannot build worker of judge[%s]: %v", node, err)
+		}
+		judgeWorkers[node] = worker
+		JudgeQueues[node] = worker.queue
+	}
+
+	for node, nitem := range cfg.Graph.ClusterList {
+		for _, addr := range nitem.Addrs {
+			worker, err := newNodeWorker(backendGraph, node, addr)
+			if err != nil {
+				log.Fatalf("Cannot build worker of graph[%s:%s]: %v", node, addr, err)
+			}
+			graphWorkers[node+addr] = worker
+			GraphQueues[node+addr] = worker.queue
+		}
+	}
+
+	for _, worker := range judgeWorkers {
+		worker.start()
+	}
+	for _, worker := range graphWorkers {
+		worker.start()
+	}
+}
@@ -7,17 +7,7 @@ import (
 
 func initSendQueues() {
 	cfg := g.Config()
-	for node := range cfg.Judge.Cluster {
-		Q := nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
-		JudgeQueues[node] = Q
-	}
-
-	for node, nitem := range cfg.Graph.ClusterList {
-		for _, addr := range nitem.Addrs {
-			Q := nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
-			GraphQueues[node+addr] = Q
-		}
-	}
+	// The queues of judge/graph are owned by workers of nodes, see "startNodeWorkers()"
 
 	if cfg.Tsdb.Enabled {
 		TsdbQueue = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
@@ -35,4 +25,8 @@ func initSendQueues() {
 	if cfg.Staging.Enabled {
 		StagingQueue = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
 	}
+
+	if cfg.Kafka != nil && cfg.Kafka.Enabled {
+		KafkaQueue = nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
+	}
 }
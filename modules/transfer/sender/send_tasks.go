@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	nsema "github.com/toolkits/concurrent/semaphore"
@@ -14,19 +15,19 @@ import (
 
 	"github.com/fwtpe/owl-backend/modules/transfer/g"
 	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+	"github.com/fwtpe/owl-backend/modules/transfer/sender/kafka"
 )
 
 // send
 const (
 	DefaultSendTaskSleepInterval = time.Millisecond * 50 //默认睡眠间隔为50ms
+	DefaultKafkaBatch            = 200
 )
 
 // TODO 添加对发送任务的控制,比如stop等
 func startSendTasks() {
 	cfg := g.Config()
 	// init semaphore
-	judgeConcurrent := cfg.Judge.MaxConns
-	graphConcurrent := cfg.Graph.MaxConns
 	tsdbConcurrent := cfg.Tsdb.MaxConns
 	influxdbConcurrent := cfg.Influxdb.MaxIdle
 
@@ -34,30 +35,16 @@ func startSendTasks() {
 		tsdbConcurrent = 1
 	}
 
-	if judgeConcurrent < 1 {
-		judgeConcurrent = 1
-	}
-
-	if graphConcurrent < 1 {
-		graphConcurrent = 1
-	}
 	if influxdbConcurrent < 1 {
 		influxdbConcurrent = 1
 	}
-
-	// init send go-routines
-	for node := range cfg.Judge.Cluster {
-		queue := JudgeQueues[node]
-		go forward2JudgeTask(queue, node, judgeConcurrent)
-	}
-
-	for node, nitem := range cfg.Graph.ClusterList {
-		for _, addr := range nitem.Addrs {
-			queue := GraphQueues[node+addr]
-			go forward2GraphTask(queue, node, addr, graphConcurrent)
-		}
+	kafkaConcurrent := 1
+	if cfg.Kafka != nil && cfg.Kafka.MaxConns > 1 {
+		kafkaConcurrent = cfg.Kafka.MaxConns
 	}
 
+	// init send go-routines
+	// 各个judge/graph节点的发送任务由 nodeWorker 启动, 参考 startNodeWorkers()
 	if cfg.Tsdb.Enabled {
 		go forward2TsdbTask(tsdbConcurrent)
 	}
@@ -73,18 +60,39 @@ func startSendTasks() {
 	if cfg.Staging.Enabled {
 		go forward2StagingTask()
 	}
+
+	if KafkaProducer != nil {
+		go forward2KafkaTask(kafkaConcurrent)
+	}
 }
 
 // Judge定时任务, 将 Judge发送缓存中的数据 通过rpc连接池 发送到Judge
-func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
+//
+// 节点被移除(worker stopped)后, 发送完缓存中的数据才结束
+func forward2JudgeTask(worker *nodeWorker, concurrent int) {
+	defer close(worker.forwardDone)
+
 	batch := g.Config().Judge.Batch // 一次发送,最多batch条数据
-	addr := g.Config().Judge.Cluster[node]
 	sema := nsema.NewSemaphore(concurrent)
+	inFlight := &sync.WaitGroup{}
+	defer inFlight.Wait()
+
+	node := worker.node
+	Q := worker.queue
+	spillQ := worker.spill
 
 	for {
+		if worker.isAborted() {
+			worker.dropQueue(proc.SendToJudgeDropCnt)
+			return
+		}
+
 		items := Q.PopBackBy(batch)
 		count := len(items)
 		if count == 0 {
+			if worker.isStopped() {
+				return
+			}
 			time.Sleep(DefaultSendTaskSleepInterval)
 			continue
 		}
@@ -96,27 +104,31 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 
 		go logTooLateMetric(judgeItems)
 
+		// 磁盘中仍有未发送的数据时, 为保持顺序, 新数据直接写入磁盘
+		if spillQ != nil && spillQ.Len() > 0 {
+			spillItems(spillQ, judgeItems, count, proc.SendToJudgeSpillCnt, proc.SendToJudgeSpillDropCnt)
+			continue
+		}
+
+		addr := worker.getAddr()
+
 		//	同步Call + 有限并发 进行发送
 		sema.Acquire()
+		inFlight.Add(1)
 		go func(addr string, judgeItems []*cmodel.JudgeItem, count int) {
+			defer inFlight.Done()
 			defer sema.Release()
 
-			resp := &cmodel.SimpleRpcResponse{}
-			var err error
-			sendOk := false
-			for i := 0; i < 3; i++ { //最多重试3次
-				err = JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp)
-				if err == nil {
-					sendOk = true
-					break
-				}
-				time.Sleep(time.Millisecond * 10)
-			}
+			err := sendToJudge(addr, judgeItems)
 
 			// statistics
-			if !sendOk {
+			if err != nil {
 				log.Errorf("send judge %s:%s fail: %v", node, addr, err)
 				proc.SendToJudgeFailCnt.IncrBy(int64(count))
+
+				if spillQ != nil {
+					spillItems(spillQ, judgeItems, count, proc.SendToJudgeSpillCnt, proc.SendToJudgeSpillDropCnt)
+				}
 			} else {
 				proc.SendToJudgeCnt.IncrBy(int64(count))
 			}
@@ -124,15 +136,48 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 	}
 }
 
+func sendToJudge(addr string, judgeItems []*cmodel.JudgeItem) error {
+	resp := &cmodel.SimpleRpcResponse{}
+	var err error
+	for i := 0; i < 3; i++ { //最多重试3次
+		err = JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp)
+		if err == nil {
+			return nil
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	return err
+}
+
 // Graph定时任务, 将 Graph发送缓存中的数据 通过rpc连接池 发送到Graph
-func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concurrent int) {
+//
+// 节点被移除(worker stopped)后, 发送完缓存中的数据才结束
+func forward2GraphTask(worker *nodeWorker, concurrent int) {
+	defer close(worker.forwardDone)
+
 	batch := g.Config().Graph.Batch // 一次发送,最多batch条数据
 	sema := nsema.NewSemaphore(concurrent)
+	inFlight := &sync.WaitGroup{}
+	defer inFlight.Wait()
+
+	node := worker.node
+	addr := worker.addr
+	Q := worker.queue
+	spillQ := worker.spill
 
 	for {
+		if worker.isAborted() {
+			worker.dropQueue(proc.SendToGraphDropCnt)
+			return
+		}
+
 		items := Q.PopBackBy(batch)
 		count := len(items)
 		if count == 0 {
+			if worker.isStopped() {
+				return
+			}
 			time.Sleep(DefaultSendTaskSleepInterval)
 			continue
 		}
@@ -142,26 +187,28 @@ func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concur
 			graphItems[i] = items[i].(*cmodel.GraphItem)
 		}
 
+		// 磁盘中仍有未发送的数据时, 为保持顺序, 新数据直接写入磁盘
+		if spillQ != nil && spillQ.Len() > 0 {
+			spillItems(spillQ, graphItems, count, proc.SendToGraphSpillCnt, proc.SendToGraphSpillDropCnt)
+			continue
+		}
+
 		sema.Acquire()
+		inFlight.Add(1)
 		go func(addr string, graphItems []*cmodel.GraphItem, count int) {
+			defer inFlight.Done()
 			defer sema.Release()
 
-			resp := &cmodel.SimpleRpcResponse{}
-			var err error
-			sendOk := false
-			for i := 0; i < 3; i++ { //最多重试3次
-				err = GraphConnPools.Call(addr, "Graph.Send", graphItems, resp)
-				if err == nil {
-					sendOk = true
-					break
-				}
-				time.Sleep(time.Millisecond * 10)
-			}
+			err := sendToGraph(addr, graphItems)
 
 			// statistics
-			if !sendOk {
+			if err != nil {
 				log.Errorf("send to graph %s:%s fail: %v", node, addr, err)
 				proc.SendToGraphFailCnt.IncrBy(int64(count))
+
+				if spillQ != nil {
+					spillItems(spillQ, graphItems, count, proc.SendToGraphSpillCnt, proc.SendToGraphSpillDropCnt)
+				}
 			} else {
 				proc.SendToGraphCnt.IncrBy(int64(count))
 			}
@@ -169,6 +216,20 @@ func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concur
 	}
 }
 
+func sendToGraph(addr string, graphItems []*cmodel.GraphItem) error {
+	resp := &cmodel.SimpleRpcResponse{}
+	var err error
+	for i := 0; i < 3; i++ { //最多重试3次
+		err = GraphConnPools.Call(addr, "Graph.Send", graphItems, resp)
+		if err == nil {
+			return nil
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	return err
+}
+
 // Tsdb定时任务, 将数据通过api发送到tsdb
 func forward2TsdbTask(concurrent int) {
 	batch := g.Config().Tsdb.Batch // 一次发送,最多batch条数据
@@ -357,6 +418,57 @@ func forward2StagingTask() {
 	}
 }
 
+// Kafka定时任务, 将数据发布到kafka的topic
+func forward2KafkaTask(concurrent int) {
+	cfg := g.Config().Kafka
+	batch := cfg.Batch // 一次发送,最多batch条数据
+	if batch < 1 {
+		batch = DefaultKafkaBatch
+	}
+	retry := cfg.MaxRetry
+	if retry < 1 {
+		retry = 1
+	}
+	sema := nsema.NewSemaphore(concurrent)
+
+	for {
+		items := KafkaQueue.PopBackBy(batch)
+		count := len(items)
+		if count == 0 {
+			time.Sleep(DefaultSendTaskSleepInterval)
+			continue
+		}
+
+		messages := make([]*kafka.Message, count)
+		for i := 0; i < count; i++ {
+			messages[i] = items[i].(*kafka.Message)
+		}
+
+		//	同步Call + 有限并发 进行发送
+		sema.Acquire()
+		go func(messages []*kafka.Message, count int) {
+			defer sema.Release()
+
+			var err error
+			for i := 0; i < retry; i++ {
+				err = KafkaProducer.Send(messages)
+				if err == nil {
+					break
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			// statistics
+			if err != nil {
+				log.Errorf("send kafka fail: %v", err)
+				proc.SendToKafkaFailCnt.IncrBy(int64(count))
+			} else {
+				proc.SendToKafkaCnt.IncrBy(int64(count))
+			}
+		}(messages, count)
+	}
+}
+
 const (
 	tooLateSecond = 180
 	tooLateTime   = tooLateSecond * time.Second
@@ -9,6 +9,7 @@ import (
 	"github.com/fwtpe/owl-backend/modules/transfer/g"
 	"github.com/fwtpe/owl-backend/modules/transfer/proc"
 	cpool "github.com/fwtpe/owl-backend/modules/transfer/sender/conn_pool"
+	"github.com/fwtpe/owl-backend/modules/transfer/sender/kafka"
 	nlist "github.com/toolkits/container/list"
 )
 
@@ -39,6 +40,7 @@ var (
 	NqmTcpQueue     *nlist.SafeListLimited
 	NqmTcpconnQueue *nlist.SafeListLimited
 	StagingQueue    *nlist.SafeListLimited
+	KafkaQueue      *nlist.SafeListLimited
 )
 
 // 连接池
@@ -49,6 +51,7 @@ var (
 	GraphConnPools        *cpool.SafeRpcConnPools
 	InfluxdbConnPools     *cpool.InfluxdbConnPools
 	StagingConnPoolHelper *cpool.StagingConnPoolHelper
+	KafkaProducer         *kafka.Producer
 )
 
 // 初始化数据发送服务, 在main函数中调用
@@ -63,6 +66,7 @@ func Start() {
 	initSendQueues()
 	initNodeRings()
 	// SendTasks依赖基础组件的初始化,要最后启动
+	startNodeWorkers()
 	startSendTasks()
 	startSenderCron()
 	log.Info("send.Start, ok")
@@ -70,6 +74,10 @@ func Start() {
 
 // 将数据 打入 某个Judge的发送缓存队列, 具体是哪一个Judge 由一致性哈希 决定
 func Push2JudgeSendQueue(items []*cmodel.MetaData) {
+	// 节点环与发送队列在重新载入集群配置时会被替换
+	nodesLock.RLock()
+	defer nodesLock.RUnlock()
+
 	for _, item := range items {
 		pk := item.PK()
 		node, err := JudgeNodeRing.GetNode(pk)
@@ -106,6 +114,10 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 
 // 将数据 打入 某个Graph的发送缓存队列, 具体是哪一个Graph 由一致性哈希 决定
 func Push2GraphSendQueue(items []*cmodel.MetaData) {
+	// 节点环与发送队列在重新载入集群配置时会被替换
+	nodesLock.RLock()
+	defer nodesLock.RUnlock()
+
 	cfg := g.Config().Graph
 
 	for _, item := range items {
@@ -247,6 +259,23 @@ func Push2StagingSendQueue(items []*cmodel.MetricValue) {
 	}
 }
 
+// 将数据入到kafka发送缓存队列
+func Push2KafkaSendQueue(items []*cmodel.MetaData) {
+	cfg := g.Config().Kafka
+
+	for _, item := range items {
+		message, err := convert2KafkaMessage(item, cfg.Encoding, cfg.PartitionKey)
+		if err != nil {
+			log.Errorf("convert2KafkaMessage() has error: %v", err)
+			continue
+		}
+
+		if !KafkaQueue.PushFront(message) {
+			proc.SendToKafkaDropCnt.Incr()
+		}
+	}
+}
+
 // Push metrics from fping to the queue for RESTful API
 func Push2NqmIcmpSendQueue(pingItems []*cmodel.MetaData) {
 	for _, item := range pingItems {
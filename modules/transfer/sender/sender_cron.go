@@ -33,9 +33,17 @@ func startLogCron() {
 }
 
 func refreshSendingCacheSize() {
+	nodesLock.RLock()
 	proc.JudgeQueuesCnt.SetCnt(calcSendCacheSize(JudgeQueues))
 	proc.GraphQueuesCnt.SetCnt(calcSendCacheSize(GraphQueues))
+	proc.JudgeSpillBytesCnt.SetCnt(calcSpillBytes(judgeWorkers))
+	proc.GraphSpillBytesCnt.SetCnt(calcSpillBytes(graphWorkers))
+	nodesLock.RUnlock()
+
 	proc.InfluxdbQueuesCnt.SetCnt(calcSendCacheSize(InfluxdbQueues))
+	if KafkaQueue != nil {
+		proc.KafkaQueuesCnt.SetCnt(int64(KafkaQueue.Len()))
+	}
 }
 func calcSendCacheSize(mapList map[string]*list.SafeListLimited) int64 {
 	var cnt int64 = 0
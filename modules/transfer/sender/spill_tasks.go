@@ -0,0 +1,183 @@
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	nproc "github.com/toolkits/proc"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/spill"
+
+	"github.com/fwtpe/owl-backend/modules/transfer/g"
+)
+
+const (
+	defaultSpillMaxSizeMB     = 1024
+	defaultSpillSegmentSizeMB = 16
+	defaultSpillRetryInterval = 3000
+)
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func openSpillQueue(spillConfig *g.SpillConfig, backend string, name string) (*spill.Queue, error) {
+	maxSizeMB := spillConfig.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultSpillMaxSizeMB
+	}
+	segmentSizeMB := spillConfig.SegmentSizeMB
+	if segmentSizeMB <= 0 {
+		segmentSizeMB = defaultSpillSegmentSizeMB
+	}
+
+	dir := filepath.Join(spillConfig.Dir, backend, unsafeFileNameChars.ReplaceAllString(name, "_"))
+	queue, err := spill.Open(dir, maxSizeMB<<20, segmentSizeMB<<20)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open spill queue[%s]: %v", dir, err)
+	}
+
+	if queue.Len() > 0 {
+		log.Warnf("Spill queue[%s] has %d batch(es) to be sent", dir, queue.Len())
+	}
+
+	return queue, nil
+}
+
+func spillRetryInterval() time.Duration {
+	retryInterval := time.Duration(g.Config().Spill.RetryInterval) * time.Millisecond
+	if retryInterval <= 0 {
+		retryInterval = defaultSpillRetryInterval * time.Millisecond
+	}
+	return retryInterval
+}
+
+func sendSpilledJudgeItems(worker *nodeWorker) func([]byte) (int, error) {
+	return func(data []byte) (int, error) {
+		judgeItems := make([]*cmodel.JudgeItem, 0)
+		if err := json.Unmarshal(data, &judgeItems); err != nil {
+			return 0, err
+		}
+
+		return len(judgeItems), sendToJudge(worker.getAddr(), judgeItems)
+	}
+}
+func sendSpilledGraphItems(worker *nodeWorker) func([]byte) (int, error) {
+	return func(data []byte) (int, error) {
+		graphItems := make([]*cmodel.GraphItem, 0)
+		if err := json.Unmarshal(data, &graphItems); err != nil {
+			return 0, err
+		}
+
+		return len(graphItems), sendToGraph(worker.addr, graphItems)
+	}
+}
+
+// Keeps sending spilled batches of the worker by order, waits for retry interval if the sending is failed.
+//
+// The task is finished if the worker is aborted, or the worker is stopped and
+// the spilled batches are all sent(after the sending task of worker is finished).
+func drainSpillTask(
+	worker *nodeWorker,
+	send func([]byte) (int, error),
+	sendCnt *nproc.SCounterQps, dropCnt *nproc.SCounterQps,
+) {
+	defer close(worker.spillDone)
+
+	retryInterval := spillRetryInterval()
+	for {
+		sendingDone := isClosed(worker.forwardDone)
+
+		err := drainSpill(worker.spill, send, sendCnt, dropCnt)
+		if err == nil && sendingDone {
+			return
+		}
+
+		sleepInterval := DefaultSendTaskSleepInterval
+		if err != nil {
+			sleepInterval = retryInterval
+		}
+
+		select {
+		case <-worker.abort:
+			return
+		case <-time.After(sleepInterval):
+		}
+	}
+}
+
+// Sends spilled batches until the queue is empty or the sending is failed.
+//
+// A batch which cannot be read or decoded is dropped.
+func drainSpill(
+	queue *spill.Queue,
+	send func([]byte) (int, error),
+	sendCnt *nproc.SCounterQps, dropCnt *nproc.SCounterQps,
+) error {
+	for {
+		data, err := queue.Peek()
+		if err != nil {
+			log.Errorf("Cannot read spilled data, drop it: %v", err)
+			if err = queue.Pop(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if data == nil {
+			return nil
+		}
+
+		count, err := send(data)
+		if err != nil {
+			if count == 0 {
+				log.Errorf("Cannot decode spilled data, drop it: %v", err)
+				dropCnt.Incr()
+				if err = queue.Pop(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			return err
+		}
+
+		if err = queue.Pop(); err != nil {
+			return err
+		}
+		sendCnt.IncrBy(int64(count))
+	}
+}
+
+// Writes the batch of items to disk, the items are dropped if the queue is full.
+func spillItems(
+	queue *spill.Queue, items interface{}, count int,
+	spillCnt *nproc.SCounterQps, dropCnt *nproc.SCounterQps,
+) {
+	data, err := json.Marshal(items)
+	if err == nil {
+		err = queue.Push(data)
+	}
+
+	if err != nil {
+		if err != spill.ErrFull {
+			log.Errorf("Cannot spill data to disk: %v", err)
+		}
+		dropCnt.IncrBy(int64(count))
+		return
+	}
+
+	spillCnt.IncrBy(int64(count))
+}
+
+func calcSpillBytes(workers map[string]*nodeWorker) int64 {
+	var bytes int64 = 0
+	for _, worker := range workers {
+		if worker.spill != nil {
+			bytes += worker.spill.Size()
+		}
+	}
+	return bytes
+}
@@ -0,0 +1,103 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	nproc "github.com/toolkits/proc"
+
+	cmodel "github.com/fwtpe/owl-backend/common/model"
+	"github.com/fwtpe/owl-backend/common/spill"
+)
+
+func TestSpillAndDrain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sender-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := spill.Open(dir, 1<<20, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	spillCnt := nproc.NewSCounterQps("TestSpillCnt")
+	dropCnt := nproc.NewSCounterQps("TestSpillDropCnt")
+	sendCnt := nproc.NewSCounterQps("TestSendCnt")
+
+	spillItems(queue, []*cmodel.GraphItem{{Metric: "m1"}, {Metric: "m2"}}, 2, spillCnt, dropCnt)
+	spillItems(queue, []*cmodel.GraphItem{{Metric: "m3"}}, 1, spillCnt, dropCnt)
+
+	if queue.Len() != 2 || spillCnt.Cnt != 3 {
+		t.Fatalf("Expected 2 batches(3 items) are spilled, got %d batches(%d items)", queue.Len(), spillCnt.Cnt)
+	}
+
+	/**
+	 * The backend is still unreachable
+	 */
+	failedSend := func(data []byte) (int, error) {
+		return 1, errors.New("connection refused")
+	}
+	if err = drainSpill(queue, failedSend, sendCnt, dropCnt); err == nil {
+		t.Fatal("Expected error of sending")
+	}
+	if queue.Len() != 2 {
+		t.Fatalf("Spilled batches should be kept. Got %d", queue.Len())
+	}
+	// :~)
+
+	/**
+	 * The backend is back
+	 */
+	sentMetrics := make([]string, 0)
+	okSend := func(data []byte) (int, error) {
+		graphItems := make([]*cmodel.GraphItem, 0)
+		if err := json.Unmarshal(data, &graphItems); err != nil {
+			return 0, err
+		}
+
+		for _, item := range graphItems {
+			sentMetrics = append(sentMetrics, item.Metric)
+		}
+		return len(graphItems), nil
+	}
+	if err = drainSpill(queue, okSend, sendCnt, dropCnt); err != nil {
+		t.Fatalf("Draining has error: %v", err)
+	}
+
+	if queue.Len() != 0 || sendCnt.Cnt != 3 {
+		t.Fatalf("Expected all of the batches are sent, got %d pending batches, %d sent items", queue.Len(), sendCnt.Cnt)
+	}
+	if len(sentMetrics) != 3 || sentMetrics[0] != "m1" || sentMetrics[2] != "m3" {
+		t.Fatalf("Items are not sent by order: %v", sentMetrics)
+	}
+	// :~)
+}
+
+func TestSpillItemsOnFullQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sender-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := spill.Open(dir, 64, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	spillCnt := nproc.NewSCounterQps("TestSpillCnt")
+	dropCnt := nproc.NewSCounterQps("TestSpillDropCnt")
+
+	spillItems(queue, []*cmodel.JudgeItem{{Metric: "m1", Endpoint: "pc01.it.cepave.com"}, {Metric: "m2"}}, 2, spillCnt, dropCnt)
+
+	if queue.Len() != 0 || dropCnt.Cnt != 2 {
+		t.Fatalf("Expected 2 items are dropped, got %d", dropCnt.Cnt)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	cmodel "github.com/fwtpe/owl-backend/common/model"
+	cutils "github.com/fwtpe/owl-backend/common/utils"
 
 	"github.com/fwtpe/owl-backend/modules/transfer/g"
 	"github.com/fwtpe/owl-backend/modules/transfer/sender"
@@ -52,6 +53,9 @@ func NewRelayFactoryByGlobalConfig(config *g.GlobalConfig) *RelayStationFactory
 	if config.Influxdb.Enabled {
 		genericTargets = append(genericTargets, sender.Push2InfluxdbSendQueue)
 	}
+	if config.Kafka != nil && config.Kafka.Enabled {
+		genericTargets = append(genericTargets, sender.Push2KafkaSendQueue)
+	}
 
 	if len(genericTargets) > 0 {
 		stationBase.Otherwise = append(stationBase.Otherwise, &genericRelayPool{relayTargets: &genericTargets})
@@ -245,8 +249,14 @@ type stageRelayPool struct {
 	metrics []*cmodel.MetricValue
 }
 
+// The rewritten endpoint, metric and tags are relayed, the others are kept as received
 func (p *stageRelayPool) Accept(metric *cmodel.MetaData) bool {
-	p.metrics = append(p.metrics, metric.SourceMetric)
+	stagedMetric := *metric.SourceMetric
+	stagedMetric.Endpoint = metric.Endpoint
+	stagedMetric.Metric = metric.Metric
+	stagedMetric.Tags = cutils.SortedTags(metric.Tags)
+
+	p.metrics = append(p.metrics, &stagedMetric)
 	return true
 }
 func (p *stageRelayPool) RelayToQueue() int {
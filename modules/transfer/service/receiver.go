@@ -9,6 +9,7 @@ import (
 
 	"github.com/fwtpe/owl-backend/modules/transfer/g"
 	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+	"github.com/fwtpe/owl-backend/modules/transfer/rewrite"
 )
 
 // process new metric values
@@ -27,8 +28,13 @@ func RecvMetricValues(sourceMetrics []*cmodel.MetricValue, reply *cmodel.Transfe
 			continue
 		}
 
-		relayStation.Dispatch(refinedValue)
 		validCount++
+
+		if !rewrite.Apply(refinedValue) {
+			continue
+		}
+
+		relayStation.Dispatch(refinedValue)
 	}
 
 	/**
@@ -39,6 +45,14 @@ func RecvMetricValues(sourceMetrics []*cmodel.MetricValue, reply *cmodel.Transfe
 		proc.RpcRecvCnt.IncrBy(validCount)
 	} else if from == "http" {
 		proc.HttpRecvCnt.IncrBy(validCount)
+	} else if from == "socket" {
+		proc.SocketRecvCnt.IncrBy(validCount)
+	} else if from == "prometheus" {
+		proc.PrometheusRecvCnt.IncrBy(validCount)
+	} else if from == "opentsdb" {
+		proc.OpenTsdbRecvCnt.IncrBy(validCount)
+	} else if from == "graphite" {
+		proc.GraphiteRecvCnt.IncrBy(validCount)
 	}
 	// :~)
 
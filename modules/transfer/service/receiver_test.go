@@ -11,6 +11,7 @@ import (
 
 	"github.com/fwtpe/owl-backend/modules/transfer/g"
 	"github.com/fwtpe/owl-backend/modules/transfer/proc"
+	"github.com/fwtpe/owl-backend/modules/transfer/rewrite"
 	"github.com/fwtpe/owl-backend/modules/transfer/sender"
 
 	. "github.com/onsi/ginkgo"
@@ -163,6 +164,38 @@ var _ = Describe("RecvMetricValues()", func() {
 			Expect(sender.StagingQueue.Len()).To(Equal(5))
 			// :~)
 		})
+
+		It("Staging queue should have the rewritten metrics", func() {
+			chain, err := rewrite.NewChain([]*rewrite.RuleConfig{
+				{Name: "s-rename", Action: rewrite.ActionRename, Metric: "^m01$", Rename: "m01.renamed"},
+				{Name: "s-tag", Action: rewrite.ActionAddTag, AddTags: map[string]string{"dc": "tw"}},
+				{Name: "s-drop", Action: rewrite.ActionDrop, Metric: "^m02$"},
+			})
+			Expect(err).To(Succeed())
+			rewrite.SetChain(chain)
+			defer rewrite.SetChain(nil)
+
+			reply := &cmodel.TransferResponse{}
+			Expect(RecvMetricValues(
+				[]*cmodel.MetricValue{
+					{
+						Endpoint: "pc02.it.cepave.com", Metric: "m01", Step: 30, Type: "GAUGE", Tags: "",
+						Value: 12, Timestamp: time.Now().Unix(),
+					},
+					{
+						Endpoint: "pc02.it.cepave.com", Metric: "m02", Step: 30, Type: "GAUGE", Tags: "",
+						Value: 13, Timestamp: time.Now().Unix(),
+					},
+				},
+				reply, "rpc",
+			)).To(Succeed())
+
+			Expect(sender.StagingQueue.Len()).To(Equal(1))
+			staged := sender.StagingQueue.PopBackBy(1)[0].(*cmodel.MetricValue)
+			Expect(staged.Metric).To(Equal("m01.renamed"))
+			Expect(staged.Tags).To(Equal("dc=tw"))
+			Expect(staged.Value).To(BeEquivalentTo(12))
+		})
 	})
 })
 
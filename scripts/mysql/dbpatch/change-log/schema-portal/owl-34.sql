@@ -0,0 +1,2 @@
+ALTER TABLE `strategy`
+    ADD COLUMN `cond` VARCHAR(1024) NOT NULL DEFAULT '' AFTER `right_value`;
@@ -0,0 +1,26 @@
+SET NAMES 'utf8';
+
+CREATE TABLE IF NOT EXISTS alarm_silence(
+	id INT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+	endpoint VARCHAR(255) NOT NULL DEFAULT '',
+	metric VARCHAR(255) NOT NULL DEFAULT '',
+	tags VARCHAR(1024) NOT NULL DEFAULT '',
+	strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+	template_id INT UNSIGNED NOT NULL DEFAULT 0,
+	priority TINYINT NOT NULL DEFAULT -1,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME NOT NULL,
+	creator VARCHAR(64) NOT NULL,
+	comment VARCHAR(1024) NOT NULL DEFAULT '',
+	created DATETIME DEFAULT NOW(),
+	INDEX ix_alarm_silence__end_time
+		(end_time)
+)
+	DEFAULT CHARSET =utf8
+	COLLATE =utf8_general_ci;
+
+ALTER TABLE events
+ADD COLUMN silence_id INT UNSIGNED NOT NULL DEFAULT 0;
+
+ALTER TABLE event_cases
+ADD COLUMN suppressed_count INT UNSIGNED NOT NULL DEFAULT 0;
@@ -0,0 +1,17 @@
+SET NAMES 'utf8';
+
+CREATE TABLE IF NOT EXISTS alarm_escalation(
+	id INT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+	action_id INT UNSIGNED NOT NULL,
+	level INT UNSIGNED NOT NULL,
+	delay INT UNSIGNED NOT NULL,
+	uic VARCHAR(255) NOT NULL DEFAULT '',
+	channels VARCHAR(64) NOT NULL DEFAULT '',
+	url VARCHAR(255) NOT NULL DEFAULT '',
+	creator VARCHAR(64) NOT NULL,
+	created DATETIME DEFAULT NOW(),
+	CONSTRAINT UNIQUE INDEX unq_alarm_escalation__action_id_level
+		(action_id, level)
+)
+	DEFAULT CHARSET =utf8
+	COLLATE =utf8_general_ci;
@@ -0,0 +1,18 @@
+SET NAMES 'utf8';
+
+CREATE TABLE IF NOT EXISTS alarm_webhook_delivery(
+	id VARCHAR(32) PRIMARY KEY,
+	event_caseId VARCHAR(50) NOT NULL,
+	action_id INT UNSIGNED NOT NULL DEFAULT 0,
+	url VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	attempts INT UNSIGNED NOT NULL DEFAULT 0,
+	response_code INT NOT NULL DEFAULT 0,
+	response VARCHAR(1024) NOT NULL DEFAULT '',
+	created DATETIME DEFAULT NOW(),
+	updated DATETIME DEFAULT NOW(),
+	INDEX ix_alarm_webhook_delivery__event_caseId
+		(event_caseId)
+)
+	DEFAULT CHARSET =utf8
+	COLLATE =utf8_general_ci;